@@ -0,0 +1,191 @@
+package auctiondrainer
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/auction/auctiontypes"
+	"code.cloudfoundry.org/auctioneer"
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager"
+	"github.com/tedsuo/ifrit"
+)
+
+const DefaultDrainTimeout = 10 * time.Second
+
+type lrpKey struct {
+	processGuid string
+	index       int
+}
+
+// AuctionDrainer keeps track of the auctions that were scheduled but have not
+// completed yet, so that the auction runner can finish them on shutdown
+// instead of dropping them until BBS convergence submits them again.
+type AuctionDrainer struct {
+	logger  lager.Logger
+	clock   clock.Clock
+	timeout time.Duration
+	fence   auctioneer.Fence
+
+	lock      sync.Mutex
+	tasks     map[string]struct{}
+	lrps      map[lrpKey]struct{}
+	completed chan struct{}
+}
+
+// New returns a drainer that waits up to timeout for pending auctions. When
+// fence is not nil, pending auctions are abandoned right away if the lock has
+// already been lost, as they can no longer be placed.
+func New(logger lager.Logger, clock clock.Clock, timeout time.Duration, fence auctioneer.Fence) *AuctionDrainer {
+	if timeout <= 0 {
+		timeout = DefaultDrainTimeout
+	}
+
+	return &AuctionDrainer{
+		logger:    logger.Session("auction-drainer"),
+		clock:     clock,
+		timeout:   timeout,
+		fence:     fence,
+		tasks:     map[string]struct{}{},
+		lrps:      map[lrpKey]struct{}{},
+		completed: make(chan struct{}, 1),
+	}
+}
+
+// Pending returns the number of tasks and LRP instances waiting to be
+// auctioned.
+func (d *AuctionDrainer) Pending() (int, int) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return len(d.tasks), len(d.lrps)
+}
+
+// Delegate wraps the auction runner delegate so that completed auctions are
+// no longer pending.
+func (d *AuctionDrainer) Delegate(delegate auctiontypes.AuctionRunnerDelegate) auctiontypes.AuctionRunnerDelegate {
+	return &drainingDelegate{
+		AuctionRunnerDelegate: delegate,
+		drainer:               d,
+	}
+}
+
+// Runner wraps the auction runner so that scheduled auctions are pending until
+// they complete. When signalled, it keeps the auction runner going until no
+// auctions are pending or the drain timeout expires, and only then stops it.
+func (d *AuctionDrainer) Runner(runner auctiontypes.AuctionRunner) auctiontypes.AuctionRunner {
+	return &drainingRunner{
+		AuctionRunner: runner,
+		drainer:       d,
+	}
+}
+
+func (d *AuctionDrainer) add(tasks []auctioneer.TaskStartRequest, lrps []auctioneer.LRPStartRequest) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	for i := range tasks {
+		d.tasks[tasks[i].TaskGuid] = struct{}{}
+	}
+
+	for i := range lrps {
+		for _, index := range lrps[i].Indices {
+			d.lrps[lrpKey{lrps[i].ProcessGuid, index}] = struct{}{}
+		}
+	}
+}
+
+func (d *AuctionDrainer) complete(results auctiontypes.AuctionResults) {
+	d.lock.Lock()
+	for _, tasks := range [][]auctiontypes.TaskAuction{results.SuccessfulTasks, results.FailedTasks} {
+		for i := range tasks {
+			delete(d.tasks, tasks[i].TaskGuid)
+		}
+	}
+	for _, lrps := range [][]auctiontypes.LRPAuction{results.SuccessfulLRPs, results.FailedLRPs} {
+		for i := range lrps {
+			delete(d.lrps, lrpKey{lrps[i].ProcessGuid, int(lrps[i].Index)})
+		}
+	}
+	d.lock.Unlock()
+
+	select {
+	case d.completed <- struct{}{}:
+	default:
+	}
+}
+
+func (d *AuctionDrainer) drain() {
+	logger := d.logger.Session("drain")
+
+	tasks, lrps := d.Pending()
+	if d.fence != nil {
+		if _, held := d.fence.FencingToken(); !held {
+			logger.Info("lock-lost", lager.Data{"abandoned-tasks": tasks, "abandoned-lrps": lrps})
+			return
+		}
+	}
+
+	logger.Info("starting", lager.Data{"pending-tasks": tasks, "pending-lrps": lrps, "timeout": d.timeout.String()})
+
+	timer := d.clock.NewTimer(d.timeout)
+	defer timer.Stop()
+
+	for tasks > 0 || lrps > 0 {
+		select {
+		case <-d.completed:
+			tasks, lrps = d.Pending()
+		case <-timer.C():
+			logger.Info("timed-out", lager.Data{"abandoned-tasks": tasks, "abandoned-lrps": lrps})
+			return
+		}
+	}
+
+	logger.Info("finished")
+}
+
+type drainingDelegate struct {
+	auctiontypes.AuctionRunnerDelegate
+	drainer *AuctionDrainer
+}
+
+func (d *drainingDelegate) AuctionCompleted(results auctiontypes.AuctionResults) {
+	d.AuctionRunnerDelegate.AuctionCompleted(results)
+	d.drainer.complete(results)
+}
+
+type drainingRunner struct {
+	auctiontypes.AuctionRunner
+	drainer *AuctionDrainer
+}
+
+func (r *drainingRunner) ScheduleLRPsForAuctions(starts []auctioneer.LRPStartRequest) {
+	r.drainer.add(nil, starts)
+	r.AuctionRunner.ScheduleLRPsForAuctions(starts)
+}
+
+func (r *drainingRunner) ScheduleTasksForAuctions(tasks []auctioneer.TaskStartRequest) {
+	r.drainer.add(tasks, nil)
+	r.AuctionRunner.ScheduleTasksForAuctions(tasks)
+}
+
+func (r *drainingRunner) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	process := ifrit.Background(r.AuctionRunner)
+
+	select {
+	case <-process.Ready():
+	case err := <-process.Wait():
+		return err
+	}
+
+	close(ready)
+
+	select {
+	case err := <-process.Wait():
+		return err
+	case signal := <-signals:
+		r.drainer.drain()
+		process.Signal(signal)
+		return <-process.Wait()
+	}
+}
@@ -0,0 +1,173 @@
+package auctiondrainer_test
+
+import (
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/auction/auctiontypes"
+	fake_auction_runner "code.cloudfoundry.org/auction/auctiontypes/fakes"
+	"code.cloudfoundry.org/auctioneer"
+	"code.cloudfoundry.org/auctioneer/auctiondrainer"
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/rep"
+	"github.com/tedsuo/ifrit"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakeDelegate struct {
+	completed []auctiontypes.AuctionResults
+}
+
+func (d *fakeDelegate) FetchCellReps() (map[string]rep.Client, error) {
+	return map[string]rep.Client{}, nil
+}
+
+func (d *fakeDelegate) AuctionCompleted(results auctiontypes.AuctionResults) {
+	d.completed = append(d.completed, results)
+}
+
+type fakeFence struct {
+	held bool
+}
+
+func (f *fakeFence) FencingToken() (uint64, bool) {
+	return 1, f.held
+}
+
+var _ = Describe("AuctionDrainer", func() {
+	const drainTimeout = 5 * time.Second
+
+	var (
+		clock         *fakeclock.FakeClock
+		drainer       *auctiondrainer.AuctionDrainer
+		innerRunner   *fake_auction_runner.FakeAuctionRunner
+		innerStopped  chan struct{}
+		delegate      auctiontypes.AuctionRunnerDelegate
+		innerDelegate *fakeDelegate
+		runner        auctiontypes.AuctionRunner
+		process       ifrit.Process
+
+		task rep.Task
+		lrp  auctioneer.LRPStartRequest
+	)
+
+	BeforeEach(func() {
+		clock = fakeclock.NewFakeClock(time.Now())
+		fence = &fakeFence{held: true}
+		drainer = auctiondrainer.New(lagertest.NewTestLogger("test"), clock, drainTimeout, fence)
+
+		innerStopped = make(chan struct{})
+		innerRunner = new(fake_auction_runner.FakeAuctionRunner)
+		innerRunner.RunStub = func(signals <-chan os.Signal, ready chan<- struct{}) error {
+			close(ready)
+			<-signals
+			close(innerStopped)
+			return nil
+		}
+
+		innerDelegate = &fakeDelegate{}
+		delegate = drainer.Delegate(innerDelegate)
+		runner = drainer.Runner(innerRunner)
+
+		resource := rep.NewResource(10, 10, 10)
+		pc := rep.NewPlacementConstraint("linux", []string{}, []string{})
+		task = rep.NewTask("task-guid", "domain", resource, pc)
+		lrp = auctioneer.NewLRPStartRequest("process-guid", "domain", []int{0, 1}, resource, pc)
+
+		process = ifrit.Invoke(runner)
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(func() <-chan error {
+			clock.Increment(drainTimeout)
+			return process.Wait()
+		}).Should(Receive())
+	})
+
+	It("passes scheduled auctions through to the auction runner", func() {
+		runner.ScheduleTasksForAuctions([]auctioneer.TaskStartRequest{{Task: task}})
+		runner.ScheduleLRPsForAuctions([]auctioneer.LRPStartRequest{lrp})
+
+		Expect(innerRunner.ScheduleTasksForAuctionsCallCount()).To(Equal(1))
+		Expect(innerRunner.ScheduleLRPsForAuctionsCallCount()).To(Equal(1))
+
+		tasks, lrps := drainer.Pending()
+		Expect(tasks).To(Equal(1))
+		Expect(lrps).To(Equal(2))
+	})
+
+	It("passes completed auctions through to the delegate", func() {
+		runner.ScheduleTasksForAuctions([]auctioneer.TaskStartRequest{{Task: task}})
+		results := auctiontypes.AuctionResults{
+			FailedTasks: []auctiontypes.TaskAuction{{Task: task}},
+		}
+		delegate.AuctionCompleted(results)
+
+		Expect(innerDelegate.completed).To(ConsistOf(results))
+
+		tasks, _ := drainer.Pending()
+		Expect(tasks).To(BeZero())
+	})
+
+	Context("when signalled with nothing pending", func() {
+		It("stops the auction runner right away", func() {
+			process.Signal(os.Interrupt)
+			Eventually(innerStopped).Should(BeClosed())
+			Eventually(process.Wait()).Should(Receive(BeNil()))
+		})
+	})
+
+	Context("when signalled with pending auctions after losing the lock", func() {
+		BeforeEach(func() {
+			runner.ScheduleTasksForAuctions([]auctioneer.TaskStartRequest{{Task: task}})
+			fence.held = false
+		})
+
+		It("stops the auction runner right away", func() {
+			process.Signal(os.Interrupt)
+			Eventually(innerStopped).Should(BeClosed())
+		})
+	})
+
+	Context("when signalled with pending auctions", func() {
+		BeforeEach(func() {
+			runner.ScheduleTasksForAuctions([]auctioneer.TaskStartRequest{{Task: task}})
+			runner.ScheduleLRPsForAuctions([]auctioneer.LRPStartRequest{lrp})
+
+			process.Signal(os.Interrupt)
+		})
+
+		It("keeps the auction runner going until they complete", func() {
+			Consistently(innerStopped).ShouldNot(BeClosed())
+
+			delegate.AuctionCompleted(auctiontypes.AuctionResults{
+				SuccessfulTasks: []auctiontypes.TaskAuction{{Task: task}},
+				SuccessfulLRPs: []auctiontypes.LRPAuction{
+					{LRP: rep.NewLRP("", models.NewActualLRPKey("process-guid", 0, "domain"), lrp.Resource, lrp.PlacementConstraint)},
+				},
+			})
+			Consistently(innerStopped).ShouldNot(BeClosed())
+
+			delegate.AuctionCompleted(auctiontypes.AuctionResults{
+				FailedLRPs: []auctiontypes.LRPAuction{
+					{LRP: rep.NewLRP("", models.NewActualLRPKey("process-guid", 1, "domain"), lrp.Resource, lrp.PlacementConstraint)},
+				},
+			})
+			Eventually(innerStopped).Should(BeClosed())
+		})
+
+		It("stops the auction runner once the drain timeout expires", func() {
+			clock.WaitForWatcherAndIncrement(drainTimeout)
+			Eventually(innerStopped).Should(BeClosed())
+
+			tasks, lrps := drainer.Pending()
+			Expect(tasks).To(Equal(1))
+			Expect(lrps).To(Equal(2))
+		})
+	})
+})
@@ -0,0 +1,13 @@
+package auctiondrainer_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestAuctiondrainer(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Auction Drainer Suite")
+}
@@ -0,0 +1 @@
+package auctiondrainer // import "code.cloudfoundry.org/auctioneer/auctiondrainer"
@@ -2,6 +2,7 @@
 package auctioneerfakes
 
 import (
+	"context"
 	"sync"
 
 	"code.cloudfoundry.org/auctioneer"
@@ -9,6 +10,59 @@ import (
 )
 
 type FakeClient struct {
+	CellsStub        func(lager.Logger) ([]auctioneer.Cell, error)
+	cellsMutex       sync.RWMutex
+	cellsArgsForCall []struct {
+		arg1 lager.Logger
+	}
+	cellsReturns struct {
+		result1 []auctioneer.Cell
+		result2 error
+	}
+	cellsReturnsOnCall map[int]struct {
+		result1 []auctioneer.Cell
+		result2 error
+	}
+	ClearCellQuarantineStub        func(lager.Logger, string) error
+	clearCellQuarantineMutex       sync.RWMutex
+	clearCellQuarantineArgsForCall []struct {
+		arg1 lager.Logger
+		arg2 string
+	}
+	clearCellQuarantineReturns struct {
+		result1 error
+	}
+	clearCellQuarantineReturnsOnCall map[int]struct {
+		result1 error
+	}
+	PreviewLRPAuctionsStub        func(lager.Logger, []*auctioneer.LRPStartRequest) ([]auctioneer.PlacementExplanation, error)
+	previewLRPAuctionsMutex       sync.RWMutex
+	previewLRPAuctionsArgsForCall []struct {
+		arg1 lager.Logger
+		arg2 []*auctioneer.LRPStartRequest
+	}
+	previewLRPAuctionsReturns struct {
+		result1 []auctioneer.PlacementExplanation
+		result2 error
+	}
+	previewLRPAuctionsReturnsOnCall map[int]struct {
+		result1 []auctioneer.PlacementExplanation
+		result2 error
+	}
+	PreviewTaskAuctionsStub        func(lager.Logger, []*auctioneer.TaskStartRequest) ([]auctioneer.PlacementExplanation, error)
+	previewTaskAuctionsMutex       sync.RWMutex
+	previewTaskAuctionsArgsForCall []struct {
+		arg1 lager.Logger
+		arg2 []*auctioneer.TaskStartRequest
+	}
+	previewTaskAuctionsReturns struct {
+		result1 []auctioneer.PlacementExplanation
+		result2 error
+	}
+	previewTaskAuctionsReturnsOnCall map[int]struct {
+		result1 []auctioneer.PlacementExplanation
+		result2 error
+	}
 	RequestLRPAuctionsStub        func(lager.Logger, []*auctioneer.LRPStartRequest) error
 	requestLRPAuctionsMutex       sync.RWMutex
 	requestLRPAuctionsArgsForCall []struct {
@@ -21,6 +75,19 @@ type FakeClient struct {
 	requestLRPAuctionsReturnsOnCall map[int]struct {
 		result1 error
 	}
+	RequestLRPAuctionsContextStub        func(context.Context, lager.Logger, []*auctioneer.LRPStartRequest) error
+	requestLRPAuctionsContextMutex       sync.RWMutex
+	requestLRPAuctionsContextArgsForCall []struct {
+		arg1 context.Context
+		arg2 lager.Logger
+		arg3 []*auctioneer.LRPStartRequest
+	}
+	requestLRPAuctionsContextReturns struct {
+		result1 error
+	}
+	requestLRPAuctionsContextReturnsOnCall map[int]struct {
+		result1 error
+	}
 	RequestTaskAuctionsStub        func(lager.Logger, []*auctioneer.TaskStartRequest) error
 	requestTaskAuctionsMutex       sync.RWMutex
 	requestTaskAuctionsArgsForCall []struct {
@@ -33,10 +100,302 @@ type FakeClient struct {
 	requestTaskAuctionsReturnsOnCall map[int]struct {
 		result1 error
 	}
+	RequestTaskAuctionsContextStub        func(context.Context, lager.Logger, []*auctioneer.TaskStartRequest) error
+	requestTaskAuctionsContextMutex       sync.RWMutex
+	requestTaskAuctionsContextArgsForCall []struct {
+		arg1 context.Context
+		arg2 lager.Logger
+		arg3 []*auctioneer.TaskStartRequest
+	}
+	requestTaskAuctionsContextReturns struct {
+		result1 error
+	}
+	requestTaskAuctionsContextReturnsOnCall map[int]struct {
+		result1 error
+	}
+	StatusStub        func(lager.Logger) (auctioneer.Status, error)
+	statusMutex       sync.RWMutex
+	statusArgsForCall []struct {
+		arg1 lager.Logger
+	}
+	statusReturns struct {
+		result1 auctioneer.Status
+		result2 error
+	}
+	statusReturnsOnCall map[int]struct {
+		result1 auctioneer.Status
+		result2 error
+	}
 	invocations      map[string][][]interface{}
 	invocationsMutex sync.RWMutex
 }
 
+func (fake *FakeClient) Cells(arg1 lager.Logger) ([]auctioneer.Cell, error) {
+	fake.cellsMutex.Lock()
+	ret, specificReturn := fake.cellsReturnsOnCall[len(fake.cellsArgsForCall)]
+	fake.cellsArgsForCall = append(fake.cellsArgsForCall, struct {
+		arg1 lager.Logger
+	}{arg1})
+	fake.recordInvocation("Cells", []interface{}{arg1})
+	cellsStubCopy := fake.CellsStub
+	fake.cellsMutex.Unlock()
+	if cellsStubCopy != nil {
+		return cellsStubCopy(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.cellsReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeClient) CellsCallCount() int {
+	fake.cellsMutex.RLock()
+	defer fake.cellsMutex.RUnlock()
+	return len(fake.cellsArgsForCall)
+}
+
+func (fake *FakeClient) CellsCalls(stub func(lager.Logger) ([]auctioneer.Cell, error)) {
+	fake.cellsMutex.Lock()
+	defer fake.cellsMutex.Unlock()
+	fake.CellsStub = stub
+}
+
+func (fake *FakeClient) CellsArgsForCall(i int) lager.Logger {
+	fake.cellsMutex.RLock()
+	defer fake.cellsMutex.RUnlock()
+	argsForCall := fake.cellsArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeClient) CellsReturns(result1 []auctioneer.Cell, result2 error) {
+	fake.cellsMutex.Lock()
+	defer fake.cellsMutex.Unlock()
+	fake.CellsStub = nil
+	fake.cellsReturns = struct {
+		result1 []auctioneer.Cell
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) CellsReturnsOnCall(i int, result1 []auctioneer.Cell, result2 error) {
+	fake.cellsMutex.Lock()
+	defer fake.cellsMutex.Unlock()
+	fake.CellsStub = nil
+	if fake.cellsReturnsOnCall == nil {
+		fake.cellsReturnsOnCall = make(map[int]struct {
+			result1 []auctioneer.Cell
+			result2 error
+		})
+	}
+	fake.cellsReturnsOnCall[i] = struct {
+		result1 []auctioneer.Cell
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) ClearCellQuarantine(arg1 lager.Logger, arg2 string) error {
+	fake.clearCellQuarantineMutex.Lock()
+	ret, specificReturn := fake.clearCellQuarantineReturnsOnCall[len(fake.clearCellQuarantineArgsForCall)]
+	fake.clearCellQuarantineArgsForCall = append(fake.clearCellQuarantineArgsForCall, struct {
+		arg1 lager.Logger
+		arg2 string
+	}{arg1, arg2})
+	fake.recordInvocation("ClearCellQuarantine", []interface{}{arg1, arg2})
+	clearCellQuarantineStubCopy := fake.ClearCellQuarantineStub
+	fake.clearCellQuarantineMutex.Unlock()
+	if clearCellQuarantineStubCopy != nil {
+		return clearCellQuarantineStubCopy(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.clearCellQuarantineReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeClient) ClearCellQuarantineCallCount() int {
+	fake.clearCellQuarantineMutex.RLock()
+	defer fake.clearCellQuarantineMutex.RUnlock()
+	return len(fake.clearCellQuarantineArgsForCall)
+}
+
+func (fake *FakeClient) ClearCellQuarantineCalls(stub func(lager.Logger, string) error) {
+	fake.clearCellQuarantineMutex.Lock()
+	defer fake.clearCellQuarantineMutex.Unlock()
+	fake.ClearCellQuarantineStub = stub
+}
+
+func (fake *FakeClient) ClearCellQuarantineArgsForCall(i int) (lager.Logger, string) {
+	fake.clearCellQuarantineMutex.RLock()
+	defer fake.clearCellQuarantineMutex.RUnlock()
+	argsForCall := fake.clearCellQuarantineArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeClient) ClearCellQuarantineReturns(result1 error) {
+	fake.clearCellQuarantineMutex.Lock()
+	defer fake.clearCellQuarantineMutex.Unlock()
+	fake.ClearCellQuarantineStub = nil
+	fake.clearCellQuarantineReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) ClearCellQuarantineReturnsOnCall(i int, result1 error) {
+	fake.clearCellQuarantineMutex.Lock()
+	defer fake.clearCellQuarantineMutex.Unlock()
+	fake.ClearCellQuarantineStub = nil
+	if fake.clearCellQuarantineReturnsOnCall == nil {
+		fake.clearCellQuarantineReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.clearCellQuarantineReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) PreviewLRPAuctions(arg1 lager.Logger, arg2 []*auctioneer.LRPStartRequest) ([]auctioneer.PlacementExplanation, error) {
+	var arg2Copy []*auctioneer.LRPStartRequest
+	if arg2 != nil {
+		arg2Copy = make([]*auctioneer.LRPStartRequest, len(arg2))
+		copy(arg2Copy, arg2)
+	}
+	fake.previewLRPAuctionsMutex.Lock()
+	ret, specificReturn := fake.previewLRPAuctionsReturnsOnCall[len(fake.previewLRPAuctionsArgsForCall)]
+	fake.previewLRPAuctionsArgsForCall = append(fake.previewLRPAuctionsArgsForCall, struct {
+		arg1 lager.Logger
+		arg2 []*auctioneer.LRPStartRequest
+	}{arg1, arg2Copy})
+	fake.recordInvocation("PreviewLRPAuctions", []interface{}{arg1, arg2Copy})
+	previewLRPAuctionsStubCopy := fake.PreviewLRPAuctionsStub
+	fake.previewLRPAuctionsMutex.Unlock()
+	if previewLRPAuctionsStubCopy != nil {
+		return previewLRPAuctionsStubCopy(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.previewLRPAuctionsReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeClient) PreviewLRPAuctionsCallCount() int {
+	fake.previewLRPAuctionsMutex.RLock()
+	defer fake.previewLRPAuctionsMutex.RUnlock()
+	return len(fake.previewLRPAuctionsArgsForCall)
+}
+
+func (fake *FakeClient) PreviewLRPAuctionsCalls(stub func(lager.Logger, []*auctioneer.LRPStartRequest) ([]auctioneer.PlacementExplanation, error)) {
+	fake.previewLRPAuctionsMutex.Lock()
+	defer fake.previewLRPAuctionsMutex.Unlock()
+	fake.PreviewLRPAuctionsStub = stub
+}
+
+func (fake *FakeClient) PreviewLRPAuctionsArgsForCall(i int) (lager.Logger, []*auctioneer.LRPStartRequest) {
+	fake.previewLRPAuctionsMutex.RLock()
+	defer fake.previewLRPAuctionsMutex.RUnlock()
+	argsForCall := fake.previewLRPAuctionsArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeClient) PreviewLRPAuctionsReturns(result1 []auctioneer.PlacementExplanation, result2 error) {
+	fake.previewLRPAuctionsMutex.Lock()
+	defer fake.previewLRPAuctionsMutex.Unlock()
+	fake.PreviewLRPAuctionsStub = nil
+	fake.previewLRPAuctionsReturns = struct {
+		result1 []auctioneer.PlacementExplanation
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) PreviewLRPAuctionsReturnsOnCall(i int, result1 []auctioneer.PlacementExplanation, result2 error) {
+	fake.previewLRPAuctionsMutex.Lock()
+	defer fake.previewLRPAuctionsMutex.Unlock()
+	fake.PreviewLRPAuctionsStub = nil
+	if fake.previewLRPAuctionsReturnsOnCall == nil {
+		fake.previewLRPAuctionsReturnsOnCall = make(map[int]struct {
+			result1 []auctioneer.PlacementExplanation
+			result2 error
+		})
+	}
+	fake.previewLRPAuctionsReturnsOnCall[i] = struct {
+		result1 []auctioneer.PlacementExplanation
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) PreviewTaskAuctions(arg1 lager.Logger, arg2 []*auctioneer.TaskStartRequest) ([]auctioneer.PlacementExplanation, error) {
+	var arg2Copy []*auctioneer.TaskStartRequest
+	if arg2 != nil {
+		arg2Copy = make([]*auctioneer.TaskStartRequest, len(arg2))
+		copy(arg2Copy, arg2)
+	}
+	fake.previewTaskAuctionsMutex.Lock()
+	ret, specificReturn := fake.previewTaskAuctionsReturnsOnCall[len(fake.previewTaskAuctionsArgsForCall)]
+	fake.previewTaskAuctionsArgsForCall = append(fake.previewTaskAuctionsArgsForCall, struct {
+		arg1 lager.Logger
+		arg2 []*auctioneer.TaskStartRequest
+	}{arg1, arg2Copy})
+	fake.recordInvocation("PreviewTaskAuctions", []interface{}{arg1, arg2Copy})
+	previewTaskAuctionsStubCopy := fake.PreviewTaskAuctionsStub
+	fake.previewTaskAuctionsMutex.Unlock()
+	if previewTaskAuctionsStubCopy != nil {
+		return previewTaskAuctionsStubCopy(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.previewTaskAuctionsReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeClient) PreviewTaskAuctionsCallCount() int {
+	fake.previewTaskAuctionsMutex.RLock()
+	defer fake.previewTaskAuctionsMutex.RUnlock()
+	return len(fake.previewTaskAuctionsArgsForCall)
+}
+
+func (fake *FakeClient) PreviewTaskAuctionsCalls(stub func(lager.Logger, []*auctioneer.TaskStartRequest) ([]auctioneer.PlacementExplanation, error)) {
+	fake.previewTaskAuctionsMutex.Lock()
+	defer fake.previewTaskAuctionsMutex.Unlock()
+	fake.PreviewTaskAuctionsStub = stub
+}
+
+func (fake *FakeClient) PreviewTaskAuctionsArgsForCall(i int) (lager.Logger, []*auctioneer.TaskStartRequest) {
+	fake.previewTaskAuctionsMutex.RLock()
+	defer fake.previewTaskAuctionsMutex.RUnlock()
+	argsForCall := fake.previewTaskAuctionsArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeClient) PreviewTaskAuctionsReturns(result1 []auctioneer.PlacementExplanation, result2 error) {
+	fake.previewTaskAuctionsMutex.Lock()
+	defer fake.previewTaskAuctionsMutex.Unlock()
+	fake.PreviewTaskAuctionsStub = nil
+	fake.previewTaskAuctionsReturns = struct {
+		result1 []auctioneer.PlacementExplanation
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) PreviewTaskAuctionsReturnsOnCall(i int, result1 []auctioneer.PlacementExplanation, result2 error) {
+	fake.previewTaskAuctionsMutex.Lock()
+	defer fake.previewTaskAuctionsMutex.Unlock()
+	fake.PreviewTaskAuctionsStub = nil
+	if fake.previewTaskAuctionsReturnsOnCall == nil {
+		fake.previewTaskAuctionsReturnsOnCall = make(map[int]struct {
+			result1 []auctioneer.PlacementExplanation
+			result2 error
+		})
+	}
+	fake.previewTaskAuctionsReturnsOnCall[i] = struct {
+		result1 []auctioneer.PlacementExplanation
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeClient) RequestLRPAuctions(arg1 lager.Logger, arg2 []*auctioneer.LRPStartRequest) error {
 	var arg2Copy []*auctioneer.LRPStartRequest
 	if arg2 != nil {
@@ -104,6 +463,74 @@ func (fake *FakeClient) RequestLRPAuctionsReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
+func (fake *FakeClient) RequestLRPAuctionsContext(arg1 context.Context, arg2 lager.Logger, arg3 []*auctioneer.LRPStartRequest) error {
+	var arg3Copy []*auctioneer.LRPStartRequest
+	if arg3 != nil {
+		arg3Copy = make([]*auctioneer.LRPStartRequest, len(arg3))
+		copy(arg3Copy, arg3)
+	}
+	fake.requestLRPAuctionsContextMutex.Lock()
+	ret, specificReturn := fake.requestLRPAuctionsContextReturnsOnCall[len(fake.requestLRPAuctionsContextArgsForCall)]
+	fake.requestLRPAuctionsContextArgsForCall = append(fake.requestLRPAuctionsContextArgsForCall, struct {
+		arg1 context.Context
+		arg2 lager.Logger
+		arg3 []*auctioneer.LRPStartRequest
+	}{arg1, arg2, arg3Copy})
+	fake.recordInvocation("RequestLRPAuctionsContext", []interface{}{arg1, arg2, arg3Copy})
+	requestLRPAuctionsContextStubCopy := fake.RequestLRPAuctionsContextStub
+	fake.requestLRPAuctionsContextMutex.Unlock()
+	if requestLRPAuctionsContextStubCopy != nil {
+		return requestLRPAuctionsContextStubCopy(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.requestLRPAuctionsContextReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeClient) RequestLRPAuctionsContextCallCount() int {
+	fake.requestLRPAuctionsContextMutex.RLock()
+	defer fake.requestLRPAuctionsContextMutex.RUnlock()
+	return len(fake.requestLRPAuctionsContextArgsForCall)
+}
+
+func (fake *FakeClient) RequestLRPAuctionsContextCalls(stub func(context.Context, lager.Logger, []*auctioneer.LRPStartRequest) error) {
+	fake.requestLRPAuctionsContextMutex.Lock()
+	defer fake.requestLRPAuctionsContextMutex.Unlock()
+	fake.RequestLRPAuctionsContextStub = stub
+}
+
+func (fake *FakeClient) RequestLRPAuctionsContextArgsForCall(i int) (context.Context, lager.Logger, []*auctioneer.LRPStartRequest) {
+	fake.requestLRPAuctionsContextMutex.RLock()
+	defer fake.requestLRPAuctionsContextMutex.RUnlock()
+	argsForCall := fake.requestLRPAuctionsContextArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeClient) RequestLRPAuctionsContextReturns(result1 error) {
+	fake.requestLRPAuctionsContextMutex.Lock()
+	defer fake.requestLRPAuctionsContextMutex.Unlock()
+	fake.RequestLRPAuctionsContextStub = nil
+	fake.requestLRPAuctionsContextReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) RequestLRPAuctionsContextReturnsOnCall(i int, result1 error) {
+	fake.requestLRPAuctionsContextMutex.Lock()
+	defer fake.requestLRPAuctionsContextMutex.Unlock()
+	fake.RequestLRPAuctionsContextStub = nil
+	if fake.requestLRPAuctionsContextReturnsOnCall == nil {
+		fake.requestLRPAuctionsContextReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.requestLRPAuctionsContextReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
 func (fake *FakeClient) RequestTaskAuctions(arg1 lager.Logger, arg2 []*auctioneer.TaskStartRequest) error {
 	var arg2Copy []*auctioneer.TaskStartRequest
 	if arg2 != nil {
@@ -171,13 +598,159 @@ func (fake *FakeClient) RequestTaskAuctionsReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
+func (fake *FakeClient) RequestTaskAuctionsContext(arg1 context.Context, arg2 lager.Logger, arg3 []*auctioneer.TaskStartRequest) error {
+	var arg3Copy []*auctioneer.TaskStartRequest
+	if arg3 != nil {
+		arg3Copy = make([]*auctioneer.TaskStartRequest, len(arg3))
+		copy(arg3Copy, arg3)
+	}
+	fake.requestTaskAuctionsContextMutex.Lock()
+	ret, specificReturn := fake.requestTaskAuctionsContextReturnsOnCall[len(fake.requestTaskAuctionsContextArgsForCall)]
+	fake.requestTaskAuctionsContextArgsForCall = append(fake.requestTaskAuctionsContextArgsForCall, struct {
+		arg1 context.Context
+		arg2 lager.Logger
+		arg3 []*auctioneer.TaskStartRequest
+	}{arg1, arg2, arg3Copy})
+	fake.recordInvocation("RequestTaskAuctionsContext", []interface{}{arg1, arg2, arg3Copy})
+	requestTaskAuctionsContextStubCopy := fake.RequestTaskAuctionsContextStub
+	fake.requestTaskAuctionsContextMutex.Unlock()
+	if requestTaskAuctionsContextStubCopy != nil {
+		return requestTaskAuctionsContextStubCopy(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.requestTaskAuctionsContextReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeClient) RequestTaskAuctionsContextCallCount() int {
+	fake.requestTaskAuctionsContextMutex.RLock()
+	defer fake.requestTaskAuctionsContextMutex.RUnlock()
+	return len(fake.requestTaskAuctionsContextArgsForCall)
+}
+
+func (fake *FakeClient) RequestTaskAuctionsContextCalls(stub func(context.Context, lager.Logger, []*auctioneer.TaskStartRequest) error) {
+	fake.requestTaskAuctionsContextMutex.Lock()
+	defer fake.requestTaskAuctionsContextMutex.Unlock()
+	fake.RequestTaskAuctionsContextStub = stub
+}
+
+func (fake *FakeClient) RequestTaskAuctionsContextArgsForCall(i int) (context.Context, lager.Logger, []*auctioneer.TaskStartRequest) {
+	fake.requestTaskAuctionsContextMutex.RLock()
+	defer fake.requestTaskAuctionsContextMutex.RUnlock()
+	argsForCall := fake.requestTaskAuctionsContextArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeClient) RequestTaskAuctionsContextReturns(result1 error) {
+	fake.requestTaskAuctionsContextMutex.Lock()
+	defer fake.requestTaskAuctionsContextMutex.Unlock()
+	fake.RequestTaskAuctionsContextStub = nil
+	fake.requestTaskAuctionsContextReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) RequestTaskAuctionsContextReturnsOnCall(i int, result1 error) {
+	fake.requestTaskAuctionsContextMutex.Lock()
+	defer fake.requestTaskAuctionsContextMutex.Unlock()
+	fake.RequestTaskAuctionsContextStub = nil
+	if fake.requestTaskAuctionsContextReturnsOnCall == nil {
+		fake.requestTaskAuctionsContextReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.requestTaskAuctionsContextReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) Status(arg1 lager.Logger) (auctioneer.Status, error) {
+	fake.statusMutex.Lock()
+	ret, specificReturn := fake.statusReturnsOnCall[len(fake.statusArgsForCall)]
+	fake.statusArgsForCall = append(fake.statusArgsForCall, struct {
+		arg1 lager.Logger
+	}{arg1})
+	fake.recordInvocation("Status", []interface{}{arg1})
+	statusStubCopy := fake.StatusStub
+	fake.statusMutex.Unlock()
+	if statusStubCopy != nil {
+		return statusStubCopy(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.statusReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeClient) StatusCallCount() int {
+	fake.statusMutex.RLock()
+	defer fake.statusMutex.RUnlock()
+	return len(fake.statusArgsForCall)
+}
+
+func (fake *FakeClient) StatusCalls(stub func(lager.Logger) (auctioneer.Status, error)) {
+	fake.statusMutex.Lock()
+	defer fake.statusMutex.Unlock()
+	fake.StatusStub = stub
+}
+
+func (fake *FakeClient) StatusArgsForCall(i int) lager.Logger {
+	fake.statusMutex.RLock()
+	defer fake.statusMutex.RUnlock()
+	argsForCall := fake.statusArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeClient) StatusReturns(result1 auctioneer.Status, result2 error) {
+	fake.statusMutex.Lock()
+	defer fake.statusMutex.Unlock()
+	fake.StatusStub = nil
+	fake.statusReturns = struct {
+		result1 auctioneer.Status
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) StatusReturnsOnCall(i int, result1 auctioneer.Status, result2 error) {
+	fake.statusMutex.Lock()
+	defer fake.statusMutex.Unlock()
+	fake.StatusStub = nil
+	if fake.statusReturnsOnCall == nil {
+		fake.statusReturnsOnCall = make(map[int]struct {
+			result1 auctioneer.Status
+			result2 error
+		})
+	}
+	fake.statusReturnsOnCall[i] = struct {
+		result1 auctioneer.Status
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeClient) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
+	fake.cellsMutex.RLock()
+	defer fake.cellsMutex.RUnlock()
+	fake.clearCellQuarantineMutex.RLock()
+	defer fake.clearCellQuarantineMutex.RUnlock()
+	fake.previewLRPAuctionsMutex.RLock()
+	defer fake.previewLRPAuctionsMutex.RUnlock()
+	fake.previewTaskAuctionsMutex.RLock()
+	defer fake.previewTaskAuctionsMutex.RUnlock()
 	fake.requestLRPAuctionsMutex.RLock()
 	defer fake.requestLRPAuctionsMutex.RUnlock()
+	fake.requestLRPAuctionsContextMutex.RLock()
+	defer fake.requestLRPAuctionsContextMutex.RUnlock()
 	fake.requestTaskAuctionsMutex.RLock()
 	defer fake.requestTaskAuctionsMutex.RUnlock()
+	fake.requestTaskAuctionsContextMutex.RLock()
+	defer fake.requestTaskAuctionsContextMutex.RUnlock()
+	fake.statusMutex.RLock()
+	defer fake.statusMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
 	for key, value := range fake.invocations {
 		copiedInvocations[key] = value
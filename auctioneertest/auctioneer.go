@@ -0,0 +1,270 @@
+package auctioneertest
+
+import (
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/auction/auctionrunner"
+	"code.cloudfoundry.org/auction/auctiontypes"
+	"code.cloudfoundry.org/auction/simulation/simulationrep"
+	"code.cloudfoundry.org/auctioneer"
+	"code.cloudfoundry.org/auctioneer/handlers"
+	"code.cloudfoundry.org/clock"
+	loggingclient "code.cloudfoundry.org/diego-logging-client"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/rep"
+	"code.cloudfoundry.org/workpool"
+	"github.com/tedsuo/ifrit"
+)
+
+const (
+	DefaultStack      = "linux"
+	DefaultZone       = "z1"
+	DefaultMemoryMB   = 1024
+	DefaultDiskMB     = 1024
+	DefaultContainers = 100
+)
+
+type CellConfig struct {
+	CellID        string
+	Stack         string
+	Zone          string
+	MemoryMB      int32
+	DiskMB        int32
+	Containers    int
+	VolumeDrivers []string
+}
+
+type Config struct {
+	Cells                         []CellConfig
+	BinPackFirstFitWeight         float64
+	StartingContainerWeight       float64
+	StartingContainerCountMaximum int
+	RequestTimeout                time.Duration
+	// MetronClient receives the metrics emitted by the handlers. A no-op
+	// client is used when it is nil.
+	MetronClient loggingclient.IngressClient
+}
+
+// Auctioneer runs the real auction handlers and auction runner in-process
+// against simulated cells, so that work submitted through Client is actually
+// placed.
+type Auctioneer struct {
+	// URL is the address of the auctioneer's HTTP server.
+	URL string
+	// Client is an auctioneer.Client pointed at URL.
+	Client auctioneer.Client
+
+	logger  lager.Logger
+	server  *httptest.Server
+	process ifrit.Process
+	cells   map[string]rep.SimClient
+
+	resultsLock sync.Mutex
+	results     []auctiontypes.AuctionResults
+}
+
+// New starts an auctioneer with the given cells. Callers must call Close.
+func New(logger lager.Logger, cfg Config) (*Auctioneer, error) {
+	if len(cfg.Cells) == 0 {
+		return nil, errors.New("at least one cell is required")
+	}
+
+	a := &Auctioneer{
+		logger: logger.Session("auctioneertest"),
+		cells:  map[string]rep.SimClient{},
+	}
+
+	for i, cellCfg := range cfg.Cells {
+		cellCfg = withDefaults(cellCfg, i)
+		if _, ok := a.cells[cellCfg.CellID]; ok {
+			return nil, fmt.Errorf("duplicate cell id %q", cellCfg.CellID)
+		}
+
+		a.cells[cellCfg.CellID] = simulationrep.New(
+			cellCfg.CellID,
+			i,
+			cellCfg.Stack,
+			cellCfg.Zone,
+			rep.NewResources(cellCfg.MemoryMB, cellCfg.DiskMB, cellCfg.Containers),
+			cellCfg.VolumeDrivers,
+		)
+	}
+
+	metronClient := cfg.MetronClient
+	if metronClient == nil {
+		var err error
+		metronClient, err = loggingclient.NewIngressClient(loggingclient.Config{})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	workPool, err := workpool.NewWorkPool(len(a.cells))
+	if err != nil {
+		return nil, err
+	}
+
+	runner := auctionrunner.New(
+		a.logger,
+		a,
+		noopMetricEmitter{},
+		clock.NewClock(),
+		workPool,
+		cfg.BinPackFirstFitWeight,
+		cfg.StartingContainerWeight,
+		cfg.StartingContainerCountMaximum,
+	)
+	a.process = ifrit.Invoke(runner)
+
+	a.server = httptest.NewServer(handlers.New(a.logger, runner, metronClient))
+	a.URL = a.server.URL
+
+	requestTimeout := cfg.RequestTimeout
+	if requestTimeout == 0 {
+		requestTimeout = 5 * time.Second
+	}
+	a.Client = auctioneer.NewClient(a.URL, requestTimeout)
+
+	return a, nil
+}
+
+func withDefaults(cfg CellConfig, index int) CellConfig {
+	if cfg.CellID == "" {
+		cfg.CellID = fmt.Sprintf("cell-%d", index)
+	}
+	if cfg.Stack == "" {
+		cfg.Stack = DefaultStack
+	}
+	if cfg.Zone == "" {
+		cfg.Zone = DefaultZone
+	}
+	if cfg.MemoryMB == 0 {
+		cfg.MemoryMB = DefaultMemoryMB
+	}
+	if cfg.DiskMB == 0 {
+		cfg.DiskMB = DefaultDiskMB
+	}
+	if cfg.Containers == 0 {
+		cfg.Containers = DefaultContainers
+	}
+	return cfg
+}
+
+func (a *Auctioneer) Close() {
+	a.server.Close()
+	a.process.Signal(os.Interrupt)
+	<-a.process.Wait()
+}
+
+// FetchCellReps implements auctiontypes.AuctionRunnerDelegate.
+func (a *Auctioneer) FetchCellReps() (map[string]rep.Client, error) {
+	cellReps := map[string]rep.Client{}
+	for id, cell := range a.cells {
+		cellReps[id] = cell
+	}
+	return cellReps, nil
+}
+
+// AuctionCompleted implements auctiontypes.AuctionRunnerDelegate.
+func (a *Auctioneer) AuctionCompleted(results auctiontypes.AuctionResults) {
+	a.resultsLock.Lock()
+	defer a.resultsLock.Unlock()
+	a.results = append(a.results, results)
+}
+
+// AuctionResults returns the results of every auction run so far.
+func (a *Auctioneer) AuctionResults() []auctiontypes.AuctionResults {
+	a.resultsLock.Lock()
+	defer a.resultsLock.Unlock()
+	return append([]auctiontypes.AuctionResults{}, a.results...)
+}
+
+// FailedTasks returns every task the auction failed to place.
+func (a *Auctioneer) FailedTasks() []auctiontypes.TaskAuction {
+	failed := []auctiontypes.TaskAuction{}
+	for _, results := range a.AuctionResults() {
+		failed = append(failed, results.FailedTasks...)
+	}
+	return failed
+}
+
+// FailedLRPs returns every LRP instance the auction failed to place.
+func (a *Auctioneer) FailedLRPs() []auctiontypes.LRPAuction {
+	failed := []auctiontypes.LRPAuction{}
+	for _, results := range a.AuctionResults() {
+		failed = append(failed, results.FailedLRPs...)
+	}
+	return failed
+}
+
+// Cell returns the simulated rep for cellID, or nil if there is no such cell.
+func (a *Auctioneer) Cell(cellID string) rep.SimClient {
+	return a.cells[cellID]
+}
+
+// CellState returns the current state of cellID.
+func (a *Auctioneer) CellState(cellID string) (rep.CellState, error) {
+	cell, ok := a.cells[cellID]
+	if !ok {
+		return rep.CellState{}, fmt.Errorf("unknown cell %q", cellID)
+	}
+	return cell.State(a.logger)
+}
+
+// CellForTask returns the id of the cell the task was placed on.
+func (a *Auctioneer) CellForTask(taskGuid string) (string, bool) {
+	for id := range a.cells {
+		state, err := a.CellState(id)
+		if err != nil {
+			continue
+		}
+		for _, task := range state.Tasks {
+			if task.TaskGuid == taskGuid {
+				return id, true
+			}
+		}
+	}
+	return "", false
+}
+
+// CellsForLRP maps each placed index of processGuid to the id of its cell.
+func (a *Auctioneer) CellsForLRP(processGuid string) map[int]string {
+	placements := map[int]string{}
+	for id := range a.cells {
+		state, err := a.CellState(id)
+		if err != nil {
+			continue
+		}
+		for _, lrp := range state.LRPs {
+			if lrp.ProcessGuid == processGuid {
+				placements[int(lrp.Index)] = id
+			}
+		}
+	}
+	return placements
+}
+
+// Reset removes all work from every cell and forgets past auction results.
+func (a *Auctioneer) Reset() error {
+	for _, cell := range a.cells {
+		if err := cell.Reset(); err != nil {
+			return err
+		}
+	}
+
+	a.resultsLock.Lock()
+	defer a.resultsLock.Unlock()
+	a.results = nil
+	return nil
+}
+
+type noopMetricEmitter struct{}
+
+func (noopMetricEmitter) FetchStatesCompleted(time.Duration) error     { return nil }
+func (noopMetricEmitter) FailedCellStateRequest()                      {}
+func (noopMetricEmitter) AuctionCompleted(auctiontypes.AuctionResults) {}
@@ -0,0 +1,123 @@
+package auctioneertest_test
+
+import (
+	"code.cloudfoundry.org/auctioneer"
+	"code.cloudfoundry.org/auctioneer/auctioneertest"
+	"code.cloudfoundry.org/bbs/models"
+	mfakes "code.cloudfoundry.org/diego-logging-client/testhelpers"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/rep"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Auctioneer", func() {
+	var (
+		logger         *lagertest.TestLogger
+		cfg            auctioneertest.Config
+		testAuctioneer *auctioneertest.Auctioneer
+	)
+
+	linuxRootFS := models.PreloadedRootFS("linux")
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		cfg = auctioneertest.Config{
+			Cells: []auctioneertest.CellConfig{
+				{CellID: "linux-cell", Stack: "linux", MemoryMB: 100},
+				{CellID: "windows-cell", Stack: "windows", MemoryMB: 100},
+			},
+		}
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		testAuctioneer, err = auctioneertest.New(logger, cfg)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		testAuctioneer.Close()
+	})
+
+	It("places tasks on a compatible cell", func() {
+		task := newTask("task-guid", linuxRootFS, 10)
+		Expect(testAuctioneer.Client.RequestTaskAuctions(logger, []*auctioneer.TaskStartRequest{&task})).To(Succeed())
+
+		Eventually(func() string {
+			cellID, _ := testAuctioneer.CellForTask("task-guid")
+			return cellID
+		}).Should(Equal("linux-cell"))
+	})
+
+	It("places LRP instances on a compatible cell", func() {
+		start := auctioneer.NewLRPStartRequest("process-guid", "domain", []int{0, 1}, rep.NewResource(10, 1, 1), rep.NewPlacementConstraint(linuxRootFS, nil, nil))
+		Expect(testAuctioneer.Client.RequestLRPAuctions(logger, []*auctioneer.LRPStartRequest{&start})).To(Succeed())
+
+		Eventually(func() map[int]string {
+			return testAuctioneer.CellsForLRP("process-guid")
+		}).Should(Equal(map[int]string{0: "linux-cell", 1: "linux-cell"}))
+	})
+
+	It("reports work that could not be placed", func() {
+		task := newTask("too-big", linuxRootFS, 1000)
+		Expect(testAuctioneer.Client.RequestTaskAuctions(logger, []*auctioneer.TaskStartRequest{&task})).To(Succeed())
+
+		Eventually(testAuctioneer.FailedTasks).Should(HaveLen(1))
+		Expect(testAuctioneer.FailedTasks()[0].TaskGuid).To(Equal("too-big"))
+
+		_, placed := testAuctioneer.CellForTask("too-big")
+		Expect(placed).To(BeFalse())
+	})
+
+	Describe("Reset", func() {
+		It("clears placed work and recorded results", func() {
+			task := newTask("task-guid", linuxRootFS, 10)
+			Expect(testAuctioneer.Client.RequestTaskAuctions(logger, []*auctioneer.TaskStartRequest{&task})).To(Succeed())
+			Eventually(testAuctioneer.AuctionResults).ShouldNot(BeEmpty())
+
+			Expect(testAuctioneer.Reset()).To(Succeed())
+
+			_, placed := testAuctioneer.CellForTask("task-guid")
+			Expect(placed).To(BeFalse())
+			Expect(testAuctioneer.AuctionResults()).To(BeEmpty())
+		})
+	})
+
+	Context("with a metron client", func() {
+		var fakeMetronClient *mfakes.FakeIngressClient
+
+		BeforeEach(func() {
+			fakeMetronClient = &mfakes.FakeIngressClient{}
+			cfg.MetronClient = fakeMetronClient
+		})
+
+		It("emits the request metrics to it", func() {
+			task := newTask("task-guid", linuxRootFS, 10)
+			Expect(testAuctioneer.Client.RequestTaskAuctions(logger, []*auctioneer.TaskStartRequest{&task})).To(Succeed())
+
+			Expect(fakeMetronClient.IncrementCounterCallCount()).To(BeNumerically(">", 0))
+		})
+	})
+
+	Context("without cells", func() {
+		It("returns an error", func() {
+			_, err := auctioneertest.New(logger, auctioneertest.Config{})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("with duplicate cell ids", func() {
+		It("returns an error", func() {
+			_, err := auctioneertest.New(logger, auctioneertest.Config{
+				Cells: []auctioneertest.CellConfig{{CellID: "a"}, {CellID: "a"}},
+			})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
+
+func newTask(guid, rootFS string, memoryMB int32) auctioneer.TaskStartRequest {
+	return auctioneer.NewTaskStartRequest(rep.NewTask(guid, "domain", rep.NewResource(memoryMB, 1, 1), rep.NewPlacementConstraint(rootFS, nil, nil)))
+}
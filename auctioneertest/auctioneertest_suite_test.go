@@ -0,0 +1,13 @@
+package auctioneertest_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestAuctioneertest(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Auctioneer Test Helpers Suite")
+}
@@ -0,0 +1 @@
+package auctioneertest // import "code.cloudfoundry.org/auctioneer/auctioneertest"
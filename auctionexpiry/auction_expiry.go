@@ -0,0 +1,303 @@
+package auctionexpiry
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/auction/auctiontypes"
+	"code.cloudfoundry.org/auctioneer"
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/clock"
+	loggingclient "code.cloudfoundry.org/diego-logging-client"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/rep"
+)
+
+const AuctionsExpiredCounter = "AuctioneerAuctionsExpired"
+
+// ErrAuctionExpired is the placement error of auctions that were still
+// waiting to run when their deadline passed.
+var ErrAuctionExpired = errors.New("auction expired")
+
+type lrpKey struct {
+	processGuid string
+	index       int
+}
+
+// AuctionExpiry fails auctions that wait past their deadline, whether in the
+// fair queue or for a retry, instead of running them long after the requester
+// has given up. The deadline is the one set on the start request or, if
+// earlier or unset, MaxWait after the auction was first scheduled.
+type AuctionExpiry struct {
+	logger       lager.Logger
+	clock        clock.Clock
+	metronClient loggingclient.IngressClient
+	maxWait      time.Duration
+
+	lock  sync.Mutex
+	tasks map[string]time.Time
+	lrps  map[lrpKey]time.Time
+}
+
+// New returns an AuctionExpiry. A maxWait of zero only enforces the deadlines
+// set on start requests.
+func New(logger lager.Logger, clock clock.Clock, metronClient loggingclient.IngressClient, maxWait time.Duration) *AuctionExpiry {
+	return &AuctionExpiry{
+		logger:       logger.Session("auction-expiry"),
+		clock:        clock,
+		metronClient: metronClient,
+		maxWait:      maxWait,
+		tasks:        map[string]time.Time{},
+		lrps:         map[lrpKey]time.Time{},
+	}
+}
+
+// Pending returns the number of tasks and LRP instances with a deadline that
+// have not completed yet.
+func (e *AuctionExpiry) Pending() (int, int) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	return len(e.tasks), len(e.lrps)
+}
+
+// Runner wraps the runner the handlers schedule auctions on, so that the
+// deadline of every auction is known before it starts waiting. The deadline is
+// set on the start requests scheduled on runner, so that the fair queue and
+// the auction retrier can hand over auctions that expire while they wait.
+func (e *AuctionExpiry) Runner(runner auctiontypes.AuctionRunner) auctiontypes.AuctionRunner {
+	return &trackingRunner{
+		AuctionRunner: runner,
+		expiry:        e,
+	}
+}
+
+// Delegate wraps the auction runner delegate so that the deadlines of
+// completed auctions are forgotten. It must only be told about auctions that
+// will not be retried, so it belongs inside the auction retrier.
+func (e *AuctionExpiry) Delegate(delegate auctiontypes.AuctionRunnerDelegate) auctiontypes.AuctionRunnerDelegate {
+	return &trackingDelegate{
+		AuctionRunnerDelegate: delegate,
+		expiry:                e,
+	}
+}
+
+// Gate wraps the runner that runs the auctions, so that auctions past their
+// deadline fail with ErrAuctionExpired instead of running. Auctions that did
+// not come through Runner, such as those recovered from the auction log, have
+// their deadline recorded here. Expired auctions are reported to delegate,
+// which should be the delegate the auction runner reports to, so that every
+// wrapper sees them complete.
+func (e *AuctionExpiry) Gate(runner auctiontypes.AuctionRunner, delegate auctiontypes.AuctionRunnerDelegate) auctiontypes.AuctionRunner {
+	return &expiringRunner{
+		AuctionRunner: runner,
+		delegate:      delegate,
+		expiry:        e,
+	}
+}
+
+func (e *AuctionExpiry) deadline(requested int64, now time.Time) (time.Time, bool) {
+	var deadline time.Time
+	if requested > 0 {
+		deadline = time.Unix(0, requested)
+	}
+	if e.maxWait > 0 {
+		maxWait := now.Add(e.maxWait)
+		if deadline.IsZero() || maxWait.Before(deadline) {
+			deadline = maxWait
+		}
+	}
+	return deadline, !deadline.IsZero()
+}
+
+// track records the deadlines of newly scheduled auctions. Auctions that are
+// already waiting keep their deadline. It returns copies of tasks and lrps
+// with the deadline they are held to, which for an LRP start request is the
+// earliest of its instances.
+func (e *AuctionExpiry) track(tasks []auctioneer.TaskStartRequest, lrps []auctioneer.LRPStartRequest) ([]auctioneer.TaskStartRequest, []auctioneer.LRPStartRequest) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	now := e.clock.Now()
+	trackedTasks := append([]auctioneer.TaskStartRequest(nil), tasks...)
+	for i := range trackedTasks {
+		task := &trackedTasks[i]
+		deadline, ok := e.tasks[task.TaskGuid]
+		if !ok {
+			deadline, ok = e.deadline(task.Deadline, now)
+			if !ok {
+				continue
+			}
+			e.tasks[task.TaskGuid] = deadline
+		}
+		task.Deadline = deadline.UnixNano()
+	}
+
+	trackedLRPs := append([]auctioneer.LRPStartRequest(nil), lrps...)
+	for i := range trackedLRPs {
+		start := &trackedLRPs[i]
+		requested, hasDeadline := e.deadline(start.Deadline, now)
+		var earliest time.Time
+		for _, index := range start.Indices {
+			key := lrpKey{start.ProcessGuid, index}
+			deadline, ok := e.lrps[key]
+			if !ok {
+				if !hasDeadline {
+					continue
+				}
+				deadline = requested
+				e.lrps[key] = deadline
+			}
+			if earliest.IsZero() || deadline.Before(earliest) {
+				earliest = deadline
+			}
+		}
+		if !earliest.IsZero() {
+			start.Deadline = earliest.UnixNano()
+		}
+	}
+
+	return trackedTasks, trackedLRPs
+}
+
+func (e *AuctionExpiry) complete(results auctiontypes.AuctionResults) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	for _, tasks := range [][]auctiontypes.TaskAuction{results.SuccessfulTasks, results.FailedTasks} {
+		for i := range tasks {
+			delete(e.tasks, tasks[i].TaskGuid)
+		}
+	}
+	for _, lrps := range [][]auctiontypes.LRPAuction{results.SuccessfulLRPs, results.FailedLRPs} {
+		for i := range lrps {
+			delete(e.lrps, lrpKey{lrps[i].ProcessGuid, int(lrps[i].Index)})
+		}
+	}
+}
+
+// expireTasks splits tasks into those that may still run and those past their
+// deadline, and forgets the deadlines of the latter.
+func (e *AuctionExpiry) expireTasks(tasks []auctioneer.TaskStartRequest) ([]auctioneer.TaskStartRequest, []auctiontypes.TaskAuction) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	now := e.clock.Now()
+	live := make([]auctioneer.TaskStartRequest, 0, len(tasks))
+	expired := []auctiontypes.TaskAuction{}
+	for i := range tasks {
+		deadline, ok := e.tasks[tasks[i].TaskGuid]
+		if !ok || now.Before(deadline) {
+			live = append(live, tasks[i])
+			continue
+		}
+
+		delete(e.tasks, tasks[i].TaskGuid)
+		expired = append(expired, auctiontypes.TaskAuction{
+			Task:          tasks[i].Task,
+			AuctionRecord: auctiontypes.AuctionRecord{PlacementError: ErrAuctionExpired.Error()},
+		})
+	}
+	return live, expired
+}
+
+// expireLRPs splits the instances of lrps into those that may still run and
+// those past their deadline, and forgets the deadlines of the latter.
+func (e *AuctionExpiry) expireLRPs(lrps []auctioneer.LRPStartRequest) ([]auctioneer.LRPStartRequest, []auctiontypes.LRPAuction) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	now := e.clock.Now()
+	live := make([]auctioneer.LRPStartRequest, 0, len(lrps))
+	expired := []auctiontypes.LRPAuction{}
+	for i := range lrps {
+		start := lrps[i]
+		indices := make([]int, 0, len(start.Indices))
+		for _, index := range start.Indices {
+			key := lrpKey{start.ProcessGuid, index}
+			deadline, ok := e.lrps[key]
+			if !ok || now.Before(deadline) {
+				indices = append(indices, index)
+				continue
+			}
+
+			delete(e.lrps, key)
+			expired = append(expired, auctiontypes.LRPAuction{
+				LRP:           rep.NewLRP("", models.NewActualLRPKey(start.ProcessGuid, int32(index), start.Domain), start.Resource, start.PlacementConstraint),
+				AuctionRecord: auctiontypes.AuctionRecord{PlacementError: ErrAuctionExpired.Error()},
+			})
+		}
+
+		if len(indices) > 0 {
+			start.Indices = indices
+			live = append(live, start)
+		}
+	}
+	return live, expired
+}
+
+func (e *AuctionExpiry) reportExpired(delegate auctiontypes.AuctionRunnerDelegate, results auctiontypes.AuctionResults) {
+	expired := len(results.FailedTasks) + len(results.FailedLRPs)
+	if expired == 0 {
+		return
+	}
+
+	e.logger.Info("expired-auctions", lager.Data{"tasks": len(results.FailedTasks), "lrps": len(results.FailedLRPs)})
+	if e.metronClient != nil {
+		err := e.metronClient.IncrementCounterWithDelta(AuctionsExpiredCounter, uint64(expired))
+		if err != nil {
+			e.logger.Error("failed-to-increment-expired-counter", err)
+		}
+	}
+	delegate.AuctionCompleted(results)
+}
+
+type trackingRunner struct {
+	auctiontypes.AuctionRunner
+	expiry *AuctionExpiry
+}
+
+func (r *trackingRunner) ScheduleLRPsForAuctions(starts []auctioneer.LRPStartRequest) {
+	_, starts = r.expiry.track(nil, starts)
+	r.AuctionRunner.ScheduleLRPsForAuctions(starts)
+}
+
+func (r *trackingRunner) ScheduleTasksForAuctions(tasks []auctioneer.TaskStartRequest) {
+	tasks, _ = r.expiry.track(tasks, nil)
+	r.AuctionRunner.ScheduleTasksForAuctions(tasks)
+}
+
+type trackingDelegate struct {
+	auctiontypes.AuctionRunnerDelegate
+	expiry *AuctionExpiry
+}
+
+func (d *trackingDelegate) AuctionCompleted(results auctiontypes.AuctionResults) {
+	d.expiry.complete(results)
+	d.AuctionRunnerDelegate.AuctionCompleted(results)
+}
+
+type expiringRunner struct {
+	auctiontypes.AuctionRunner
+	delegate auctiontypes.AuctionRunnerDelegate
+	expiry   *AuctionExpiry
+}
+
+func (r *expiringRunner) ScheduleLRPsForAuctions(starts []auctioneer.LRPStartRequest) {
+	r.expiry.track(nil, starts)
+	live, expired := r.expiry.expireLRPs(starts)
+	r.expiry.reportExpired(r.delegate, auctiontypes.AuctionResults{FailedLRPs: expired})
+	if len(live) > 0 {
+		r.AuctionRunner.ScheduleLRPsForAuctions(live)
+	}
+}
+
+func (r *expiringRunner) ScheduleTasksForAuctions(tasks []auctioneer.TaskStartRequest) {
+	r.expiry.track(tasks, nil)
+	live, expired := r.expiry.expireTasks(tasks)
+	r.expiry.reportExpired(r.delegate, auctiontypes.AuctionResults{FailedTasks: expired})
+	if len(live) > 0 {
+		r.AuctionRunner.ScheduleTasksForAuctions(live)
+	}
+}
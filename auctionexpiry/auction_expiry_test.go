@@ -0,0 +1,267 @@
+package auctionexpiry_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/auction/auctiontypes"
+	fake_auction_runner "code.cloudfoundry.org/auction/auctiontypes/fakes"
+	"code.cloudfoundry.org/auctioneer"
+	"code.cloudfoundry.org/auctioneer/auctionexpiry"
+	"code.cloudfoundry.org/auctioneer/auctionlog"
+	"code.cloudfoundry.org/clock/fakeclock"
+	mfakes "code.cloudfoundry.org/diego-logging-client/testhelpers"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/rep"
+	"github.com/tedsuo/ifrit"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakeDelegate struct {
+	completed []auctiontypes.AuctionResults
+}
+
+func (d *fakeDelegate) FetchCellReps() (map[string]rep.Client, error) {
+	return map[string]rep.Client{}, nil
+}
+
+func (d *fakeDelegate) AuctionCompleted(results auctiontypes.AuctionResults) {
+	d.completed = append(d.completed, results)
+}
+
+var _ = Describe("AuctionExpiry", func() {
+	var (
+		clock            *fakeclock.FakeClock
+		fakeMetronClient *mfakes.FakeIngressClient
+		maxWait          time.Duration
+		expiry           *auctionexpiry.AuctionExpiry
+		innerRunner      *fake_auction_runner.FakeAuctionRunner
+		outerDelegate    *fakeDelegate
+		innerDelegate    *fakeDelegate
+		gate             auctiontypes.AuctionRunner
+		runner           auctiontypes.AuctionRunner
+		delegate         auctiontypes.AuctionRunnerDelegate
+		resource         rep.Resource
+		constraint       rep.PlacementConstraint
+	)
+
+	BeforeEach(func() {
+		clock = fakeclock.NewFakeClock(time.Now())
+		fakeMetronClient = &mfakes.FakeIngressClient{}
+		maxWait = time.Minute
+		innerRunner = new(fake_auction_runner.FakeAuctionRunner)
+		outerDelegate = &fakeDelegate{}
+		innerDelegate = &fakeDelegate{}
+		resource = rep.NewResource(10, 10, 10)
+		constraint = rep.NewPlacementConstraint("linux", []string{}, []string{})
+	})
+
+	JustBeforeEach(func() {
+		expiry = auctionexpiry.New(lagertest.NewTestLogger("test"), clock, fakeMetronClient, maxWait)
+		gate = expiry.Gate(innerRunner, outerDelegate)
+		runner = expiry.Runner(gate)
+		delegate = expiry.Delegate(innerDelegate)
+	})
+
+	Describe("tasks", func() {
+		var task auctioneer.TaskStartRequest
+
+		BeforeEach(func() {
+			task = auctioneer.NewTaskStartRequest(rep.NewTask("task-guid", "domain", resource, constraint))
+		})
+
+		It("runs tasks that are within their deadline", func() {
+			runner.ScheduleTasksForAuctions([]auctioneer.TaskStartRequest{task})
+
+			clock.Increment(59 * time.Second)
+			gate.ScheduleTasksForAuctions([]auctioneer.TaskStartRequest{task})
+
+			Expect(innerRunner.ScheduleTasksForAuctionsCallCount()).To(Equal(2))
+			Expect(outerDelegate.completed).To(BeEmpty())
+		})
+
+		It("fails tasks that wait past the max wait", func() {
+			runner.ScheduleTasksForAuctions([]auctioneer.TaskStartRequest{task})
+
+			clock.Increment(time.Minute)
+			gate.ScheduleTasksForAuctions([]auctioneer.TaskStartRequest{task})
+
+			Expect(innerRunner.ScheduleTasksForAuctionsCallCount()).To(Equal(1))
+			Expect(outerDelegate.completed).To(HaveLen(1))
+			failed := outerDelegate.completed[0].FailedTasks
+			Expect(failed).To(HaveLen(1))
+			Expect(failed[0].TaskGuid).To(Equal("task-guid"))
+			Expect(failed[0].PlacementError).To(Equal(auctionexpiry.ErrAuctionExpired.Error()))
+
+			Expect(fakeMetronClient.IncrementCounterWithDeltaCallCount()).To(Equal(1))
+			name, value := fakeMetronClient.IncrementCounterWithDeltaArgsForCall(0)
+			Expect(name).To(Equal(auctionexpiry.AuctionsExpiredCounter))
+			Expect(value).To(BeEquivalentTo(1))
+
+			tasks, _ := expiry.Pending()
+			Expect(tasks).To(Equal(0))
+		})
+
+		It("honours an earlier deadline set on the request", func() {
+			task.Deadline = clock.Now().Add(10 * time.Second).UnixNano()
+			runner.ScheduleTasksForAuctions([]auctioneer.TaskStartRequest{task})
+
+			clock.Increment(10 * time.Second)
+			gate.ScheduleTasksForAuctions([]auctioneer.TaskStartRequest{task})
+
+			Expect(innerRunner.ScheduleTasksForAuctionsCallCount()).To(Equal(1))
+			Expect(outerDelegate.completed).To(HaveLen(1))
+		})
+
+		It("sets the deadline on the tasks it schedules", func() {
+			tasks := []auctioneer.TaskStartRequest{task}
+			runner.ScheduleTasksForAuctions(tasks)
+
+			scheduled := innerRunner.ScheduleTasksForAuctionsArgsForCall(0)
+			Expect(scheduled[0].Deadline).To(Equal(clock.Now().Add(time.Minute).UnixNano()))
+			Expect(tasks[0].Deadline).To(BeZero())
+		})
+
+		It("forgets the deadline once the auction completes", func() {
+			runner.ScheduleTasksForAuctions([]auctioneer.TaskStartRequest{task})
+			delegate.AuctionCompleted(auctiontypes.AuctionResults{
+				SuccessfulTasks: []auctiontypes.TaskAuction{{Task: task.Task}},
+			})
+
+			Expect(innerDelegate.completed).To(HaveLen(1))
+			tasks, _ := expiry.Pending()
+			Expect(tasks).To(Equal(0))
+
+			clock.Increment(time.Hour)
+			runner.ScheduleTasksForAuctions([]auctioneer.TaskStartRequest{task})
+			Expect(innerRunner.ScheduleTasksForAuctionsCallCount()).To(Equal(2))
+		})
+
+		Context("without a max wait", func() {
+			BeforeEach(func() {
+				maxWait = 0
+			})
+
+			It("never expires tasks without a deadline", func() {
+				runner.ScheduleTasksForAuctions([]auctioneer.TaskStartRequest{task})
+
+				clock.Increment(time.Hour)
+				gate.ScheduleTasksForAuctions([]auctioneer.TaskStartRequest{task})
+
+				Expect(innerRunner.ScheduleTasksForAuctionsCallCount()).To(Equal(2))
+				tasks, _ := expiry.Pending()
+				Expect(tasks).To(Equal(0))
+			})
+		})
+	})
+
+	Describe("LRPs", func() {
+		It("fails only the instances past their deadline", func() {
+			runner.ScheduleLRPsForAuctions([]auctioneer.LRPStartRequest{
+				auctioneer.NewLRPStartRequest("process-guid", "domain", []int{0}, resource, constraint),
+			})
+			clock.Increment(30 * time.Second)
+			runner.ScheduleLRPsForAuctions([]auctioneer.LRPStartRequest{
+				auctioneer.NewLRPStartRequest("process-guid", "domain", []int{1}, resource, constraint),
+			})
+
+			clock.Increment(45 * time.Second)
+			gate.ScheduleLRPsForAuctions([]auctioneer.LRPStartRequest{
+				auctioneer.NewLRPStartRequest("process-guid", "domain", []int{0, 1}, resource, constraint),
+			})
+
+			Expect(innerRunner.ScheduleLRPsForAuctionsCallCount()).To(Equal(3))
+			Expect(innerRunner.ScheduleLRPsForAuctionsArgsForCall(2)[0].Indices).To(Equal([]int{1}))
+
+			Expect(outerDelegate.completed).To(HaveLen(1))
+			failed := outerDelegate.completed[0].FailedLRPs
+			Expect(failed).To(HaveLen(1))
+			Expect(failed[0].ProcessGuid).To(Equal("process-guid"))
+			Expect(failed[0].Index).To(BeEquivalentTo(0))
+			Expect(failed[0].Domain).To(Equal("domain"))
+			Expect(failed[0].PlacementError).To(Equal(auctionexpiry.ErrAuctionExpired.Error()))
+
+			_, lrps := expiry.Pending()
+			Expect(lrps).To(Equal(1))
+		})
+
+		It("sets the earliest deadline of the instances on the start requests it schedules", func() {
+			deadline := clock.Now().Add(time.Minute)
+			runner.ScheduleLRPsForAuctions([]auctioneer.LRPStartRequest{
+				auctioneer.NewLRPStartRequest("process-guid", "domain", []int{0}, resource, constraint),
+			})
+			clock.Increment(30 * time.Second)
+			runner.ScheduleLRPsForAuctions([]auctioneer.LRPStartRequest{
+				auctioneer.NewLRPStartRequest("process-guid", "domain", []int{0, 1}, resource, constraint),
+			})
+
+			Expect(innerRunner.ScheduleLRPsForAuctionsArgsForCall(1)[0].Deadline).To(Equal(deadline.UnixNano()))
+		})
+	})
+
+	Describe("auctions recovered from the auction log", func() {
+		var (
+			dir     string
+			store   *auctionlog.FileStore
+			process ifrit.Process
+		)
+
+		BeforeEach(func() {
+			innerRunner.RunStub = func(signals <-chan os.Signal, ready chan<- struct{}) error {
+				close(ready)
+				<-signals
+				return nil
+			}
+
+			var err error
+			dir, err = ioutil.TempDir("", "auction-expiry")
+			Expect(err).NotTo(HaveOccurred())
+
+			store, err = auctionlog.NewFileStore(filepath.Join(dir, "auctions.log"))
+			Expect(err).NotTo(HaveOccurred())
+
+			expired := auctioneer.NewTaskStartRequest(rep.NewTask("expired-task", "domain", resource, constraint))
+			expired.Deadline = clock.Now().Add(-time.Second).UnixNano()
+			live := auctioneer.NewTaskStartRequest(rep.NewTask("live-task", "domain", resource, constraint))
+			Expect(store.Append([]auctioneer.TaskStartRequest{expired, live}, nil)).To(Succeed())
+		})
+
+		JustBeforeEach(func() {
+			process = ifrit.Invoke(auctionlog.New(lagertest.NewTestLogger("test"), store, nil).Runner(gate))
+		})
+
+		AfterEach(func() {
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive())
+			store.Close()
+			os.RemoveAll(dir)
+		})
+
+		It("rejects those past their deadline", func() {
+			Expect(innerRunner.ScheduleTasksForAuctionsCallCount()).To(Equal(1))
+			scheduled := innerRunner.ScheduleTasksForAuctionsArgsForCall(0)
+			Expect(scheduled).To(HaveLen(1))
+			Expect(scheduled[0].TaskGuid).To(Equal("live-task"))
+
+			Expect(outerDelegate.completed).To(HaveLen(1))
+			failed := outerDelegate.completed[0].FailedTasks
+			Expect(failed).To(HaveLen(1))
+			Expect(failed[0].TaskGuid).To(Equal("expired-task"))
+			Expect(failed[0].PlacementError).To(Equal(auctionexpiry.ErrAuctionExpired.Error()))
+		})
+
+		It("applies the max wait from when they are recovered", func() {
+			tasks, _ := expiry.Pending()
+			Expect(tasks).To(Equal(1))
+
+			clock.Increment(time.Minute)
+			gate.ScheduleTasksForAuctions(innerRunner.ScheduleTasksForAuctionsArgsForCall(0))
+			Expect(outerDelegate.completed).To(HaveLen(2))
+			Expect(outerDelegate.completed[1].FailedTasks[0].TaskGuid).To(Equal("live-task"))
+		})
+	})
+})
@@ -0,0 +1,13 @@
+package auctionexpiry_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestAuctionexpiry(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Auction Expiry Suite")
+}
@@ -0,0 +1 @@
+package auctionexpiry // import "code.cloudfoundry.org/auctioneer/auctionexpiry"
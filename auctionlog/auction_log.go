@@ -0,0 +1,166 @@
+package auctionlog
+
+import (
+	"os"
+
+	"code.cloudfoundry.org/auction/auctiontypes"
+	"code.cloudfoundry.org/auctioneer"
+	"code.cloudfoundry.org/lager"
+)
+
+// LRPKey identifies a single LRP instance in the log.
+type LRPKey struct {
+	ProcessGuid string `json:"process_guid"`
+	Index       int    `json:"index"`
+}
+
+// Store persists auctions that were accepted but not placed yet. It is read
+// by the auctioneer that acquires the lock next, so that it can resume them
+// right away instead of waiting for BBS convergence.
+type Store interface {
+	Append(tasks []auctioneer.TaskStartRequest, lrps []auctioneer.LRPStartRequest) error
+	Complete(taskGuids []string, lrps []LRPKey) error
+	// Load returns the pending auctions. Stores may compact themselves while
+	// loading.
+	Load() ([]auctioneer.TaskStartRequest, []auctioneer.LRPStartRequest, error)
+}
+
+// AuctionLog writes scheduled auctions to a Store until the auction runner
+// delegate reports them completed.
+type AuctionLog struct {
+	logger lager.Logger
+	store  Store
+	fence  auctioneer.Fence
+}
+
+// New returns an AuctionLog writing to store. Failed auctions are only
+// completed while fence reports the lock held, as the delegate drops them
+// otherwise and the next leader has to run them again. A nil fence completes
+// them unconditionally.
+func New(logger lager.Logger, store Store, fence auctioneer.Fence) *AuctionLog {
+	return &AuctionLog{
+		logger: logger.Session("auction-log"),
+		store:  store,
+		fence:  fence,
+	}
+}
+
+// Delegate wraps the auction runner delegate so that completed auctions are
+// removed from the store once the delegate has handled them.
+func (l *AuctionLog) Delegate(delegate auctiontypes.AuctionRunnerDelegate) auctiontypes.AuctionRunnerDelegate {
+	return &loggingDelegate{
+		AuctionRunnerDelegate: delegate,
+		log:                   l,
+	}
+}
+
+// Runner wraps the auction runner so that scheduled auctions are written to
+// the store first. When started, it schedules the auctions left pending in
+// the store before running the auction runner.
+func (l *AuctionLog) Runner(runner auctiontypes.AuctionRunner) auctiontypes.AuctionRunner {
+	return &loggingRunner{
+		AuctionRunner: runner,
+		log:           l,
+	}
+}
+
+func (l *AuctionLog) recover(runner auctiontypes.AuctionRunner) {
+	logger := l.logger.Session("recover")
+
+	tasks, lrps, err := l.store.Load()
+	if err != nil {
+		logger.Error("failed-to-load", err)
+		return
+	}
+
+	logger.Info("recovered", lager.Data{"tasks": len(tasks), "lrps": len(lrps)})
+
+	if len(tasks) > 0 {
+		runner.ScheduleTasksForAuctions(tasks)
+	}
+	if len(lrps) > 0 {
+		runner.ScheduleLRPsForAuctions(lrps)
+	}
+}
+
+func (l *AuctionLog) holdsLock() bool {
+	if l.fence == nil {
+		return true
+	}
+	_, held := l.fence.FencingToken()
+	return held
+}
+
+type loggingDelegate struct {
+	auctiontypes.AuctionRunnerDelegate
+	log *AuctionLog
+}
+
+// AuctionCompleted checks the fence after the delegate has handled the
+// results, so that failures it may have dropped are kept in the log.
+func (d *loggingDelegate) AuctionCompleted(results auctiontypes.AuctionResults) {
+	d.AuctionRunnerDelegate.AuctionCompleted(results)
+
+	taskAuctions := [][]auctiontypes.TaskAuction{results.SuccessfulTasks}
+	lrpAuctions := [][]auctiontypes.LRPAuction{results.SuccessfulLRPs}
+	if d.log.holdsLock() {
+		taskAuctions = append(taskAuctions, results.FailedTasks)
+		lrpAuctions = append(lrpAuctions, results.FailedLRPs)
+	} else if len(results.FailedTasks) > 0 || len(results.FailedLRPs) > 0 {
+		d.log.logger.Info("keeping-failures-after-losing-lock", lager.Data{
+			"failed-tasks": len(results.FailedTasks),
+			"failed-lrps":  len(results.FailedLRPs),
+		})
+	}
+
+	taskGuids := []string{}
+	for _, tasks := range taskAuctions {
+		for i := range tasks {
+			taskGuids = append(taskGuids, tasks[i].TaskGuid)
+		}
+	}
+
+	lrps := []LRPKey{}
+	for _, auctions := range lrpAuctions {
+		for i := range auctions {
+			lrps = append(lrps, LRPKey{ProcessGuid: auctions[i].ProcessGuid, Index: int(auctions[i].Index)})
+		}
+	}
+
+	if len(taskGuids) == 0 && len(lrps) == 0 {
+		return
+	}
+
+	err := d.log.store.Complete(taskGuids, lrps)
+	if err != nil {
+		d.log.logger.Error("failed-to-complete", err, lager.Data{"tasks": len(taskGuids), "lrps": len(lrps)})
+	}
+}
+
+type loggingRunner struct {
+	auctiontypes.AuctionRunner
+	log *AuctionLog
+}
+
+// ScheduleLRPsForAuctions still schedules the auctions if they cannot be
+// written, as they are then no worse off than without a log.
+func (r *loggingRunner) ScheduleLRPsForAuctions(starts []auctioneer.LRPStartRequest) {
+	err := r.log.store.Append(nil, starts)
+	if err != nil {
+		r.log.logger.Error("failed-to-append-lrps", err, lager.Data{"lrps": len(starts)})
+	}
+	r.AuctionRunner.ScheduleLRPsForAuctions(starts)
+}
+
+func (r *loggingRunner) ScheduleTasksForAuctions(tasks []auctioneer.TaskStartRequest) {
+	err := r.log.store.Append(tasks, nil)
+	if err != nil {
+		r.log.logger.Error("failed-to-append-tasks", err, lager.Data{"tasks": len(tasks)})
+	}
+	r.AuctionRunner.ScheduleTasksForAuctions(tasks)
+}
+
+func (r *loggingRunner) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	r.log.recover(r.AuctionRunner)
+	return r.AuctionRunner.Run(signals, ready)
+}
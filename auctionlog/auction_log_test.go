@@ -0,0 +1,159 @@
+package auctionlog_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/auction/auctiontypes"
+	fake_auction_runner "code.cloudfoundry.org/auction/auctiontypes/fakes"
+	"code.cloudfoundry.org/auctioneer"
+	"code.cloudfoundry.org/auctioneer/auctionlog"
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/rep"
+	"github.com/tedsuo/ifrit"
+	"github.com/tedsuo/ifrit/ginkgomon"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakeDelegate struct {
+	completed []auctiontypes.AuctionResults
+}
+
+func (d *fakeDelegate) FetchCellReps() (map[string]rep.Client, error) {
+	return map[string]rep.Client{}, nil
+}
+
+func (d *fakeDelegate) AuctionCompleted(results auctiontypes.AuctionResults) {
+	d.completed = append(d.completed, results)
+}
+
+type fakeFence struct {
+	held bool
+}
+
+func (f *fakeFence) FencingToken() (uint64, bool) {
+	return 1, f.held
+}
+
+var _ = Describe("AuctionLog", func() {
+	var (
+		dir           string
+		store         *auctionlog.FileStore
+		auctionLog    *auctionlog.AuctionLog
+		innerRunner   *fake_auction_runner.FakeAuctionRunner
+		innerDelegate *fakeDelegate
+		fence         *fakeFence
+		runner        auctiontypes.AuctionRunner
+		delegate      auctiontypes.AuctionRunnerDelegate
+
+		task rep.Task
+		lrp  auctioneer.LRPStartRequest
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "auction-log")
+		Expect(err).NotTo(HaveOccurred())
+
+		store, err = auctionlog.NewFileStore(filepath.Join(dir, "auctions.log"))
+		Expect(err).NotTo(HaveOccurred())
+
+		innerRunner = new(fake_auction_runner.FakeAuctionRunner)
+		innerRunner.RunStub = func(signals <-chan os.Signal, ready chan<- struct{}) error {
+			close(ready)
+			<-signals
+			return nil
+		}
+		innerDelegate = &fakeDelegate{}
+		fence = &fakeFence{held: true}
+
+		auctionLog = auctionlog.New(lagertest.NewTestLogger("test"), store, fence)
+		runner = auctionLog.Runner(innerRunner)
+		delegate = auctionLog.Delegate(innerDelegate)
+
+		resource := rep.NewResource(10, 10, 10)
+		pc := rep.NewPlacementConstraint("linux", []string{}, []string{})
+		task = rep.NewTask("task-guid", "domain", resource, pc)
+		lrp = auctioneer.NewLRPStartRequest("process-guid", "domain", []int{0}, resource, pc)
+	})
+
+	AfterEach(func() {
+		store.Close()
+		os.RemoveAll(dir)
+	})
+
+	It("logs scheduled auctions before passing them to the auction runner", func() {
+		runner.ScheduleTasksForAuctions([]auctioneer.TaskStartRequest{{Task: task}})
+		runner.ScheduleLRPsForAuctions([]auctioneer.LRPStartRequest{lrp})
+
+		Expect(innerRunner.ScheduleTasksForAuctionsCallCount()).To(Equal(1))
+		Expect(innerRunner.ScheduleLRPsForAuctionsCallCount()).To(Equal(1))
+
+		tasks, lrps, err := store.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tasks).To(HaveLen(1))
+		Expect(lrps).To(HaveLen(1))
+	})
+
+	It("removes completed auctions from the log after the delegate handled them", func() {
+		runner.ScheduleTasksForAuctions([]auctioneer.TaskStartRequest{{Task: task}})
+		runner.ScheduleLRPsForAuctions([]auctioneer.LRPStartRequest{lrp})
+
+		results := auctiontypes.AuctionResults{
+			SuccessfulTasks: []auctiontypes.TaskAuction{{Task: task}},
+			FailedLRPs: []auctiontypes.LRPAuction{
+				{LRP: rep.NewLRP("", models.NewActualLRPKey("process-guid", 0, "domain"), lrp.Resource, lrp.PlacementConstraint)},
+			},
+		}
+		delegate.AuctionCompleted(results)
+		Expect(innerDelegate.completed).To(ConsistOf(results))
+
+		tasks, lrps, err := store.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tasks).To(BeEmpty())
+		Expect(lrps).To(BeEmpty())
+	})
+
+	It("keeps failed auctions after the lock is lost", func() {
+		runner.ScheduleTasksForAuctions([]auctioneer.TaskStartRequest{{Task: task}})
+		runner.ScheduleLRPsForAuctions([]auctioneer.LRPStartRequest{lrp})
+
+		fence.held = false
+		delegate.AuctionCompleted(auctiontypes.AuctionResults{
+			SuccessfulTasks: []auctiontypes.TaskAuction{{Task: task}},
+			FailedLRPs: []auctiontypes.LRPAuction{
+				{LRP: rep.NewLRP("", models.NewActualLRPKey("process-guid", 0, "domain"), lrp.Resource, lrp.PlacementConstraint)},
+			},
+		})
+
+		tasks, lrps, err := store.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tasks).To(BeEmpty())
+		Expect(lrps).To(HaveLen(1))
+	})
+
+	Context("when the log has pending auctions on start", func() {
+		var process ifrit.Process
+
+		BeforeEach(func() {
+			Expect(store.Append([]auctioneer.TaskStartRequest{{Task: task}}, []auctioneer.LRPStartRequest{lrp})).To(Succeed())
+			process = ginkgomon.Invoke(runner)
+		})
+
+		AfterEach(func() {
+			ginkgomon.Interrupt(process)
+		})
+
+		It("schedules them", func() {
+			Expect(innerRunner.ScheduleTasksForAuctionsCallCount()).To(Equal(1))
+			Expect(innerRunner.ScheduleTasksForAuctionsArgsForCall(0)).To(ConsistOf(auctioneer.TaskStartRequest{Task: task}))
+
+			Expect(innerRunner.ScheduleLRPsForAuctionsCallCount()).To(Equal(1))
+			Expect(innerRunner.ScheduleLRPsForAuctionsArgsForCall(0)).To(ConsistOf(lrp))
+		})
+	})
+})
@@ -0,0 +1,13 @@
+package auctionlog_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestAuctionlog(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Auction Log Suite")
+}
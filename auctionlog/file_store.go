@@ -0,0 +1,322 @@
+package auctionlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"code.cloudfoundry.org/auctioneer"
+)
+
+// record is a line of the file store. Each line either adds or completes
+// auctions.
+type record struct {
+	Tasks          []auctioneer.TaskStartRequest `json:"tasks,omitempty"`
+	LRPs           []auctioneer.LRPStartRequest  `json:"lrps,omitempty"`
+	CompletedTasks []string                      `json:"completed_tasks,omitempty"`
+	CompletedLRPs  []LRPKey                      `json:"completed_lrps,omitempty"`
+}
+
+// DefaultCompactionThreshold is the number of completed auctions after which
+// a FileStore rewrites its file.
+const DefaultCompactionThreshold = 10000
+
+// FileStore is a Store backed by an append-only file of JSON lines, which is
+// rewritten with only the pending auctions on Load and whenever enough
+// auctions have completed since the last rewrite. It suits single-node
+// deployments, where the restarted auctioneer reads the same disk.
+//
+// Every Append and Complete returns once its record is synced to disk, which
+// adds the latency of an fsync to the handlers scheduling auctions. Records
+// written concurrently share a single fsync, so that the cost is paid once
+// per batch of requests rather than once per request.
+type FileStore struct {
+	path                string
+	compactionThreshold int
+
+	// syncLock serializes fsyncs and rewrites, which replace the file. It is
+	// taken before lock.
+	syncLock sync.Mutex
+
+	lock      sync.Mutex
+	file      *os.File
+	written   uint64
+	synced    uint64
+	completed int
+	tasks     map[string]auctioneer.TaskStartRequest
+	lrps      map[LRPKey]auctioneer.LRPStartRequest
+}
+
+type FileStoreOption func(*FileStore)
+
+// WithCompactionThreshold rewrites the file once threshold auctions have
+// completed since the last rewrite, instead of DefaultCompactionThreshold.
+func WithCompactionThreshold(threshold int) FileStoreOption {
+	return func(s *FileStore) {
+		s.compactionThreshold = threshold
+	}
+}
+
+// NewFileStore opens the log at path, creating it if needed. A partially
+// written last line, as left by a crash, is dropped. Any other line that
+// cannot be parsed fails the load and leaves the file untouched, as the
+// auctions logged after it could otherwise be lost.
+func NewFileStore(path string, options ...FileStoreOption) (*FileStore, error) {
+	s := &FileStore{
+		path:                path,
+		compactionThreshold: DefaultCompactionThreshold,
+		tasks:               map[string]auctioneer.TaskStartRequest{},
+		lrps:                map[LRPKey]auctioneer.LRPStartRequest{},
+	}
+	for _, option := range options {
+		option(s)
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	line := 0
+	var corrupt error
+	for scanner.Scan() {
+		if corrupt != nil {
+			file.Close()
+			return nil, corrupt
+		}
+
+		line++
+		r := record{}
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			corrupt = fmt.Errorf("line %d of %s is corrupt: %s", line, path, err)
+			continue
+		}
+		s.apply(r)
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	file.Close()
+
+	if err := s.rewrite(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *FileStore) Append(tasks []auctioneer.TaskStartRequest, lrps []auctioneer.LRPStartRequest) error {
+	return s.write(record{Tasks: tasks, LRPs: lrps})
+}
+
+func (s *FileStore) Complete(taskGuids []string, lrps []LRPKey) error {
+	err := s.write(record{CompletedTasks: taskGuids, CompletedLRPs: lrps})
+	if err != nil {
+		return err
+	}
+
+	s.syncLock.Lock()
+	defer s.syncLock.Unlock()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.completed < s.compactionThreshold {
+		return nil
+	}
+	return s.rewrite()
+}
+
+func (s *FileStore) Load() ([]auctioneer.TaskStartRequest, []auctioneer.LRPStartRequest, error) {
+	s.syncLock.Lock()
+	defer s.syncLock.Unlock()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.rewrite(); err != nil {
+		return nil, nil, err
+	}
+
+	tasks, lrps := s.pending()
+	return tasks, lrps, nil
+}
+
+func (s *FileStore) Close() error {
+	s.syncLock.Lock()
+	defer s.syncLock.Unlock()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.file.Close()
+}
+
+func (s *FileStore) write(r record) error {
+	payload, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	if _, err := s.file.Write(append(payload, '\n')); err != nil {
+		s.lock.Unlock()
+		return err
+	}
+	s.apply(r)
+	s.completed += len(r.CompletedTasks) + len(r.CompletedLRPs)
+	s.written++
+	seq := s.written
+	s.lock.Unlock()
+
+	return s.sync(seq)
+}
+
+// sync returns once the record numbered seq is on disk. Whoever syncs first
+// syncs every record written so far, so writers waiting behind it usually
+// find their record synced already.
+func (s *FileStore) sync(seq uint64) error {
+	s.syncLock.Lock()
+	defer s.syncLock.Unlock()
+
+	s.lock.Lock()
+	file, written := s.file, s.written
+	synced := s.synced >= seq
+	s.lock.Unlock()
+
+	if synced {
+		return nil
+	}
+
+	if err := file.Sync(); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	s.synced = written
+	s.lock.Unlock()
+	return nil
+}
+
+func (s *FileStore) apply(r record) {
+	for i := range r.Tasks {
+		s.tasks[r.Tasks[i].TaskGuid] = r.Tasks[i]
+	}
+
+	for i := range r.LRPs {
+		for _, index := range r.LRPs[i].Indices {
+			start := r.LRPs[i]
+			start.Indices = []int{index}
+			s.lrps[LRPKey{ProcessGuid: start.ProcessGuid, Index: index}] = start
+		}
+	}
+
+	for _, guid := range r.CompletedTasks {
+		delete(s.tasks, guid)
+	}
+
+	for _, key := range r.CompletedLRPs {
+		delete(s.lrps, key)
+	}
+}
+
+func (s *FileStore) pending() ([]auctioneer.TaskStartRequest, []auctioneer.LRPStartRequest) {
+	tasks := make([]auctioneer.TaskStartRequest, 0, len(s.tasks))
+	for _, task := range s.tasks {
+		tasks = append(tasks, task)
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].TaskGuid < tasks[j].TaskGuid })
+
+	keys := make([]LRPKey, 0, len(s.lrps))
+	for key := range s.lrps {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].ProcessGuid != keys[j].ProcessGuid {
+			return keys[i].ProcessGuid < keys[j].ProcessGuid
+		}
+		return keys[i].Index < keys[j].Index
+	})
+
+	starts := make([]auctioneer.LRPStartRequest, 0, len(keys))
+	for _, key := range keys {
+		starts = append(starts, s.lrps[key])
+	}
+
+	lrps := []auctioneer.LRPStartRequest{}
+	for _, start := range auctioneer.MergeLRPStartRequests(starts) {
+		lrps = append(lrps, *start)
+	}
+
+	return tasks, lrps
+}
+
+// rewrite replaces the file with a record per pending auction and reopens it
+// for appending. Writing a record per auction keeps the lines short however
+// large the backlog grows.
+func (s *FileStore) rewrite() error {
+	tasks, lrps := s.pending()
+
+	tmp, err := os.OpenFile(s.path+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	records := make([]record, 0, len(tasks)+len(lrps))
+	for i := range tasks {
+		records = append(records, record{Tasks: tasks[i : i+1]})
+	}
+	for i := range lrps {
+		records = append(records, record{LRPs: lrps[i : i+1]})
+	}
+
+	writer := bufio.NewWriter(tmp)
+	for _, r := range records {
+		payload, err := json.Marshal(r)
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		if _, err := writer.Write(append(payload, '\n')); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if s.file != nil {
+		s.file.Close()
+	}
+
+	if err := os.Rename(s.path+".tmp", s.path); err != nil {
+		return err
+	}
+
+	if dir, err := os.Open(filepath.Dir(s.path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+
+	s.file, err = os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	s.synced = s.written
+	s.completed = 0
+	return nil
+}
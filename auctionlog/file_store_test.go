@@ -0,0 +1,221 @@
+package auctionlog_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"code.cloudfoundry.org/auctioneer"
+	"code.cloudfoundry.org/auctioneer/auctionlog"
+	"code.cloudfoundry.org/rep"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FileStore", func() {
+	var (
+		dir   string
+		path  string
+		store *auctionlog.FileStore
+
+		task auctioneer.TaskStartRequest
+		lrp  auctioneer.LRPStartRequest
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "auction-log")
+		Expect(err).NotTo(HaveOccurred())
+		path = filepath.Join(dir, "auctions.log")
+
+		store, err = auctionlog.NewFileStore(path)
+		Expect(err).NotTo(HaveOccurred())
+
+		resource := rep.NewResource(10, 10, 10)
+		pc := rep.NewPlacementConstraint("linux", []string{}, []string{})
+		task = auctioneer.NewTaskStartRequest(rep.NewTask("task-guid", "domain", resource, pc))
+		lrp = auctioneer.NewLRPStartRequest("process-guid", "domain", []int{0, 1, 2}, resource, pc)
+	})
+
+	AfterEach(func() {
+		store.Close()
+		os.RemoveAll(dir)
+	})
+
+	reopen := func() {
+		Expect(store.Close()).To(Succeed())
+
+		var err error
+		store, err = auctionlog.NewFileStore(path)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	It("starts empty", func() {
+		tasks, lrps, err := store.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tasks).To(BeEmpty())
+		Expect(lrps).To(BeEmpty())
+	})
+
+	It("returns the auctions that were not completed, across restarts", func() {
+		Expect(store.Append([]auctioneer.TaskStartRequest{task}, []auctioneer.LRPStartRequest{lrp})).To(Succeed())
+		Expect(store.Complete(nil, []auctionlog.LRPKey{{ProcessGuid: "process-guid", Index: 1}})).To(Succeed())
+
+		reopen()
+
+		tasks, lrps, err := store.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tasks).To(ConsistOf(task))
+		Expect(lrps).To(HaveLen(1))
+		Expect(lrps[0].ProcessGuid).To(Equal("process-guid"))
+		Expect(lrps[0].Indices).To(Equal([]int{0, 2}))
+		Expect(lrps[0].Resource).To(Equal(lrp.Resource))
+	})
+
+	It("forgets completed auctions", func() {
+		Expect(store.Append([]auctioneer.TaskStartRequest{task}, nil)).To(Succeed())
+		Expect(store.Complete([]string{"task-guid"}, nil)).To(Succeed())
+
+		reopen()
+
+		tasks, _, err := store.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tasks).To(BeEmpty())
+	})
+
+	It("compacts the file when loading", func() {
+		for i := 0; i < 10; i++ {
+			Expect(store.Append([]auctioneer.TaskStartRequest{task}, nil)).To(Succeed())
+			Expect(store.Complete([]string{"task-guid"}, nil)).To(Succeed())
+		}
+
+		_, _, err := store.Load()
+		Expect(err).NotTo(HaveOccurred())
+
+		info, err := os.Stat(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Size()).To(BeZero())
+	})
+
+	It("writes a line per pending auction when compacting", func() {
+		other := auctioneer.NewTaskStartRequest(rep.NewTask("other-task-guid", "domain", task.Resource, task.PlacementConstraint))
+		Expect(store.Append([]auctioneer.TaskStartRequest{task, other}, []auctioneer.LRPStartRequest{lrp})).To(Succeed())
+
+		_, _, err := store.Load()
+		Expect(err).NotTo(HaveOccurred())
+
+		contents, err := ioutil.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(strings.Split(strings.TrimSpace(string(contents)), "\n")).To(HaveLen(3))
+
+		reopen()
+
+		tasks, lrps, err := store.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tasks).To(ConsistOf(task, other))
+		Expect(lrps).To(HaveLen(1))
+		Expect(lrps[0].Indices).To(Equal([]int{0, 1, 2}))
+	})
+
+	It("keeps every auction appended concurrently", func() {
+		wg := sync.WaitGroup{}
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				start := auctioneer.NewTaskStartRequest(rep.NewTask(fmt.Sprintf("task-%d", i), "domain", task.Resource, task.PlacementConstraint))
+				Expect(store.Append([]auctioneer.TaskStartRequest{start}, nil)).To(Succeed())
+			}(i)
+		}
+		wg.Wait()
+
+		reopen()
+
+		tasks, _, err := store.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tasks).To(HaveLen(20))
+	})
+
+	Context("with a compaction threshold", func() {
+		BeforeEach(func() {
+			Expect(store.Close()).To(Succeed())
+
+			var err error
+			store, err = auctionlog.NewFileStore(path, auctionlog.WithCompactionThreshold(5))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("compacts the file once enough auctions have completed", func() {
+			Expect(store.Append(nil, []auctioneer.LRPStartRequest{lrp})).To(Succeed())
+			for i := 0; i < 5; i++ {
+				Expect(store.Append([]auctioneer.TaskStartRequest{task}, nil)).To(Succeed())
+				Expect(store.Complete([]string{"task-guid"}, nil)).To(Succeed())
+			}
+
+			contents, err := ioutil.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strings.Split(strings.TrimSpace(string(contents)), "\n")).To(HaveLen(1))
+
+			Expect(store.Append([]auctioneer.TaskStartRequest{task}, nil)).To(Succeed())
+			reopen()
+
+			tasks, lrps, err := store.Load()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tasks).To(ConsistOf(task))
+			Expect(lrps).To(HaveLen(1))
+		})
+	})
+
+	Context("when the last line was only partially written", func() {
+		BeforeEach(func() {
+			Expect(store.Append([]auctioneer.TaskStartRequest{task}, nil)).To(Succeed())
+			Expect(store.Close()).To(Succeed())
+
+			file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = file.WriteString(`{"completed_tasks":["task-gu`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(file.Close()).To(Succeed())
+
+			store, err = auctionlog.NewFileStore(path)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("ignores it", func() {
+			tasks, _, err := store.Load()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tasks).To(ConsistOf(task))
+		})
+	})
+
+	Context("when a line before the last is corrupt", func() {
+		var contents []byte
+
+		BeforeEach(func() {
+			Expect(store.Append([]auctioneer.TaskStartRequest{task}, nil)).To(Succeed())
+			Expect(store.Close()).To(Succeed())
+
+			file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = file.WriteString("{\"completed_tasks\":[\"task-gu\n{\"lrps\":[{\"process_guid\":\"process-guid\",\"indices\":[0]}]}\n")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(file.Close()).To(Succeed())
+
+			contents, err = ioutil.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("refuses to load the log and leaves it untouched", func() {
+			_, err := auctionlog.NewFileStore(path)
+			Expect(err).To(MatchError(ContainSubstring("line 2")))
+
+			Expect(ioutil.ReadFile(path)).To(Equal(contents))
+		})
+	})
+})
@@ -0,0 +1 @@
+package auctionlog // import "code.cloudfoundry.org/auctioneer/auctionlog"
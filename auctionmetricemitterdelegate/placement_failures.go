@@ -0,0 +1,188 @@
+package auctionmetricemitterdelegate
+
+import (
+	"strings"
+	"sync"
+
+	"code.cloudfoundry.org/auction/auctiontypes"
+	"code.cloudfoundry.org/auctioneer"
+	"code.cloudfoundry.org/auctioneer/auctionexpiry"
+	"code.cloudfoundry.org/auctioneer/domainquota"
+	loggingclient "code.cloudfoundry.org/diego-logging-client"
+	"code.cloudfoundry.org/rep"
+)
+
+// PlacementFailureCounters names the counter emitted for each placement
+// failure reason.
+var PlacementFailureCounters = map[auctioneer.PlacementFailureReason]string{
+	auctioneer.PlacementFailureInsufficientMemory:     "AuctioneerPlacementFailuresInsufficientMemory",
+	auctioneer.PlacementFailureInsufficientDisk:       "AuctioneerPlacementFailuresInsufficientDisk",
+	auctioneer.PlacementFailureInsufficientPids:       "AuctioneerPlacementFailuresInsufficientPids",
+	auctioneer.PlacementFailureInsufficientContainers: "AuctioneerPlacementFailuresInsufficientContainers",
+	auctioneer.PlacementFailureRootFSMismatch:         "AuctioneerPlacementFailuresRootFSMismatch",
+	auctioneer.PlacementFailurePlacementTagMismatch:   "AuctioneerPlacementFailuresPlacementTagMismatch",
+	auctioneer.PlacementFailureVolumeDriverMismatch:   "AuctioneerPlacementFailuresVolumeDriverMismatch",
+	auctioneer.PlacementFailureNoCells:                "AuctioneerPlacementFailuresNoCells",
+	auctioneer.PlacementFailureCellCommunication:      "AuctioneerPlacementFailuresCellCommunication",
+	auctioneer.PlacementFailureQuotaExceeded:          "AuctioneerPlacementFailuresQuotaExceeded",
+	auctioneer.PlacementFailureExpired:                "AuctioneerPlacementFailuresExpired",
+	auctioneer.PlacementFailureOther:                  "AuctioneerPlacementFailuresOther",
+}
+
+// placementFailureReasons lists the reasons in the order their counters are
+// emitted.
+var placementFailureReasons = []auctioneer.PlacementFailureReason{
+	auctioneer.PlacementFailureInsufficientMemory,
+	auctioneer.PlacementFailureInsufficientDisk,
+	auctioneer.PlacementFailureInsufficientPids,
+	auctioneer.PlacementFailureInsufficientContainers,
+	auctioneer.PlacementFailureRootFSMismatch,
+	auctioneer.PlacementFailurePlacementTagMismatch,
+	auctioneer.PlacementFailureVolumeDriverMismatch,
+	auctioneer.PlacementFailureNoCells,
+	auctioneer.PlacementFailureCellCommunication,
+	auctioneer.PlacementFailureQuotaExceeded,
+	auctioneer.PlacementFailureExpired,
+	auctioneer.PlacementFailureOther,
+}
+
+var insufficientResourcesReasons = map[string]auctioneer.PlacementFailureReason{
+	"memory":     auctioneer.PlacementFailureInsufficientMemory,
+	"disk":       auctioneer.PlacementFailureInsufficientDisk,
+	"pids":       auctioneer.PlacementFailureInsufficientPids,
+	"containers": auctioneer.PlacementFailureInsufficientContainers,
+}
+
+// ClassifyPlacementError returns the reasons behind a placement error
+// reported by the auction. An insufficient resources error yields one reason
+// per exhausted resource; errors it does not recognise are classified as
+// PlacementFailureOther. The auction reports a cell mismatch when it has no
+// cells at all, which only the caller can tell apart from a rootfs mismatch.
+func ClassifyPlacementError(placementError string) []auctioneer.PlacementFailureReason {
+	switch placementError {
+	case auctiontypes.ErrorCellMismatch.Error(), rep.ErrorIncompatibleRootfs.Error():
+		return []auctioneer.PlacementFailureReason{auctioneer.PlacementFailureRootFSMismatch}
+	case auctiontypes.ErrorPlacementTagMismatch.Error():
+		return []auctioneer.PlacementFailureReason{auctioneer.PlacementFailurePlacementTagMismatch}
+	case auctiontypes.ErrorVolumeDriverMismatch.Error():
+		return []auctioneer.PlacementFailureReason{auctioneer.PlacementFailureVolumeDriverMismatch}
+	case auctiontypes.ErrorCellCommunication.Error():
+		return []auctioneer.PlacementFailureReason{auctioneer.PlacementFailureCellCommunication}
+	case auctionexpiry.ErrAuctionExpired.Error():
+		return []auctioneer.PlacementFailureReason{auctioneer.PlacementFailureExpired}
+	}
+
+	if strings.HasPrefix(placementError, domainquota.ErrQuotaExceeded.Error()) {
+		return []auctioneer.PlacementFailureReason{auctioneer.PlacementFailureQuotaExceeded}
+	}
+
+	insufficientResources := rep.InsufficientResourcesError{}.Error()
+	if !strings.HasPrefix(placementError, insufficientResources) {
+		return []auctioneer.PlacementFailureReason{auctioneer.PlacementFailureOther}
+	}
+
+	reasons := []auctioneer.PlacementFailureReason{}
+	problems := strings.TrimPrefix(strings.TrimPrefix(placementError, insufficientResources), ":")
+	for _, problem := range strings.Split(problems, ",") {
+		if reason, ok := insufficientResourcesReasons[strings.TrimSpace(problem)]; ok {
+			reasons = append(reasons, reason)
+		}
+	}
+
+	if len(reasons) == 0 {
+		return []auctioneer.PlacementFailureReason{auctioneer.PlacementFailureOther}
+	}
+	return reasons
+}
+
+func classifyFailures(results auctiontypes.AuctionResults, noCells bool) map[auctioneer.PlacementFailureReason]uint64 {
+	classify := func(placementError string) []auctioneer.PlacementFailureReason {
+		if noCells && placementError == auctiontypes.ErrorCellMismatch.Error() {
+			return []auctioneer.PlacementFailureReason{auctioneer.PlacementFailureNoCells}
+		}
+		return ClassifyPlacementError(placementError)
+	}
+
+	counts := map[auctioneer.PlacementFailureReason]uint64{}
+	for _, lrp := range results.FailedLRPs {
+		for _, reason := range classify(lrp.PlacementError) {
+			counts[reason]++
+		}
+	}
+	for _, task := range results.FailedTasks {
+		for _, reason := range classify(task.PlacementError) {
+			counts[reason]++
+		}
+	}
+	return counts
+}
+
+// PlacementFailureRecorder counts failed placements by reason. Its delegate
+// counts the failures it is told about, so wrapped in an auction retrier it
+// only counts the failures that are not retried.
+type PlacementFailureRecorder struct {
+	metronClient      loggingclient.IngressClient
+	placementFailures *auctioneer.PlacementFailures
+
+	lock    sync.Mutex
+	noCells bool
+}
+
+// NewPlacementFailureRecorder emits a counter per reason and, unless
+// placementFailures is nil, records the counts in it.
+func NewPlacementFailureRecorder(metronClient loggingclient.IngressClient, placementFailures *auctioneer.PlacementFailures) *PlacementFailureRecorder {
+	return &PlacementFailureRecorder{
+		metronClient:      metronClient,
+		placementFailures: placementFailures,
+	}
+}
+
+// Delegate wraps the auction runner delegate to count the failed placements
+// and to tell whether the auction had any cells to place them on.
+func (r *PlacementFailureRecorder) Delegate(delegate auctiontypes.AuctionRunnerDelegate) auctiontypes.AuctionRunnerDelegate {
+	return &recordingDelegate{
+		AuctionRunnerDelegate: delegate,
+		recorder:              r,
+	}
+}
+
+func (r *PlacementFailureRecorder) fetched(cellReps map[string]rep.Client) {
+	r.lock.Lock()
+	r.noCells = len(cellReps) == 0
+	r.lock.Unlock()
+}
+
+func (r *PlacementFailureRecorder) record(results auctiontypes.AuctionResults) {
+	r.lock.Lock()
+	noCells := r.noCells
+	r.lock.Unlock()
+
+	failures := classifyFailures(results, noCells)
+	for _, reason := range placementFailureReasons {
+		count := failures[reason]
+		if count == 0 {
+			continue
+		}
+
+		r.metronClient.IncrementCounterWithDelta(PlacementFailureCounters[reason], count)
+		if r.placementFailures != nil {
+			r.placementFailures.Add(reason, count)
+		}
+	}
+}
+
+type recordingDelegate struct {
+	auctiontypes.AuctionRunnerDelegate
+	recorder *PlacementFailureRecorder
+}
+
+func (d *recordingDelegate) FetchCellReps() (map[string]rep.Client, error) {
+	cellReps, err := d.AuctionRunnerDelegate.FetchCellReps()
+	d.recorder.fetched(cellReps)
+	return cellReps, err
+}
+
+func (d *recordingDelegate) AuctionCompleted(results auctiontypes.AuctionResults) {
+	d.recorder.record(results)
+	d.AuctionRunnerDelegate.AuctionCompleted(results)
+}
@@ -0,0 +1,217 @@
+package auctionmetricemitterdelegate_test
+
+import (
+	"time"
+
+	"code.cloudfoundry.org/auction/auctiontypes"
+	"code.cloudfoundry.org/auctioneer"
+	"code.cloudfoundry.org/auctioneer/auctionexpiry"
+	"code.cloudfoundry.org/auctioneer/auctionmetricemitterdelegate"
+	"code.cloudfoundry.org/auctioneer/auctionretrier"
+	"code.cloudfoundry.org/auctioneer/domainquota"
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/clock/fakeclock"
+	mfakes "code.cloudfoundry.org/diego-logging-client/testhelpers"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/rep"
+	"code.cloudfoundry.org/rep/repfakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakeDelegate struct {
+	cellReps  map[string]rep.Client
+	completed []auctiontypes.AuctionResults
+}
+
+func (d *fakeDelegate) FetchCellReps() (map[string]rep.Client, error) {
+	return d.cellReps, nil
+}
+
+func (d *fakeDelegate) AuctionCompleted(results auctiontypes.AuctionResults) {
+	d.completed = append(d.completed, results)
+}
+
+var _ = Describe("PlacementFailureRecorder", func() {
+	var (
+		fakeMetronClient *mfakes.FakeIngressClient
+		innerDelegate    *fakeDelegate
+		failures         *auctioneer.PlacementFailures
+		delegate         auctiontypes.AuctionRunnerDelegate
+		resource         rep.Resource
+		pc               rep.PlacementConstraint
+	)
+
+	failedTask := func(guid, placementError string) auctiontypes.TaskAuction {
+		return auctiontypes.TaskAuction{
+			Task:          rep.NewTask(guid, "domain", resource, pc),
+			AuctionRecord: auctiontypes.AuctionRecord{PlacementError: placementError},
+		}
+	}
+
+	BeforeEach(func() {
+		fakeMetronClient = &mfakes.FakeIngressClient{}
+		innerDelegate = &fakeDelegate{cellReps: map[string]rep.Client{"cell-a": &repfakes.FakeClient{}}}
+		failures = auctioneer.NewPlacementFailures()
+		delegate = auctionmetricemitterdelegate.NewPlacementFailureRecorder(fakeMetronClient, failures).Delegate(innerDelegate)
+		resource = rep.NewResource(10, 10, 10)
+		pc = rep.NewPlacementConstraint("linux", []string{}, []string{})
+	})
+
+	It("emits and records a counter per failure reason", func() {
+		results := auctiontypes.AuctionResults{
+			FailedLRPs: []auctiontypes.LRPAuction{
+				{
+					LRP:           rep.NewLRP("", models.NewActualLRPKey("no-memory-or-disk", 0, "domain"), resource, pc),
+					AuctionRecord: auctiontypes.AuctionRecord{PlacementError: "insufficient resources: disk, memory"},
+				},
+				{
+					LRP:           rep.NewLRP("", models.NewActualLRPKey("no-tags", 0, "domain"), resource, pc),
+					AuctionRecord: auctiontypes.AuctionRecord{PlacementError: auctiontypes.ErrorPlacementTagMismatch.Error()},
+				},
+			},
+			FailedTasks: []auctiontypes.TaskAuction{failedTask("no-memory", "insufficient resources: memory")},
+		}
+		delegate.AuctionCompleted(results)
+
+		Expect(fakeMetronClient.IncrementCounterWithDeltaCallCount()).To(Equal(3))
+
+		name, value := fakeMetronClient.IncrementCounterWithDeltaArgsForCall(0)
+		Expect(name).To(Equal("AuctioneerPlacementFailuresInsufficientMemory"))
+		Expect(value).To(BeEquivalentTo(2))
+
+		name, value = fakeMetronClient.IncrementCounterWithDeltaArgsForCall(1)
+		Expect(name).To(Equal("AuctioneerPlacementFailuresInsufficientDisk"))
+		Expect(value).To(BeEquivalentTo(1))
+
+		name, value = fakeMetronClient.IncrementCounterWithDeltaArgsForCall(2)
+		Expect(name).To(Equal("AuctioneerPlacementFailuresPlacementTagMismatch"))
+		Expect(value).To(BeEquivalentTo(1))
+
+		Expect(failures.Counts()).To(Equal(map[auctioneer.PlacementFailureReason]uint64{
+			auctioneer.PlacementFailureInsufficientMemory:   2,
+			auctioneer.PlacementFailureInsufficientDisk:     1,
+			auctioneer.PlacementFailurePlacementTagMismatch: 1,
+		}))
+		Expect(innerDelegate.completed).To(Equal([]auctiontypes.AuctionResults{results}))
+	})
+
+	It("counts cell communication errors apart from having no cells", func() {
+		delegate.AuctionCompleted(auctiontypes.AuctionResults{
+			FailedTasks: []auctiontypes.TaskAuction{failedTask("unreachable", auctiontypes.ErrorCellCommunication.Error())},
+		})
+
+		Expect(failures.Counts()).To(Equal(map[auctioneer.PlacementFailureReason]uint64{
+			auctioneer.PlacementFailureCellCommunication: 1,
+		}))
+	})
+
+	Context("when the auction has cells", func() {
+		It("counts cell mismatches as rootfs mismatches", func() {
+			_, err := delegate.FetchCellReps()
+			Expect(err).NotTo(HaveOccurred())
+
+			delegate.AuctionCompleted(auctiontypes.AuctionResults{
+				FailedTasks: []auctiontypes.TaskAuction{failedTask("no-rootfs", auctiontypes.ErrorCellMismatch.Error())},
+			})
+
+			Expect(failures.Counts()).To(Equal(map[auctioneer.PlacementFailureReason]uint64{
+				auctioneer.PlacementFailureRootFSMismatch: 1,
+			}))
+		})
+	})
+
+	Context("when the auction has no cells", func() {
+		BeforeEach(func() {
+			innerDelegate.cellReps = map[string]rep.Client{}
+		})
+
+		It("counts the cell mismatches it reports as no cells", func() {
+			cellReps, err := delegate.FetchCellReps()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cellReps).To(BeEmpty())
+
+			delegate.AuctionCompleted(auctiontypes.AuctionResults{
+				FailedTasks: []auctiontypes.TaskAuction{failedTask("no-cells", auctiontypes.ErrorCellMismatch.Error())},
+			})
+
+			Expect(fakeMetronClient.IncrementCounterWithDeltaCallCount()).To(Equal(1))
+			name, value := fakeMetronClient.IncrementCounterWithDeltaArgsForCall(0)
+			Expect(name).To(Equal("AuctioneerPlacementFailuresNoCells"))
+			Expect(value).To(BeEquivalentTo(1))
+		})
+	})
+
+	Context("without placement failures to record", func() {
+		BeforeEach(func() {
+			delegate = auctionmetricemitterdelegate.NewPlacementFailureRecorder(fakeMetronClient, nil).Delegate(innerDelegate)
+		})
+
+		It("only emits the counters", func() {
+			delegate.AuctionCompleted(auctiontypes.AuctionResults{
+				FailedTasks: []auctiontypes.TaskAuction{failedTask("boom", "boom")},
+			})
+
+			Expect(fakeMetronClient.IncrementCounterWithDeltaCallCount()).To(Equal(1))
+			name, _ := fakeMetronClient.IncrementCounterWithDeltaArgsForCall(0)
+			Expect(name).To(Equal("AuctioneerPlacementFailuresOther"))
+		})
+	})
+
+	Context("behind an auction retrier", func() {
+		BeforeEach(func() {
+			retrier := auctionretrier.New(lagertest.NewTestLogger("test"), fakeclock.NewFakeClock(time.Now()), auctionretrier.Policy{MaxRetries: 1})
+			delegate = retrier.Delegate(delegate)
+		})
+
+		It("only counts the failures that are not retried", func() {
+			results := auctiontypes.AuctionResults{
+				FailedTasks: []auctiontypes.TaskAuction{failedTask("task-1", "insufficient resources: memory")},
+			}
+
+			delegate.AuctionCompleted(results)
+			Expect(fakeMetronClient.IncrementCounterWithDeltaCallCount()).To(Equal(0))
+
+			delegate.AuctionCompleted(results)
+			Expect(failures.Counts()).To(Equal(map[auctioneer.PlacementFailureReason]uint64{
+				auctioneer.PlacementFailureInsufficientMemory: 1,
+			}))
+		})
+	})
+})
+
+var _ = Describe("ClassifyPlacementError", func() {
+	It("returns a reason per insufficient resource", func() {
+		Expect(auctionmetricemitterdelegate.ClassifyPlacementError("insufficient resources: containers, disk, memory, pids")).To(Equal([]auctioneer.PlacementFailureReason{
+			auctioneer.PlacementFailureInsufficientContainers,
+			auctioneer.PlacementFailureInsufficientDisk,
+			auctioneer.PlacementFailureInsufficientMemory,
+			auctioneer.PlacementFailureInsufficientPids,
+		}))
+	})
+
+	It("classifies cell mismatches", func() {
+		Expect(auctionmetricemitterdelegate.ClassifyPlacementError(auctiontypes.ErrorCellMismatch.Error())).To(ConsistOf(auctioneer.PlacementFailureRootFSMismatch))
+		Expect(auctionmetricemitterdelegate.ClassifyPlacementError(auctiontypes.ErrorPlacementTagMismatch.Error())).To(ConsistOf(auctioneer.PlacementFailurePlacementTagMismatch))
+		Expect(auctionmetricemitterdelegate.ClassifyPlacementError(auctiontypes.ErrorVolumeDriverMismatch.Error())).To(ConsistOf(auctioneer.PlacementFailureVolumeDriverMismatch))
+	})
+
+	It("classifies unreachable cells as cell communication failures", func() {
+		Expect(auctionmetricemitterdelegate.ClassifyPlacementError(auctiontypes.ErrorCellCommunication.Error())).To(ConsistOf(auctioneer.PlacementFailureCellCommunication))
+	})
+
+	It("classifies auctions rejected by a domain quota", func() {
+		err := domainquota.QuotaExceededError{Domain: "cf-apps", Resource: "memory_mb", Requested: 512, InUse: 768, Limit: 1024}
+		Expect(auctionmetricemitterdelegate.ClassifyPlacementError(err.Error())).To(ConsistOf(auctioneer.PlacementFailureQuotaExceeded))
+	})
+
+	It("classifies auctions that outlived their deadline as expired", func() {
+		Expect(auctionmetricemitterdelegate.ClassifyPlacementError(auctionexpiry.ErrAuctionExpired.Error())).To(ConsistOf(auctioneer.PlacementFailureExpired))
+	})
+
+	It("classifies anything else as other", func() {
+		Expect(auctionmetricemitterdelegate.ClassifyPlacementError("insufficient resources")).To(ConsistOf(auctioneer.PlacementFailureOther))
+		Expect(auctionmetricemitterdelegate.ClassifyPlacementError("boom")).To(ConsistOf(auctioneer.PlacementFailureOther))
+	})
+})
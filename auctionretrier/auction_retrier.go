@@ -0,0 +1,414 @@
+package auctionretrier
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/auction/auctiontypes"
+	"code.cloudfoundry.org/auctioneer"
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/rep"
+	"github.com/tedsuo/ifrit"
+)
+
+const (
+	DefaultBackoff    = 5 * time.Second
+	DefaultMaxBackoff = 1 * time.Minute
+)
+
+// DefaultRetryableErrors are the placement errors that usually go away on
+// their own, once cells free up resources or can be reached again.
+var DefaultRetryableErrors = []string{
+	rep.InsufficientResourcesError{}.Error(),
+	auctiontypes.ErrorCellCommunication.Error(),
+}
+
+// Policy decides which failed auctions are retried and when. The first retry
+// waits Backoff and every further retry waits twice as long as the previous
+// one, up to MaxBackoff.
+type Policy struct {
+	MaxRetries int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// RetryableErrors are matched as prefixes of the placement error, so that
+	// "insufficient resources" also matches "insufficient resources: memory".
+	// DefaultRetryableErrors are used if empty.
+	RetryableErrors []string
+}
+
+type lrpKey struct {
+	processGuid string
+	index       int
+}
+
+type pendingRetry struct {
+	due   time.Time
+	tasks []auctioneer.TaskStartRequest
+	lrps  []auctioneer.LRPStartRequest
+}
+
+// AuctionRetrier schedules auctions that failed to place again after a
+// backoff instead of reporting them to the BBS right away, so that a
+// transient shortage of cells does not fail them for good. Auctions are only
+// reported as failed once they run out of retries, with the retries added to
+// their attempts.
+type AuctionRetrier struct {
+	logger lager.Logger
+	clock  clock.Clock
+	policy Policy
+
+	lock         sync.Mutex
+	taskAttempts map[string]int
+	lrpAttempts  map[lrpKey]int
+	taskStarts   map[string]auctioneer.TaskStartRequest
+	lrpStarts    map[lrpKey]auctioneer.LRPStartRequest
+	waiting      []pendingRetry
+	stopped      bool
+	added        chan struct{}
+}
+
+func New(logger lager.Logger, clock clock.Clock, policy Policy) *AuctionRetrier {
+	if policy.Backoff <= 0 {
+		policy.Backoff = DefaultBackoff
+	}
+	if policy.MaxBackoff < policy.Backoff {
+		policy.MaxBackoff = DefaultMaxBackoff
+		if policy.MaxBackoff < policy.Backoff {
+			policy.MaxBackoff = policy.Backoff
+		}
+	}
+	if len(policy.RetryableErrors) == 0 {
+		policy.RetryableErrors = DefaultRetryableErrors
+	}
+
+	return &AuctionRetrier{
+		logger:       logger.Session("auction-retrier"),
+		clock:        clock,
+		policy:       policy,
+		taskAttempts: map[string]int{},
+		lrpAttempts:  map[lrpKey]int{},
+		taskStarts:   map[string]auctioneer.TaskStartRequest{},
+		lrpStarts:    map[lrpKey]auctioneer.LRPStartRequest{},
+		added:        make(chan struct{}, 1),
+	}
+}
+
+// Waiting returns the number of tasks and LRP instances waiting for their
+// next retry.
+func (r *AuctionRetrier) Waiting() (int, int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	tasks, lrps := 0, 0
+	for i := range r.waiting {
+		tasks += len(r.waiting[i].tasks)
+		lrps += len(r.waiting[i].lrps)
+	}
+	return tasks, lrps
+}
+
+// Delegate wraps the auction runner delegate so that it is only told about
+// failed auctions once they will not be retried.
+func (r *AuctionRetrier) Delegate(delegate auctiontypes.AuctionRunnerDelegate) auctiontypes.AuctionRunnerDelegate {
+	return &retryingDelegate{
+		AuctionRunnerDelegate: delegate,
+		retrier:               r,
+	}
+}
+
+// Runner wraps the auction runner so that failed auctions are scheduled on it
+// again once their backoff expires. Retries are copies of the start requests
+// scheduled through the runner, so that they keep fields such as the deadline
+// that the auction results do not carry. A retry is scheduled at the deadline
+// of its start request if that comes before the backoff expires, so that
+// runner can fail it as expired. When signalled, auctions still waiting are
+// scheduled right away and no further retries are made.
+func (r *AuctionRetrier) Runner(runner auctiontypes.AuctionRunner) auctiontypes.AuctionRunner {
+	return &retryingRunner{
+		AuctionRunner: runner,
+		retrier:       r,
+	}
+}
+
+func (r *AuctionRetrier) backoff(retries int) time.Duration {
+	backoff := r.policy.Backoff
+	for i := 0; i < retries && backoff < r.policy.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > r.policy.MaxBackoff {
+		backoff = r.policy.MaxBackoff
+	}
+	return backoff
+}
+
+// remember keeps the start requests of newly scheduled auctions until they
+// complete.
+func (r *AuctionRetrier) remember(tasks []auctioneer.TaskStartRequest, lrps []auctioneer.LRPStartRequest) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for i := range tasks {
+		r.taskStarts[tasks[i].TaskGuid] = tasks[i]
+	}
+	for i := range lrps {
+		for _, index := range lrps[i].Indices {
+			r.lrpStarts[lrpKey{lrps[i].ProcessGuid, index}] = lrps[i]
+		}
+	}
+}
+
+// taskRetry returns the start request to retry task with.
+func (r *AuctionRetrier) taskRetry(task auctiontypes.TaskAuction) auctioneer.TaskStartRequest {
+	start, ok := r.taskStarts[task.TaskGuid]
+	if !ok {
+		return auctioneer.NewTaskStartRequest(task.Task)
+	}
+	start.Task = task.Task
+	return start
+}
+
+// lrpRetry returns the start request to retry the instance of lrp with.
+func (r *AuctionRetrier) lrpRetry(lrp auctiontypes.LRPAuction) auctioneer.LRPStartRequest {
+	start, ok := r.lrpStarts[lrpKey{lrp.ProcessGuid, int(lrp.Index)}]
+	if !ok {
+		return auctioneer.NewLRPStartRequest(lrp.ProcessGuid, lrp.Domain, []int{int(lrp.Index)}, lrp.Resource, lrp.PlacementConstraint)
+	}
+	start.Indices = []int{int(lrp.Index)}
+	return start
+}
+
+func (r *AuctionRetrier) retryable(placementError string) bool {
+	for _, retryableError := range r.policy.RetryableErrors {
+		if strings.HasPrefix(placementError, retryableError) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryFailures takes the auctions that can still be retried out of results
+// and queues them.
+func (r *AuctionRetrier) retryFailures(results auctiontypes.AuctionResults) auctiontypes.AuctionResults {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for i := range results.SuccessfulTasks {
+		delete(r.taskAttempts, results.SuccessfulTasks[i].TaskGuid)
+		delete(r.taskStarts, results.SuccessfulTasks[i].TaskGuid)
+	}
+	for i := range results.SuccessfulLRPs {
+		key := lrpKey{results.SuccessfulLRPs[i].ProcessGuid, int(results.SuccessfulLRPs[i].Index)}
+		delete(r.lrpAttempts, key)
+		delete(r.lrpStarts, key)
+	}
+
+	// A retry is due after its backoff or at the deadline of its start
+	// request, whichever comes first, so that auctions past their deadline do
+	// not wait out the backoff before the runner fails them.
+	now := r.clock.Now()
+	retries := map[time.Time]*pendingRetry{}
+	pending := func(retry int, deadline int64) *pendingRetry {
+		due := now.Add(r.backoff(retry))
+		if deadline > 0 && time.Unix(0, deadline).Before(due) {
+			due = time.Unix(0, deadline)
+		}
+		if _, ok := retries[due]; !ok {
+			retries[due] = &pendingRetry{due: due}
+		}
+		return retries[due]
+	}
+
+	failedTasks := make([]auctiontypes.TaskAuction, 0, len(results.FailedTasks))
+	for _, task := range results.FailedTasks {
+		retry := r.taskAttempts[task.TaskGuid]
+		if !r.stopped && retry < r.policy.MaxRetries && r.retryable(task.PlacementError) {
+			r.taskAttempts[task.TaskGuid] = retry + 1
+			start := r.taskRetry(task)
+			p := pending(retry, start.Deadline)
+			p.tasks = append(p.tasks, start)
+			continue
+		}
+
+		delete(r.taskAttempts, task.TaskGuid)
+		delete(r.taskStarts, task.TaskGuid)
+		if retry > 0 {
+			task.Attempts += retry
+			r.logger.Info("giving-up-on-task", lager.Data{
+				"task-guid":       task.TaskGuid,
+				"attempts":        task.Attempts,
+				"placement-error": task.PlacementError,
+			})
+		}
+		failedTasks = append(failedTasks, task)
+	}
+
+	failedLRPs := make([]auctiontypes.LRPAuction, 0, len(results.FailedLRPs))
+	for _, lrp := range results.FailedLRPs {
+		key := lrpKey{lrp.ProcessGuid, int(lrp.Index)}
+		retry := r.lrpAttempts[key]
+		if !r.stopped && retry < r.policy.MaxRetries && r.retryable(lrp.PlacementError) {
+			r.lrpAttempts[key] = retry + 1
+			start := r.lrpRetry(lrp)
+			p := pending(retry, start.Deadline)
+			p.lrps = append(p.lrps, start)
+			continue
+		}
+
+		delete(r.lrpAttempts, key)
+		delete(r.lrpStarts, key)
+		if retry > 0 {
+			lrp.Attempts += retry
+			r.logger.Info("giving-up-on-lrp", lager.Data{
+				"process-guid":    lrp.ProcessGuid,
+				"index":           lrp.Index,
+				"attempts":        lrp.Attempts,
+				"placement-error": lrp.PlacementError,
+			})
+		}
+		failedLRPs = append(failedLRPs, lrp)
+	}
+
+	if len(retries) > 0 {
+		for _, p := range retries {
+			r.logger.Debug("retrying", lager.Data{"tasks": len(p.tasks), "lrps": len(p.lrps), "due": p.due})
+			r.waiting = append(r.waiting, *p)
+		}
+
+		select {
+		case r.added <- struct{}{}:
+		default:
+		}
+	}
+
+	results.FailedTasks = failedTasks
+	results.FailedLRPs = failedLRPs
+	return results
+}
+
+// nextDue returns how long until the earliest waiting retry is due.
+func (r *AuctionRetrier) nextDue() (time.Duration, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if len(r.waiting) == 0 {
+		return 0, false
+	}
+
+	next := r.waiting[0].due
+	for i := range r.waiting {
+		if r.waiting[i].due.Before(next) {
+			next = r.waiting[i].due
+		}
+	}
+	return next.Sub(r.clock.Now()), true
+}
+
+// takeDue removes the retries that are due, or all of them if all is set.
+func (r *AuctionRetrier) takeDue(all bool) ([]auctioneer.TaskStartRequest, []auctioneer.LRPStartRequest) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := r.clock.Now()
+	tasks := []auctioneer.TaskStartRequest{}
+	lrps := []auctioneer.LRPStartRequest{}
+	waiting := r.waiting[:0]
+	for _, p := range r.waiting {
+		if !all && p.due.After(now) {
+			waiting = append(waiting, p)
+			continue
+		}
+		tasks = append(tasks, p.tasks...)
+		lrps = append(lrps, p.lrps...)
+	}
+	r.waiting = waiting
+
+	return tasks, lrps
+}
+
+func (r *AuctionRetrier) stop() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.stopped = true
+}
+
+func (r *AuctionRetrier) schedule(runner auctiontypes.AuctionRunner, all bool) {
+	tasks, lrps := r.takeDue(all)
+	if len(tasks) > 0 {
+		runner.ScheduleTasksForAuctions(tasks)
+	}
+	if len(lrps) > 0 {
+		runner.ScheduleLRPsForAuctions(lrps)
+	}
+}
+
+type retryingDelegate struct {
+	auctiontypes.AuctionRunnerDelegate
+	retrier *AuctionRetrier
+}
+
+func (d *retryingDelegate) AuctionCompleted(results auctiontypes.AuctionResults) {
+	d.AuctionRunnerDelegate.AuctionCompleted(d.retrier.retryFailures(results))
+}
+
+type retryingRunner struct {
+	auctiontypes.AuctionRunner
+	retrier *AuctionRetrier
+}
+
+func (r *retryingRunner) ScheduleLRPsForAuctions(starts []auctioneer.LRPStartRequest) {
+	r.retrier.remember(nil, starts)
+	r.AuctionRunner.ScheduleLRPsForAuctions(starts)
+}
+
+func (r *retryingRunner) ScheduleTasksForAuctions(tasks []auctioneer.TaskStartRequest) {
+	r.retrier.remember(tasks, nil)
+	r.AuctionRunner.ScheduleTasksForAuctions(tasks)
+}
+
+func (r *retryingRunner) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	process := ifrit.Background(r.AuctionRunner)
+	select {
+	case <-process.Ready():
+	case err := <-process.Wait():
+		return err
+	}
+
+	close(ready)
+
+	for {
+		var timer clock.Timer
+		var due <-chan time.Time
+		if wait, ok := r.retrier.nextDue(); ok {
+			timer = r.retrier.clock.NewTimer(wait)
+			due = timer.C()
+		}
+
+		select {
+		case <-r.retrier.added:
+		case <-due:
+			r.retrier.schedule(r.AuctionRunner, false)
+		case err := <-process.Wait():
+			stopTimer(timer)
+			return err
+		case signal := <-signals:
+			stopTimer(timer)
+			r.retrier.stop()
+			r.retrier.schedule(r.AuctionRunner, true)
+			process.Signal(signal)
+			return <-process.Wait()
+		}
+
+		stopTimer(timer)
+	}
+}
+
+func stopTimer(timer clock.Timer) {
+	if timer != nil {
+		timer.Stop()
+	}
+}
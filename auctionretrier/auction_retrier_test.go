@@ -0,0 +1,208 @@
+package auctionretrier_test
+
+import (
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/auction/auctiontypes"
+	fake_auction_runner "code.cloudfoundry.org/auction/auctiontypes/fakes"
+	"code.cloudfoundry.org/auctioneer"
+	"code.cloudfoundry.org/auctioneer/auctionretrier"
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/rep"
+	"github.com/tedsuo/ifrit"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakeDelegate struct {
+	completed []auctiontypes.AuctionResults
+}
+
+func (d *fakeDelegate) FetchCellReps() (map[string]rep.Client, error) {
+	return map[string]rep.Client{}, nil
+}
+
+func (d *fakeDelegate) AuctionCompleted(results auctiontypes.AuctionResults) {
+	d.completed = append(d.completed, results)
+}
+
+var _ = Describe("AuctionRetrier", func() {
+	var (
+		clock         *fakeclock.FakeClock
+		retrier       *auctionretrier.AuctionRetrier
+		innerRunner   *fake_auction_runner.FakeAuctionRunner
+		innerDelegate *fakeDelegate
+		delegate      auctiontypes.AuctionRunnerDelegate
+		runner        auctiontypes.AuctionRunner
+		process       ifrit.Process
+
+		task rep.Task
+		lrp  rep.LRP
+	)
+
+	failTask := func(placementError string) {
+		delegate.AuctionCompleted(auctiontypes.AuctionResults{
+			FailedTasks: []auctiontypes.TaskAuction{{
+				Task:          task,
+				AuctionRecord: auctiontypes.AuctionRecord{Attempts: 1, PlacementError: placementError},
+			}},
+		})
+	}
+
+	BeforeEach(func() {
+		clock = fakeclock.NewFakeClock(time.Now())
+		retrier = auctionretrier.New(lagertest.NewTestLogger("test"), clock, auctionretrier.Policy{
+			MaxRetries: 2,
+			Backoff:    10 * time.Second,
+			MaxBackoff: 15 * time.Second,
+		})
+
+		innerRunner = new(fake_auction_runner.FakeAuctionRunner)
+		innerRunner.RunStub = func(signals <-chan os.Signal, ready chan<- struct{}) error {
+			close(ready)
+			<-signals
+			return nil
+		}
+		innerDelegate = &fakeDelegate{}
+		delegate = retrier.Delegate(innerDelegate)
+
+		resource := rep.NewResource(10, 10, 10)
+		pc := rep.NewPlacementConstraint("linux", []string{}, []string{})
+		task = rep.NewTask("task-guid", "domain", resource, pc)
+		lrp = rep.NewLRP("", models.NewActualLRPKey("process-guid", 1, "domain"), resource, pc)
+
+		runner = retrier.Runner(innerRunner)
+		process = ifrit.Invoke(runner)
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive())
+	})
+
+	It("schedules retryable failures again after the backoff instead of reporting them", func() {
+		failTask("insufficient resources: memory")
+
+		Expect(innerDelegate.completed).To(HaveLen(1))
+		Expect(innerDelegate.completed[0].FailedTasks).To(BeEmpty())
+		Expect(retrier.Waiting()).To(Equal(1))
+
+		clock.WaitForWatcherAndIncrement(9 * time.Second)
+		Consistently(innerRunner.ScheduleTasksForAuctionsCallCount).Should(Equal(0))
+
+		clock.Increment(time.Second)
+		Eventually(innerRunner.ScheduleTasksForAuctionsCallCount).Should(Equal(1))
+		Expect(innerRunner.ScheduleTasksForAuctionsArgsForCall(0)).To(Equal([]auctioneer.TaskStartRequest{{Task: task}}))
+		Expect(retrier.Waiting()).To(Equal(0))
+	})
+
+	It("retries LRP instances", func() {
+		delegate.AuctionCompleted(auctiontypes.AuctionResults{
+			FailedLRPs: []auctiontypes.LRPAuction{{
+				LRP:           lrp,
+				AuctionRecord: auctiontypes.AuctionRecord{PlacementError: auctiontypes.ErrorCellCommunication.Error()},
+			}},
+		})
+		Expect(innerDelegate.completed[0].FailedLRPs).To(BeEmpty())
+
+		clock.WaitForWatcherAndIncrement(10 * time.Second)
+		Eventually(innerRunner.ScheduleLRPsForAuctionsCallCount).Should(Equal(1))
+		Expect(innerRunner.ScheduleLRPsForAuctionsArgsForCall(0)).To(Equal([]auctioneer.LRPStartRequest{
+			auctioneer.NewLRPStartRequest("process-guid", "domain", []int{1}, lrp.Resource, lrp.PlacementConstraint),
+		}))
+	})
+
+	It("retries copies of the scheduled start requests", func() {
+		deadline := clock.Now().Add(time.Hour).UnixNano()
+		runner.ScheduleTasksForAuctions([]auctioneer.TaskStartRequest{{Task: task, Deadline: deadline}})
+		start := auctioneer.NewLRPStartRequest("process-guid", "domain", []int{0, 1}, lrp.Resource, lrp.PlacementConstraint)
+		start.Deadline = deadline
+		runner.ScheduleLRPsForAuctions([]auctioneer.LRPStartRequest{start})
+
+		failTask("insufficient resources: memory")
+		delegate.AuctionCompleted(auctiontypes.AuctionResults{
+			FailedLRPs: []auctiontypes.LRPAuction{{
+				LRP:           lrp,
+				AuctionRecord: auctiontypes.AuctionRecord{PlacementError: auctiontypes.ErrorCellCommunication.Error()},
+			}},
+		})
+
+		clock.WaitForWatcherAndIncrement(10 * time.Second)
+		Eventually(innerRunner.ScheduleTasksForAuctionsCallCount).Should(Equal(2))
+		Expect(innerRunner.ScheduleTasksForAuctionsArgsForCall(1)).To(Equal([]auctioneer.TaskStartRequest{{Task: task, Deadline: deadline}}))
+
+		Eventually(innerRunner.ScheduleLRPsForAuctionsCallCount).Should(Equal(2))
+		retried := innerRunner.ScheduleLRPsForAuctionsArgsForCall(1)
+		Expect(retried).To(HaveLen(1))
+		Expect(retried[0].Indices).To(Equal([]int{1}))
+		Expect(retried[0].Deadline).To(Equal(deadline))
+	})
+
+	It("retries auctions at their deadline when it comes before the backoff", func() {
+		deadline := clock.Now().Add(4 * time.Second).UnixNano()
+		runner.ScheduleTasksForAuctions([]auctioneer.TaskStartRequest{{Task: task, Deadline: deadline}})
+		failTask("insufficient resources: memory")
+
+		clock.WaitForWatcherAndIncrement(3 * time.Second)
+		Consistently(innerRunner.ScheduleTasksForAuctionsCallCount).Should(Equal(1))
+
+		clock.Increment(time.Second)
+		Eventually(innerRunner.ScheduleTasksForAuctionsCallCount).Should(Equal(2))
+		Expect(innerRunner.ScheduleTasksForAuctionsArgsForCall(1)).To(Equal([]auctioneer.TaskStartRequest{{Task: task, Deadline: deadline}}))
+		Expect(retrier.Waiting()).To(Equal(0))
+	})
+
+	It("reports failures that cannot be retried right away", func() {
+		failTask(auctiontypes.ErrorCellMismatch.Error())
+
+		Expect(innerDelegate.completed[0].FailedTasks).To(HaveLen(1))
+		Expect(retrier.Waiting()).To(Equal(0))
+	})
+
+	It("reports failures once they run out of retries, with their attempts", func() {
+		failTask("insufficient resources: memory")
+		clock.WaitForWatcherAndIncrement(10 * time.Second)
+		Eventually(innerRunner.ScheduleTasksForAuctionsCallCount).Should(Equal(1))
+
+		failTask("insufficient resources: memory")
+		Expect(innerDelegate.completed[1].FailedTasks).To(BeEmpty())
+		clock.WaitForWatcherAndIncrement(14 * time.Second)
+		Consistently(innerRunner.ScheduleTasksForAuctionsCallCount).Should(Equal(1))
+		clock.Increment(time.Second)
+		Eventually(innerRunner.ScheduleTasksForAuctionsCallCount).Should(Equal(2))
+
+		failTask("insufficient resources: memory")
+		Expect(innerDelegate.completed[2].FailedTasks).To(HaveLen(1))
+		Expect(innerDelegate.completed[2].FailedTasks[0].Attempts).To(Equal(3))
+	})
+
+	It("starts over once an auction succeeds", func() {
+		failTask("insufficient resources: memory")
+		clock.WaitForWatcherAndIncrement(10 * time.Second)
+		Eventually(innerRunner.ScheduleTasksForAuctionsCallCount).Should(Equal(1))
+
+		delegate.AuctionCompleted(auctiontypes.AuctionResults{
+			SuccessfulTasks: []auctiontypes.TaskAuction{{Task: task}},
+		})
+
+		failTask("insufficient resources: memory")
+		clock.WaitForWatcherAndIncrement(10 * time.Second)
+		Eventually(innerRunner.ScheduleTasksForAuctionsCallCount).Should(Equal(2))
+	})
+
+	Context("when signalled", func() {
+		It("schedules the waiting retries right away and stops retrying", func() {
+			failTask("insufficient resources: memory")
+
+			process.Signal(os.Interrupt)
+			Eventually(innerRunner.ScheduleTasksForAuctionsCallCount).Should(Equal(1))
+
+			failTask("insufficient resources: memory")
+			Expect(innerDelegate.completed[1].FailedTasks).To(HaveLen(1))
+		})
+	})
+})
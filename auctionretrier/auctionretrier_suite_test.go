@@ -0,0 +1,13 @@
+package auctionretrier_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestAuctionretrier(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Auction Retrier Suite")
+}
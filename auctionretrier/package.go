@@ -0,0 +1 @@
+package auctionretrier // import "code.cloudfoundry.org/auctioneer/auctionretrier"
@@ -1,7 +1,15 @@
 package auctionrunnerdelegate
 
 import (
+	"sort"
+	"time"
+
+	"code.cloudfoundry.org/auctioneer"
+	"code.cloudfoundry.org/auctioneer/bbsoutbox"
 	"code.cloudfoundry.org/bbs"
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/clock"
+	loggingclient "code.cloudfoundry.org/diego-logging-client"
 	"code.cloudfoundry.org/rep"
 
 	"code.cloudfoundry.org/auction/auctiontypes"
@@ -12,45 +20,322 @@ type AuctionRunnerDelegate struct {
 	repClientFactory rep.ClientFactory
 	bbsClient        bbs.InternalClient
 	logger           lager.Logger
+	fence            auctioneer.Fence
+	clock            clock.Clock
+	refreshInterval  time.Duration
+	metronClient     loggingclient.IngressClient
+	quarantineConfig *CellQuarantineConfig
+	outbox           Outbox
+	filters          CellFilters
+	domainFilters    map[string]CellFilters
+	orderings        CellOrderings
+	scope            *domainScope
+	registry         *cellRegistry
+	quarantine       *cellQuarantine
+}
+
+type Option func(*AuctionRunnerDelegate)
+
+// Outbox delivers failed auctions to the BBS on behalf of the delegate.
+type Outbox interface {
+	Enqueue(logger lager.Logger, callbacks []bbsoutbox.Callback) error
+}
+
+// WithFence stops auctions from reaching the cells and the BBS once this
+// auctioneer knows that the leadership term they started in has ended. The
+// term is logged with every rep and BBS call so that calls racing a change of
+// leader can be told apart.
+func WithFence(fence auctioneer.Fence) Option {
+	return func(a *AuctionRunnerDelegate) {
+		a.fence = fence
+	}
+}
+
+// WithCellRefreshInterval reuses the list of cells fetched from the BBS for
+// interval. Without it the list is fetched for every auction. Rep clients are
+// reused either way for as long as their cell keeps its address.
+func WithCellRefreshInterval(clock clock.Clock, interval time.Duration) Option {
+	return func(a *AuctionRunnerDelegate) {
+		a.clock = clock
+		a.refreshInterval = interval
+	}
+}
+
+// WithCellQuarantine skips cells whose state could not be fetched in several
+// auctions in a row, so that an unresponsive cell does not hold up every
+// auction for the cell state timeout.
+func WithCellQuarantine(config CellQuarantineConfig) Option {
+	return func(a *AuctionRunnerDelegate) {
+		a.quarantineConfig = &config
+	}
+}
+
+// WithOutbox reports failed auctions to the BBS through outbox, which keeps
+// retrying them while the BBS cannot be reached. The BBS is called directly
+// if the outbox cannot take them.
+func WithOutbox(outbox Outbox) Option {
+	return func(a *AuctionRunnerDelegate) {
+		a.outbox = outbox
+	}
+}
+
+// WithCellFilters only offers auctions the cells allowed by every filter, in
+// order. Cells that are filtered out are still listed by Cells.
+func WithCellFilters(filters ...CellFilter) Option {
+	return func(a *AuctionRunnerDelegate) {
+		a.filters = append(a.filters, filters...)
+	}
+}
+
+// WithDomainCellFilters only offers the auctions of domains the cells allowed
+// by every filter, in order, on top of the filters of WithCellFilters. The
+// auctions must be scheduled through Runner, and the auction runner must report
+// to Delegate, for these filters to apply. Cells list the domains they are
+// filtered out for.
+func WithDomainCellFilters(domains []string, filters ...CellFilter) Option {
+	return func(a *AuctionRunnerDelegate) {
+		if a.domainFilters == nil {
+			a.domainFilters = map[string]CellFilters{}
+		}
+		for _, domain := range domains {
+			a.domainFilters[domain] = append(a.domainFilters[domain], filters...)
+		}
+	}
+}
+
+// WithCellOrderings prefers cells by every ordering, in order, among the cells
+// offered to auctions. The auction only takes the order into account with a
+// bin pack first fit weight, as it is reported to the auction as the index of
+// the cells.
+func WithCellOrderings(orderings ...CellOrdering) Option {
+	return func(a *AuctionRunnerDelegate) {
+		a.orderings = append(a.orderings, orderings...)
+	}
+}
+
+// WithMetronClient emits metrics about the cell registry and quarantine.
+func WithMetronClient(metronClient loggingclient.IngressClient) Option {
+	return func(a *AuctionRunnerDelegate) {
+		a.metronClient = metronClient
+	}
 }
 
 func New(
 	repClientFactory rep.ClientFactory,
 	bbsClient bbs.InternalClient,
 	logger lager.Logger,
+	opts ...Option,
 ) *AuctionRunnerDelegate {
-	return &AuctionRunnerDelegate{
+	a := &AuctionRunnerDelegate{
 		repClientFactory: repClientFactory,
 		bbsClient:        bbsClient,
 		logger:           logger,
+		clock:            clock.NewClock(),
 	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	a.registry = newCellRegistry(a.clock, a.refreshInterval, repClientFactory, bbsClient, a.metronClient)
+	if a.quarantineConfig != nil {
+		a.quarantine = newCellQuarantine(*a.quarantineConfig, a.clock, a.metronClient)
+	}
+	if len(a.domainFilters) > 0 {
+		a.scope = newDomainScope()
+	}
+
+	return a
 }
 
 func (a *AuctionRunnerDelegate) FetchCellReps() (map[string]rep.Client, error) {
-	cells, err := a.bbsClient.Cells(a.logger)
+	logger := a.logger
 	cellReps := map[string]rep.Client{}
+
+	var token uint64
+	if a.fence != nil {
+		var ok bool
+		token, ok = a.fence.FencingToken()
+		if !ok {
+			return cellReps, auctioneer.ErrLeadershipLost
+		}
+		logger = logger.WithData(lager.Data{"leadership-term": token})
+	}
+
+	registered, err := a.registry.registeredCells(logger)
 	if err != nil {
 		return cellReps, err
 	}
 
-	for _, cell := range cells {
-		client, err := a.repClientFactory.CreateClient(cell.RepAddress, cell.RepUrl)
-		if err != nil {
-			a.logger.Error("create-rep-client-failed", err)
+	if a.quarantine != nil {
+		a.quarantine.retain(registered)
+	}
+
+	filters := a.filters
+	if a.scope != nil {
+		if domain := a.scope.current(); domain != "" {
+			filters = append(append(CellFilters{}, a.filters...), a.domainFilters[domain]...)
+			logger = logger.WithData(lager.Data{"domain": domain})
+		}
+	}
+
+	filteredOut := 0
+	for cellID, cell := range registered {
+		if filter := filters.deniedBy(cell.presence); filter != nil {
+			logger.Debug("skipping-filtered-cell", lager.Data{"cell-id": cellID, "filter": filter.Name()})
+			filteredOut++
 			continue
 		}
-		cellReps[cell.CellId] = client
+
+		client := cell.client
+		if a.quarantine != nil {
+			if _, ok := a.quarantine.quarantined(cellID); ok {
+				logger.Debug("skipping-quarantined-cell", lager.Data{"cell-id": cellID})
+				continue
+			}
+			client = &monitoredRepClient{Client: client, cellID: cellID, quarantine: a.quarantine}
+		}
+		if a.fence != nil {
+			client = &termRepClient{Client: client, fence: a.fence, token: token}
+		}
+		cellReps[cellID] = client
+	}
+
+	if len(filters) > 0 && a.metronClient != nil {
+		a.metronClient.SendMetric(CellsFilteredOut, filteredOut)
 	}
 
+	a.orderCells(registered, cellReps)
 	return cellReps, nil
 }
 
+// Cells lists the registered cells along with the filter that excludes them
+// and their quarantine, if any.
+func (a *AuctionRunnerDelegate) Cells(logger lager.Logger) ([]auctioneer.Cell, error) {
+	registered, err := a.registry.registeredCells(logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.listCells(registered), nil
+}
+
+// CandidateCells lists the registered cells like Cells, along with the rep
+// clients of the cells auctions are offered. Unlike FetchCellReps it neither
+// records the outcome of state fetches in the quarantine nor emits metrics, so
+// that looking at the cells does not change how auctions are run.
+func (a *AuctionRunnerDelegate) CandidateCells(logger lager.Logger) (map[string]rep.Client, []auctioneer.Cell, error) {
+	registered, err := a.registry.registeredCells(logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cells := a.listCells(registered)
+	cellReps := map[string]rep.Client{}
+	for _, cell := range cells {
+		if cell.FilteredBy == "" && cell.Quarantine == nil {
+			cellReps[cell.CellID] = registered[cell.CellID].client
+		}
+	}
+	a.orderCells(registered, cellReps)
+
+	return cellReps, cells, nil
+}
+
+// orderCells moves the index each of cellReps reports past the cells it is
+// ordered after. The index of a cell is at most the number of cells when they
+// are numbered from zero, as BOSH does, so that many indices are left for the
+// cells of each position.
+func (a *AuctionRunnerDelegate) orderCells(registered map[string]registeredCell, cellReps map[string]rep.Client) {
+	if len(a.orderings) == 0 {
+		return
+	}
+
+	cells := make(map[string]*models.CellPresence, len(cellReps))
+	for cellID := range cellReps {
+		cells[cellID] = registered[cellID].presence
+	}
+	for cellID, position := range a.orderings.positions(cells) {
+		if position > 0 {
+			cellReps[cellID] = &rankedRepClient{Client: cellReps[cellID], offset: position * len(registered)}
+		}
+	}
+}
+
+func (a *AuctionRunnerDelegate) listCells(registered map[string]registeredCell) []auctioneer.Cell {
+	cells := make([]auctioneer.Cell, 0, len(registered))
+	for cellID, registeredCell := range registered {
+		cell := auctioneer.Cell{
+			CellID:     cellID,
+			RepAddress: registeredCell.repAddress,
+			RepURL:     registeredCell.repURL,
+		}
+		if filter := a.filters.deniedBy(registeredCell.presence); filter != nil {
+			cell.FilteredBy = filter.Name()
+		}
+		cell.FilteredForDomains = a.deniedDomains(registeredCell.presence)
+		if a.quarantine != nil {
+			cell.Quarantine, _ = a.quarantine.quarantined(cellID)
+		}
+		cells = append(cells, cell)
+	}
+
+	sort.Slice(cells, func(i, j int) bool { return cells[i].CellID < cells[j].CellID })
+	return cells
+}
+
+// ClearCellQuarantine lets the next auction try cellID again and reports
+// whether the cell was quarantined.
+func (a *AuctionRunnerDelegate) ClearCellQuarantine(logger lager.Logger, cellID string) bool {
+	if a.quarantine == nil {
+		return false
+	}
+
+	cleared := a.quarantine.clear(cellID)
+	if cleared {
+		logger.Info("cleared-cell-quarantine", lager.Data{"cell-id": cellID})
+	}
+	return cleared
+}
+
 func (a *AuctionRunnerDelegate) AuctionCompleted(results auctiontypes.AuctionResults) {
+	logger := a.logger
+	if a.fence != nil {
+		token, ok := a.fence.FencingToken()
+		if !ok {
+			a.logger.Info("dropping-results-after-losing-lock", lager.Data{
+				"failed-tasks": len(results.FailedTasks),
+				"failed-lrps":  len(results.FailedLRPs),
+			})
+			return
+		}
+		logger = logger.WithData(lager.Data{"leadership-term": token})
+	}
+
+	if a.outbox != nil {
+		callbacks := make([]bbsoutbox.Callback, 0, len(results.FailedTasks)+len(results.FailedLRPs))
+		for i := range results.FailedTasks {
+			task := &results.FailedTasks[i]
+			callbacks = append(callbacks, bbsoutbox.RejectTask(task.TaskGuid, task.PlacementError))
+		}
+		for i := range results.FailedLRPs {
+			lrp := &results.FailedLRPs[i]
+			key := lrp.ActualLRPKey
+			callbacks = append(callbacks, bbsoutbox.FailActualLRP(&key, lrp.PlacementError))
+		}
+
+		err := a.outbox.Enqueue(logger, callbacks)
+		if err == nil {
+			return
+		}
+		logger.Error("failed-to-enqueue-callbacks", err)
+	}
+
 	for i := range results.FailedTasks {
 		task := &results.FailedTasks[i]
-		err := a.bbsClient.RejectTask(a.logger, task.TaskGuid, task.PlacementError)
+		err := a.bbsClient.RejectTask(logger, task.TaskGuid, task.PlacementError)
 		if err != nil {
-			a.logger.Error("failed-to-reject-task", err, lager.Data{
+			logger.Error("failed-to-reject-task", err, lager.Data{
 				"task":           task,
 				"auction-result": "failed",
 			})
@@ -59,9 +344,9 @@ func (a *AuctionRunnerDelegate) AuctionCompleted(results auctiontypes.AuctionRes
 
 	for i := range results.FailedLRPs {
 		lrp := &results.FailedLRPs[i]
-		err := a.bbsClient.FailActualLRP(a.logger, &lrp.ActualLRPKey, lrp.PlacementError)
+		err := a.bbsClient.FailActualLRP(logger, &lrp.ActualLRPKey, lrp.PlacementError)
 		if err != nil {
-			a.logger.Error("failed-to-fail-LRP", err, lager.Data{
+			logger.Error("failed-to-fail-LRP", err, lager.Data{
 				"lrp":            lrp,
 				"auction-result": "failed",
 			})
@@ -2,17 +2,23 @@ package auctionrunnerdelegate_test
 
 import (
 	"errors"
+	"time"
 
 	"code.cloudfoundry.org/auction/auctiontypes"
+	fake_auction_runner "code.cloudfoundry.org/auction/auctiontypes/fakes"
 	"code.cloudfoundry.org/bbs/fake_bbs"
 	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/clock/fakeclock"
+	mfakes "code.cloudfoundry.org/diego-logging-client/testhelpers"
 	"code.cloudfoundry.org/rep"
 	"code.cloudfoundry.org/rep/repfakes"
 
 	"code.cloudfoundry.org/lager"
 	"code.cloudfoundry.org/lager/lagertest"
 
+	"code.cloudfoundry.org/auctioneer"
 	"code.cloudfoundry.org/auctioneer/auctionrunnerdelegate"
+	"code.cloudfoundry.org/auctioneer/bbsoutbox"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -212,4 +218,554 @@ var _ = Describe("Auction Runner Delegate", func() {
 			Expect(errorMessage1).To(Equal(auctiontypes.ErrorCellMismatch.Error()))
 		})
 	})
+
+	Describe("reporting failures through an outbox", func() {
+		var outbox *fakeOutbox
+
+		BeforeEach(func() {
+			outbox = &fakeOutbox{}
+			delegate = auctionrunnerdelegate.New(repClientFactory, bbsClient, logger, auctionrunnerdelegate.WithOutbox(outbox))
+		})
+
+		JustBeforeEach(func() {
+			delegate.AuctionCompleted(auctiontypes.AuctionResults{
+				FailedTasks: []auctiontypes.TaskAuction{{
+					Task:          rep.Task{TaskGuid: "failed-task"},
+					AuctionRecord: auctiontypes.AuctionRecord{PlacementError: "insufficient resources"},
+				}},
+				FailedLRPs: []auctiontypes.LRPAuction{{
+					LRP:           rep.LRP{ActualLRPKey: models.NewActualLRPKey("failed-lrp", 1, "domain")},
+					AuctionRecord: auctiontypes.AuctionRecord{PlacementError: "found no compatible cell"},
+				}},
+			})
+		})
+
+		It("enqueues all of them at once instead of calling the BBS", func() {
+			lrpKey := models.NewActualLRPKey("failed-lrp", 1, "domain")
+			Expect(outbox.enqueued).To(Equal([][]bbsoutbox.Callback{{
+				bbsoutbox.RejectTask("failed-task", "insufficient resources"),
+				bbsoutbox.FailActualLRP(&lrpKey, "found no compatible cell"),
+			}}))
+			Expect(bbsClient.RejectTaskCallCount()).To(Equal(0))
+			Expect(bbsClient.FailActualLRPCallCount()).To(Equal(0))
+		})
+
+		Context("when the outbox cannot take them", func() {
+			BeforeEach(func() {
+				outbox.err = errors.New("disk full")
+			})
+
+			It("calls the BBS directly", func() {
+				Expect(bbsClient.RejectTaskCallCount()).To(Equal(1))
+				Expect(bbsClient.FailActualLRPCallCount()).To(Equal(1))
+			})
+		})
+	})
+
+	Describe("cell registry", func() {
+		var (
+			clock            *fakeclock.FakeClock
+			fakeMetronClient *mfakes.FakeIngressClient
+			cellA, cellB     models.CellPresence
+		)
+
+		BeforeEach(func() {
+			clock = fakeclock.NewFakeClock(time.Now())
+			fakeMetronClient = &mfakes.FakeIngressClient{}
+
+			delegate = auctionrunnerdelegate.New(
+				repClientFactory,
+				bbsClient,
+				logger,
+				auctionrunnerdelegate.WithCellRefreshInterval(clock, time.Minute),
+				auctionrunnerdelegate.WithMetronClient(fakeMetronClient),
+			)
+
+			cellA = models.NewCellPresence("cell-A", "cell-a.url", "", "zone-1", models.NewCellCapacity(123, 456, 789), []string{}, []string{}, []string{}, []string{})
+			cellB = models.NewCellPresence("cell-B", "cell-b.url", "", "zone-1", models.NewCellCapacity(123, 456, 789), []string{}, []string{}, []string{}, []string{})
+			bbsClient.CellsReturns([]*models.CellPresence{&cellA, &cellB}, nil)
+
+			_, err := delegate.FetchCellReps()
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("reuses the cells until the refresh interval has passed", func() {
+			reps, err := delegate.FetchCellReps()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reps).To(HaveLen(2))
+			Expect(bbsClient.CellsCallCount()).To(Equal(1))
+
+			clock.Increment(time.Minute)
+
+			_, err = delegate.FetchCellReps()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bbsClient.CellsCallCount()).To(Equal(2))
+		})
+
+		It("only creates rep clients for new or moved cells", func() {
+			cellB.RepAddress = "cell-b-moved.url"
+			cellC := models.NewCellPresence("cell-C", "cell-c.url", "", "zone-1", models.NewCellCapacity(123, 456, 789), []string{}, []string{}, []string{}, []string{})
+			bbsClient.CellsReturns([]*models.CellPresence{&cellA, &cellB, &cellC}, nil)
+			clock.Increment(time.Minute)
+
+			reps, err := delegate.FetchCellReps()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reps).To(HaveLen(3))
+
+			Expect(repClientFactory.CreateClientCallCount()).To(Equal(4))
+			movedAddr, _ := repClientFactory.CreateClientArgsForCall(2)
+			newAddr, _ := repClientFactory.CreateClientArgsForCall(3)
+			Expect([]string{movedAddr, newAddr}).To(ConsistOf("cell-b-moved.url", "cell-c.url"))
+		})
+
+		It("drops the cells that disappeared", func() {
+			bbsClient.CellsReturns([]*models.CellPresence{&cellA}, nil)
+			clock.Increment(time.Minute)
+
+			reps, err := delegate.FetchCellReps()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reps).To(HaveLen(1))
+			Expect(reps).To(HaveKey("cell-A"))
+		})
+
+		It("emits metrics about the refresh", func() {
+			Expect(fakeMetronClient.SendDurationCallCount()).To(Equal(1))
+			name, _, _ := fakeMetronClient.SendDurationArgsForCall(0)
+			Expect(name).To(Equal(auctionrunnerdelegate.CellRegistryRefreshDuration))
+
+			Expect(fakeMetronClient.SendMetricCallCount()).To(Equal(1))
+			name, value, _ := fakeMetronClient.SendMetricArgsForCall(0)
+			Expect(name).To(Equal(auctionrunnerdelegate.CellRegistryCells))
+			Expect(value).To(Equal(2))
+		})
+
+		Context("when the refresh fails", func() {
+			BeforeEach(func() {
+				bbsClient.CellsReturns(nil, errors.New("boom"))
+				clock.Increment(time.Minute)
+			})
+
+			It("returns the error and counts the failure", func() {
+				_, err := delegate.FetchCellReps()
+				Expect(err).To(MatchError("boom"))
+
+				Expect(fakeMetronClient.IncrementCounterCallCount()).To(Equal(1))
+				name := fakeMetronClient.IncrementCounterArgsForCall(0)
+				Expect(name).To(Equal(auctionrunnerdelegate.CellRegistryRefreshFailedCounter))
+			})
+		})
+	})
+
+	Describe("cell filters", func() {
+		var fakeMetronClient *mfakes.FakeIngressClient
+
+		BeforeEach(func() {
+			fakeMetronClient = &mfakes.FakeIngressClient{}
+
+			delegate = auctionrunnerdelegate.New(
+				repClientFactory,
+				bbsClient,
+				logger,
+				auctionrunnerdelegate.WithMetronClient(fakeMetronClient),
+				auctionrunnerdelegate.WithCellFilters(
+					auctionrunnerdelegate.NewLabelExclusionFilter("gpu"),
+					auctionrunnerdelegate.NewCellIDDenyList("cell-C"),
+				),
+			)
+
+			cellA := models.NewCellPresence("cell-A", "cell-a.url", "", "zone-1", models.NewCellCapacity(123, 456, 789), []string{}, []string{}, []string{}, []string{})
+			cellB := models.NewCellPresence("cell-B", "cell-b.url", "", "zone-1", models.NewCellCapacity(123, 456, 789), []string{}, []string{}, []string{}, []string{"gpu"})
+			cellC := models.NewCellPresence("cell-C", "cell-c.url", "", "zone-1", models.NewCellCapacity(123, 456, 789), []string{}, []string{}, []string{}, []string{})
+			bbsClient.CellsReturns([]*models.CellPresence{&cellA, &cellB, &cellC}, nil)
+		})
+
+		It("only offers the cells every filter allows", func() {
+			cellReps, err := delegate.FetchCellReps()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cellReps).To(HaveLen(1))
+			Expect(cellReps).To(HaveKey("cell-A"))
+
+			Expect(fakeMetronClient.SendMetricCallCount()).To(BeNumerically(">", 0))
+			name, value, _ := fakeMetronClient.SendMetricArgsForCall(fakeMetronClient.SendMetricCallCount() - 1)
+			Expect(name).To(Equal(auctionrunnerdelegate.CellsFilteredOut))
+			Expect(value).To(Equal(2))
+		})
+
+		It("lists the filter that excludes each cell", func() {
+			cells, err := delegate.Cells(logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cells).To(HaveLen(3))
+			Expect(cells[0].FilteredBy).To(BeEmpty())
+			Expect(cells[1].FilteredBy).To(Equal("label-exclusion"))
+			Expect(cells[2].FilteredBy).To(Equal("cell-id-deny-list"))
+		})
+
+		Context("when filters are scoped to domains", func() {
+			var fakeRunner *fake_auction_runner.FakeAuctionRunner
+
+			BeforeEach(func() {
+				fakeRunner = new(fake_auction_runner.FakeAuctionRunner)
+				delegate = auctionrunnerdelegate.New(
+					repClientFactory,
+					bbsClient,
+					logger,
+					auctionrunnerdelegate.WithMetronClient(fakeMetronClient),
+					auctionrunnerdelegate.WithCellFilters(auctionrunnerdelegate.NewCellIDDenyList("cell-C")),
+					auctionrunnerdelegate.WithDomainCellFilters([]string{"batch"}, auctionrunnerdelegate.NewLabelExclusionFilter("gpu")),
+				)
+				repClient.StateStub = func(lager.Logger) (rep.CellState, error) {
+					return rep.CellState{OptionalPlacementTags: []string{"ssd"}}, nil
+				}
+			})
+
+			It("offers the cells every filter allows while no scoped domain is in flight", func() {
+				cellReps, err := delegate.FetchCellReps()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(cellReps).To(HaveLen(2))
+				Expect(cellReps).To(HaveKey("cell-A"))
+				Expect(cellReps).To(HaveKey("cell-B"))
+			})
+
+			It("offers the cells the domain in flight allows", func() {
+				runner := delegate.Runner(fakeRunner)
+				task := auctioneer.NewTaskStartRequest(rep.NewTask("task-guid", "batch", rep.NewResource(10, 10, 10), rep.NewPlacementConstraint("rootfs", []string{"ssd"}, nil)))
+				runner.ScheduleTasksForAuctions([]auctioneer.TaskStartRequest{task})
+
+				cellReps, err := delegate.FetchCellReps()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(cellReps).To(HaveLen(1))
+				Expect(cellReps).To(HaveKey("cell-A"))
+			})
+
+			It("holds other domains back until the batch in flight completes", func() {
+				runner := delegate.Runner(fakeRunner)
+				completed := &fakeAuctionRunnerDelegate{}
+				runnerDelegate := delegate.Delegate(completed)
+
+				task := auctioneer.NewTaskStartRequest(rep.NewTask("task-guid", "batch", rep.NewResource(10, 10, 10), rep.NewPlacementConstraint("rootfs", []string{"ssd"}, nil)))
+				runner.ScheduleTasksForAuctions([]auctioneer.TaskStartRequest{task})
+				lrp := auctioneer.LRPStartRequest{ProcessGuid: "process-guid", Domain: "cf-apps", Indices: []int{0}}
+				runner.ScheduleLRPsForAuctions([]auctioneer.LRPStartRequest{lrp})
+
+				Expect(fakeRunner.ScheduleTasksForAuctionsCallCount()).To(Equal(1))
+				Expect(fakeRunner.ScheduleLRPsForAuctionsCallCount()).To(Equal(0))
+
+				results := auctiontypes.AuctionResults{
+					SuccessfulTasks: []auctiontypes.TaskAuction{{Task: task.Task}},
+				}
+				runnerDelegate.AuctionCompleted(results)
+				Expect(completed.completed).To(Equal([]auctiontypes.AuctionResults{results}))
+
+				Expect(fakeRunner.ScheduleLRPsForAuctionsCallCount()).To(Equal(1))
+				Expect(fakeRunner.ScheduleLRPsForAuctionsArgsForCall(0)).To(Equal([]auctioneer.LRPStartRequest{lrp}))
+
+				cellReps, err := delegate.FetchCellReps()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(cellReps).To(HaveLen(2))
+			})
+
+			It("leaves the placement constraints of the auctions alone", func() {
+				runner := delegate.Runner(fakeRunner)
+				task := auctioneer.NewTaskStartRequest(rep.NewTask("task-guid", "batch", rep.NewResource(10, 10, 10), rep.NewPlacementConstraint("rootfs", []string{"ssd"}, nil)))
+				runner.ScheduleTasksForAuctions([]auctioneer.TaskStartRequest{task})
+
+				Expect(fakeRunner.ScheduleTasksForAuctionsArgsForCall(0)).To(Equal([]auctioneer.TaskStartRequest{task}))
+			})
+
+			It("lists the domains each cell is filtered out for", func() {
+				cells, err := delegate.Cells(logger)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(cells).To(HaveLen(3))
+				Expect(cells[0].FilteredForDomains).To(BeEmpty())
+				Expect(cells[1].FilteredBy).To(BeEmpty())
+				Expect(cells[1].FilteredForDomains).To(Equal([]string{"batch"}))
+				Expect(cells[2].FilteredBy).To(Equal("cell-id-deny-list"))
+			})
+		})
+	})
+
+	Describe("cell orderings", func() {
+		var cellAClient, cellBClient *repfakes.FakeClient
+
+		BeforeEach(func() {
+			cellAClient = &repfakes.FakeClient{}
+			cellAClient.StateReturns(rep.CellState{CellIndex: 0}, nil)
+			cellBClient = &repfakes.FakeClient{}
+			cellBClient.StateReturns(rep.CellState{CellIndex: 1}, nil)
+			repClientFactory.CreateClientStub = func(address, url string) (rep.Client, error) {
+				if address == "cell-a.url" {
+					return cellAClient, nil
+				}
+				return cellBClient, nil
+			}
+
+			delegate = auctionrunnerdelegate.New(
+				repClientFactory,
+				bbsClient,
+				logger,
+				auctionrunnerdelegate.WithCellOrderings(auctionrunnerdelegate.NewLabelPreference("cached-images")),
+			)
+
+			cellA := models.NewCellPresence("cell-A", "cell-a.url", "", "zone-1", models.NewCellCapacity(123, 456, 789), []string{}, []string{}, []string{}, []string{})
+			cellB := models.NewCellPresence("cell-B", "cell-b.url", "", "zone-1", models.NewCellCapacity(123, 456, 789), []string{}, []string{}, []string{}, []string{"cached-images"})
+			bbsClient.CellsReturns([]*models.CellPresence{&cellA, &cellB}, nil)
+		})
+
+		It("moves the index of the cells ordered last past the others", func() {
+			cellReps, err := delegate.FetchCellReps()
+			Expect(err).NotTo(HaveOccurred())
+
+			state, err := cellReps["cell-B"].State(logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(state.CellIndex).To(Equal(1))
+
+			state, err = cellReps["cell-A"].State(logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(state.CellIndex).To(Equal(2))
+		})
+
+		It("orders the candidate cells alike", func() {
+			cellReps, _, err := delegate.CandidateCells(logger)
+			Expect(err).NotTo(HaveOccurred())
+
+			state, err := cellReps["cell-A"].State(logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(state.CellIndex).To(Equal(2))
+		})
+
+		It("leaves the index alone when every cell is ordered alike", func() {
+			cellB := models.NewCellPresence("cell-B", "cell-b.url", "", "zone-1", models.NewCellCapacity(123, 456, 789), []string{}, []string{}, []string{}, []string{})
+			cellA := models.NewCellPresence("cell-A", "cell-a.url", "", "zone-1", models.NewCellCapacity(123, 456, 789), []string{}, []string{}, []string{}, []string{})
+			bbsClient.CellsReturns([]*models.CellPresence{&cellA, &cellB}, nil)
+
+			cellReps, err := delegate.FetchCellReps()
+			Expect(err).NotTo(HaveOccurred())
+
+			state, err := cellReps["cell-A"].State(logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(state.CellIndex).To(Equal(0))
+		})
+	})
+
+	Describe("cell quarantine", func() {
+		var (
+			clock            *fakeclock.FakeClock
+			fakeMetronClient *mfakes.FakeIngressClient
+		)
+
+		fetchStates := func() map[string]rep.Client {
+			reps, err := delegate.FetchCellReps()
+			Expect(err).NotTo(HaveOccurred())
+			for _, client := range reps {
+				client.State(logger)
+			}
+			return reps
+		}
+
+		BeforeEach(func() {
+			clock = fakeclock.NewFakeClock(time.Now())
+			fakeMetronClient = &mfakes.FakeIngressClient{}
+
+			delegate = auctionrunnerdelegate.New(
+				repClientFactory,
+				bbsClient,
+				logger,
+				auctionrunnerdelegate.WithCellRefreshInterval(clock, time.Hour),
+				auctionrunnerdelegate.WithMetronClient(fakeMetronClient),
+				auctionrunnerdelegate.WithCellQuarantine(auctionrunnerdelegate.CellQuarantineConfig{
+					Threshold:    2,
+					BaseDuration: 10 * time.Second,
+					MaxDuration:  30 * time.Second,
+				}),
+			)
+
+			cellPresence := models.NewCellPresence("cell-A", "cell-a.url", "", "zone-1", models.NewCellCapacity(123, 456, 789), []string{}, []string{}, []string{}, []string{})
+			bbsClient.CellsReturns([]*models.CellPresence{&cellPresence}, nil)
+			repClient.StateReturns(rep.CellState{}, errors.New("timed out"))
+		})
+
+		It("keeps auctioning onto a cell until it fails the threshold", func() {
+			fetchStates()
+			Expect(fetchStates()).To(HaveKey("cell-A"))
+			Expect(repClient.StateCallCount()).To(Equal(2))
+		})
+
+		It("skips the cell for the quarantine once it reaches the threshold", func() {
+			fetchStates()
+			fetchStates()
+			Expect(fetchStates()).To(BeEmpty())
+
+			Expect(fakeMetronClient.IncrementCounterCallCount()).To(Equal(1))
+			Expect(fakeMetronClient.IncrementCounterArgsForCall(0)).To(Equal(auctionrunnerdelegate.CellQuarantineEventsCounter))
+
+			clock.Increment(10 * time.Second)
+			Expect(fetchStates()).To(HaveKey("cell-A"))
+		})
+
+		It("doubles the quarantine for every further failure up to the maximum", func() {
+			fetchStates()
+			fetchStates()
+
+			clock.Increment(10 * time.Second)
+			fetchStates()
+			clock.Increment(19 * time.Second)
+			Expect(fetchStates()).To(BeEmpty())
+			clock.Increment(time.Second)
+			fetchStates()
+
+			clock.Increment(29 * time.Second)
+			Expect(fetchStates()).To(BeEmpty())
+			clock.Increment(time.Second)
+			Expect(fetchStates()).To(HaveKey("cell-A"))
+		})
+
+		It("forgets the failures once the cell responds", func() {
+			fetchStates()
+			repClient.StateReturns(rep.CellState{}, nil)
+			fetchStates()
+			repClient.StateReturns(rep.CellState{}, errors.New("timed out"))
+			fetchStates()
+
+			Expect(fetchStates()).To(HaveKey("cell-A"))
+		})
+
+		It("emits the number of quarantined cells", func() {
+			fetchStates()
+			fetchStates()
+			fetchStates()
+
+			name, value, _ := fakeMetronClient.SendMetricArgsForCall(fakeMetronClient.SendMetricCallCount() - 1)
+			Expect(name).To(Equal(auctionrunnerdelegate.QuarantinedCells))
+			Expect(value).To(Equal(1))
+		})
+
+		It("lists the quarantine with the cells", func() {
+			fetchStates()
+			fetchStates()
+
+			cells, err := delegate.Cells(logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cells).To(Equal([]auctioneer.Cell{{
+				CellID:     "cell-A",
+				RepAddress: "cell-a.url",
+				Quarantine: &auctioneer.CellQuarantine{
+					ConsecutiveFailures: 2,
+					Until:               clock.Now().Add(10 * time.Second),
+				},
+			}}))
+		})
+
+		It("lists the candidate cells without affecting the quarantine", func() {
+			fetchStates()
+			metricsSent := fakeMetronClient.SendMetricCallCount()
+
+			for i := 0; i < 2; i++ {
+				reps, cells, err := delegate.CandidateCells(logger)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(reps).To(HaveKeyWithValue("cell-A", repClient))
+				Expect(cells).To(ConsistOf(auctioneer.Cell{CellID: "cell-A", RepAddress: "cell-a.url"}))
+
+				reps["cell-A"].State(logger)
+			}
+
+			Expect(fakeMetronClient.SendMetricCallCount()).To(Equal(metricsSent))
+			Expect(fakeMetronClient.IncrementCounterCallCount()).To(Equal(0))
+			Expect(fetchStates()).To(HaveKey("cell-A"))
+		})
+
+		It("can be cleared", func() {
+			fetchStates()
+			fetchStates()
+
+			Expect(delegate.ClearCellQuarantine(logger, "cell-A")).To(BeTrue())
+			Expect(fetchStates()).To(HaveKey("cell-A"))
+			Expect(delegate.ClearCellQuarantine(logger, "cell-B")).To(BeFalse())
+		})
+	})
+
+	Describe("fencing", func() {
+		var fence *fakeFence
+
+		BeforeEach(func() {
+			fence = &fakeFence{token: 7, held: true}
+			delegate = auctionrunnerdelegate.New(repClientFactory, bbsClient, logger, auctionrunnerdelegate.WithFence(fence))
+
+			cellPresence := models.NewCellPresence("cell-A", "cell-a.url", "", "zone-1", models.NewCellCapacity(123, 456, 789), []string{}, []string{}, []string{}, []string{})
+			bbsClient.CellsReturns([]*models.CellPresence{&cellPresence}, nil)
+		})
+
+		It("performs work on the cells during the term", func() {
+			reps, err := delegate.FetchCellReps()
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = reps["cell-A"].Perform(logger, rep.Work{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(repClient.PerformCallCount()).To(Equal(1))
+		})
+
+		It("stops performing work on the cells once the term ends", func() {
+			reps, err := delegate.FetchCellReps()
+			Expect(err).NotTo(HaveOccurred())
+
+			fence.held = false
+			_, err = reps["cell-A"].Perform(logger, rep.Work{})
+			Expect(err).To(Equal(auctioneer.ErrLeadershipLost))
+			Expect(repClient.PerformCallCount()).To(Equal(0))
+		})
+
+		It("does not fetch cells without the lock", func() {
+			fence.held = false
+			_, err := delegate.FetchCellReps()
+			Expect(err).To(Equal(auctioneer.ErrLeadershipLost))
+			Expect(bbsClient.CellsCallCount()).To(Equal(0))
+		})
+
+		It("logs the leadership term with the calls to the BBS", func() {
+			delegate.AuctionCompleted(auctiontypes.AuctionResults{
+				FailedTasks: []auctiontypes.TaskAuction{{Task: rep.Task{TaskGuid: "failed-task"}}},
+			})
+
+			Expect(bbsClient.RejectTaskCallCount()).To(Equal(1))
+			bbsLogger, _, _ := bbsClient.RejectTaskArgsForCall(0)
+			bbsLogger.Info("rejecting")
+			Expect(logger.(*lagertest.TestLogger).Buffer()).To(gbytes.Say(`"leadership-term":7`))
+		})
+
+		It("does not report results to the BBS without the lock", func() {
+			fence.held = false
+			delegate.AuctionCompleted(auctiontypes.AuctionResults{
+				FailedTasks: []auctiontypes.TaskAuction{{Task: rep.Task{TaskGuid: "failed-task"}}},
+			})
+
+			Expect(bbsClient.RejectTaskCallCount()).To(Equal(0))
+		})
+	})
 })
+
+type fakeOutbox struct {
+	enqueued [][]bbsoutbox.Callback
+	err      error
+}
+
+func (o *fakeOutbox) Enqueue(logger lager.Logger, callbacks []bbsoutbox.Callback) error {
+	o.enqueued = append(o.enqueued, callbacks)
+	return o.err
+}
+
+type fakeFence struct {
+	token uint64
+	held  bool
+}
+
+func (f *fakeFence) FencingToken() (uint64, bool) {
+	return f.token, f.held
+}
+
+type fakeAuctionRunnerDelegate struct {
+	auctiontypes.AuctionRunnerDelegate
+	completed []auctiontypes.AuctionResults
+}
+
+func (d *fakeAuctionRunnerDelegate) AuctionCompleted(results auctiontypes.AuctionResults) {
+	d.completed = append(d.completed, results)
+}
@@ -0,0 +1,89 @@
+package auctionrunnerdelegate
+
+import (
+	"code.cloudfoundry.org/bbs/models"
+)
+
+const CellsFilteredOut = "AuctioneerCellsFilteredOut"
+
+// CellFilter decides which registered cells are offered to auctions. Filters
+// only see the cell presence registered in the BBS, and apply to every
+// auction alike unless they are scoped to domains. A CellOrdering prefers some
+// of the cells the filters allow.
+type CellFilter interface {
+	// Name identifies the filter in logs and in the list of cells.
+	Name() string
+	Allow(cell *models.CellPresence) bool
+}
+
+// CellFilters chains filters. A cell is allowed if every filter allows it.
+type CellFilters []CellFilter
+
+func (filters CellFilters) Name() string {
+	return "chain"
+}
+
+func (filters CellFilters) Allow(cell *models.CellPresence) bool {
+	return filters.deniedBy(cell) == nil
+}
+
+// deniedBy returns the first filter that does not allow cell, if any.
+func (filters CellFilters) deniedBy(cell *models.CellPresence) CellFilter {
+	for _, filter := range filters {
+		if !filter.Allow(cell) {
+			return filter
+		}
+	}
+	return nil
+}
+
+type labelExclusionFilter struct {
+	labels map[string]struct{}
+}
+
+// NewLabelExclusionFilter excludes the cells carrying any of labels as a
+// required or optional placement tag.
+func NewLabelExclusionFilter(labels ...string) CellFilter {
+	f := labelExclusionFilter{labels: make(map[string]struct{}, len(labels))}
+	for _, label := range labels {
+		f.labels[label] = struct{}{}
+	}
+	return f
+}
+
+func (labelExclusionFilter) Name() string {
+	return "label-exclusion"
+}
+
+func (f labelExclusionFilter) Allow(cell *models.CellPresence) bool {
+	for _, tags := range [][]string{cell.PlacementTags, cell.OptionalPlacementTags} {
+		for _, tag := range tags {
+			if _, ok := f.labels[tag]; ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+type cellIDDenyList struct {
+	cellIDs map[string]struct{}
+}
+
+// NewCellIDDenyList excludes the cells with any of cellIDs.
+func NewCellIDDenyList(cellIDs ...string) CellFilter {
+	f := cellIDDenyList{cellIDs: make(map[string]struct{}, len(cellIDs))}
+	for _, cellID := range cellIDs {
+		f.cellIDs[cellID] = struct{}{}
+	}
+	return f
+}
+
+func (cellIDDenyList) Name() string {
+	return "cell-id-deny-list"
+}
+
+func (f cellIDDenyList) Allow(cell *models.CellPresence) bool {
+	_, denied := f.cellIDs[cell.CellId]
+	return !denied
+}
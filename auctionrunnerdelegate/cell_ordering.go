@@ -0,0 +1,110 @@
+package auctionrunnerdelegate
+
+import (
+	"sort"
+
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/rep"
+)
+
+// CellOrdering prefers some of the cells offered to auctions over others.
+// Like filters, orderings only see the cell presence registered in the BBS.
+type CellOrdering interface {
+	// Name identifies the ordering in logs.
+	Name() string
+	// Rank places cell in the order. Cells of lower rank are preferred, and
+	// cells of equal rank are left to the auction to choose between.
+	Rank(cell *models.CellPresence) int
+}
+
+// CellOrderings chains orderings. Cells are ordered by the first ordering,
+// then by the next among cells of equal rank, and so on.
+type CellOrderings []CellOrdering
+
+// positions numbers the cells from zero in order. Cells of equal rank for
+// every ordering share a position.
+func (orderings CellOrderings) positions(cells map[string]*models.CellPresence) map[string]int {
+	ranks := make(map[string][]int, len(cells))
+	all := [][]int{}
+	for cellID, cell := range cells {
+		rank := make([]int, len(orderings))
+		for i, ordering := range orderings {
+			rank[i] = ordering.Rank(cell)
+		}
+		ranks[cellID] = rank
+		all = append(all, rank)
+	}
+
+	sort.Slice(all, func(i, j int) bool { return lessRank(all[i], all[j]) })
+	unique := all[:0]
+	for _, rank := range all {
+		if len(unique) == 0 || lessRank(unique[len(unique)-1], rank) {
+			unique = append(unique, rank)
+		}
+	}
+
+	positions := make(map[string]int, len(cells))
+	for cellID, rank := range ranks {
+		positions[cellID] = sort.Search(len(unique), func(i int) bool { return !lessRank(unique[i], rank) })
+	}
+	return positions
+}
+
+func lessRank(a, b []int) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+// rankedRepClient reports the index of its cell moved past the cells of
+// lower position. The auction adds the cell index times the bin pack first fit
+// weight to the score of every cell, so cells of lower position are preferred
+// for as long as they have room. Without a bin pack first fit weight the
+// orderings have no effect.
+type rankedRepClient struct {
+	rep.Client
+	offset int
+}
+
+func (c *rankedRepClient) State(logger lager.Logger) (rep.CellState, error) {
+	state, err := c.Client.State(logger)
+	if err != nil {
+		return state, err
+	}
+	state.CellIndex += c.offset
+	return state, nil
+}
+
+type labelPreference struct {
+	labels map[string]struct{}
+}
+
+// NewLabelPreference prefers the cells carrying any of labels as a required
+// or optional placement tag, such as a label for the cells that have cached
+// the images of a domain.
+func NewLabelPreference(labels ...string) CellOrdering {
+	o := labelPreference{labels: make(map[string]struct{}, len(labels))}
+	for _, label := range labels {
+		o.labels[label] = struct{}{}
+	}
+	return o
+}
+
+func (labelPreference) Name() string {
+	return "label-preference"
+}
+
+func (o labelPreference) Rank(cell *models.CellPresence) int {
+	for _, tags := range [][]string{cell.PlacementTags, cell.OptionalPlacementTags} {
+		for _, tag := range tags {
+			if _, ok := o.labels[tag]; ok {
+				return 0
+			}
+		}
+	}
+	return 1
+}
@@ -0,0 +1,185 @@
+package auctionrunnerdelegate
+
+import (
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/auctioneer"
+	"code.cloudfoundry.org/clock"
+	loggingclient "code.cloudfoundry.org/diego-logging-client"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/rep"
+)
+
+const (
+	CellQuarantineEventsCounter = "AuctioneerCellQuarantineEvents"
+	QuarantinedCells            = "AuctioneerQuarantinedCells"
+)
+
+const (
+	DefaultCellQuarantineBaseDuration = 30 * time.Second
+	DefaultCellQuarantineMaxDuration  = 10 * time.Minute
+)
+
+// CellQuarantineConfig controls how long cells are skipped after fetching
+// their state fails Threshold times in a row. The first quarantine lasts
+// BaseDuration and every further failure doubles it, up to MaxDuration. Zero
+// durations take their default.
+type CellQuarantineConfig struct {
+	Threshold    int
+	BaseDuration time.Duration
+	MaxDuration  time.Duration
+}
+
+type quarantineRecord struct {
+	failures int
+	until    time.Time
+}
+
+// cellQuarantine counts the consecutive state fetch failures of every cell.
+// A quarantined cell is tried again once its quarantine expires; a failure
+// then quarantines it for twice as long, while a success forgets the cell.
+type cellQuarantine struct {
+	config       CellQuarantineConfig
+	clock        clock.Clock
+	metronClient loggingclient.IngressClient
+
+	lock  sync.Mutex
+	cells map[string]*quarantineRecord
+}
+
+func newCellQuarantine(config CellQuarantineConfig, clock clock.Clock, metronClient loggingclient.IngressClient) *cellQuarantine {
+	if config.Threshold <= 0 {
+		config.Threshold = 1
+	}
+	if config.BaseDuration <= 0 {
+		config.BaseDuration = DefaultCellQuarantineBaseDuration
+	}
+	if config.MaxDuration <= 0 {
+		config.MaxDuration = DefaultCellQuarantineMaxDuration
+	}
+	if config.MaxDuration < config.BaseDuration {
+		config.MaxDuration = config.BaseDuration
+	}
+
+	return &cellQuarantine{
+		config:       config,
+		clock:        clock,
+		metronClient: metronClient,
+		cells:        map[string]*quarantineRecord{},
+	}
+}
+
+func (q *cellQuarantine) recordSuccess(cellID string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	delete(q.cells, cellID)
+}
+
+func (q *cellQuarantine) recordFailure(logger lager.Logger, cellID string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	record, ok := q.cells[cellID]
+	if !ok {
+		record = &quarantineRecord{}
+		q.cells[cellID] = record
+	}
+	record.failures++
+
+	if record.failures < q.config.Threshold {
+		return
+	}
+
+	duration := q.config.BaseDuration
+	for i := q.config.Threshold; i < record.failures && duration < q.config.MaxDuration; i++ {
+		duration *= 2
+	}
+	if duration > q.config.MaxDuration {
+		duration = q.config.MaxDuration
+	}
+	record.until = q.clock.Now().Add(duration)
+
+	logger.Info("quarantined-cell", lager.Data{
+		"cell-id":              cellID,
+		"consecutive-failures": record.failures,
+		"duration":             duration.String(),
+	})
+	if q.metronClient != nil {
+		q.metronClient.IncrementCounter(CellQuarantineEventsCounter)
+	}
+}
+
+// quarantined returns the quarantine of cellID if the cell is currently
+// skipped.
+func (q *cellQuarantine) quarantined(cellID string) (*auctioneer.CellQuarantine, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	record, ok := q.cells[cellID]
+	if !ok || !q.clock.Now().Before(record.until) {
+		return nil, false
+	}
+
+	return &auctioneer.CellQuarantine{
+		ConsecutiveFailures: record.failures,
+		Until:               record.until,
+	}, true
+}
+
+// clear forgets the failures of cellID and reports whether the cell was
+// quarantined.
+func (q *cellQuarantine) clear(cellID string) bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	record, ok := q.cells[cellID]
+	if !ok {
+		return false
+	}
+
+	delete(q.cells, cellID)
+	return q.clock.Now().Before(record.until)
+}
+
+// retain forgets the cells that are no longer registered and emits the
+// number of cells currently skipped.
+func (q *cellQuarantine) retain(cells map[string]registeredCell) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	now := q.clock.Now()
+	count := 0
+	for cellID, record := range q.cells {
+		if _, ok := cells[cellID]; !ok {
+			delete(q.cells, cellID)
+			continue
+		}
+		if now.Before(record.until) {
+			count++
+		}
+	}
+
+	if q.metronClient != nil {
+		q.metronClient.SendMetric(QuarantinedCells, count)
+	}
+}
+
+// monitoredRepClient reports the outcome of every state fetch to the
+// quarantine.
+type monitoredRepClient struct {
+	rep.Client
+	cellID     string
+	quarantine *cellQuarantine
+}
+
+func (c *monitoredRepClient) State(logger lager.Logger) (rep.CellState, error) {
+	state, err := c.Client.State(logger)
+	if err != nil {
+		c.quarantine.recordFailure(logger, c.cellID)
+	} else {
+		c.quarantine.recordSuccess(c.cellID)
+	}
+	return state, err
+}
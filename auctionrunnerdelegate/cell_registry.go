@@ -0,0 +1,135 @@
+package auctionrunnerdelegate
+
+import (
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/bbs"
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/clock"
+	loggingclient "code.cloudfoundry.org/diego-logging-client"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/rep"
+)
+
+const (
+	CellRegistryRefreshDuration      = "AuctioneerCellRegistryRefreshDuration"
+	CellRegistryRefreshFailedCounter = "AuctioneerCellRegistryRefreshFailures"
+	CellRegistryCells                = "AuctioneerCellRegistryCells"
+)
+
+type registeredCell struct {
+	repAddress string
+	repURL     string
+	presence   *models.CellPresence
+	client     rep.Client
+}
+
+// cellRegistry caches the rep client of every cell. The list of cells is
+// fetched from the BBS at most once per refresh interval, and a client is
+// only replaced when its cell changes address or disappears.
+type cellRegistry struct {
+	clock            clock.Clock
+	refreshInterval  time.Duration
+	repClientFactory rep.ClientFactory
+	bbsClient        bbs.InternalClient
+	metronClient     loggingclient.IngressClient
+
+	lock        sync.Mutex
+	cells       map[string]registeredCell
+	refreshedAt time.Time
+}
+
+func newCellRegistry(
+	clock clock.Clock,
+	refreshInterval time.Duration,
+	repClientFactory rep.ClientFactory,
+	bbsClient bbs.InternalClient,
+	metronClient loggingclient.IngressClient,
+) *cellRegistry {
+	return &cellRegistry{
+		clock:            clock,
+		refreshInterval:  refreshInterval,
+		repClientFactory: repClientFactory,
+		bbsClient:        bbsClient,
+		metronClient:     metronClient,
+		cells:            map[string]registeredCell{},
+	}
+}
+
+func (r *cellRegistry) registeredCells(logger lager.Logger) (map[string]registeredCell, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.refreshedAt.IsZero() || r.clock.Since(r.refreshedAt) >= r.refreshInterval {
+		if err := r.refresh(logger); err != nil {
+			return nil, err
+		}
+	}
+
+	// refresh replaces the map rather than changing it, so it can be shared
+	return r.cells, nil
+}
+
+func (r *cellRegistry) refresh(logger lager.Logger) error {
+	logger = logger.Session("refresh-cells")
+	started := r.clock.Now()
+
+	cells, err := r.bbsClient.Cells(logger)
+	if err != nil {
+		r.incrementCounter(CellRegistryRefreshFailedCounter)
+		return err
+	}
+
+	refreshed := make(map[string]registeredCell, len(cells))
+	added := 0
+	for _, cell := range cells {
+		existing, ok := r.cells[cell.CellId]
+		if ok && existing.repAddress == cell.RepAddress && existing.repURL == cell.RepUrl {
+			existing.presence = cell
+			refreshed[cell.CellId] = existing
+			continue
+		}
+
+		client, err := r.repClientFactory.CreateClient(cell.RepAddress, cell.RepUrl)
+		if err != nil {
+			logger.Error("create-rep-client-failed", err, lager.Data{"cell-id": cell.CellId})
+			continue
+		}
+
+		refreshed[cell.CellId] = registeredCell{
+			repAddress: cell.RepAddress,
+			repURL:     cell.RepUrl,
+			presence:   cell,
+			client:     client,
+		}
+		added++
+	}
+
+	removed := []string{}
+	for cellID := range r.cells {
+		if _, ok := refreshed[cellID]; !ok {
+			removed = append(removed, cellID)
+		}
+	}
+
+	if added > 0 || len(removed) > 0 {
+		logger.Info("cells-changed", lager.Data{"added": added, "removed": removed, "cells": len(refreshed)})
+	}
+
+	r.cells = refreshed
+	r.refreshedAt = r.clock.Now()
+
+	if r.metronClient != nil {
+		r.metronClient.SendDuration(CellRegistryRefreshDuration, r.clock.Since(started))
+		r.metronClient.SendMetric(CellRegistryCells, len(refreshed))
+	}
+
+	return nil
+}
+
+func (r *cellRegistry) incrementCounter(name string) {
+	if r.metronClient != nil {
+		r.metronClient.IncrementCounter(name)
+	}
+}
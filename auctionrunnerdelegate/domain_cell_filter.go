@@ -0,0 +1,237 @@
+package auctionrunnerdelegate
+
+import (
+	"sort"
+	"sync"
+
+	"code.cloudfoundry.org/auction/auctiontypes"
+	"code.cloudfoundry.org/auctioneer"
+	"code.cloudfoundry.org/bbs/models"
+)
+
+// The auction offers the cells of FetchCellReps to every auction of a batch,
+// so the filters of a domain can only apply to batches holding nothing but
+// auctions of that domain. Runner hands the auctions of each domain with cell
+// filters to the auction runner on their own, waiting for the batch in flight
+// to complete first, and FetchCellReps applies the filters of the domain whose
+// auctions are in flight. Auctions of domains without cell filters share their
+// batches.
+
+type lrpKey struct {
+	processGuid string
+	index       int
+}
+
+// scopedWork holds the auctions of a domain waiting for their batch.
+type scopedWork struct {
+	tasks []auctioneer.TaskStartRequest
+	lrps  []auctioneer.LRPStartRequest
+}
+
+type domainScope struct {
+	lock sync.Mutex
+
+	// domain is the domain whose auctions are in flight, or empty for the
+	// domains without cell filters.
+	domain        string
+	inFlightTasks map[string]struct{}
+	inFlightLRPs  map[lrpKey]struct{}
+
+	waiting map[string]*scopedWork
+	order   []string
+
+	runner auctiontypes.AuctionRunner
+}
+
+func newDomainScope() *domainScope {
+	return &domainScope{
+		inFlightTasks: map[string]struct{}{},
+		inFlightLRPs:  map[lrpKey]struct{}{},
+		waiting:       map[string]*scopedWork{},
+	}
+}
+
+func (s *domainScope) current() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.domain
+}
+
+func (s *domainScope) idle() bool {
+	return len(s.inFlightTasks) == 0 && len(s.inFlightLRPs) == 0
+}
+
+// add returns the auctions of work that may join the batch in flight and
+// keeps the others waiting. Auctions join the batch in flight only while no
+// other domain is waiting, so that every domain gets its turn.
+func (s *domainScope) add(domain string, work scopedWork) scopedWork {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.idle() || (domain == s.domain && len(s.order) == 0) {
+		s.domain = domain
+		s.track(work)
+		return work
+	}
+
+	waiting, ok := s.waiting[domain]
+	if !ok {
+		waiting = &scopedWork{}
+		s.waiting[domain] = waiting
+		s.order = append(s.order, domain)
+	}
+	waiting.tasks = append(waiting.tasks, work.tasks...)
+	waiting.lrps = append(waiting.lrps, work.lrps...)
+	return scopedWork{}
+}
+
+func (s *domainScope) track(work scopedWork) {
+	for i := range work.tasks {
+		s.inFlightTasks[work.tasks[i].TaskGuid] = struct{}{}
+	}
+	for i := range work.lrps {
+		for _, index := range work.lrps[i].Indices {
+			s.inFlightLRPs[lrpKey{work.lrps[i].ProcessGuid, index}] = struct{}{}
+		}
+	}
+}
+
+// complete forgets the auctions of results and, once none are in flight,
+// returns the auctions of the domain that has waited longest.
+func (s *domainScope) complete(results auctiontypes.AuctionResults) scopedWork {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, tasks := range [][]auctiontypes.TaskAuction{results.SuccessfulTasks, results.FailedTasks} {
+		for i := range tasks {
+			delete(s.inFlightTasks, tasks[i].TaskGuid)
+		}
+	}
+	for _, lrps := range [][]auctiontypes.LRPAuction{results.SuccessfulLRPs, results.FailedLRPs} {
+		for i := range lrps {
+			delete(s.inFlightLRPs, lrpKey{lrps[i].ProcessGuid, int(lrps[i].Index)})
+		}
+	}
+
+	if !s.idle() || len(s.order) == 0 {
+		return scopedWork{}
+	}
+
+	s.domain = s.order[0]
+	s.order = s.order[1:]
+	work := *s.waiting[s.domain]
+	delete(s.waiting, s.domain)
+	s.track(work)
+	return work
+}
+
+func (s *domainScope) schedule(work scopedWork) {
+	if len(work.tasks) > 0 {
+		s.runner.ScheduleTasksForAuctions(work.tasks)
+	}
+	if len(work.lrps) > 0 {
+		s.runner.ScheduleLRPsForAuctions(work.lrps)
+	}
+}
+
+// scopeOf returns the domain whose filters apply to the auctions of domain,
+// or empty if it has none.
+func (a *AuctionRunnerDelegate) scopeOf(domain string) string {
+	if _, ok := a.domainFilters[domain]; ok {
+		return domain
+	}
+	return ""
+}
+
+// deniedDomains returns the domains whose filters do not allow cell.
+func (a *AuctionRunnerDelegate) deniedDomains(cell *models.CellPresence) []string {
+	domains := []string{}
+	for domain, filters := range a.domainFilters {
+		if filters.deniedBy(cell) != nil {
+			domains = append(domains, domain)
+		}
+	}
+	if len(domains) == 0 {
+		return nil
+	}
+	sort.Strings(domains)
+	return domains
+}
+
+// Runner applies the cell filters of WithDomainCellFilters to the auctions
+// scheduled through runner. It must wrap the auction runner the delegate is
+// used with, and that auction runner must report to Delegate.
+func (a *AuctionRunnerDelegate) Runner(runner auctiontypes.AuctionRunner) auctiontypes.AuctionRunner {
+	if len(a.domainFilters) == 0 {
+		return runner
+	}
+
+	a.scope.runner = runner
+	return &scopingRunner{AuctionRunner: runner, delegate: a}
+}
+
+// Delegate wraps the delegate the auction runner reports to, so that Runner
+// learns when the batch in flight completes. It must be given to the auction
+// runner itself, as the wrappers of the delegate may hold back results.
+func (a *AuctionRunnerDelegate) Delegate(delegate auctiontypes.AuctionRunnerDelegate) auctiontypes.AuctionRunnerDelegate {
+	if len(a.domainFilters) == 0 {
+		return delegate
+	}
+	return &scopingDelegate{AuctionRunnerDelegate: delegate, scope: a.scope}
+}
+
+type scopingRunner struct {
+	auctiontypes.AuctionRunner
+	delegate *AuctionRunnerDelegate
+}
+
+func (r *scopingRunner) ScheduleLRPsForAuctions(starts []auctioneer.LRPStartRequest) {
+	batches := &byDomain{work: map[string]*scopedWork{}}
+	for i := range starts {
+		work := batches.of(r.delegate.scopeOf(starts[i].Domain))
+		work.lrps = append(work.lrps, starts[i])
+	}
+	r.schedule(batches)
+}
+
+func (r *scopingRunner) ScheduleTasksForAuctions(tasks []auctioneer.TaskStartRequest) {
+	batches := &byDomain{work: map[string]*scopedWork{}}
+	for i := range tasks {
+		work := batches.of(r.delegate.scopeOf(tasks[i].Domain))
+		work.tasks = append(work.tasks, tasks[i])
+	}
+	r.schedule(batches)
+}
+
+func (r *scopingRunner) schedule(batches *byDomain) {
+	for _, domain := range batches.domains {
+		r.delegate.scope.schedule(r.delegate.scope.add(domain, *batches.work[domain]))
+	}
+}
+
+// byDomain groups auctions by the domain whose filters apply to them, in the
+// order the domains first appear.
+type byDomain struct {
+	domains []string
+	work    map[string]*scopedWork
+}
+
+func (b *byDomain) of(domain string) *scopedWork {
+	work, ok := b.work[domain]
+	if !ok {
+		work = &scopedWork{}
+		b.work[domain] = work
+		b.domains = append(b.domains, domain)
+	}
+	return work
+}
+
+type scopingDelegate struct {
+	auctiontypes.AuctionRunnerDelegate
+	scope *domainScope
+}
+
+func (d *scopingDelegate) AuctionCompleted(results auctiontypes.AuctionResults) {
+	d.AuctionRunnerDelegate.AuctionCompleted(results)
+	d.scope.schedule(d.scope.complete(results))
+}
@@ -0,0 +1,45 @@
+package auctionrunnerdelegate
+
+import (
+	"code.cloudfoundry.org/auctioneer"
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/rep"
+)
+
+// termRepClient refuses to change the state of a cell once this auctioneer
+// knows that the leadership term the client was created in has ended. Reps do
+// not know about terms, so calls made before then still go through; the term
+// is logged with every call to correlate them with the leader that made them.
+// Reading the cell state is still allowed.
+type termRepClient struct {
+	rep.Client
+	fence auctioneer.Fence
+	token uint64
+}
+
+func (c *termRepClient) Perform(logger lager.Logger, work rep.Work) (rep.Work, error) {
+	if !c.inTerm() {
+		return work, auctioneer.ErrLeadershipLost
+	}
+	return c.Client.Perform(logger.WithData(lager.Data{"leadership-term": c.token}), work)
+}
+
+func (c *termRepClient) StopLRPInstance(logger lager.Logger, key models.ActualLRPKey, instanceKey models.ActualLRPInstanceKey) error {
+	if !c.inTerm() {
+		return auctioneer.ErrLeadershipLost
+	}
+	return c.Client.StopLRPInstance(logger.WithData(lager.Data{"leadership-term": c.token}), key, instanceKey)
+}
+
+func (c *termRepClient) CancelTask(logger lager.Logger, taskGuid string) error {
+	if !c.inTerm() {
+		return auctioneer.ErrLeadershipLost
+	}
+	return c.Client.CancelTask(logger.WithData(lager.Data{"leadership-term": c.token}), taskGuid)
+}
+
+func (c *termRepClient) inTerm() bool {
+	token, ok := c.fence.FencingToken()
+	return ok && token == c.token
+}
@@ -0,0 +1,277 @@
+package auctioneer
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager"
+)
+
+var ErrBatchingClientClosed = errors.New("batching client is closed")
+
+const (
+	DefaultBatchFlushInterval = 100 * time.Millisecond
+	DefaultMaxBatchSize       = 500
+)
+
+type BatchingClientConfig struct {
+	// FlushInterval is how long submissions are coalesced before being sent.
+	FlushInterval time.Duration
+	// MaxBatchSize flushes early once this many items are pending.
+	MaxBatchSize int
+	// Clock defaults to the wall clock.
+	Clock clock.Clock
+}
+
+// PendingAuction is resolved once the batch containing the submitted item has
+// been sent to the auctioneer.
+type PendingAuction struct {
+	done chan struct{}
+	err  error
+}
+
+func newPendingAuction() *PendingAuction {
+	return &PendingAuction{done: make(chan struct{})}
+}
+
+func (p *PendingAuction) Done() <-chan struct{} {
+	return p.done
+}
+
+// Wait blocks until the batch has been sent and returns the error of the
+// request that carried the item.
+func (p *PendingAuction) Wait() error {
+	<-p.done
+	return p.err
+}
+
+func (p *PendingAuction) resolve(err error) {
+	p.err = err
+	close(p.done)
+}
+
+type pendingLRP struct {
+	start   LRPStartRequest
+	pending *PendingAuction
+}
+
+type pendingTask struct {
+	task    TaskStartRequest
+	pending *PendingAuction
+}
+
+// BatchingClient accepts individual start requests from many goroutines and
+// submits them through the wrapped Client in batches.
+type BatchingClient struct {
+	client        Client
+	logger        lager.Logger
+	flushInterval time.Duration
+	maxBatchSize  int
+	clock         clock.Clock
+
+	lock   sync.Mutex
+	lrps   []pendingLRP
+	tasks  []pendingTask
+	closed bool
+
+	flushNow chan struct{}
+	closing  chan struct{}
+	exited   chan struct{}
+}
+
+func NewBatchingClient(logger lager.Logger, client Client, cfg BatchingClientConfig) *BatchingClient {
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = DefaultBatchFlushInterval
+	}
+	if cfg.MaxBatchSize <= 0 {
+		cfg.MaxBatchSize = DefaultMaxBatchSize
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = clock.NewClock()
+	}
+
+	b := &BatchingClient{
+		client:        client,
+		logger:        logger.Session("batching-client"),
+		flushInterval: cfg.FlushInterval,
+		maxBatchSize:  cfg.MaxBatchSize,
+		clock:         cfg.Clock,
+		flushNow:      make(chan struct{}, 1),
+		closing:       make(chan struct{}),
+		exited:        make(chan struct{}),
+	}
+
+	go b.run()
+
+	return b
+}
+
+func (b *BatchingClient) SubmitLRP(start LRPStartRequest) *PendingAuction {
+	pending := newPendingAuction()
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.closed {
+		pending.resolve(ErrBatchingClientClosed)
+		return pending
+	}
+
+	b.lrps = append(b.lrps, pendingLRP{start: start, pending: pending})
+	b.signalIfFullLocked()
+	return pending
+}
+
+func (b *BatchingClient) SubmitTask(task TaskStartRequest) *PendingAuction {
+	pending := newPendingAuction()
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.closed {
+		pending.resolve(ErrBatchingClientClosed)
+		return pending
+	}
+
+	b.tasks = append(b.tasks, pendingTask{task: task, pending: pending})
+	b.signalIfFullLocked()
+	return pending
+}
+
+// Close stops accepting submissions, flushes everything still pending and
+// waits for the final batch to be sent.
+func (b *BatchingClient) Close() error {
+	b.lock.Lock()
+	if b.closed {
+		b.lock.Unlock()
+		<-b.exited
+		return nil
+	}
+	b.closed = true
+	b.lock.Unlock()
+
+	close(b.closing)
+	<-b.exited
+	return nil
+}
+
+func (b *BatchingClient) signalIfFullLocked() {
+	if len(b.lrps)+len(b.tasks) < b.maxBatchSize {
+		return
+	}
+
+	select {
+	case b.flushNow <- struct{}{}:
+	default:
+	}
+}
+
+func (b *BatchingClient) run() {
+	defer close(b.exited)
+
+	timer := b.clock.NewTimer(b.flushInterval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C():
+			b.flush()
+			timer.Reset(b.flushInterval)
+		case <-b.flushNow:
+			b.flush()
+		case <-b.closing:
+			b.flush()
+			return
+		}
+	}
+}
+
+func (b *BatchingClient) flush() {
+	b.lock.Lock()
+	lrps, tasks := b.lrps, b.tasks
+	b.lrps, b.tasks = nil, nil
+	b.lock.Unlock()
+
+	if len(lrps) > 0 {
+		b.flushLRPs(lrps)
+	}
+	if len(tasks) > 0 {
+		b.flushTasks(tasks)
+	}
+}
+
+func (b *BatchingClient) flushLRPs(lrps []pendingLRP) {
+	starts := make([]LRPStartRequest, 0, len(lrps))
+	for i := range lrps {
+		starts = append(starts, lrps[i].start)
+	}
+
+	merged := MergeLRPStartRequests(starts)
+	b.logger.Debug("flushing-lrps", lager.Data{"submitted": len(lrps), "batch-size": len(merged)})
+
+	err := b.client.RequestLRPAuctions(b.logger, merged)
+	if err != nil {
+		b.logger.Error("failed-to-request-lrp-auctions", err, lager.Data{"batch-size": len(merged)})
+	}
+
+	for i := range lrps {
+		lrps[i].pending.resolve(err)
+	}
+}
+
+func (b *BatchingClient) flushTasks(tasks []pendingTask) {
+	batch := make([]*TaskStartRequest, 0, len(tasks))
+	for i := range tasks {
+		batch = append(batch, &tasks[i].task)
+	}
+
+	b.logger.Debug("flushing-tasks", lager.Data{"batch-size": len(batch)})
+
+	err := b.client.RequestTaskAuctions(b.logger, batch)
+	if err != nil {
+		b.logger.Error("failed-to-request-task-auctions", err, lager.Data{"batch-size": len(batch)})
+	}
+
+	for i := range tasks {
+		tasks[i].pending.resolve(err)
+	}
+}
+
+// MergeLRPStartRequests collapses start requests for the same process guid
+// into one request carrying the union of their indices. The first request for
+// a process guid determines its resources and placement constraint; the merged
+// request keeps the earliest deadline of the requests that have one.
+func MergeLRPStartRequests(starts []LRPStartRequest) []*LRPStartRequest {
+	merged := []*LRPStartRequest{}
+	byGuid := map[string]*LRPStartRequest{}
+	seenIndices := map[string]map[int]struct{}{}
+
+	for i := range starts {
+		start := starts[i]
+		indices := start.Indices
+
+		existing, ok := byGuid[start.ProcessGuid]
+		if !ok {
+			existing = &start
+			existing.Indices = make([]int, 0, len(indices))
+			byGuid[start.ProcessGuid] = existing
+			seenIndices[start.ProcessGuid] = map[int]struct{}{}
+			merged = append(merged, existing)
+		} else if start.Deadline != 0 && (existing.Deadline == 0 || start.Deadline < existing.Deadline) {
+			existing.Deadline = start.Deadline
+		}
+
+		seen := seenIndices[start.ProcessGuid]
+		for _, index := range indices {
+			if _, ok := seen[index]; ok {
+				continue
+			}
+			seen[index] = struct{}{}
+			existing.Indices = append(existing.Indices, index)
+		}
+	}
+
+	return merged
+}
@@ -0,0 +1,158 @@
+package auctioneer_test
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/auctioneer"
+	"code.cloudfoundry.org/auctioneer/auctioneerfakes"
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/rep"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BatchingClient", func() {
+	var (
+		fakeClient     *auctioneerfakes.FakeClient
+		fakeClock      *fakeclock.FakeClock
+		logger         *lagertest.TestLogger
+		batchingClient *auctioneer.BatchingClient
+		maxBatchSize   int
+	)
+
+	newLRPStart := func(guid string, indices ...int) auctioneer.LRPStartRequest {
+		return auctioneer.NewLRPStartRequest(guid, "domain", indices, rep.NewResource(1, 1, 1), rep.NewPlacementConstraint("rootfs", nil, nil))
+	}
+
+	newTask := func(guid string) auctioneer.TaskStartRequest {
+		return auctioneer.NewTaskStartRequest(rep.NewTask(guid, "domain", rep.NewResource(1, 1, 1), rep.NewPlacementConstraint("rootfs", nil, nil)))
+	}
+
+	BeforeEach(func() {
+		fakeClient = new(auctioneerfakes.FakeClient)
+		fakeClock = fakeclock.NewFakeClock(time.Now())
+		logger = lagertest.NewTestLogger("batching-client")
+		maxBatchSize = 100
+	})
+
+	JustBeforeEach(func() {
+		batchingClient = auctioneer.NewBatchingClient(logger, fakeClient, auctioneer.BatchingClientConfig{
+			FlushInterval: time.Second,
+			MaxBatchSize:  maxBatchSize,
+			Clock:         fakeClock,
+		})
+	})
+
+	AfterEach(func() {
+		Expect(batchingClient.Close()).To(Succeed())
+	})
+
+	It("coalesces submissions made within the flush interval", func() {
+		var wg sync.WaitGroup
+		pending := make([]*auctioneer.PendingAuction, 10)
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer GinkgoRecover()
+				defer wg.Done()
+				pending[i] = batchingClient.SubmitTask(newTask("task-guid"))
+			}(i)
+		}
+		wg.Wait()
+
+		Consistently(fakeClient.RequestTaskAuctionsCallCount).Should(Equal(0))
+
+		fakeClock.WaitForWatcherAndIncrement(time.Second)
+
+		Eventually(fakeClient.RequestTaskAuctionsCallCount).Should(Equal(1))
+		_, tasks := fakeClient.RequestTaskAuctionsArgsForCall(0)
+		Expect(tasks).To(HaveLen(10))
+
+		for _, p := range pending {
+			Expect(p.Wait()).To(Succeed())
+		}
+	})
+
+	It("merges the indices of LRP starts for the same process guid", func() {
+		batchingClient.SubmitLRP(newLRPStart("guid-a", 0, 1))
+		batchingClient.SubmitLRP(newLRPStart("guid-b", 0))
+		last := batchingClient.SubmitLRP(newLRPStart("guid-a", 1, 2))
+
+		fakeClock.WaitForWatcherAndIncrement(time.Second)
+		Expect(last.Wait()).To(Succeed())
+
+		Expect(fakeClient.RequestLRPAuctionsCallCount()).To(Equal(1))
+		_, starts := fakeClient.RequestLRPAuctionsArgsForCall(0)
+		Expect(starts).To(HaveLen(2))
+		Expect(starts[0].ProcessGuid).To(Equal("guid-a"))
+		Expect(starts[0].Indices).To(Equal([]int{0, 1, 2}))
+		Expect(starts[1].ProcessGuid).To(Equal("guid-b"))
+		Expect(starts[1].Indices).To(Equal([]int{0}))
+	})
+
+	It("keeps the earliest deadline of the merged LRP starts", func() {
+		first := newLRPStart("guid-a", 0)
+		second := newLRPStart("guid-a", 1)
+		second.Deadline = 200
+		third := newLRPStart("guid-a", 2)
+		third.Deadline = 100
+
+		batchingClient.SubmitLRP(first)
+		batchingClient.SubmitLRP(second)
+		last := batchingClient.SubmitLRP(third)
+
+		fakeClock.WaitForWatcherAndIncrement(time.Second)
+		Expect(last.Wait()).To(Succeed())
+
+		_, starts := fakeClient.RequestLRPAuctionsArgsForCall(0)
+		Expect(starts).To(HaveLen(1))
+		Expect(starts[0].Deadline).To(BeEquivalentTo(100))
+	})
+
+	It("reports the request error to every item in the batch", func() {
+		requestErr := errors.New("boom")
+		fakeClient.RequestLRPAuctionsReturns(requestErr)
+
+		first := batchingClient.SubmitLRP(newLRPStart("guid-a", 0))
+		second := batchingClient.SubmitLRP(newLRPStart("guid-b", 0))
+
+		fakeClock.WaitForWatcherAndIncrement(time.Second)
+		Expect(first.Wait()).To(MatchError(requestErr))
+		Expect(second.Wait()).To(MatchError(requestErr))
+	})
+
+	Context("when the max batch size is reached", func() {
+		BeforeEach(func() {
+			maxBatchSize = 2
+		})
+
+		It("flushes without waiting for the interval", func() {
+			batchingClient.SubmitTask(newTask("task-1"))
+			pending := batchingClient.SubmitTask(newTask("task-2"))
+
+			Eventually(pending.Done()).Should(BeClosed())
+			Expect(fakeClient.RequestTaskAuctionsCallCount()).To(Equal(1))
+		})
+	})
+
+	Describe("Close", func() {
+		It("flushes pending submissions", func() {
+			pending := batchingClient.SubmitTask(newTask("task-guid"))
+
+			Expect(batchingClient.Close()).To(Succeed())
+			Expect(pending.Done()).To(BeClosed())
+			Expect(fakeClient.RequestTaskAuctionsCallCount()).To(Equal(1))
+		})
+
+		It("rejects submissions made after closing", func() {
+			Expect(batchingClient.Close()).To(Succeed())
+
+			pending := batchingClient.SubmitLRP(newLRPStart("guid-a", 0))
+			Expect(pending.Wait()).To(MatchError(auctioneer.ErrBatchingClientClosed))
+			Expect(fakeClient.RequestLRPAuctionsCallCount()).To(Equal(0))
+		})
+	})
+})
@@ -0,0 +1,13 @@
+package bbsoutbox_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestBbsoutbox(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "BBS Outbox Suite")
+}
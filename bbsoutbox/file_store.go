@@ -0,0 +1,185 @@
+package bbsoutbox
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// record is a line of the file store. Each line either adds or completes
+// callbacks.
+type record struct {
+	Callbacks []Callback `json:"callbacks,omitempty"`
+	Completed []string   `json:"completed,omitempty"`
+}
+
+// FileStore is a Store backed by an append-only file of JSON lines, which is
+// rewritten with only the pending callbacks on Load.
+type FileStore struct {
+	path string
+
+	lock      sync.Mutex
+	file      *os.File
+	callbacks map[string]Callback
+}
+
+// NewFileStore opens the outbox at path, creating it if needed. A partially
+// written last line, as left by a crash, is dropped. Any other line that
+// cannot be parsed fails the load and leaves the file untouched, as the
+// callbacks recorded after it could otherwise be lost.
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{
+		path:      path,
+		callbacks: map[string]Callback{},
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	line := 0
+	var corrupt error
+	for scanner.Scan() {
+		if corrupt != nil {
+			file.Close()
+			return nil, corrupt
+		}
+
+		line++
+		r := record{}
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			corrupt = fmt.Errorf("line %d of %s is corrupt: %s", line, path, err)
+			continue
+		}
+		s.apply(r)
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	file.Close()
+
+	if err := s.rewrite(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *FileStore) Append(callbacks []Callback) error {
+	return s.write(record{Callbacks: callbacks})
+}
+
+func (s *FileStore) Complete(ids []string) error {
+	return s.write(record{Completed: ids})
+}
+
+func (s *FileStore) Load() ([]Callback, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.rewrite(); err != nil {
+		return nil, err
+	}
+
+	return s.pending(), nil
+}
+
+func (s *FileStore) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.file.Close()
+}
+
+func (s *FileStore) write(r record) error {
+	payload, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, err := s.file.Write(append(payload, '\n')); err != nil {
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+
+	s.apply(r)
+	return nil
+}
+
+func (s *FileStore) apply(r record) {
+	for _, callback := range r.Callbacks {
+		s.callbacks[callback.ID()] = callback
+	}
+
+	for _, id := range r.Completed {
+		delete(s.callbacks, id)
+	}
+}
+
+func (s *FileStore) pending() []Callback {
+	callbacks := make([]Callback, 0, len(s.callbacks))
+	for _, callback := range s.callbacks {
+		callbacks = append(callbacks, callback)
+	}
+	sort.Slice(callbacks, func(i, j int) bool { return callbacks[i].ID() < callbacks[j].ID() })
+	return callbacks
+}
+
+// rewrite replaces the file with a single record of the pending callbacks and
+// reopens it for appending.
+func (s *FileStore) rewrite() error {
+	callbacks := s.pending()
+
+	tmp, err := os.OpenFile(s.path+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	if len(callbacks) > 0 {
+		payload, err := json.Marshal(record{Callbacks: callbacks})
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		if _, err := tmp.Write(append(payload, '\n')); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if s.file != nil {
+		s.file.Close()
+	}
+
+	if err := os.Rename(s.path+".tmp", s.path); err != nil {
+		return err
+	}
+
+	if dir, err := os.Open(filepath.Dir(s.path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+
+	s.file, err = os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0600)
+	return err
+}
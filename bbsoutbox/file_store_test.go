@@ -0,0 +1,109 @@
+package bbsoutbox_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/auctioneer/bbsoutbox"
+	"code.cloudfoundry.org/bbs/models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FileStore", func() {
+	var (
+		dir   string
+		path  string
+		store *bbsoutbox.FileStore
+
+		reject bbsoutbox.Callback
+		fail   bbsoutbox.Callback
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "bbs-outbox")
+		Expect(err).NotTo(HaveOccurred())
+		path = filepath.Join(dir, "outbox.log")
+
+		store, err = bbsoutbox.NewFileStore(path)
+		Expect(err).NotTo(HaveOccurred())
+
+		lrpKey := models.NewActualLRPKey("process-guid", 0, "domain")
+		reject = bbsoutbox.RejectTask("task-guid", "insufficient resources")
+		fail = bbsoutbox.FailActualLRP(&lrpKey, "found no compatible cell")
+	})
+
+	AfterEach(func() {
+		store.Close()
+		os.RemoveAll(dir)
+	})
+
+	reopen := func() {
+		Expect(store.Close()).To(Succeed())
+
+		var err error
+		store, err = bbsoutbox.NewFileStore(path)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	It("starts empty", func() {
+		Expect(store.Load()).To(BeEmpty())
+	})
+
+	It("keeps the pending callbacks across reopening", func() {
+		Expect(store.Append([]bbsoutbox.Callback{reject, fail})).To(Succeed())
+		Expect(store.Complete([]string{reject.ID()})).To(Succeed())
+
+		reopen()
+
+		Expect(store.Load()).To(Equal([]bbsoutbox.Callback{fail}))
+	})
+
+	It("replaces a pending callback for the same task", func() {
+		newer := bbsoutbox.RejectTask("task-guid", "found no compatible cell")
+		Expect(store.Append([]bbsoutbox.Callback{reject})).To(Succeed())
+		Expect(store.Append([]bbsoutbox.Callback{newer})).To(Succeed())
+
+		Expect(store.Load()).To(Equal([]bbsoutbox.Callback{newer}))
+	})
+
+	Context("when the last line was only partially written", func() {
+		It("ignores it", func() {
+			Expect(store.Append([]bbsoutbox.Callback{reject})).To(Succeed())
+			Expect(store.Close()).To(Succeed())
+
+			file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = file.WriteString(`{"callbacks":[{"task_gu`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(file.Close()).To(Succeed())
+
+			store, err = bbsoutbox.NewFileStore(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(store.Load()).To(Equal([]bbsoutbox.Callback{reject}))
+		})
+	})
+
+	Context("when a line before the last is corrupt", func() {
+		It("refuses to load the outbox and leaves it untouched", func() {
+			Expect(store.Append([]bbsoutbox.Callback{reject})).To(Succeed())
+			Expect(store.Close()).To(Succeed())
+
+			file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = file.WriteString("{\"callbacks\":[{\"task_gu\n{\"completed\":[\"some-id\"]}\n")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(file.Close()).To(Succeed())
+
+			contents, err := ioutil.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = bbsoutbox.NewFileStore(path)
+			Expect(err).To(MatchError(ContainSubstring("line 2")))
+			Expect(ioutil.ReadFile(path)).To(Equal(contents))
+		})
+	})
+})
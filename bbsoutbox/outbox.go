@@ -0,0 +1,460 @@
+package bbsoutbox
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/auctioneer"
+	"code.cloudfoundry.org/bbs"
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/clock"
+	loggingclient "code.cloudfoundry.org/diego-logging-client"
+	"code.cloudfoundry.org/lager"
+)
+
+const (
+	PendingCallbacks        = "AuctioneerBBSCallbacksPending"
+	FailedCallbacksCounter  = "AuctioneerBBSCallbackFailures"
+	DroppedCallbacksCounter = "AuctioneerBBSCallbacksDropped"
+)
+
+const (
+	DefaultWorkers      = 10
+	DefaultMaxAttempts  = 10
+	DefaultBackoff      = 1 * time.Second
+	DefaultMaxBackoff   = 30 * time.Second
+	DefaultDrainTimeout = 10 * time.Second
+)
+
+// errLockLost is returned for deliveries that were not attempted because the
+// auctioneer no longer holds the lock.
+var errLockLost = errors.New("lock lost")
+
+// Callback tells the BBS that a task or an LRP instance could not be placed.
+// Exactly one of TaskGuid and ActualLRPKey is set.
+type Callback struct {
+	TaskGuid       string               `json:"task_guid,omitempty"`
+	ActualLRPKey   *models.ActualLRPKey `json:"actual_lrp_key,omitempty"`
+	PlacementError string               `json:"placement_error"`
+}
+
+func RejectTask(taskGuid, placementError string) Callback {
+	return Callback{TaskGuid: taskGuid, PlacementError: placementError}
+}
+
+func FailActualLRP(key *models.ActualLRPKey, placementError string) Callback {
+	return Callback{ActualLRPKey: key, PlacementError: placementError}
+}
+
+// ID identifies the task or LRP instance of the callback. A newer callback
+// for the same ID replaces a pending one.
+func (c Callback) ID() string {
+	if c.ActualLRPKey != nil {
+		return fmt.Sprintf("lrp/%s/%d", c.ActualLRPKey.ProcessGuid, c.ActualLRPKey.Index)
+	}
+	return "task/" + c.TaskGuid
+}
+
+// Store persists the callbacks that were not delivered yet, so that they
+// survive a restart of the auctioneer.
+type Store interface {
+	Append(callbacks []Callback) error
+	Complete(ids []string) error
+	Load() ([]Callback, error)
+}
+
+// Config bounds the number of concurrent calls to the BBS and how often a
+// callback is attempted. Failed attempts are retried after Backoff, doubling
+// up to MaxBackoff. When stopped, the outbox keeps delivering for up to
+// DrainTimeout. Zero values take their default.
+type Config struct {
+	Workers      int
+	MaxAttempts  int
+	Backoff      time.Duration
+	MaxBackoff   time.Duration
+	DrainTimeout time.Duration
+}
+
+type entry struct {
+	callback Callback
+	attempts int
+	due      time.Time
+	inFlight bool
+}
+
+// Outbox delivers placement failures to the BBS in the background. Callbacks
+// are written to the store before Enqueue returns and retried until the BBS
+// accepts them, rejects them for good or they run out of attempts, at which
+// point BBS convergence is left to notice the task or LRP instead.
+//
+// The BBS has no calls to reject several tasks or fail several LRPs at once,
+// so callbacks are delivered one by one; writes to the store are batched per
+// Enqueue instead.
+//
+// Callbacks are only delivered while fence reports the lock as held; while it
+// does not, they are parked and checked again after Backoff.
+type Outbox struct {
+	logger       lager.Logger
+	clock        clock.Clock
+	bbsClient    bbs.InternalClient
+	store        Store
+	metronClient loggingclient.IngressClient
+	fence        auctioneer.Fence
+	config       Config
+
+	// storeLock orders the writes to the store of Enqueue and delivered, so
+	// that completing a delivered callback cannot remove a newer callback
+	// stored under the same ID. It is taken before lock.
+	storeLock sync.Mutex
+
+	lock    sync.Mutex
+	entries map[string]*entry
+	wake    chan struct{}
+}
+
+// New returns an Outbox delivering to bbsClient. Without a store the outbox is
+// not durable: callbacks still pending when it stops after draining, or when
+// the auctioneer crashes, are lost and left to BBS convergence.
+func New(logger lager.Logger, clock clock.Clock, bbsClient bbs.InternalClient, store Store, metronClient loggingclient.IngressClient, fence auctioneer.Fence, config Config) *Outbox {
+	if config.Workers <= 0 {
+		config.Workers = DefaultWorkers
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = DefaultMaxAttempts
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = DefaultBackoff
+	}
+	if config.MaxBackoff < config.Backoff {
+		config.MaxBackoff = DefaultMaxBackoff
+		if config.MaxBackoff < config.Backoff {
+			config.MaxBackoff = config.Backoff
+		}
+	}
+	if config.DrainTimeout <= 0 {
+		config.DrainTimeout = DefaultDrainTimeout
+	}
+
+	return &Outbox{
+		logger:       logger.Session("bbs-outbox"),
+		clock:        clock,
+		bbsClient:    bbsClient,
+		store:        store,
+		metronClient: metronClient,
+		fence:        fence,
+		config:       config,
+		entries:      map[string]*entry{},
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+// Enqueue stores callbacks for delivery. An error means they were not stored
+// and will not be delivered.
+func (o *Outbox) Enqueue(logger lager.Logger, callbacks []Callback) error {
+	if len(callbacks) == 0 {
+		return nil
+	}
+
+	o.storeLock.Lock()
+	defer o.storeLock.Unlock()
+
+	if o.store != nil {
+		if err := o.store.Append(callbacks); err != nil {
+			logger.Error("failed-to-store-callbacks", err, lager.Data{"callbacks": len(callbacks)})
+			return err
+		}
+	}
+
+	o.add(callbacks)
+	return nil
+}
+
+// Pending returns the number of callbacks not delivered yet.
+func (o *Outbox) Pending() int {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return len(o.entries)
+}
+
+func (o *Outbox) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	logger := o.logger.Session("run")
+
+	if o.store != nil {
+		callbacks, err := o.store.Load()
+		if err != nil {
+			logger.Error("failed-to-load-callbacks", err)
+			return err
+		}
+		if len(callbacks) > 0 {
+			logger.Info("recovered-callbacks", lager.Data{"callbacks": len(callbacks)})
+			o.add(callbacks)
+		}
+	}
+
+	close(ready)
+
+	workers := make(chan struct{}, o.config.Workers)
+	wg := &sync.WaitGroup{}
+	reported := -1
+
+	for {
+		pending, nextDue := o.dispatch(logger, workers, wg)
+		if pending != reported && o.metronClient != nil {
+			o.metronClient.SendMetric(PendingCallbacks, pending)
+			reported = pending
+		}
+
+		var timer clock.Timer
+		var due <-chan time.Time
+		if nextDue != nil {
+			timer = o.clock.NewTimer(*nextDue)
+			due = timer.C()
+		}
+
+		select {
+		case <-o.wake:
+		case <-due:
+		case <-signals:
+			if timer != nil {
+				timer.Stop()
+			}
+			o.drain(logger, workers, wg)
+			wg.Wait()
+			if pending := o.Pending(); pending > 0 {
+				logger.Info("stopping-with-pending-callbacks", lager.Data{"callbacks": pending, "stored": o.store != nil})
+			}
+			return nil
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// drain keeps delivering the callbacks still pending when the outbox is
+// stopped, such as the ones for the auctions the auction drainer has just
+// finished, without waiting out their backoff. It gives up once DrainTimeout
+// expires or the lock is lost.
+func (o *Outbox) drain(logger lager.Logger, workers chan struct{}, wg *sync.WaitGroup) {
+	logger = logger.Session("drain")
+
+	o.lock.Lock()
+	now := o.clock.Now()
+	for _, e := range o.entries {
+		e.due = now
+	}
+	o.lock.Unlock()
+
+	timeout := o.clock.NewTimer(o.config.DrainTimeout)
+	defer timeout.Stop()
+
+	for {
+		if !o.holdsLock() {
+			logger.Info("lock-lost", lager.Data{"callbacks": o.Pending()})
+			return
+		}
+
+		pending, nextDue := o.dispatch(logger, workers, wg)
+		if pending == 0 {
+			return
+		}
+
+		var timer clock.Timer
+		var due <-chan time.Time
+		if nextDue != nil {
+			timer = o.clock.NewTimer(*nextDue)
+			due = timer.C()
+		}
+
+		select {
+		case <-o.wake:
+		case <-due:
+		case <-timeout.C():
+			logger.Info("timed-out", lager.Data{"callbacks": pending, "timeout": o.config.DrainTimeout.String()})
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+func (o *Outbox) holdsLock() bool {
+	if o.fence == nil {
+		return true
+	}
+	_, held := o.fence.FencingToken()
+	return held
+}
+
+func (o *Outbox) add(callbacks []Callback) {
+	o.lock.Lock()
+	now := o.clock.Now()
+	for _, callback := range callbacks {
+		id := callback.ID()
+		if existing, ok := o.entries[id]; ok && existing.inFlight {
+			// the delivery in flight completes the ID, so keep the newer
+			// callback under the stored entry once it returns
+			existing.callback = callback
+			existing.attempts = 0
+			continue
+		}
+		o.entries[id] = &entry{callback: callback, due: now}
+	}
+	o.lock.Unlock()
+
+	o.notify()
+}
+
+func (o *Outbox) notify() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch starts delivering the callbacks that are due, as long as workers
+// are free. It returns the number of pending callbacks and how long until the
+// next one not in flight is due. Nothing is delivered while the lock is not
+// held; the lock is checked again after Backoff.
+func (o *Outbox) dispatch(logger lager.Logger, workers chan struct{}, wg *sync.WaitGroup) (int, *time.Duration) {
+	if !o.holdsLock() {
+		wait := o.config.Backoff
+		return o.Pending(), &wait
+	}
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	now := o.clock.Now()
+	var nextDue *time.Duration
+	for id, e := range o.entries {
+		if e.inFlight {
+			continue
+		}
+
+		if e.due.After(now) {
+			wait := e.due.Sub(now)
+			if nextDue == nil || wait < *nextDue {
+				nextDue = &wait
+			}
+			continue
+		}
+
+		select {
+		case workers <- struct{}{}:
+		default:
+			// every worker is busy; a finishing delivery wakes the loop again
+			continue
+		}
+
+		e.inFlight = true
+		wg.Add(1)
+		go func(id string, callback Callback) {
+			defer wg.Done()
+			err := o.deliver(logger, callback)
+			<-workers
+			o.delivered(logger, id, callback, err)
+		}(id, e.callback)
+	}
+
+	return len(o.entries), nextDue
+}
+
+func (o *Outbox) deliver(logger lager.Logger, callback Callback) error {
+	if !o.holdsLock() {
+		return errLockLost
+	}
+	if callback.ActualLRPKey != nil {
+		return o.bbsClient.FailActualLRP(logger, callback.ActualLRPKey, callback.PlacementError)
+	}
+	return o.bbsClient.RejectTask(logger, callback.TaskGuid, callback.PlacementError)
+}
+
+func (o *Outbox) delivered(logger lager.Logger, id string, callback Callback, err error) {
+	defer o.notify()
+
+	o.storeLock.Lock()
+	defer o.storeLock.Unlock()
+
+	o.lock.Lock()
+	e := o.entries[id]
+	e.inFlight = false
+
+	if e.callback != callback {
+		// a newer callback was enqueued while this one was in flight
+		e.due = o.clock.Now()
+		o.lock.Unlock()
+		return
+	}
+
+	if err == errLockLost {
+		logger.Info("parking-callback", lager.Data{"callback": id})
+		e.due = o.clock.Now().Add(o.config.Backoff)
+		o.lock.Unlock()
+		return
+	}
+
+	done := err == nil || permanent(err)
+	if !done {
+		e.attempts++
+		o.incrementCounter(FailedCallbacksCounter)
+		if e.attempts >= o.config.MaxAttempts {
+			logger.Error("dropping-callback", err, lager.Data{"callback": id, "attempts": e.attempts})
+			o.incrementCounter(DroppedCallbacksCounter)
+			done = true
+		} else {
+			logger.Error("failed-to-deliver-callback", err, lager.Data{"callback": id, "attempts": e.attempts})
+			e.due = o.clock.Now().Add(o.backoff(e.attempts))
+		}
+	} else if err != nil {
+		logger.Info("callback-no-longer-applies", lager.Data{"callback": id, "error": err.Error()})
+	}
+
+	if done {
+		delete(o.entries, id)
+	}
+	o.lock.Unlock()
+
+	if done && o.store != nil {
+		if err := o.store.Complete([]string{id}); err != nil {
+			logger.Error("failed-to-complete-callback", err, lager.Data{"callback": id})
+		}
+	}
+}
+
+func (o *Outbox) backoff(attempts int) time.Duration {
+	backoff := o.config.Backoff
+	for i := 1; i < attempts && backoff < o.config.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > o.config.MaxBackoff {
+		backoff = o.config.MaxBackoff
+	}
+	return backoff
+}
+
+func (o *Outbox) incrementCounter(name string) {
+	if o.metronClient != nil {
+		o.metronClient.IncrementCounter(name)
+	}
+}
+
+// permanent reports whether the BBS refused the callback in a way that will
+// not change on retrying, such as the task or LRP being gone already.
+func permanent(err error) bool {
+	switch models.ConvertError(err).GetType() {
+	case models.Error_ResourceNotFound, models.Error_InvalidStateTransition, models.Error_InvalidRequest:
+		return true
+	default:
+		return false
+	}
+}
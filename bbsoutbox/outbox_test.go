@@ -0,0 +1,372 @@
+package bbsoutbox_test
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/auctioneer/bbsoutbox"
+	"code.cloudfoundry.org/bbs/fake_bbs"
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/clock/fakeclock"
+	mfakes "code.cloudfoundry.org/diego-logging-client/testhelpers"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/lager/lagertest"
+	"github.com/tedsuo/ifrit"
+	"github.com/tedsuo/ifrit/ginkgomon"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakeStore struct {
+	lock         sync.Mutex
+	callbacks    []bbsoutbox.Callback
+	completed    []string
+	appendErr    error
+	beforeAppend func()
+}
+
+func (s *fakeStore) Append(callbacks []bbsoutbox.Callback) error {
+	s.lock.Lock()
+	beforeAppend := s.beforeAppend
+	s.lock.Unlock()
+	if beforeAppend != nil {
+		beforeAppend()
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.appendErr != nil {
+		return s.appendErr
+	}
+	s.callbacks = append(s.callbacks, callbacks...)
+	return nil
+}
+
+func (s *fakeStore) Complete(ids []string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.completed = append(s.completed, ids...)
+	return nil
+}
+
+func (s *fakeStore) Load() ([]bbsoutbox.Callback, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.callbacks, nil
+}
+
+func (s *fakeStore) BeforeAppend(beforeAppend func()) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.beforeAppend = beforeAppend
+}
+
+func (s *fakeStore) Completed() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.completed
+}
+
+type fakeFence struct {
+	lock sync.Mutex
+	held bool
+}
+
+func (f *fakeFence) FencingToken() (uint64, bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return 1, f.held
+}
+
+func (f *fakeFence) SetHeld(held bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.held = held
+}
+
+var _ = Describe("Outbox", func() {
+	var (
+		logger           *lagertest.TestLogger
+		clock            *fakeclock.FakeClock
+		bbsClient        *fake_bbs.FakeInternalClient
+		store            *fakeStore
+		fakeMetronClient *mfakes.FakeIngressClient
+		fence            *fakeFence
+		outbox           *bbsoutbox.Outbox
+		process          ifrit.Process
+
+		lrpKey models.ActualLRPKey
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		clock = fakeclock.NewFakeClock(time.Now())
+		bbsClient = &fake_bbs.FakeInternalClient{}
+		store = &fakeStore{}
+		fakeMetronClient = &mfakes.FakeIngressClient{}
+		fence = &fakeFence{held: true}
+		lrpKey = models.NewActualLRPKey("process-guid", 1, "domain")
+	})
+
+	JustBeforeEach(func() {
+		outbox = bbsoutbox.New(logger, clock, bbsClient, store, fakeMetronClient, fence, bbsoutbox.Config{
+			Workers:      2,
+			MaxAttempts:  3,
+			Backoff:      time.Second,
+			MaxBackoff:   2 * time.Second,
+			DrainTimeout: 10 * time.Second,
+		})
+		process = ginkgomon.Invoke(outbox)
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		exited := process.Wait()
+		Eventually(func() bool {
+			clock.Increment(10 * time.Second)
+			select {
+			case <-exited:
+				return true
+			default:
+				return false
+			}
+		}).Should(BeTrue())
+	})
+
+	It("stores the callbacks and delivers them to the BBS", func() {
+		err := outbox.Enqueue(logger, []bbsoutbox.Callback{
+			bbsoutbox.RejectTask("task-guid", "insufficient resources"),
+			bbsoutbox.FailActualLRP(&lrpKey, "found no compatible cell"),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(store.Load()).To(HaveLen(2))
+
+		Eventually(bbsClient.RejectTaskCallCount).Should(Equal(1))
+		_, taskGuid, reason := bbsClient.RejectTaskArgsForCall(0)
+		Expect(taskGuid).To(Equal("task-guid"))
+		Expect(reason).To(Equal("insufficient resources"))
+
+		Eventually(bbsClient.FailActualLRPCallCount).Should(Equal(1))
+		_, key, reason := bbsClient.FailActualLRPArgsForCall(0)
+		Expect(*key).To(Equal(lrpKey))
+		Expect(reason).To(Equal("found no compatible cell"))
+
+		Eventually(store.Completed).Should(ConsistOf("task/task-guid", "lrp/process-guid/1"))
+		Eventually(outbox.Pending).Should(Equal(0))
+	})
+
+	Context("when a callback is enqueued again while it is delivered", func() {
+		var rejecting chan struct{}
+
+		BeforeEach(func() {
+			rejecting = make(chan struct{})
+			bbsClient.RejectTaskStub = func(lager.Logger, string, string) error {
+				<-rejecting
+				return nil
+			}
+		})
+
+		It("only completes it in the store once the newer callback is delivered", func() {
+			Expect(outbox.Enqueue(logger, []bbsoutbox.Callback{bbsoutbox.RejectTask("task-guid", "first")})).To(Succeed())
+			Eventually(bbsClient.RejectTaskCallCount).Should(Equal(1))
+
+			appendStarted := make(chan struct{})
+			appending := make(chan struct{})
+			store.BeforeAppend(func() {
+				close(appendStarted)
+				<-appending
+			})
+
+			enqueued := make(chan error, 1)
+			go func() {
+				enqueued <- outbox.Enqueue(logger, []bbsoutbox.Callback{bbsoutbox.RejectTask("task-guid", "second")})
+			}()
+			Eventually(appendStarted).Should(BeClosed())
+
+			close(rejecting)
+			Consistently(store.Completed).Should(BeEmpty())
+
+			close(appending)
+			Eventually(enqueued).Should(Receive(BeNil()))
+
+			Eventually(bbsClient.RejectTaskCallCount).Should(Equal(2))
+			_, _, reason := bbsClient.RejectTaskArgsForCall(1)
+			Expect(reason).To(Equal("second"))
+			Eventually(store.Completed).Should(HaveLen(1))
+			Consistently(store.Completed).Should(ConsistOf("task/task-guid"))
+		})
+	})
+
+	Context("when the store cannot take the callbacks", func() {
+		BeforeEach(func() {
+			store.appendErr = errors.New("disk full")
+		})
+
+		It("returns the error and does not deliver them", func() {
+			err := outbox.Enqueue(logger, []bbsoutbox.Callback{bbsoutbox.RejectTask("task-guid", "boom")})
+			Expect(err).To(MatchError("disk full"))
+			Consistently(bbsClient.RejectTaskCallCount).Should(Equal(0))
+		})
+	})
+
+	Context("when callbacks were left in the store", func() {
+		BeforeEach(func() {
+			store.callbacks = []bbsoutbox.Callback{bbsoutbox.RejectTask("left-over-guid", "boom")}
+		})
+
+		It("delivers them on start", func() {
+			Eventually(bbsClient.RejectTaskCallCount).Should(Equal(1))
+			_, taskGuid, _ := bbsClient.RejectTaskArgsForCall(0)
+			Expect(taskGuid).To(Equal("left-over-guid"))
+		})
+	})
+
+	Context("when the BBS cannot be reached", func() {
+		BeforeEach(func() {
+			bbsClient.RejectTaskReturns(errors.New("connection refused"))
+		})
+
+		JustBeforeEach(func() {
+			Expect(outbox.Enqueue(logger, []bbsoutbox.Callback{bbsoutbox.RejectTask("task-guid", "boom")})).To(Succeed())
+			Eventually(bbsClient.RejectTaskCallCount).Should(Equal(1))
+		})
+
+		It("retries with a backoff and counts the failures", func() {
+			clock.WaitForWatcherAndIncrement(999 * time.Millisecond)
+			Consistently(bbsClient.RejectTaskCallCount).Should(Equal(1))
+
+			clock.Increment(time.Millisecond)
+			Eventually(bbsClient.RejectTaskCallCount).Should(Equal(2))
+			Expect(fakeMetronClient.IncrementCounterArgsForCall(0)).To(Equal(bbsoutbox.FailedCallbacksCounter))
+			Expect(outbox.Pending()).To(Equal(1))
+		})
+
+		It("drops the callback once it runs out of attempts", func() {
+			clock.WaitForWatcherAndIncrement(time.Second)
+			Eventually(bbsClient.RejectTaskCallCount).Should(Equal(2))
+			clock.WaitForWatcherAndIncrement(2 * time.Second)
+			Eventually(bbsClient.RejectTaskCallCount).Should(Equal(3))
+
+			Eventually(outbox.Pending).Should(Equal(0))
+			Expect(store.Completed()).To(ConsistOf("task/task-guid"))
+			Expect(fakeMetronClient.IncrementCounterCallCount()).To(Equal(4))
+			Expect(fakeMetronClient.IncrementCounterArgsForCall(3)).To(Equal(bbsoutbox.DroppedCallbacksCounter))
+		})
+
+		It("emits the number of pending callbacks", func() {
+			Eventually(func() bool {
+				for i := 0; i < fakeMetronClient.SendMetricCallCount(); i++ {
+					name, value, _ := fakeMetronClient.SendMetricArgsForCall(i)
+					if name == bbsoutbox.PendingCallbacks && value == 1 {
+						return true
+					}
+				}
+				return false
+			}).Should(BeTrue())
+		})
+	})
+
+	Context("when the BBS no longer knows the task", func() {
+		BeforeEach(func() {
+			bbsClient.RejectTaskReturns(models.ErrResourceNotFound)
+		})
+
+		It("does not retry", func() {
+			Expect(outbox.Enqueue(logger, []bbsoutbox.Callback{bbsoutbox.RejectTask("task-guid", "boom")})).To(Succeed())
+			Eventually(store.Completed).Should(ConsistOf("task/task-guid"))
+			Expect(bbsClient.RejectTaskCallCount()).To(Equal(1))
+		})
+	})
+
+	Context("with more callbacks than workers", func() {
+		var release chan struct{}
+
+		BeforeEach(func() {
+			release = make(chan struct{})
+			bbsClient.RejectTaskStub = func(lager.Logger, string, string) error {
+				<-release
+				return nil
+			}
+		})
+
+		It("only makes as many calls at once as there are workers", func() {
+			Expect(outbox.Enqueue(logger, []bbsoutbox.Callback{
+				bbsoutbox.RejectTask("task-1", "boom"),
+				bbsoutbox.RejectTask("task-2", "boom"),
+				bbsoutbox.RejectTask("task-3", "boom"),
+			})).To(Succeed())
+
+			Eventually(bbsClient.RejectTaskCallCount).Should(Equal(2))
+			Consistently(bbsClient.RejectTaskCallCount).Should(Equal(2))
+
+			close(release)
+			Eventually(bbsClient.RejectTaskCallCount).Should(Equal(3))
+		})
+	})
+
+	Context("when stopped with callbacks waiting for their backoff", func() {
+		BeforeEach(func() {
+			bbsClient.RejectTaskReturnsOnCall(0, errors.New("connection refused"))
+		})
+
+		It("delivers them before stopping", func() {
+			Expect(outbox.Enqueue(logger, []bbsoutbox.Callback{bbsoutbox.RejectTask("task-guid", "boom")})).To(Succeed())
+			Eventually(bbsClient.RejectTaskCallCount).Should(Equal(1))
+			Eventually(outbox.Pending).Should(Equal(1))
+
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive(BeNil()))
+			Expect(bbsClient.RejectTaskCallCount()).To(Equal(2))
+			Expect(store.Completed()).To(ConsistOf("task/task-guid"))
+		})
+	})
+
+	Context("when stopped while the BBS cannot be reached", func() {
+		BeforeEach(func() {
+			bbsClient.RejectTaskReturns(errors.New("connection refused"))
+		})
+
+		It("gives up once the drain timeout expires", func() {
+			Expect(outbox.Enqueue(logger, []bbsoutbox.Callback{bbsoutbox.RejectTask("task-guid", "boom")})).To(Succeed())
+			Eventually(bbsClient.RejectTaskCallCount).Should(Equal(1))
+
+			process.Signal(os.Interrupt)
+			Eventually(bbsClient.RejectTaskCallCount).Should(Equal(2))
+			Consistently(process.Wait()).ShouldNot(Receive())
+
+			clock.WaitForNWatchersAndIncrement(10*time.Second, 2)
+			Eventually(process.Wait()).Should(Receive(BeNil()))
+		})
+	})
+
+	Context("when the lock is not held", func() {
+		BeforeEach(func() {
+			fence.SetHeld(false)
+		})
+
+		It("parks the callbacks until the lock is held again", func() {
+			Expect(outbox.Enqueue(logger, []bbsoutbox.Callback{bbsoutbox.RejectTask("task-guid", "boom")})).To(Succeed())
+			clock.WaitForWatcherAndIncrement(time.Second)
+			Consistently(bbsClient.RejectTaskCallCount).Should(Equal(0))
+			Expect(outbox.Pending()).To(Equal(1))
+			Expect(fakeMetronClient.IncrementCounterCallCount()).To(Equal(0))
+
+			fence.SetHeld(true)
+			clock.WaitForWatcherAndIncrement(time.Second)
+			Eventually(bbsClient.RejectTaskCallCount).Should(Equal(1))
+			Eventually(store.Completed).Should(ConsistOf("task/task-guid"))
+		})
+
+		It("does not drain them when stopped", func() {
+			Expect(outbox.Enqueue(logger, []bbsoutbox.Callback{bbsoutbox.RejectTask("task-guid", "boom")})).To(Succeed())
+
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive(BeNil()))
+			Expect(bbsClient.RejectTaskCallCount()).To(Equal(0))
+			Expect(outbox.Pending()).To(Equal(1))
+		})
+	})
+})
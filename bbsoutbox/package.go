@@ -0,0 +1 @@
+package bbsoutbox // import "code.cloudfoundry.org/auctioneer/bbsoutbox"
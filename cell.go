@@ -0,0 +1,27 @@
+package auctioneer
+
+import "time"
+
+// Cell is a cell the auctioneer auctions work onto, as served by the
+// CellsRoute.
+type Cell struct {
+	CellID     string `json:"cell_id"`
+	RepAddress string `json:"rep_address"`
+	RepURL     string `json:"rep_url,omitempty"`
+
+	// FilteredBy names the cell filter that keeps the cell out of auctions.
+	FilteredBy string `json:"filtered_by,omitempty"`
+
+	// FilteredForDomains lists the domains whose cell filters keep the cell
+	// out of their auctions.
+	FilteredForDomains []string `json:"filtered_for_domains,omitempty"`
+
+	// Quarantine is set while the auctioneer skips the cell because fetching
+	// its state kept failing.
+	Quarantine *CellQuarantine `json:"quarantine,omitempty"`
+}
+
+type CellQuarantine struct {
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	Until               time.Time `json:"until"`
+}
@@ -0,0 +1,153 @@
+package auctioneer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"code.cloudfoundry.org/lager"
+)
+
+type ChunkingConfig struct {
+	// MaxItems is the maximum number of start requests sent in one request.
+	// Zero means unlimited.
+	MaxItems int
+	// MaxBytes is the maximum size of an encoded request body. A single item
+	// larger than MaxBytes is still sent, on its own. Zero means unlimited.
+	MaxBytes int
+	// MaxConcurrency is the number of chunks in flight at once. Zero or one
+	// sends chunks sequentially.
+	MaxConcurrency int
+}
+
+// WithChunking makes the client split large batches into several requests
+// instead of sending them in one body.
+func WithChunking(cfg ChunkingConfig) ClientOption {
+	return func(c *auctioneerClient) {
+		c.chunking = &cfg
+	}
+}
+
+// ErrChunksFailed is returned when some of the chunks of a batch could not be
+// submitted. It unwraps to the first chunk error.
+type ErrChunksFailed struct {
+	Chunks       int
+	FailedChunks int
+	FailedItems  int
+	Err          error
+}
+
+func (e ErrChunksFailed) Error() string {
+	return fmt.Sprintf("%d of %d chunks (%d items) failed: %s", e.FailedChunks, e.Chunks, e.FailedItems, e.Err)
+}
+
+func (e ErrChunksFailed) Unwrap() error {
+	return e.Err
+}
+
+type chunk struct {
+	payload []byte
+	items   int
+}
+
+// splitIntoChunks encodes each item separately and packs the encodings into
+// JSON arrays that respect the configured limits.
+func splitIntoChunks(cfg ChunkingConfig, items []interface{}) ([]chunk, error) {
+	chunks := []chunk{}
+	current := &bytes.Buffer{}
+	currentItems := 0
+
+	closeChunk := func() {
+		current.WriteByte(']')
+		chunks = append(chunks, chunk{payload: current.Bytes(), items: currentItems})
+		current = &bytes.Buffer{}
+		currentItems = 0
+	}
+
+	for _, item := range items {
+		encoded, err := json.Marshal(item)
+		if err != nil {
+			return nil, err
+		}
+
+		if currentItems > 0 {
+			fullByCount := cfg.MaxItems > 0 && currentItems >= cfg.MaxItems
+			// +2 accounts for the separating comma and the closing bracket
+			fullBySize := cfg.MaxBytes > 0 && current.Len()+len(encoded)+2 > cfg.MaxBytes
+			if fullByCount || fullBySize {
+				closeChunk()
+			}
+		}
+
+		if currentItems == 0 {
+			current.WriteByte('[')
+		} else {
+			current.WriteByte(',')
+		}
+		current.Write(encoded)
+		currentItems++
+	}
+
+	if currentItems > 0 || len(chunks) == 0 {
+		if currentItems == 0 {
+			current.WriteByte('[')
+		}
+		closeChunk()
+	}
+
+	return chunks, nil
+}
+
+func (c *auctioneerClient) requestAuctionsInChunks(ctx context.Context, logger lager.Logger, route string, items []interface{}) error {
+	chunks, err := splitIntoChunks(*c.chunking, items)
+	if err != nil {
+		return err
+	}
+
+	if len(chunks) == 1 {
+		return c.requestAuctions(ctx, logger, route, chunks[0].payload)
+	}
+
+	logger.Info("splitting-batch", lager.Data{"items": len(items), "chunks": len(chunks)})
+
+	concurrency := c.chunking.MaxConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	errs := make([]error, len(chunks))
+	semaphore := make(chan struct{}, concurrency)
+	wg := sync.WaitGroup{}
+
+	for i := range chunks {
+		semaphore <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+			errs[i] = c.requestAuctions(ctx, logger.WithData(lager.Data{"chunk": i}), route, chunks[i].payload)
+		}(i)
+	}
+	wg.Wait()
+
+	result := ErrChunksFailed{Chunks: len(chunks)}
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		if result.Err == nil {
+			result.Err = err
+		}
+		result.FailedChunks++
+		result.FailedItems += chunks[i].items
+	}
+
+	if result.Err == nil {
+		return nil
+	}
+	return result
+}
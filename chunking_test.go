@@ -0,0 +1,153 @@
+package auctioneer_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/auctioneer"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/rep"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+)
+
+var _ = Describe("Chunking", func() {
+	var (
+		fakeAuctioneerServer *ghttp.Server
+		logger               *lagertest.TestLogger
+		chunkingConfig       auctioneer.ChunkingConfig
+		client               auctioneer.Client
+
+		receivedLock    sync.Mutex
+		receivedBatches [][]auctioneer.TaskStartRequest
+		statusCodes     map[int]int
+	)
+
+	newTasks := func(n int) []*auctioneer.TaskStartRequest {
+		tasks := make([]*auctioneer.TaskStartRequest, n)
+		for i := range tasks {
+			task := auctioneer.NewTaskStartRequest(rep.NewTask("task-guid", "domain", rep.NewResource(1, 1, 1), rep.NewPlacementConstraint("rootfs", nil, nil)))
+			tasks[i] = &task
+		}
+		return tasks
+	}
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("chunking")
+		receivedBatches = nil
+		statusCodes = map[int]int{}
+		chunkingConfig = auctioneer.ChunkingConfig{}
+
+		fakeAuctioneerServer = ghttp.NewServer()
+		fakeAuctioneerServer.RouteToHandler("POST", "/v1/tasks", func(w http.ResponseWriter, r *http.Request) {
+			body, err := ioutil.ReadAll(r.Body)
+			Expect(err).NotTo(HaveOccurred())
+
+			batch := []auctioneer.TaskStartRequest{}
+			Expect(json.Unmarshal(body, &batch)).To(Succeed())
+			if chunkingConfig.MaxBytes > 0 {
+				Expect(len(body)).To(BeNumerically("<=", chunkingConfig.MaxBytes))
+			}
+
+			receivedLock.Lock()
+			index := len(receivedBatches)
+			receivedBatches = append(receivedBatches, batch)
+			statusCode, ok := statusCodes[index]
+			receivedLock.Unlock()
+
+			if !ok {
+				statusCode = http.StatusAccepted
+			}
+			w.WriteHeader(statusCode)
+		})
+	})
+
+	JustBeforeEach(func() {
+		client = auctioneer.NewClient(fakeAuctioneerServer.URL(), 5*time.Second, auctioneer.WithChunking(chunkingConfig))
+	})
+
+	AfterEach(func() {
+		fakeAuctioneerServer.Close()
+	})
+
+	Context("when limiting by item count", func() {
+		BeforeEach(func() {
+			chunkingConfig.MaxItems = 3
+		})
+
+		It("splits the batch into chunks of at most MaxItems", func() {
+			Expect(client.RequestTaskAuctions(logger, newTasks(7))).To(Succeed())
+
+			Expect(receivedBatches).To(HaveLen(3))
+			Expect(receivedBatches[0]).To(HaveLen(3))
+			Expect(receivedBatches[1]).To(HaveLen(3))
+			Expect(receivedBatches[2]).To(HaveLen(1))
+		})
+
+		It("sends small batches in a single request", func() {
+			Expect(client.RequestTaskAuctions(logger, newTasks(2))).To(Succeed())
+			Expect(receivedBatches).To(HaveLen(1))
+		})
+
+		It("still sends an empty batch", func() {
+			Expect(client.RequestTaskAuctions(logger, newTasks(0))).To(Succeed())
+			Expect(receivedBatches).To(Equal([][]auctioneer.TaskStartRequest{{}}))
+		})
+	})
+
+	Context("when limiting by encoded size", func() {
+		BeforeEach(func() {
+			encoded, err := json.Marshal(newTasks(2))
+			Expect(err).NotTo(HaveOccurred())
+			chunkingConfig.MaxBytes = len(encoded)
+		})
+
+		It("keeps every request body within MaxBytes", func() {
+			Expect(client.RequestTaskAuctions(logger, newTasks(5))).To(Succeed())
+
+			Expect(receivedBatches).To(HaveLen(3))
+			total := 0
+			for _, batch := range receivedBatches {
+				total += len(batch)
+			}
+			Expect(total).To(Equal(5))
+		})
+	})
+
+	Context("when sending chunks concurrently", func() {
+		BeforeEach(func() {
+			chunkingConfig.MaxItems = 1
+			chunkingConfig.MaxConcurrency = 4
+		})
+
+		It("submits every chunk", func() {
+			Expect(client.RequestTaskAuctions(logger, newTasks(10))).To(Succeed())
+			Expect(receivedBatches).To(HaveLen(10))
+		})
+	})
+
+	Context("when some chunks fail", func() {
+		BeforeEach(func() {
+			chunkingConfig.MaxItems = 2
+			statusCodes[1] = http.StatusServiceUnavailable
+		})
+
+		It("returns an ErrChunksFailed describing the failed chunks", func() {
+			err := client.RequestTaskAuctions(logger, newTasks(5))
+
+			var chunksFailed auctioneer.ErrChunksFailed
+			Expect(errors.As(err, &chunksFailed)).To(BeTrue())
+			Expect(chunksFailed.Chunks).To(Equal(3))
+			Expect(chunksFailed.FailedChunks).To(Equal(1))
+			Expect(chunksFailed.FailedItems).To(Equal(2))
+
+			var unavailable auctioneer.ErrUnavailable
+			Expect(errors.As(err, &unavailable)).To(BeTrue())
+		})
+	})
+})
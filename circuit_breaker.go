@@ -0,0 +1,159 @@
+package auctioneer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+)
+
+var ErrCircuitOpen = errors.New("auctioneer circuit breaker is open")
+
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the number of consecutive failed requests after
+	// which the breaker opens.
+	FailureThreshold int
+	// OpenTimeout is how long the breaker fails fast before letting a single
+	// half-open probe through.
+	OpenTimeout time.Duration
+	// OnStateChange, if set, is called after every state transition.
+	OnStateChange func(from, to CircuitState)
+	// Clock defaults to the wall clock.
+	Clock clock.Clock
+}
+
+// WithCircuitBreaker makes the client fail fast with ErrCircuitOpen while the
+// auctioneer keeps failing, instead of waiting out the request timeout on
+// every call.
+func WithCircuitBreaker(cfg CircuitBreakerConfig) ClientOption {
+	return func(c *auctioneerClient) {
+		c.breaker = newCircuitBreaker(cfg)
+	}
+}
+
+type circuitBreaker struct {
+	failureThreshold int
+	openTimeout      time.Duration
+	onStateChange    func(from, to CircuitState)
+	clock            clock.Clock
+
+	lock                sync.Mutex
+	state               CircuitState
+	consecutiveFailures int
+	openedAt            time.Time
+	probing             bool
+}
+
+func newCircuitBreaker(cfg CircuitBreakerConfig) *circuitBreaker {
+	clk := cfg.Clock
+	if clk == nil {
+		clk = clock.NewClock()
+	}
+
+	threshold := cfg.FailureThreshold
+	if threshold < 1 {
+		threshold = 1
+	}
+
+	return &circuitBreaker{
+		failureThreshold: threshold,
+		openTimeout:      cfg.OpenTimeout,
+		onStateChange:    cfg.OnStateChange,
+		clock:            clk,
+	}
+}
+
+// allow reports whether a request may be sent. While half-open only one probe
+// is in flight at a time.
+func (b *circuitBreaker) allow() error {
+	b.lock.Lock()
+	from := b.state
+	err := b.allowLocked()
+	to := b.state
+	b.lock.Unlock()
+
+	b.notify(from, to)
+	return err
+}
+
+func (b *circuitBreaker) allowLocked() error {
+	switch b.state {
+	case CircuitOpen:
+		if b.clock.Since(b.openedAt) < b.openTimeout {
+			return ErrCircuitOpen
+		}
+		b.state = CircuitHalfOpen
+		b.probing = true
+		return nil
+	case CircuitHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// record updates the breaker with the outcome of a request that allow let
+// through.
+func (b *circuitBreaker) record(ctx context.Context, err error) {
+	b.lock.Lock()
+	from := b.state
+	b.probing = false
+	switch {
+	case err == nil:
+		b.consecutiveFailures = 0
+		b.state = CircuitClosed
+	case countsAsFailure(ctx, err):
+		b.consecutiveFailures++
+		if b.state == CircuitHalfOpen || b.consecutiveFailures >= b.failureThreshold {
+			b.openedAt = b.clock.Now()
+			b.state = CircuitOpen
+		}
+	}
+	to := b.state
+	b.lock.Unlock()
+
+	b.notify(from, to)
+}
+
+func (b *circuitBreaker) notify(from, to CircuitState) {
+	if from != to && b.onStateChange != nil {
+		b.onStateChange(from, to)
+	}
+}
+
+// countsAsFailure ignores errors caused by the caller: a rejected payload or
+// a context the caller cancelled says nothing about the auctioneer's health.
+func countsAsFailure(ctx context.Context, err error) bool {
+	var invalidRequest ErrInvalidRequest
+	if errors.As(err, &invalidRequest) {
+		return false
+	}
+	return ctx.Err() == nil
+}
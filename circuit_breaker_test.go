@@ -0,0 +1,136 @@
+package auctioneer_test
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/auctioneer"
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager/lagertest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+)
+
+var _ = Describe("CircuitBreaker", func() {
+	type transition struct {
+		from, to auctioneer.CircuitState
+	}
+
+	var (
+		fakeAuctioneerServer *ghttp.Server
+		logger               *lagertest.TestLogger
+		fakeClock            *fakeclock.FakeClock
+		client               auctioneer.Client
+
+		transitionsLock sync.Mutex
+		transitions     []transition
+	)
+
+	recordedTransitions := func() []transition {
+		transitionsLock.Lock()
+		defer transitionsLock.Unlock()
+		return append([]transition{}, transitions...)
+	}
+
+	request := func() error {
+		return client.RequestLRPAuctions(logger, []*auctioneer.LRPStartRequest{})
+	}
+
+	BeforeEach(func() {
+		fakeAuctioneerServer = ghttp.NewServer()
+		fakeAuctioneerServer.SetAllowUnhandledRequests(true)
+		fakeAuctioneerServer.SetUnhandledRequestStatusCode(http.StatusServiceUnavailable)
+		logger = lagertest.NewTestLogger("circuit-breaker")
+		fakeClock = fakeclock.NewFakeClock(time.Now())
+		transitions = nil
+
+		client = auctioneer.NewClient(fakeAuctioneerServer.URL(), time.Second, auctioneer.WithCircuitBreaker(auctioneer.CircuitBreakerConfig{
+			FailureThreshold: 3,
+			OpenTimeout:      10 * time.Second,
+			Clock:            fakeClock,
+			OnStateChange: func(from, to auctioneer.CircuitState) {
+				transitionsLock.Lock()
+				defer transitionsLock.Unlock()
+				transitions = append(transitions, transition{from, to})
+			},
+		}))
+	})
+
+	AfterEach(func() {
+		fakeAuctioneerServer.Close()
+	})
+
+	Context("when fewer than the threshold of consecutive requests fail", func() {
+		It("stays closed", func() {
+			Expect(request()).To(HaveOccurred())
+			Expect(request()).To(HaveOccurred())
+
+			fakeAuctioneerServer.AppendHandlers(ghttp.RespondWith(http.StatusAccepted, nil))
+			Expect(request()).To(Succeed())
+
+			Expect(request()).To(HaveOccurred())
+			Expect(request()).To(HaveOccurred())
+			Expect(fakeAuctioneerServer.ReceivedRequests()).To(HaveLen(5))
+			Expect(recordedTransitions()).To(BeEmpty())
+		})
+	})
+
+	Context("when the threshold of consecutive failures is reached", func() {
+		BeforeEach(func() {
+			for i := 0; i < 3; i++ {
+				Expect(request()).To(HaveOccurred())
+			}
+		})
+
+		It("opens and fails fast without contacting the auctioneer", func() {
+			Expect(recordedTransitions()).To(Equal([]transition{{auctioneer.CircuitClosed, auctioneer.CircuitOpen}}))
+
+			Expect(request()).To(MatchError(auctioneer.ErrCircuitOpen))
+			Expect(fakeAuctioneerServer.ReceivedRequests()).To(HaveLen(3))
+		})
+
+		Context("and the open timeout elapses", func() {
+			BeforeEach(func() {
+				fakeClock.Increment(10 * time.Second)
+			})
+
+			It("closes again when the half-open probe succeeds", func() {
+				fakeAuctioneerServer.AppendHandlers(ghttp.RespondWith(http.StatusAccepted, nil))
+
+				Expect(request()).To(Succeed())
+				Expect(recordedTransitions()).To(Equal([]transition{
+					{auctioneer.CircuitClosed, auctioneer.CircuitOpen},
+					{auctioneer.CircuitOpen, auctioneer.CircuitHalfOpen},
+					{auctioneer.CircuitHalfOpen, auctioneer.CircuitClosed},
+				}))
+			})
+
+			It("re-opens when the half-open probe fails", func() {
+				Expect(request()).To(HaveOccurred())
+				Expect(recordedTransitions()).To(Equal([]transition{
+					{auctioneer.CircuitClosed, auctioneer.CircuitOpen},
+					{auctioneer.CircuitOpen, auctioneer.CircuitHalfOpen},
+					{auctioneer.CircuitHalfOpen, auctioneer.CircuitOpen},
+				}))
+
+				Expect(request()).To(MatchError(auctioneer.ErrCircuitOpen))
+				Expect(fakeAuctioneerServer.ReceivedRequests()).To(HaveLen(4))
+			})
+		})
+	})
+
+	Context("when the auctioneer rejects the request as invalid", func() {
+		BeforeEach(func() {
+			fakeAuctioneerServer.RouteToHandler("POST", "/v1/lrps", ghttp.RespondWith(http.StatusBadRequest, nil))
+		})
+
+		It("does not count towards opening the breaker", func() {
+			for i := 0; i < 5; i++ {
+				Expect(request()).To(BeAssignableToTypeOf(auctioneer.ErrInvalidRequest{}))
+			}
+			Expect(recordedTransitions()).To(BeEmpty())
+		})
+	})
+})
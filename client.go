@@ -2,8 +2,8 @@ package auctioneer
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"fmt"
 	"net/http"
 	"time"
 
@@ -17,6 +17,43 @@ import (
 type Client interface {
 	RequestLRPAuctions(logger lager.Logger, lrpStart []*LRPStartRequest) error
 	RequestTaskAuctions(logger lager.Logger, tasks []*TaskStartRequest) error
+
+	// The Context variants honor cancellation and deadlines of ctx on top of
+	// the client's request timeout, and forward the request ID stored in ctx
+	// (see WithRequestID) to the auctioneer.
+	RequestLRPAuctionsContext(ctx context.Context, logger lager.Logger, lrpStart []*LRPStartRequest) error
+	RequestTaskAuctionsContext(ctx context.Context, logger lager.Logger, tasks []*TaskStartRequest) error
+
+	// Cells lists the cells of the auctioneer holding the lock, including
+	// the ones it currently skips.
+	Cells(logger lager.Logger) ([]Cell, error)
+	// ClearCellQuarantine lets the next auction try cellID again.
+	ClearCellQuarantine(logger lager.Logger, cellID string) error
+
+	// PreviewLRPAuctions and PreviewTaskAuctions explain how the auctioneer
+	// holding the lock would place the start requests, without scheduling
+	// them.
+	PreviewLRPAuctions(logger lager.Logger, lrpStarts []*LRPStartRequest) ([]PlacementExplanation, error)
+	PreviewTaskAuctions(logger lager.Logger, tasks []*TaskStartRequest) ([]PlacementExplanation, error)
+
+	// Status reports the leadership and placement failures of the
+	// auctioneer the client talks to, which need not hold the lock.
+	Status(logger lager.Logger) (Status, error)
+}
+
+const RequestIDHeader = "X-Vcap-Request-Id"
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying requestID. Requests made with
+// the returned context send it to the auctioneer in the RequestIDHeader.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
 }
 
 type auctioneerClient struct {
@@ -25,19 +62,27 @@ type auctioneerClient struct {
 	url                string
 	requireTLS         bool
 	reqGen             *rata.RequestGenerator
+	breaker            *circuitBreaker
+	chunking           *ChunkingConfig
 }
 
-func NewClient(auctioneerURL string, requestTimeout time.Duration) Client {
-	return &auctioneerClient{
+type ClientOption func(*auctioneerClient)
+
+func NewClient(auctioneerURL string, requestTimeout time.Duration, opts ...ClientOption) Client {
+	client := &auctioneerClient{
 		httpClient: cfhttp.NewClient(
 			cfhttp.WithRequestTimeout(requestTimeout),
 		),
 		url:    auctioneerURL,
 		reqGen: rata.NewRequestGenerator(auctioneerURL, Routes),
 	}
+	for _, opt := range opts {
+		opt(client)
+	}
+	return client
 }
 
-func NewSecureClient(auctioneerURL, caFile, certFile, keyFile string, requireTLS bool, requestTimeout time.Duration) (Client, error) {
+func NewSecureClient(auctioneerURL, caFile, certFile, keyFile string, requireTLS bool, requestTimeout time.Duration, opts ...ClientOption) (Client, error) {
 	insecureHTTPClient := cfhttp.NewClient(
 		cfhttp.WithRequestTimeout(requestTimeout),
 	)
@@ -55,75 +100,220 @@ func NewSecureClient(auctioneerURL, caFile, certFile, keyFile string, requireTLS
 		cfhttp.WithTLSConfig(tlsConfig),
 	)
 
-	return &auctioneerClient{
+	client := &auctioneerClient{
 		httpClient:         httpClient,
 		insecureHTTPClient: insecureHTTPClient,
 		url:                auctioneerURL,
 		requireTLS:         requireTLS,
 		reqGen:             rata.NewRequestGenerator(auctioneerURL, Routes),
-	}, nil
+	}
+	for _, opt := range opts {
+		opt(client)
+	}
+	return client, nil
 }
 
 func (c *auctioneerClient) RequestLRPAuctions(logger lager.Logger, lrpStarts []*LRPStartRequest) error {
+	return c.RequestLRPAuctionsContext(context.Background(), logger, lrpStarts)
+}
+
+func (c *auctioneerClient) RequestLRPAuctionsContext(ctx context.Context, logger lager.Logger, lrpStarts []*LRPStartRequest) error {
 	logger = logger.Session("request-lrp-auctions")
 
+	if c.chunking != nil {
+		items := make([]interface{}, len(lrpStarts))
+		for i := range lrpStarts {
+			items[i] = lrpStarts[i]
+		}
+		return c.requestAuctionsInChunks(ctx, logger, CreateLRPAuctionsRoute, items)
+	}
+
 	payload, err := json.Marshal(lrpStarts)
 	if err != nil {
 		return err
 	}
 
-	resp, err := c.createRequest(logger, CreateLRPAuctionsRoute, rata.Params{}, payload)
+	return c.requestAuctions(ctx, logger, CreateLRPAuctionsRoute, payload)
+}
+
+func (c *auctioneerClient) RequestTaskAuctions(logger lager.Logger, tasks []*TaskStartRequest) error {
+	return c.RequestTaskAuctionsContext(context.Background(), logger, tasks)
+}
+
+func (c *auctioneerClient) RequestTaskAuctionsContext(ctx context.Context, logger lager.Logger, tasks []*TaskStartRequest) error {
+	logger = logger.Session("request-task-auctions")
+
+	if c.chunking != nil {
+		items := make([]interface{}, len(tasks))
+		for i := range tasks {
+			items[i] = tasks[i]
+		}
+		return c.requestAuctionsInChunks(ctx, logger, CreateTaskAuctionsRoute, items)
+	}
+
+	payload, err := json.Marshal(tasks)
 	if err != nil {
 		return err
 	}
+
+	return c.requestAuctions(ctx, logger, CreateTaskAuctionsRoute, payload)
+}
+
+func (c *auctioneerClient) Cells(logger lager.Logger) ([]Cell, error) {
+	logger = logger.Session("cells")
+
+	resp, err := c.createRequest(context.Background(), logger, CellsRoute, rata.Params{}, nil)
+	if err != nil {
+		return nil, err
+	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusAccepted {
-		return fmt.Errorf("http error: status code %d (%s)", resp.StatusCode, http.StatusText(resp.StatusCode))
+	if resp.StatusCode != http.StatusOK {
+		return nil, errorFromResponse(resp)
+	}
+
+	cells := []Cell{}
+	if err := json.NewDecoder(resp.Body).Decode(&cells); err != nil {
+		return nil, err
+	}
+
+	return cells, nil
+}
+
+func (c *auctioneerClient) ClearCellQuarantine(logger lager.Logger, cellID string) error {
+	logger = logger.Session("clear-cell-quarantine", lager.Data{"cell-id": cellID})
+
+	resp, err := c.createRequest(context.Background(), logger, ClearCellQuarantineRoute, rata.Params{"cell_id": cellID}, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return errorFromResponse(resp)
 	}
 
 	return nil
 }
 
-func (c *auctioneerClient) RequestTaskAuctions(logger lager.Logger, tasks []*TaskStartRequest) error {
-	logger = logger.Session("request-task-auctions")
+func (c *auctioneerClient) PreviewLRPAuctions(logger lager.Logger, lrpStarts []*LRPStartRequest) ([]PlacementExplanation, error) {
+	logger = logger.Session("preview-lrp-auctions")
+
+	payload, err := json.Marshal(lrpStarts)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.preview(logger, PreviewLRPAuctionsRoute, payload)
+}
+
+func (c *auctioneerClient) PreviewTaskAuctions(logger lager.Logger, tasks []*TaskStartRequest) ([]PlacementExplanation, error) {
+	logger = logger.Session("preview-task-auctions")
 
 	payload, err := json.Marshal(tasks)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	return c.preview(logger, PreviewTaskAuctionsRoute, payload)
+}
+
+func (c *auctioneerClient) preview(logger lager.Logger, route string, payload []byte) ([]PlacementExplanation, error) {
+	resp, err := c.createRequest(context.Background(), logger, route, rata.Params{}, payload)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errorFromResponse(resp)
+	}
+
+	explanations := []PlacementExplanation{}
+	if err := json.NewDecoder(resp.Body).Decode(&explanations); err != nil {
+		return nil, err
+	}
+
+	return explanations, nil
+}
+
+func (c *auctioneerClient) Status(logger lager.Logger) (Status, error) {
+	logger = logger.Session("status")
+
+	resp, err := c.createRequest(context.Background(), logger, StatusRoute, rata.Params{}, nil)
+	if err != nil {
+		return Status{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Status{}, errorFromResponse(resp)
+	}
+
+	status := Status{}
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return Status{}, err
+	}
+
+	return status, nil
+}
+
+func (c *auctioneerClient) requestAuctions(ctx context.Context, logger lager.Logger, route string, payload []byte) error {
+	if c.breaker != nil {
+		if err := c.breaker.allow(); err != nil {
+			logger.Error("circuit-breaker-rejected-request", err)
+			return err
+		}
 	}
 
-	resp, err := c.createRequest(logger, CreateTaskAuctionsRoute, rata.Params{}, payload)
+	err := c.submitAuctions(ctx, logger, route, payload)
+	if c.breaker != nil {
+		c.breaker.record(ctx, err)
+	}
+	return err
+}
+
+func (c *auctioneerClient) submitAuctions(ctx context.Context, logger lager.Logger, route string, payload []byte) error {
+	resp, err := c.createRequest(ctx, logger, route, rata.Params{}, payload)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusAccepted {
-		return fmt.Errorf("http error: status code %d (%s)", resp.StatusCode, http.StatusText(resp.StatusCode))
+		return errorFromResponse(resp)
 	}
 
 	return nil
 }
 
-func (c *auctioneerClient) createRequest(logger lager.Logger, route string, params rata.Params, payload []byte) (*http.Response, error) {
-	resp, err := c.doRequest(c.httpClient, false, route, params, payload)
+func (c *auctioneerClient) createRequest(ctx context.Context, logger lager.Logger, route string, params rata.Params, payload []byte) (*http.Response, error) {
+	resp, err := c.doRequest(ctx, c.httpClient, false, route, params, payload)
 	if err != nil {
+		// The caller gave up, so there is no point in trying again
+		if ctx.Err() != nil {
+			return resp, err
+		}
+
 		// Fall back to HTTP and try again if we do not require TLS
 		if !c.requireTLS && c.insecureHTTPClient != nil {
 			logger.Error("retrying-on-http", err)
-			return c.doRequest(c.insecureHTTPClient, true, route, params, payload)
+			return c.doRequest(ctx, c.insecureHTTPClient, true, route, params, payload)
 		}
 	}
 	return resp, err
 }
 
-func (c *auctioneerClient) doRequest(client *http.Client, useHttp bool, route string, params rata.Params, payload []byte) (*http.Response, error) {
+func (c *auctioneerClient) doRequest(ctx context.Context, client *http.Client, useHttp bool, route string, params rata.Params, payload []byte) (*http.Response, error) {
 	req, err := c.reqGen.CreateRequest(route, params, bytes.NewBuffer(payload))
 	if err != nil {
 		return nil, err
 	}
+	req = req.WithContext(ctx)
 	req.Header.Set("Content-Type", "application/json")
+	if requestID := RequestIDFromContext(ctx); requestID != "" {
+		req.Header.Set(RequestIDHeader, requestID)
+	}
 	if useHttp {
 		req.URL.Scheme = "http"
 	}
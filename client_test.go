@@ -2,6 +2,7 @@ package auctioneer_test
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"os"
 	"path"
@@ -52,6 +53,287 @@ var _ = Describe("Auctioneer Client", func() {
 
 	})
 
+	Describe("RequestLRPAuctionsContext", func() {
+		var (
+			fakeAuctioneerServer *ghttp.Server
+			dummyLogger          lager.Logger
+			c                    auctioneer.Client
+		)
+
+		BeforeEach(func() {
+			fakeAuctioneerServer = ghttp.NewServer()
+			dummyLogger = lagertest.NewTestLogger("client_test")
+			c = auctioneer.NewClient(fakeAuctioneerServer.URL(), 5*time.Second)
+		})
+
+		AfterEach(func() {
+			fakeAuctioneerServer.Close()
+		})
+
+		It("forwards the request id stored in the context", func() {
+			fakeAuctioneerServer.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyRequest("POST", "/v1/lrps"),
+				ghttp.VerifyHeaderKV(auctioneer.RequestIDHeader, "some-request-id"),
+				ghttp.RespondWith(http.StatusAccepted, nil),
+			))
+
+			ctx := auctioneer.WithRequestID(context.Background(), "some-request-id")
+			err := c.RequestLRPAuctionsContext(ctx, dummyLogger, []*auctioneer.LRPStartRequest{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeAuctioneerServer.ReceivedRequests()).To(HaveLen(1))
+		})
+
+		Context("when the context deadline is shorter than the request timeout", func() {
+			BeforeEach(func() {
+				fakeAuctioneerServer.AppendHandlers(ghttp.CombineHandlers(
+					func(rw http.ResponseWriter, r *http.Request) {
+						time.Sleep(2 * time.Second)
+					},
+					ghttp.RespondWith(http.StatusAccepted, nil),
+				))
+			})
+
+			It("returns once the deadline is exceeded", func() {
+				ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+				defer cancel()
+
+				err := c.RequestLRPAuctionsContext(ctx, dummyLogger, []*auctioneer.LRPStartRequest{})
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring(context.DeadlineExceeded.Error()))
+			})
+		})
+
+		Context("when the context is cancelled", func() {
+			It("does not make the request", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+
+				err := c.RequestLRPAuctionsContext(ctx, dummyLogger, []*auctioneer.LRPStartRequest{})
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring(context.Canceled.Error()))
+				Expect(fakeAuctioneerServer.ReceivedRequests()).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("RequestTaskAuctionsContext", func() {
+		var (
+			fakeAuctioneerServer *ghttp.Server
+			dummyLogger          lager.Logger
+		)
+
+		BeforeEach(func() {
+			fakeAuctioneerServer = ghttp.NewServer()
+			fakeAuctioneerServer.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyRequest("POST", "/v1/tasks"),
+				ghttp.VerifyHeaderKV(auctioneer.RequestIDHeader, "some-request-id"),
+				ghttp.RespondWith(http.StatusAccepted, nil),
+			))
+			dummyLogger = lagertest.NewTestLogger("client_test")
+		})
+
+		AfterEach(func() {
+			fakeAuctioneerServer.Close()
+		})
+
+		It("forwards the request id stored in the context", func() {
+			c := auctioneer.NewClient(fakeAuctioneerServer.URL(), 5*time.Second)
+
+			ctx := auctioneer.WithRequestID(context.Background(), "some-request-id")
+			err := c.RequestTaskAuctionsContext(ctx, dummyLogger, []*auctioneer.TaskStartRequest{})
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Describe("cells", func() {
+		var (
+			fakeAuctioneerServer *ghttp.Server
+			dummyLogger          lager.Logger
+			c                    auctioneer.Client
+		)
+
+		BeforeEach(func() {
+			fakeAuctioneerServer = ghttp.NewServer()
+			dummyLogger = lagertest.NewTestLogger("client_test")
+			c = auctioneer.NewClient(fakeAuctioneerServer.URL(), 5*time.Second)
+		})
+
+		AfterEach(func() {
+			fakeAuctioneerServer.Close()
+		})
+
+		It("lists the cells", func() {
+			cells := []auctioneer.Cell{
+				{CellID: "cell-A", RepAddress: "cell-a.url"},
+				{
+					CellID:     "cell-B",
+					RepAddress: "cell-b.url",
+					Quarantine: &auctioneer.CellQuarantine{ConsecutiveFailures: 3, Until: time.Unix(1000, 0).UTC()},
+				},
+			}
+			fakeAuctioneerServer.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/v1/cells"),
+				ghttp.RespondWithJSONEncoded(http.StatusOK, cells),
+			))
+
+			Expect(c.Cells(dummyLogger)).To(Equal(cells))
+		})
+
+		It("clears the quarantine of a cell", func() {
+			fakeAuctioneerServer.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyRequest("DELETE", "/v1/cells/cell-B/quarantine"),
+				ghttp.RespondWith(http.StatusNoContent, nil),
+			))
+
+			Expect(c.ClearCellQuarantine(dummyLogger, "cell-B")).To(Succeed())
+		})
+
+		Context("when the cell is not quarantined", func() {
+			It("returns the error", func() {
+				fakeAuctioneerServer.AppendHandlers(ghttp.RespondWithJSONEncoded(http.StatusNotFound, map[string]string{"error": "not quarantined"}))
+
+				err := c.ClearCellQuarantine(dummyLogger, "cell-A")
+				Expect(err).To(Equal(auctioneer.ErrUnexpectedStatus{StatusCode: http.StatusNotFound, Message: "not quarantined"}))
+			})
+		})
+	})
+
+	Describe("previews and status", func() {
+		var (
+			fakeAuctioneerServer *ghttp.Server
+			dummyLogger          lager.Logger
+			c                    auctioneer.Client
+		)
+
+		BeforeEach(func() {
+			fakeAuctioneerServer = ghttp.NewServer()
+			dummyLogger = lagertest.NewTestLogger("client_test")
+			c = auctioneer.NewClient(fakeAuctioneerServer.URL(), 5*time.Second)
+		})
+
+		AfterEach(func() {
+			fakeAuctioneerServer.Close()
+		})
+
+		It("previews LRP auctions", func() {
+			explanations := []auctioneer.PlacementExplanation{{
+				Identifier: "process-guid",
+				Cells:      []auctioneer.CellExplanation{{CellID: "cell-A"}},
+				BestCellID: "cell-A",
+			}}
+			fakeAuctioneerServer.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyRequest("POST", "/v1/lrps/preview"),
+				ghttp.RespondWithJSONEncoded(http.StatusOK, explanations),
+			))
+
+			Expect(c.PreviewLRPAuctions(dummyLogger, []*auctioneer.LRPStartRequest{{ProcessGuid: "process-guid"}})).To(Equal(explanations))
+		})
+
+		It("previews task auctions", func() {
+			fakeAuctioneerServer.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyRequest("POST", "/v1/tasks/preview"),
+				ghttp.RespondWithJSONEncoded(http.StatusServiceUnavailable, map[string]string{"error": "placement explanations are not available"}),
+			))
+
+			_, err := c.PreviewTaskAuctions(dummyLogger, []*auctioneer.TaskStartRequest{})
+			Expect(err).To(BeAssignableToTypeOf(auctioneer.ErrUnavailable{}))
+		})
+
+		It("fetches the status", func() {
+			status := auctioneer.Status{
+				IsLeader:          true,
+				FencingToken:      3,
+				PlacementFailures: map[auctioneer.PlacementFailureReason]uint64{auctioneer.PlacementFailureInsufficientMemory: 2},
+			}
+			fakeAuctioneerServer.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/v1/status"),
+				ghttp.RespondWithJSONEncoded(http.StatusOK, status),
+			))
+
+			Expect(c.Status(dummyLogger)).To(Equal(status))
+		})
+	})
+
+	Describe("error responses", func() {
+		var (
+			fakeAuctioneerServer *ghttp.Server
+			dummyLogger          lager.Logger
+			c                    auctioneer.Client
+		)
+
+		BeforeEach(func() {
+			fakeAuctioneerServer = ghttp.NewServer()
+			dummyLogger = lagertest.NewTestLogger("client_test")
+			c = auctioneer.NewClient(fakeAuctioneerServer.URL(), 5*time.Second)
+		})
+
+		AfterEach(func() {
+			fakeAuctioneerServer.Close()
+		})
+
+		respondWith := func(statusCode int, body interface{}) {
+			fakeAuctioneerServer.AppendHandlers(ghttp.RespondWithJSONEncoded(statusCode, body))
+		}
+
+		It("returns ErrInvalidRequest with the server message on 400", func() {
+			respondWith(http.StatusBadRequest, map[string]string{"error": "bad json"})
+
+			err := c.RequestTaskAuctions(dummyLogger, []*auctioneer.TaskStartRequest{})
+			var invalidRequest auctioneer.ErrInvalidRequest
+			Expect(errors.As(err, &invalidRequest)).To(BeTrue())
+			Expect(invalidRequest.Message).To(Equal("bad json"))
+			Expect(err.Error()).To(Equal("invalid request: bad json"))
+		})
+
+		It("returns ErrNotLeader on 421", func() {
+			respondWith(http.StatusMisdirectedRequest, map[string]string{"error": "not holding the lock"})
+
+			err := c.RequestLRPAuctions(dummyLogger, []*auctioneer.LRPStartRequest{})
+			var notLeader auctioneer.ErrNotLeader
+			Expect(errors.As(err, &notLeader)).To(BeTrue())
+			Expect(notLeader.Message).To(Equal("not holding the lock"))
+		})
+
+		It("returns ErrTooManyRequests on 429", func() {
+			respondWith(http.StatusTooManyRequests, map[string]string{"error": "slow down"})
+
+			err := c.RequestLRPAuctions(dummyLogger, []*auctioneer.LRPStartRequest{})
+			var tooManyRequests auctioneer.ErrTooManyRequests
+			Expect(errors.As(err, &tooManyRequests)).To(BeTrue())
+			Expect(tooManyRequests.Message).To(Equal("slow down"))
+		})
+
+		It("returns ErrUnavailable on 503", func() {
+			respondWith(http.StatusServiceUnavailable, map[string]string{"error": "draining"})
+
+			err := c.RequestLRPAuctions(dummyLogger, []*auctioneer.LRPStartRequest{})
+			var unavailable auctioneer.ErrUnavailable
+			Expect(errors.As(err, &unavailable)).To(BeTrue())
+			Expect(unavailable.Message).To(Equal("draining"))
+		})
+
+		Context("when the status code is not otherwise recognized", func() {
+			It("returns ErrUnexpectedStatus with the status code", func() {
+				respondWith(http.StatusInternalServerError, map[string]string{"error": "boom"})
+
+				err := c.RequestLRPAuctions(dummyLogger, []*auctioneer.LRPStartRequest{})
+				var unexpected auctioneer.ErrUnexpectedStatus
+				Expect(errors.As(err, &unexpected)).To(BeTrue())
+				Expect(unexpected.StatusCode).To(Equal(http.StatusInternalServerError))
+				Expect(err.Error()).To(Equal("http error: status code 500 (Internal Server Error): boom"))
+			})
+		})
+
+		Context("when the body is not a HandlerError", func() {
+			It("returns the error without a message", func() {
+				fakeAuctioneerServer.AppendHandlers(ghttp.RespondWith(http.StatusBadRequest, "<html>nope</html>"))
+
+				err := c.RequestLRPAuctions(dummyLogger, []*auctioneer.LRPStartRequest{})
+				Expect(err).To(Equal(auctioneer.ErrInvalidRequest{}))
+			})
+		})
+	})
+
 	Describe("NewSecureClient", func() {
 		var (
 			caFile, certFile, keyFile string
@@ -0,0 +1,544 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/ghodss/yaml"
+
+	"code.cloudfoundry.org/auctioneer"
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/consuladapter"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/locket"
+)
+
+const usage = `Usage: auctioneer-cli <command> [flags]
+
+Commands:
+  leader            print the presence of the auctioneer currently holding the lock
+  submit-tasks      submit the task start requests in -file
+  submit-lrps       submit the LRP start requests in -file
+  preview-tasks     explain how the task start requests in -file would be placed
+  preview-lrps      explain how the LRP start requests in -file would be placed
+  tail              print leadership changes and placement failures as they happen
+  cells             list the cells the auctioneer auctions work onto
+  quarantine        list the cells skipped after repeatedly failing to report their state
+  clear-quarantine  let the next auction try the cell -cell-id again
+
+Run 'auctioneer-cli <command> -h' for the flags of a command.
+`
+
+type command struct {
+	run        func(flags *globalFlags, out io.Writer) error
+	extraFlags func(fs *flag.FlagSet, flags *globalFlags)
+}
+
+type globalFlags struct {
+	auctioneerURL string
+	caFile        string
+	certFile      string
+	keyFile       string
+	requireTLS    bool
+	timeout       time.Duration
+
+	consulCluster string
+
+	locketAddress        string
+	locketCACertFile     string
+	locketClientCertFile string
+	locketClientKeyFile  string
+
+	file string
+
+	cellID string
+
+	interval time.Duration
+}
+
+var commands = map[string]command{
+	"leader": {
+		run: runLeader,
+	},
+	"submit-tasks": {
+		run:        runSubmitTasks,
+		extraFlags: fileFlag,
+	},
+	"submit-lrps": {
+		run:        runSubmitLRPs,
+		extraFlags: fileFlag,
+	},
+	"preview-tasks": {
+		run:        runPreviewTasks,
+		extraFlags: fileFlag,
+	},
+	"preview-lrps": {
+		run:        runPreviewLRPs,
+		extraFlags: fileFlag,
+	},
+	"tail": {
+		run:        runTail,
+		extraFlags: intervalFlag,
+	},
+	"cells": {
+		run: runCells,
+	},
+	"quarantine": {
+		run: runQuarantine,
+	},
+	"clear-quarantine": {
+		run:        runClearQuarantine,
+		extraFlags: cellIDFlag,
+	},
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return errors.New("no command given")
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprint(stderr, usage)
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+
+	flags := &globalFlags{}
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	auctioneerFlags(fs, flags)
+	if cmd.extraFlags != nil {
+		cmd.extraFlags(fs, flags)
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	return cmd.run(flags, stdout)
+}
+
+func auctioneerFlags(fs *flag.FlagSet, flags *globalFlags) {
+	fs.StringVar(&flags.auctioneerURL, "auctioneer-url", "", "URL of the auctioneer; looked up through -consul-cluster or -locket-address when empty")
+	fs.StringVar(&flags.caFile, "ca-file", "", "CA certificate used to verify the auctioneer")
+	fs.StringVar(&flags.certFile, "cert-file", "", "client certificate presented to the auctioneer")
+	fs.StringVar(&flags.keyFile, "key-file", "", "client key presented to the auctioneer")
+	fs.BoolVar(&flags.requireTLS, "require-tls", false, "do not fall back to plain HTTP when TLS fails")
+	fs.DurationVar(&flags.timeout, "timeout", 10*time.Second, "request timeout")
+	fs.StringVar(&flags.consulCluster, "consul-cluster", "", "consul cluster URL used to find the current auctioneer")
+	fs.StringVar(&flags.locketAddress, "locket-address", "", "address of Locket, used to find the current auctioneer without Consul")
+	fs.StringVar(&flags.locketCACertFile, "locket-ca-cert-file", "", "CA certificate used to verify Locket")
+	fs.StringVar(&flags.locketClientCertFile, "locket-client-cert-file", "", "client certificate presented to Locket")
+	fs.StringVar(&flags.locketClientKeyFile, "locket-client-key-file", "", "client key presented to Locket")
+}
+
+func fileFlag(fs *flag.FlagSet, flags *globalFlags) {
+	fs.StringVar(&flags.file, "file", "", "JSON or YAML file containing a list of start requests ('-' for stdin)")
+}
+
+func cellIDFlag(fs *flag.FlagSet, flags *globalFlags) {
+	fs.StringVar(&flags.cellID, "cell-id", "", "ID of the cell")
+}
+
+func intervalFlag(fs *flag.FlagSet, flags *globalFlags) {
+	fs.DurationVar(&flags.interval, "interval", 5*time.Second, "how often to poll the auctioneer")
+}
+
+func runLeader(flags *globalFlags, out io.Writer) error {
+	serviceClient, err := newServiceClient(flags)
+	if err != nil {
+		return err
+	}
+
+	presence, err := serviceClient.CurrentAuctioneer()
+	if err != nil {
+		return err
+	}
+
+	return printJSON(out, presence)
+}
+
+func runSubmitTasks(flags *globalFlags, out io.Writer) error {
+	tasks, err := readTasks(flags.file)
+	if err != nil {
+		return err
+	}
+
+	client, err := newClient(flags)
+	if err != nil {
+		return err
+	}
+
+	if err := client.RequestTaskAuctions(newLogger(), tasks); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "submitted %d task(s)\n", len(tasks))
+	return nil
+}
+
+func runSubmitLRPs(flags *globalFlags, out io.Writer) error {
+	starts, err := readLRPs(flags.file)
+	if err != nil {
+		return err
+	}
+
+	client, err := newClient(flags)
+	if err != nil {
+		return err
+	}
+
+	if err := client.RequestLRPAuctions(newLogger(), starts); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "submitted %d lrp start(s)\n", len(starts))
+	return nil
+}
+
+func runPreviewTasks(flags *globalFlags, out io.Writer) error {
+	tasks, err := readTasks(flags.file)
+	if err != nil {
+		return err
+	}
+
+	client, err := newClient(flags)
+	if err != nil {
+		return err
+	}
+
+	explanations, err := client.PreviewTaskAuctions(newLogger(), tasks)
+	if err != nil {
+		return err
+	}
+
+	return printJSON(out, explanations)
+}
+
+func runPreviewLRPs(flags *globalFlags, out io.Writer) error {
+	starts, err := readLRPs(flags.file)
+	if err != nil {
+		return err
+	}
+
+	client, err := newClient(flags)
+	if err != nil {
+		return err
+	}
+
+	explanations, err := client.PreviewLRPAuctions(newLogger(), starts)
+	if err != nil {
+		return err
+	}
+
+	return printJSON(out, explanations)
+}
+
+// tailEvent is printed as a line of JSON by the tail command.
+type tailEvent struct {
+	Time         time.Time                         `json:"time"`
+	Event        string                            `json:"event"`
+	Leader       *auctioneer.Presence              `json:"leader,omitempty"`
+	FencingToken uint64                            `json:"fencing_token,omitempty"`
+	Reason       auctioneer.PlacementFailureReason `json:"reason,omitempty"`
+	Count        uint64                            `json:"count,omitempty"`
+	Error        string                            `json:"error,omitempty"`
+}
+
+// runTail polls the status of the auctioneer until interrupted. Placement
+// failures are counted by each auctioneer on its own, so unless -auctioneer-url
+// is set the command follows the leader to see the failures of new auctions.
+func runTail(flags *globalFlags, out io.Writer) error {
+	logger := newLogger()
+	encoder := json.NewEncoder(out)
+
+	client, err := newClient(flags)
+	if err != nil {
+		return err
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	ticker := time.NewTicker(flags.interval)
+	defer ticker.Stop()
+
+	var last *auctioneer.Status
+	for {
+		status, err := client.Status(logger)
+		if err != nil {
+			encoder.Encode(tailEvent{Time: time.Now(), Event: "status-failed", Error: err.Error()})
+		} else {
+			for _, event := range statusEvents(last, status) {
+				encoder.Encode(event)
+			}
+			last = &status
+
+			if flags.auctioneerURL == "" && !status.IsLeader && status.Leader != nil {
+				client, err = newClientFor(flags, *status.Leader)
+				if err != nil {
+					return err
+				}
+				last = nil
+			}
+		}
+
+		select {
+		case <-signals:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// statusEvents returns the events that happened between the last and the
+// current status. Without a last status, it only reports the leader.
+func statusEvents(last *auctioneer.Status, current auctioneer.Status) []tailEvent {
+	now := time.Now()
+	events := []tailEvent{}
+
+	leader := current.Leader
+	if current.IsLeader {
+		leader = &current.Self
+	}
+
+	switch {
+	case last == nil:
+		events = append(events, tailEvent{Time: now, Event: "leader", Leader: leader, FencingToken: current.FencingToken})
+		return events
+	case leaderID(last) != leaderID(&current) || last.FencingToken != current.FencingToken:
+		events = append(events, tailEvent{Time: now, Event: "leader-changed", Leader: leader, FencingToken: current.FencingToken})
+	}
+
+	reasons := make([]string, 0, len(current.PlacementFailures))
+	for reason := range current.PlacementFailures {
+		reasons = append(reasons, string(reason))
+	}
+	sort.Strings(reasons)
+
+	for _, r := range reasons {
+		reason := auctioneer.PlacementFailureReason(r)
+		count, previous := current.PlacementFailures[reason], last.PlacementFailures[reason]
+		if count < previous {
+			// The auctioneer restarted and counts from zero again
+			previous = 0
+		}
+		if count > previous {
+			events = append(events, tailEvent{Time: now, Event: "placement-failures", Reason: reason, Count: count - previous})
+		}
+	}
+
+	return events
+}
+
+func leaderID(status *auctioneer.Status) string {
+	if status.IsLeader {
+		return status.Self.AuctioneerID
+	}
+	if status.Leader != nil {
+		return status.Leader.AuctioneerID
+	}
+	return ""
+}
+
+func runCells(flags *globalFlags, out io.Writer) error {
+	client, err := newClient(flags)
+	if err != nil {
+		return err
+	}
+
+	cells, err := client.Cells(newLogger())
+	if err != nil {
+		return err
+	}
+
+	return printJSON(out, cells)
+}
+
+func runQuarantine(flags *globalFlags, out io.Writer) error {
+	client, err := newClient(flags)
+	if err != nil {
+		return err
+	}
+
+	cells, err := client.Cells(newLogger())
+	if err != nil {
+		return err
+	}
+
+	quarantined := []auctioneer.Cell{}
+	for _, cell := range cells {
+		if cell.Quarantine != nil {
+			quarantined = append(quarantined, cell)
+		}
+	}
+
+	return printJSON(out, quarantined)
+}
+
+func runClearQuarantine(flags *globalFlags, out io.Writer) error {
+	if flags.cellID == "" {
+		return errors.New("-cell-id is required")
+	}
+
+	client, err := newClient(flags)
+	if err != nil {
+		return err
+	}
+
+	if err := client.ClearCellQuarantine(newLogger(), flags.cellID); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "cleared the quarantine of cell %s\n", flags.cellID)
+	return nil
+}
+
+func newClient(flags *globalFlags) (auctioneer.Client, error) {
+	if flags.auctioneerURL != "" {
+		return newClientForURL(flags, flags.auctioneerURL)
+	}
+
+	serviceClient, err := newServiceClient(flags)
+	if err != nil {
+		return nil, err
+	}
+
+	presence, err := serviceClient.CurrentAuctioneer()
+	if err != nil {
+		return nil, fmt.Errorf("finding current auctioneer: %s", err)
+	}
+
+	return newClientFor(flags, presence)
+}
+
+func newClientFor(flags *globalFlags, presence auctioneer.Presence) (auctioneer.Client, error) {
+	if presence.ClientCertRequired && (flags.certFile == "" || flags.keyFile == "") {
+		return nil, errors.New("the current auctioneer requires a client certificate: set -cert-file and -key-file")
+	}
+
+	return newClientForURL(flags, presence.AuctioneerAddress)
+}
+
+func newClientForURL(flags *globalFlags, url string) (auctioneer.Client, error) {
+	if flags.caFile == "" && flags.certFile == "" && flags.keyFile == "" {
+		return auctioneer.NewClient(url, flags.timeout), nil
+	}
+
+	return auctioneer.NewSecureClient(url, flags.caFile, flags.certFile, flags.keyFile, flags.requireTLS, flags.timeout)
+}
+
+// newServiceClient looks up the auctioneer through Consul if -consul-cluster
+// is set and through Locket otherwise.
+func newServiceClient(flags *globalFlags) (auctioneer.ServiceClient, error) {
+	if flags.consulCluster == "" {
+		if flags.locketAddress == "" {
+			return nil, errors.New("-consul-cluster or -locket-address is required to look up the current auctioneer")
+		}
+
+		locketClient, err := locket.NewClient(newLogger(), locket.ClientLocketConfig{
+			LocketAddress:        flags.locketAddress,
+			LocketCACertFile:     flags.locketCACertFile,
+			LocketClientCertFile: flags.locketClientCertFile,
+			LocketClientKeyFile:  flags.locketClientKeyFile,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return auctioneer.NewLocketServiceClient(locketClient, clock.NewClock()), nil
+	}
+
+	consulClient, err := consuladapter.NewClientFromUrl(flags.consulCluster)
+	if err != nil {
+		return nil, err
+	}
+
+	return auctioneer.NewServiceClient(consulClient, clock.NewClock()), nil
+}
+
+// readStartRequests decodes a JSON or YAML list into dest. The payload is
+// always converted to JSON first (YAML is a superset of JSON) so that the json
+// tags of the request types apply.
+// readTasks reads the task start requests in path and validates them like the
+// handlers do, so that nothing is sent when one of them is invalid.
+func readTasks(path string) ([]*auctioneer.TaskStartRequest, error) {
+	tasks := []*auctioneer.TaskStartRequest{}
+	if err := readStartRequests(path, &tasks); err != nil {
+		return nil, err
+	}
+
+	for _, task := range tasks {
+		if err := task.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid task %q: %s", task.TaskGuid, err)
+		}
+	}
+	return tasks, nil
+}
+
+// readLRPs reads the LRP start requests in path and validates them like the
+// handlers do, so that nothing is sent when one of them is invalid.
+func readLRPs(path string) ([]*auctioneer.LRPStartRequest, error) {
+	starts := []*auctioneer.LRPStartRequest{}
+	if err := readStartRequests(path, &starts); err != nil {
+		return nil, err
+	}
+
+	for _, start := range starts {
+		if err := start.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid lrp start %q: %s", start.ProcessGuid, err)
+		}
+	}
+	return starts, nil
+}
+
+func readStartRequests(path string, dest interface{}) error {
+	if path == "" {
+		return errors.New("-file is required")
+	}
+
+	var payload []byte
+	var err error
+	if path == "-" {
+		payload, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		payload, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+
+	payload, err = yaml.YAMLToJSON(payload)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(payload, dest)
+}
+
+func printJSON(out io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func newLogger() lager.Logger {
+	logger := lager.NewLogger("auctioneer-cli")
+	logger.RegisterSink(lager.NewWriterSink(os.Stderr, lager.ERROR))
+	return logger
+}
@@ -0,0 +1,29 @@
+package main_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+
+	"testing"
+)
+
+var cliPath string
+
+func TestAuctioneerCLI(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Auctioneer CLI Suite")
+}
+
+var _ = SynchronizedBeforeSuite(func() []byte {
+	compiledPath, err := gexec.Build("code.cloudfoundry.org/auctioneer/cmd/auctioneer-cli", "-race")
+	Expect(err).NotTo(HaveOccurred())
+	return []byte(compiledPath)
+}, func(path []byte) {
+	cliPath = string(path)
+})
+
+var _ = SynchronizedAfterSuite(func() {
+}, func() {
+	gexec.CleanupBuildArtifacts()
+})
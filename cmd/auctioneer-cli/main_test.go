@@ -0,0 +1,275 @@
+package main_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"code.cloudfoundry.org/auctioneer"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+	"github.com/onsi/gomega/ghttp"
+)
+
+var _ = Describe("auctioneer-cli", func() {
+	var (
+		fakeAuctioneerServer *ghttp.Server
+		tmpDir               string
+	)
+
+	runCLI := func(args ...string) *gexec.Session {
+		session, err := gexec.Start(exec.Command(cliPath, args...), GinkgoWriter, GinkgoWriter)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(session).Should(gexec.Exit())
+		return session
+	}
+
+	writeFile := func(name, contents string) string {
+		path := filepath.Join(tmpDir, name)
+		Expect(ioutil.WriteFile(path, []byte(contents), 0644)).To(Succeed())
+		return path
+	}
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "auctioneer-cli")
+		Expect(err).NotTo(HaveOccurred())
+
+		fakeAuctioneerServer = ghttp.NewServer()
+	})
+
+	AfterEach(func() {
+		fakeAuctioneerServer.Close()
+		os.RemoveAll(tmpDir)
+	})
+
+	Context("without a command", func() {
+		It("prints the usage and fails", func() {
+			session := runCLI()
+			Expect(session.ExitCode()).NotTo(Equal(0))
+			Expect(session.Err).To(gbytes.Say("Usage: auctioneer-cli"))
+		})
+	})
+
+	Context("with an unknown command", func() {
+		It("fails", func() {
+			session := runCLI("frobnicate")
+			Expect(session.ExitCode()).NotTo(Equal(0))
+			Expect(session.Err).To(gbytes.Say(`unknown command "frobnicate"`))
+		})
+	})
+
+	Describe("submit-lrps", func() {
+		It("submits the LRP starts in a YAML file", func() {
+			fakeAuctioneerServer.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyRequest("POST", "/v1/lrps"),
+				func(w http.ResponseWriter, r *http.Request) {
+					starts := []auctioneer.LRPStartRequest{}
+					Expect(json.NewDecoder(r.Body).Decode(&starts)).To(Succeed())
+					Expect(starts).To(HaveLen(1))
+					Expect(starts[0].ProcessGuid).To(Equal("some-guid"))
+					Expect(starts[0].Indices).To(Equal([]int{0, 1}))
+				},
+				ghttp.RespondWith(http.StatusAccepted, "{}"),
+			))
+
+			file := writeFile("lrps.yml", `
+- process_guid: some-guid
+  domain: some-domain
+  indices: [0, 1]
+  RootFs: preloaded:linux
+  MemoryMB: 128
+  DiskMB: 128
+`)
+
+			session := runCLI("submit-lrps", "-auctioneer-url", fakeAuctioneerServer.URL(), "-file", file)
+			Expect(session.ExitCode()).To(Equal(0))
+			Expect(session.Out).To(gbytes.Say("submitted 1 lrp start"))
+		})
+
+		It("refuses to submit invalid starts", func() {
+			file := writeFile("lrps.json", `[{"process_guid": "some-guid"}]`)
+
+			session := runCLI("submit-lrps", "-auctioneer-url", fakeAuctioneerServer.URL(), "-file", file)
+			Expect(session.ExitCode()).NotTo(Equal(0))
+			Expect(fakeAuctioneerServer.ReceivedRequests()).To(BeEmpty())
+		})
+	})
+
+	Describe("submit-tasks", func() {
+		It("submits the tasks in a JSON file", func() {
+			fakeAuctioneerServer.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyRequest("POST", "/v1/tasks"),
+				ghttp.RespondWith(http.StatusAccepted, "{}"),
+			))
+
+			file := writeFile("tasks.json", `[{"TaskGuid": "task-guid", "Domain": "domain", "RootFs": "preloaded:linux", "MemoryMB": 1}]`)
+
+			session := runCLI("submit-tasks", "-auctioneer-url", fakeAuctioneerServer.URL(), "-file", file)
+			Expect(session.ExitCode()).To(Equal(0))
+			Expect(session.Out).To(gbytes.Say("submitted 1 task"))
+		})
+
+		It("reports the error returned by the auctioneer", func() {
+			fakeAuctioneerServer.AppendHandlers(ghttp.RespondWithJSONEncoded(http.StatusBadRequest, map[string]string{"error": "nope"}))
+
+			file := writeFile("tasks.json", `[{"TaskGuid": "task-guid", "Domain": "domain", "RootFs": "preloaded:linux", "MemoryMB": 1}]`)
+
+			session := runCLI("submit-tasks", "-auctioneer-url", fakeAuctioneerServer.URL(), "-file", file)
+			Expect(session.ExitCode()).NotTo(Equal(0))
+			Expect(session.Err).To(gbytes.Say("invalid request: nope"))
+		})
+	})
+
+	Describe("preview-tasks", func() {
+		It("prints how the tasks would be placed", func() {
+			fakeAuctioneerServer.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyRequest("POST", "/v1/tasks/preview"),
+				ghttp.RespondWithJSONEncoded(http.StatusOK, []auctioneer.PlacementExplanation{{
+					Identifier: "task-guid",
+					Cells:      []auctioneer.CellExplanation{{CellID: "cell-A"}},
+					BestCellID: "cell-A",
+				}}),
+			))
+
+			file := writeFile("tasks.json", `[{"TaskGuid": "task-guid", "Domain": "domain", "RootFs": "preloaded:linux", "MemoryMB": 1}]`)
+
+			session := runCLI("preview-tasks", "-auctioneer-url", fakeAuctioneerServer.URL(), "-file", file)
+			Expect(session.ExitCode()).To(Equal(0))
+
+			explanations := []auctioneer.PlacementExplanation{}
+			Expect(json.Unmarshal(session.Out.Contents(), &explanations)).To(Succeed())
+			Expect(explanations).To(HaveLen(1))
+			Expect(explanations[0].BestCellID).To(Equal("cell-A"))
+		})
+	})
+
+	Describe("preview-lrps", func() {
+		It("reports the error returned by the auctioneer", func() {
+			fakeAuctioneerServer.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyRequest("POST", "/v1/lrps/preview"),
+				ghttp.RespondWithJSONEncoded(http.StatusServiceUnavailable, map[string]string{"error": "placement explanations are not available"}),
+			))
+
+			file := writeFile("lrps.json", `[{"process_guid": "some-guid", "domain": "some-domain", "indices": [0], "RootFs": "preloaded:linux", "MemoryMB": 128}]`)
+
+			session := runCLI("preview-lrps", "-auctioneer-url", fakeAuctioneerServer.URL(), "-file", file)
+			Expect(session.ExitCode()).NotTo(Equal(0))
+			Expect(session.Err).To(gbytes.Say("placement explanations are not available"))
+		})
+
+		It("refuses to preview invalid starts", func() {
+			file := writeFile("lrps.json", `[{"process_guid": "some-guid"}]`)
+
+			session := runCLI("preview-lrps", "-auctioneer-url", fakeAuctioneerServer.URL(), "-file", file)
+			Expect(session.ExitCode()).NotTo(Equal(0))
+			Expect(fakeAuctioneerServer.ReceivedRequests()).To(BeEmpty())
+		})
+	})
+
+	Describe("tail", func() {
+		It("prints the leader and new placement failures until interrupted", func() {
+			statuses := make(chan auctioneer.Status, 2)
+			statuses <- auctioneer.Status{
+				Self:              auctioneer.NewPresence("auctioneer-1", "auctioneer-1.url"),
+				IsLeader:          true,
+				FencingToken:      4,
+				PlacementFailures: map[auctioneer.PlacementFailureReason]uint64{auctioneer.PlacementFailureInsufficientMemory: 2},
+			}
+			statuses <- auctioneer.Status{
+				Self:              auctioneer.NewPresence("auctioneer-1", "auctioneer-1.url"),
+				IsLeader:          true,
+				FencingToken:      4,
+				PlacementFailures: map[auctioneer.PlacementFailureReason]uint64{auctioneer.PlacementFailureInsufficientMemory: 5},
+			}
+			last := auctioneer.Status{}
+			fakeAuctioneerServer.RouteToHandler("GET", "/v1/status", func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case last = <-statuses:
+				default:
+				}
+				ghttp.RespondWithJSONEncoded(http.StatusOK, last)(w, r)
+			})
+
+			session, err := gexec.Start(exec.Command(cliPath, "tail", "-auctioneer-url", fakeAuctioneerServer.URL(), "-interval", "10ms"), GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+
+			Eventually(session.Out).Should(gbytes.Say(`"event":"leader".*"auctioneer_id":"auctioneer-1".*"fencing_token":4`))
+			Eventually(session.Out).Should(gbytes.Say(`"event":"placement-failures","reason":"insufficient_memory","count":3`))
+
+			session.Interrupt()
+			Eventually(session).Should(gexec.Exit(0))
+		})
+	})
+
+	Describe("cells", func() {
+		It("lists the cells of the auctioneer", func() {
+			fakeAuctioneerServer.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/v1/cells"),
+				ghttp.RespondWithJSONEncoded(http.StatusOK, []auctioneer.Cell{
+					{CellID: "cell-A", RepAddress: "cell-a.url"},
+					{CellID: "cell-B", RepAddress: "cell-b.url"},
+				}),
+			))
+
+			session := runCLI("cells", "-auctioneer-url", fakeAuctioneerServer.URL())
+			Expect(session.ExitCode()).To(Equal(0))
+
+			cells := []auctioneer.Cell{}
+			Expect(json.Unmarshal(session.Out.Contents(), &cells)).To(Succeed())
+			Expect(cells).To(HaveLen(2))
+		})
+	})
+
+	Describe("quarantine", func() {
+		It("lists only the quarantined cells", func() {
+			fakeAuctioneerServer.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/v1/cells"),
+				ghttp.RespondWithJSONEncoded(http.StatusOK, []auctioneer.Cell{
+					{CellID: "cell-A", RepAddress: "cell-a.url"},
+					{CellID: "cell-B", RepAddress: "cell-b.url", Quarantine: &auctioneer.CellQuarantine{ConsecutiveFailures: 3}},
+				}),
+			))
+
+			session := runCLI("quarantine", "-auctioneer-url", fakeAuctioneerServer.URL())
+			Expect(session.ExitCode()).To(Equal(0))
+
+			cells := []auctioneer.Cell{}
+			Expect(json.Unmarshal(session.Out.Contents(), &cells)).To(Succeed())
+			Expect(cells).To(HaveLen(1))
+			Expect(cells[0].CellID).To(Equal("cell-B"))
+		})
+	})
+
+	Describe("clear-quarantine", func() {
+		It("clears the quarantine of the cell", func() {
+			fakeAuctioneerServer.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyRequest("DELETE", "/v1/cells/cell-B/quarantine"),
+				ghttp.RespondWith(http.StatusNoContent, nil),
+			))
+
+			session := runCLI("clear-quarantine", "-auctioneer-url", fakeAuctioneerServer.URL(), "-cell-id", "cell-B")
+			Expect(session.ExitCode()).To(Equal(0))
+			Expect(session.Out).To(gbytes.Say("cleared the quarantine of cell cell-B"))
+		})
+
+		It("requires a cell id", func() {
+			session := runCLI("clear-quarantine", "-auctioneer-url", fakeAuctioneerServer.URL())
+			Expect(session.ExitCode()).NotTo(Equal(0))
+			Expect(session.Err).To(gbytes.Say("-cell-id is required"))
+		})
+	})
+
+	Describe("leader", func() {
+		It("requires consul or locket", func() {
+			session := runCLI("leader")
+			Expect(session.ExitCode()).NotTo(Equal(0))
+			Expect(session.Err).To(gbytes.Say("-consul-cluster or -locket-address is required"))
+		})
+	})
+})
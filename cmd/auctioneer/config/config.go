@@ -2,6 +2,8 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 
 	"code.cloudfoundry.org/debugserver"
@@ -12,41 +14,102 @@ import (
 )
 
 type AuctioneerConfig struct {
-	AuctionRunnerWorkers            int                   `json:"auction_runner_workers,omitempty"`
-	BBSAddress                      string                `json:"bbs_address,omitempty"`
-	BBSCACertFile                   string                `json:"bbs_ca_cert_file,omitempty"`
-	BBSClientCertFile               string                `json:"bbs_client_cert_file,omitempty"`
-	BBSClientKeyFile                string                `json:"bbs_client_key_file,omitempty"`
-	BBSClientSessionCacheSize       int                   `json:"bbs_client_session_cache_size,omitempty"`
-	BBSMaxIdleConnsPerHost          int                   `json:"bbs_max_idle_conns_per_host,omitempty"`
-	CACertFile                      string                `json:"ca_cert_file,omitempty"`
-	BinPackFirstFitWeight           float64               `json:"bin_pack_first_fit_weight,omitempty"`
-	CellStateTimeout                durationjson.Duration `json:"cell_state_timeout,omitempty"`
-	CommunicationTimeout            durationjson.Duration `json:"communication_timeout,omitempty"`
-	ConsulCluster                   string                `json:"consul_cluster,omitempty"`
-	EnableConsulServiceRegistration bool                  `json:"enable_consul_service_registration,omitempty"`
-	ListenAddress                   string                `json:"listen_address,omitempty"`
-	LockRetryInterval               durationjson.Duration `json:"lock_retry_interval,omitempty"`
-	LockTTL                         durationjson.Duration `json:"lock_ttl,omitempty"`
-	LoggregatorConfig               loggingclient.Config  `json:"loggregator"`
-	RepCACert                       string                `json:"rep_ca_cert,omitempty"`
-	RepClientCert                   string                `json:"rep_client_cert,omitempty"`
-	RepClientKey                    string                `json:"rep_client_key,omitempty"`
-	RepClientSessionCacheSize       int                   `json:"rep_client_session_cache_size,omitempty"`
-	RepRequireTLS                   bool                  `json:"rep_require_tls,omitempty"`
-	ReportInterval                  durationjson.Duration `json:"report_interval,omitempty"`
-	ServerCertFile                  string                `json:"server_cert_file,omitempty"`
-	ServerKeyFile                   string                `json:"server_key_file,omitempty"`
-	SkipConsulLock                  bool                  `json:"skip_consul_lock"`
-	StartingContainerCountMaximum   int                   `json:"starting_container_count_maximum,omitempty"`
-	StartingContainerWeight         float64               `json:"starting_container_weight,omitempty"`
-	UUID                            string                `json:"uuid,omitempty"`
-	LocksLocketEnabled              bool                  `json:"locks_locket_enabled"`
+	AuctionLogPath                  string                 `json:"auction_log_path,omitempty"`
+	AuctionMaxWait                  durationjson.Duration  `json:"auction_max_wait,omitempty"`
+	AuctionRunnerWorkers            int                    `json:"auction_runner_workers,omitempty"`
+	BBSAddress                      string                 `json:"bbs_address,omitempty"`
+	BBSCACertFile                   string                 `json:"bbs_ca_cert_file,omitempty"`
+	BBSClientCertFile               string                 `json:"bbs_client_cert_file,omitempty"`
+	BBSClientKeyFile                string                 `json:"bbs_client_key_file,omitempty"`
+	BBSClientSessionCacheSize       int                    `json:"bbs_client_session_cache_size,omitempty"`
+	BBSMaxIdleConnsPerHost          int                    `json:"bbs_max_idle_conns_per_host,omitempty"`
+	BBSOutboxBackoff                durationjson.Duration  `json:"bbs_outbox_backoff,omitempty"`
+	BBSOutboxDrainTimeout           durationjson.Duration  `json:"bbs_outbox_drain_timeout,omitempty"`
+	BBSOutboxMaxAttempts            int                    `json:"bbs_outbox_max_attempts,omitempty"`
+	BBSOutboxMaxBackoff             durationjson.Duration  `json:"bbs_outbox_max_backoff,omitempty"`
+	BBSOutboxPath                   string                 `json:"bbs_outbox_path,omitempty"`
+	BBSOutboxWorkers                int                    `json:"bbs_outbox_workers,omitempty"`
+	CACertFile                      string                 `json:"ca_cert_file,omitempty"`
+	BinPackFirstFitWeight           float64                `json:"bin_pack_first_fit_weight,omitempty"`
+	CellFilters                     []CellFilterConfig     `json:"cell_filters,omitempty"`
+	CellOrderings                   []CellOrderingConfig   `json:"cell_orderings,omitempty"`
+	CellQuarantineBaseDuration      durationjson.Duration  `json:"cell_quarantine_base_duration,omitempty"`
+	CellQuarantineMaxDuration       durationjson.Duration  `json:"cell_quarantine_max_duration,omitempty"`
+	CellQuarantineThreshold         int                    `json:"cell_quarantine_threshold,omitempty"`
+	CellRefreshInterval             durationjson.Duration  `json:"cell_refresh_interval,omitempty"`
+	CellStateTimeout                durationjson.Duration  `json:"cell_state_timeout,omitempty"`
+	CommunicationTimeout            durationjson.Duration  `json:"communication_timeout,omitempty"`
+	ConsulCluster                   string                 `json:"consul_cluster,omitempty"`
+	DomainQuotas                    map[string]DomainQuota `json:"domain_quotas,omitempty"`
+	DrainTimeout                    durationjson.Duration  `json:"drain_timeout,omitempty"`
+	EnableConsulServiceRegistration bool                   `json:"enable_consul_service_registration,omitempty"`
+	FairQueueBatchSize              int                    `json:"fair_queue_batch_size,omitempty"`
+	FairQueueEnabled                bool                   `json:"fair_queue_enabled,omitempty"`
+	FairQueueKey                    string                 `json:"fair_queue_key,omitempty"`
+	FairQueueMaxDepth               int                    `json:"fair_queue_max_depth,omitempty"`
+	FairQueueMaxWait                durationjson.Duration  `json:"fair_queue_max_wait,omitempty"`
+	FairQueueWeights                map[string]int         `json:"fair_queue_weights,omitempty"`
+	ListenAddress                   string                 `json:"listen_address,omitempty"`
+	LockRetryInterval               durationjson.Duration  `json:"lock_retry_interval,omitempty"`
+	LockTTL                         durationjson.Duration  `json:"lock_ttl,omitempty"`
+	LoggregatorConfig               loggingclient.Config   `json:"loggregator"`
+	PlacementMaxRetries             int                    `json:"placement_max_retries,omitempty"`
+	PlacementRetryBackoff           durationjson.Duration  `json:"placement_retry_backoff,omitempty"`
+	PlacementRetryMaxBackoff        durationjson.Duration  `json:"placement_retry_max_backoff,omitempty"`
+	PlacementRetryableErrors        []string               `json:"placement_retryable_errors,omitempty"`
+	RepCACert                       string                 `json:"rep_ca_cert,omitempty"`
+	RepClientCert                   string                 `json:"rep_client_cert,omitempty"`
+	RepClientKey                    string                 `json:"rep_client_key,omitempty"`
+	RepClientSessionCacheSize       int                    `json:"rep_client_session_cache_size,omitempty"`
+	RepRequireTLS                   bool                   `json:"rep_require_tls,omitempty"`
+	ReportInterval                  durationjson.Duration  `json:"report_interval,omitempty"`
+	ServerCertFile                  string                 `json:"server_cert_file,omitempty"`
+	ServerKeyFile                   string                 `json:"server_key_file,omitempty"`
+	SkipConsulLock                  bool                   `json:"skip_consul_lock"`
+	StartingContainerCountMaximum   int                    `json:"starting_container_count_maximum,omitempty"`
+	StartingContainerWeight         float64                `json:"starting_container_weight,omitempty"`
+	UUID                            string                 `json:"uuid,omitempty"`
+	LocksLocketEnabled              bool                   `json:"locks_locket_enabled"`
 	debugserver.DebugServerConfig
 	lagerflags.LagerConfig
 	locket.ClientLocketConfig
 }
 
+const (
+	CellFilterExcludeLabels = "exclude_labels"
+	CellFilterDenyCellIDs   = "deny_cell_ids"
+
+	CellOrderingPreferLabels = "prefer_labels"
+
+	FairQueueKeyDomain        = "domain"
+	FairQueueKeyPlacementTags = "placement_tags"
+)
+
+// CellFilterConfig configures one filter of the cell filter chain. Filters
+// are applied in the order they are configured. A filter with Domains only
+// applies to the auctions of those domains.
+type CellFilterConfig struct {
+	Type    string   `json:"type"`
+	Labels  []string `json:"labels,omitempty"`
+	CellIDs []string `json:"cell_ids,omitempty"`
+	Domains []string `json:"domains,omitempty"`
+}
+
+// CellOrderingConfig configures one ordering of the cells offered to auctions.
+// Earlier orderings take precedence over later ones.
+type CellOrderingConfig struct {
+	Type   string   `json:"type"`
+	Labels []string `json:"labels,omitempty"`
+}
+
+// DomainQuota limits the resources auctioned for a domain. Zero leaves a
+// resource unlimited.
+type DomainQuota struct {
+	MemoryMB  int64 `json:"memory_mb,omitempty"`
+	DiskMB    int64 `json:"disk_mb,omitempty"`
+	Instances int64 `json:"instances,omitempty"`
+}
+
 func NewAuctioneerConfig(configPath string) (AuctioneerConfig, error) {
 	cfg := AuctioneerConfig{}
 
@@ -66,3 +129,58 @@ func NewAuctioneerConfig(configPath string) (AuctioneerConfig, error) {
 
 	return cfg, nil
 }
+
+// UsesConsul reports whether the configuration needs a Consul agent, either
+// for the Consul lock or for service registration.
+func (c AuctioneerConfig) UsesConsul() bool {
+	return !c.SkipConsulLock || c.EnableConsulServiceRegistration
+}
+
+// Validate rejects configurations that cannot run, such as enabling no lock
+// at all or relying on Consul without a Consul cluster.
+func (c AuctioneerConfig) Validate() error {
+	if c.SkipConsulLock && !c.LocksLocketEnabled {
+		return errors.New("at least one of the consul lock or the locket lock must be enabled")
+	}
+
+	if c.UsesConsul() && c.ConsulCluster == "" {
+		return errors.New("consul_cluster is required unless skip_consul_lock is set and consul service registration is disabled")
+	}
+
+	if c.LocksLocketEnabled {
+		if c.UUID == "" {
+			return errors.New("uuid is required when locks_locket_enabled is set")
+		}
+		if c.LocketAddress == "" {
+			return errors.New("locket_address is required when locks_locket_enabled is set")
+		}
+	}
+
+	for _, filter := range c.CellFilters {
+		switch filter.Type {
+		case CellFilterExcludeLabels, CellFilterDenyCellIDs:
+		default:
+			return fmt.Errorf("unknown cell filter type %q", filter.Type)
+		}
+	}
+
+	for _, ordering := range c.CellOrderings {
+		switch ordering.Type {
+		case CellOrderingPreferLabels:
+		default:
+			return fmt.Errorf("unknown cell ordering type %q", ordering.Type)
+		}
+	}
+
+	if len(c.CellOrderings) > 0 && c.BinPackFirstFitWeight <= 0 {
+		return errors.New("cell_orderings require a positive bin_pack_first_fit_weight")
+	}
+
+	switch c.FairQueueKey {
+	case "", FairQueueKeyDomain, FairQueueKeyPlacementTags:
+	default:
+		return fmt.Errorf("unknown fair queue key %q", c.FairQueueKey)
+	}
+
+	return nil
+}
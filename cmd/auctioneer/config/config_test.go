@@ -21,6 +21,8 @@ var _ = Describe("AuctioneerConfig", func() {
 
 	BeforeEach(func() {
 		configData = `{
+			"auction_log_path": "/var/vcap/data/auctioneer/auctions.log",
+			"auction_max_wait": "10m",
 			"auction_runner_workers": 10,
 			"bbs_address": "1.1.1.1:9091",
 			"bbs_ca_cert_file": "/tmp/bbs_ca_cert",
@@ -28,13 +30,40 @@ var _ = Describe("AuctioneerConfig", func() {
 			"bbs_client_key_file": "/tmp/bbs_client_key",
 			"bbs_client_session_cache_size": 100,
 			"bbs_max_idle_conns_per_host": 10,
+			"bbs_outbox_backoff": "2s",
+			"bbs_outbox_drain_timeout": "15s",
+			"bbs_outbox_max_attempts": 5,
+			"bbs_outbox_max_backoff": "1m",
+			"bbs_outbox_path": "/var/vcap/data/auctioneer/bbs-outbox.log",
+			"bbs_outbox_workers": 4,
 			"ca_cert_file": "/path-to-cert",
 			"bin_pack_first_fit_weight": 0.1,
+			"cell_filters": [
+				{"type": "exclude_labels", "labels": ["gpu"], "domains": ["cf-apps"]},
+				{"type": "deny_cell_ids", "cell_ids": ["cell-1"]}
+			],
+			"cell_orderings": [
+				{"type": "prefer_labels", "labels": ["cached-images"]}
+			],
+			"cell_quarantine_base_duration": "10s",
+			"cell_quarantine_max_duration": "5m",
+			"cell_quarantine_threshold": 3,
+			"cell_refresh_interval": "30s",
 			"cell_state_timeout": "2s",
 			"communication_timeout": "15s",
 			"consul_cluster": "1.1.1.1",
 			"debug_address": "127.0.0.1:17017",
+			"domain_quotas": {
+				"cf-apps": {"memory_mb": 8192, "disk_mb": 16384, "instances": 100}
+			},
+			"drain_timeout": "5s",
 			"enable_consul_service_registration": true,
+			"fair_queue_batch_size": 50,
+			"fair_queue_enabled": true,
+			"fair_queue_key": "placement_tags",
+			"fair_queue_max_depth": 10000,
+			"fair_queue_max_wait": "10s",
+			"fair_queue_weights": {"isolated": 3},
 			"listen_address": "0.0.0.0:9090",
 			"lock_retry_interval": "1m",
 			"lock_ttl": "20s",
@@ -56,6 +85,10 @@ var _ = Describe("AuctioneerConfig", func() {
 				"loggregator_job_ip": "job-ip",
 				"loggregator_job_origin": "job-origin"
 			},
+			"placement_max_retries": 3,
+			"placement_retry_backoff": "5s",
+			"placement_retry_max_backoff": "1m",
+			"placement_retryable_errors": ["insufficient resources"],
 			"rep_ca_cert": "/var/vcap/jobs/auctioneer/config/rep.ca",
 			"rep_client_cert": "/var/vcap/jobs/auctioneer/config/rep.crt",
 			"rep_client_key": "/var/vcap/jobs/auctioneer/config/rep.key",
@@ -92,6 +125,8 @@ var _ = Describe("AuctioneerConfig", func() {
 		Expect(err).NotTo(HaveOccurred())
 
 		expectedConfig := config.AuctioneerConfig{
+			AuctionLogPath:            "/var/vcap/data/auctioneer/auctions.log",
+			AuctionMaxWait:            durationjson.Duration(10 * time.Minute),
 			AuctionRunnerWorkers:      10,
 			BBSAddress:                "1.1.1.1:9091",
 			BBSCACertFile:             "/tmp/bbs_ca_cert",
@@ -99,10 +134,27 @@ var _ = Describe("AuctioneerConfig", func() {
 			BBSClientKeyFile:          "/tmp/bbs_client_key",
 			BBSClientSessionCacheSize: 100,
 			BBSMaxIdleConnsPerHost:    10,
+			BBSOutboxBackoff:          durationjson.Duration(2 * time.Second),
+			BBSOutboxDrainTimeout:     durationjson.Duration(15 * time.Second),
+			BBSOutboxMaxAttempts:      5,
+			BBSOutboxMaxBackoff:       durationjson.Duration(1 * time.Minute),
+			BBSOutboxPath:             "/var/vcap/data/auctioneer/bbs-outbox.log",
+			BBSOutboxWorkers:          4,
 			CACertFile:                "/path-to-cert",
 			BinPackFirstFitWeight:     0.1,
-			CellStateTimeout:          durationjson.Duration(2 * time.Second),
-			LocksLocketEnabled:        true,
+			CellFilters: []config.CellFilterConfig{
+				{Type: config.CellFilterExcludeLabels, Labels: []string{"gpu"}, Domains: []string{"cf-apps"}},
+				{Type: config.CellFilterDenyCellIDs, CellIDs: []string{"cell-1"}},
+			},
+			CellOrderings: []config.CellOrderingConfig{
+				{Type: config.CellOrderingPreferLabels, Labels: []string{"cached-images"}},
+			},
+			CellQuarantineBaseDuration: durationjson.Duration(10 * time.Second),
+			CellQuarantineMaxDuration:  durationjson.Duration(5 * time.Minute),
+			CellQuarantineThreshold:    3,
+			CellRefreshInterval:        durationjson.Duration(30 * time.Second),
+			CellStateTimeout:           durationjson.Duration(2 * time.Second),
+			LocksLocketEnabled:         true,
 			ClientLocketConfig: locket.ClientLocketConfig{
 				LocketAddress:        "laksdjflksdajflkajsdf",
 				LocketCACertFile:     "locket-ca-cert",
@@ -114,7 +166,17 @@ var _ = Describe("AuctioneerConfig", func() {
 			DebugServerConfig: debugserver.DebugServerConfig{
 				DebugAddress: "127.0.0.1:17017",
 			},
+			DomainQuotas: map[string]config.DomainQuota{
+				"cf-apps": {MemoryMB: 8192, DiskMB: 16384, Instances: 100},
+			},
+			DrainTimeout:                    durationjson.Duration(5 * time.Second),
 			EnableConsulServiceRegistration: true,
+			FairQueueBatchSize:              50,
+			FairQueueEnabled:                true,
+			FairQueueKey:                    config.FairQueueKeyPlacementTags,
+			FairQueueMaxDepth:               10000,
+			FairQueueMaxWait:                durationjson.Duration(10 * time.Second),
+			FairQueueWeights:                map[string]int{"isolated": 3},
 			LagerConfig: lagerflags.LagerConfig{
 				LogLevel: "debug",
 			},
@@ -133,6 +195,10 @@ var _ = Describe("AuctioneerConfig", func() {
 				JobIP:         "job-ip",
 				JobOrigin:     "job-origin",
 			},
+			PlacementMaxRetries:           3,
+			PlacementRetryBackoff:         durationjson.Duration(5 * time.Second),
+			PlacementRetryMaxBackoff:      durationjson.Duration(1 * time.Minute),
+			PlacementRetryableErrors:      []string{"insufficient resources"},
 			RepCACert:                     "/var/vcap/jobs/auctioneer/config/rep.ca",
 			RepClientCert:                 "/var/vcap/jobs/auctioneer/config/rep.crt",
 			RepClientKey:                  "/var/vcap/jobs/auctioneer/config/rep.key",
@@ -150,6 +216,94 @@ var _ = Describe("AuctioneerConfig", func() {
 		Expect(auctioneerConfig).To(Equal(expectedConfig))
 	})
 
+	Describe("Validate", func() {
+		var cfg config.AuctioneerConfig
+
+		BeforeEach(func() {
+			cfg = config.AuctioneerConfig{
+				ConsulCluster:      "http://127.0.0.1:8500",
+				LocksLocketEnabled: true,
+				UUID:               "some-uuid",
+				ClientLocketConfig: locket.ClientLocketConfig{
+					LocketAddress: "127.0.0.1:8891",
+				},
+			}
+		})
+
+		It("accepts a configuration with both locks", func() {
+			Expect(cfg.Validate()).To(Succeed())
+			Expect(cfg.UsesConsul()).To(BeTrue())
+		})
+
+		It("accepts a configuration without consul", func() {
+			cfg.SkipConsulLock = true
+			cfg.ConsulCluster = ""
+
+			Expect(cfg.Validate()).To(Succeed())
+			Expect(cfg.UsesConsul()).To(BeFalse())
+		})
+
+		It("rejects a configuration without any lock", func() {
+			cfg.SkipConsulLock = true
+			cfg.LocksLocketEnabled = false
+
+			Expect(cfg.Validate()).To(HaveOccurred())
+		})
+
+		It("rejects the consul lock without a consul cluster", func() {
+			cfg.ConsulCluster = ""
+
+			Expect(cfg.Validate()).To(HaveOccurred())
+		})
+
+		It("rejects consul service registration without a consul cluster", func() {
+			cfg.SkipConsulLock = true
+			cfg.EnableConsulServiceRegistration = true
+			cfg.ConsulCluster = ""
+
+			Expect(cfg.UsesConsul()).To(BeTrue())
+			Expect(cfg.Validate()).To(HaveOccurred())
+		})
+
+		It("rejects the locket lock without a uuid", func() {
+			cfg.UUID = ""
+
+			Expect(cfg.Validate()).To(HaveOccurred())
+		})
+
+		It("rejects the locket lock without a locket address", func() {
+			cfg.LocketAddress = ""
+
+			Expect(cfg.Validate()).To(HaveOccurred())
+		})
+
+		It("rejects unknown cell filters", func() {
+			cfg.CellFilters = []config.CellFilterConfig{{Type: "exclude_zones"}}
+
+			Expect(cfg.Validate()).To(HaveOccurred())
+		})
+
+		It("rejects unknown cell orderings", func() {
+			cfg.CellOrderings = []config.CellOrderingConfig{{Type: "prefer_zones"}}
+			cfg.BinPackFirstFitWeight = 0.1
+
+			Expect(cfg.Validate()).To(HaveOccurred())
+		})
+
+		It("rejects cell orderings without a bin pack first fit weight", func() {
+			cfg.CellOrderings = []config.CellOrderingConfig{{Type: config.CellOrderingPreferLabels, Labels: []string{"cached-images"}}}
+			cfg.BinPackFirstFitWeight = 0
+
+			Expect(cfg.Validate()).To(HaveOccurred())
+		})
+
+		It("rejects unknown fair queue keys", func() {
+			cfg.FairQueueKey = "app"
+
+			Expect(cfg.Validate()).To(HaveOccurred())
+		})
+	})
+
 	Context("when the file does not exist", func() {
 		It("returns an error", func() {
 			_, err := config.NewAuctioneerConfig("foobar")
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
 	"strconv"
 	"strings"
@@ -13,10 +14,18 @@ import (
 	"github.com/nu7hatch/gouuid"
 
 	"code.cloudfoundry.org/auctioneer"
+	"code.cloudfoundry.org/auctioneer/auctiondrainer"
+	"code.cloudfoundry.org/auctioneer/auctionexpiry"
+	"code.cloudfoundry.org/auctioneer/auctionlog"
 	"code.cloudfoundry.org/auctioneer/auctionmetricemitterdelegate"
+	"code.cloudfoundry.org/auctioneer/auctionretrier"
 	"code.cloudfoundry.org/auctioneer/auctionrunnerdelegate"
+	"code.cloudfoundry.org/auctioneer/bbsoutbox"
 	"code.cloudfoundry.org/auctioneer/cmd/auctioneer/config"
+	"code.cloudfoundry.org/auctioneer/domainquota"
+	"code.cloudfoundry.org/auctioneer/fairqueue"
 	"code.cloudfoundry.org/auctioneer/handlers"
+	"code.cloudfoundry.org/auctioneer/placementexplainer"
 	"code.cloudfoundry.org/bbs"
 	cfhttp "code.cloudfoundry.org/cfhttp/v2"
 	"code.cloudfoundry.org/consuladapter"
@@ -28,9 +37,7 @@ import (
 	"code.cloudfoundry.org/localip"
 	"code.cloudfoundry.org/locket"
 	"code.cloudfoundry.org/locket/jointlock"
-	"code.cloudfoundry.org/locket/lock"
 	"code.cloudfoundry.org/locket/lockheldmetrics"
-	locketmodels "code.cloudfoundry.org/locket/models"
 	"code.cloudfoundry.org/rep"
 	"code.cloudfoundry.org/tlsconfig"
 
@@ -50,10 +57,9 @@ var configFilePath = flag.String(
 	"Path to JSON configuration file",
 )
 
-const (
-	serverProtocol    = "http"
-	auctioneerLockKey = "auctioneer"
-)
+// version is advertised in the auctioneer presence. It is overridden at build
+// time with -ldflags "-X main.version=...".
+var version = "unknown"
 
 func main() {
 	flag.Parse()
@@ -74,9 +80,16 @@ func main() {
 		logger.Fatal("invalid-bbs-address", err)
 	}
 
-	consulClient, err := consuladapter.NewClientFromUrl(cfg.ConsulCluster)
-	if err != nil {
-		logger.Fatal("new-client-failed", err)
+	if err := cfg.Validate(); err != nil {
+		logger.Fatal("invalid-config", err)
+	}
+
+	var consulClient consuladapter.Client
+	if cfg.UsesConsul() {
+		consulClient, err = consuladapter.NewClientFromUrl(cfg.ConsulCluster)
+		if err != nil {
+			logger.Fatal("new-client-failed", err)
+		}
 	}
 
 	port, err := strconv.Atoi(strings.Split(cfg.ListenAddress, ":")[1])
@@ -85,48 +98,76 @@ func main() {
 	}
 
 	clock := clock.NewClock()
-	auctioneerServiceClient := auctioneer.NewServiceClient(consulClient, clock)
 
-	auctionRunner := initializeAuctionRunner(logger, cfg, initializeBBSClient(logger, cfg), metronClient)
+	startedAt := clock.Now()
+	tlsEnabled := cfg.ServerCertFile != "" || cfg.ServerKeyFile != "" || cfg.CACertFile != ""
+	scheme := "http"
+	if tlsEnabled {
+		scheme = "https"
+	}
 
+	presence := auctioneer.NewPresence(auctioneerID(logger, cfg), advertisedAddress(logger, scheme, port))
+	presence.Scheme = scheme
+	presence.ClientCertRequired = cfg.CACertFile != ""
+	presence.Version = version
+	presence.StartedAt = startedAt.Unix()
+	presence.Features = auctioneer.SupportedFeatures
+
+	leadership := auctioneer.NewLeadership(presence)
+	bbsClient := initializeBBSClient(logger, cfg)
+	outbox, outboxStore := initializeBBSOutbox(logger, cfg, bbsClient, metronClient, leadership)
+	placementFailures := auctioneer.NewPlacementFailures()
+	auctionLogStore := initializeAuctionLogStore(logger, cfg)
+	fairQueue := initializeFairQueue(logger, cfg, clock, metronClient)
+	auctionRunner, runnerDelegate := initializeAuctionRunner(logger, cfg, bbsClient, outbox, auctionLogStore, fairQueue, metronClient, placementFailures, leadership)
+	explainer := placementexplainer.New(runnerDelegate, placementexplainer.Weights{
+		BinPackFirstFitWeight:         cfg.BinPackFirstFitWeight,
+		StartingContainerWeight:       cfg.StartingContainerWeight,
+		StartingContainerCountMaximum: cfg.StartingContainerCountMaximum,
+	})
+
+	// the consul lock index is preferred as the fencing token, see
+	// auctioneer.ServiceClient.FencingToken
+	var watchClient, fencingClient auctioneer.ServiceClient
 	locks := []grouper.Member{}
 	if !cfg.SkipConsulLock {
+		serviceClient := auctioneer.NewServiceClient(consulClient, clock)
 		lockMaintainer := initializeLockMaintainer(
 			logger,
-			auctioneerServiceClient,
-			port,
+			serviceClient,
+			presence,
 			time.Duration(cfg.LockTTL),
 			time.Duration(cfg.LockRetryInterval),
 			metronClient,
 		)
 		locks = append(locks, grouper.Member{"lock-maintainer", lockMaintainer})
+		watchClient = serviceClient
+		fencingClient = serviceClient
 	}
 
 	if cfg.LocksLocketEnabled {
-		if cfg.UUID == "" {
-			logger.Fatal("invalid-uuid", errors.New("invalid-uuid-from-config"))
-		}
-
 		locketClient, err := locket.NewClient(logger, cfg.ClientLocketConfig)
 		if err != nil {
 			logger.Fatal("failed-to-connect-to-locket", err)
 		}
 
-		lockIdentifier := &locketmodels.Resource{
-			Key:      auctioneerLockKey,
-			Owner:    cfg.UUID,
-			TypeCode: locketmodels.LOCK,
-			Type:     locketmodels.LockType,
-		}
-
-		locks = append(locks, grouper.Member{"sql-lock", lock.NewLockRunner(
+		locketServiceClient := auctioneer.NewLocketServiceClient(locketClient, clock)
+		sqlLock, err := locketServiceClient.NewAuctioneerLockRunner(
 			logger,
-			locketClient,
-			lockIdentifier,
-			locket.DefaultSessionTTLInSeconds,
-			clock,
+			presence,
 			locket.SQLRetryInterval,
-		)})
+			locket.DefaultSessionTTL,
+			metronClient,
+		)
+		if err != nil {
+			logger.Fatal("Couldn't create sql lock", err)
+		}
+
+		locks = append(locks, grouper.Member{"sql-lock", sqlLock})
+		watchClient = locketServiceClient
+		if fencingClient == nil {
+			fencingClient = locketServiceClient
+		}
 	}
 
 	var lock ifrit.Runner
@@ -139,8 +180,27 @@ func main() {
 		lock = jointlock.NewJointLock(clock, locket.DefaultSessionTTL, locks...)
 	}
 
+	lock = leadership.LockRunner(lock, clock, time.Duration(cfg.LockRetryInterval), func() (uint64, error) {
+		token, err := fencingClient.FencingToken(presence)
+		if err != nil {
+			logger.Error("failed-to-get-fencing-token", err)
+			return 0, err
+		}
+		logger.Info("leadership-term-started", lager.Data{"leadership-term": token})
+		return token, nil
+	})
+
+	handlerOptions := []handlers.Option{
+		handlers.WithCellInventory(runnerDelegate),
+		handlers.WithPlacementFailures(placementFailures),
+		handlers.WithPlacementExplainer(explainer),
+	}
+	if fairQueue != nil {
+		handlerOptions = append(handlerOptions, handlers.WithBackpressure(fairQueue))
+	}
+
 	var auctionServer ifrit.Runner
-	if cfg.ServerCertFile != "" || cfg.ServerKeyFile != "" || cfg.CACertFile != "" {
+	if tlsEnabled {
 		tlsConfig, err := tlsconfig.Build(
 			tlsconfig.WithInternalServiceDefaults(),
 			tlsconfig.WithIdentityFromFile(cfg.ServerCertFile, cfg.ServerKeyFile),
@@ -148,9 +208,13 @@ func main() {
 		if err != nil {
 			logger.Fatal("invalid-tls-config", err)
 		}
-		auctionServer = http_server.NewTLSServer(cfg.ListenAddress, handlers.New(logger, auctionRunner, metronClient), tlsConfig)
+		handlerOptions = append(handlerOptions, handlers.WithLeadership(leadership, initializeProxyTransport(logger, cfg)))
+		handler := handlers.New(logger, auctionRunner, metronClient, handlerOptions...)
+		auctionServer = http_server.NewTLSServer(cfg.ListenAddress, handler, tlsConfig)
 	} else {
-		auctionServer = http_server.New(cfg.ListenAddress, handlers.New(logger, auctionRunner, metronClient))
+		handlerOptions = append(handlerOptions, handlers.WithLeadership(leadership, nil))
+		handler := handlers.New(logger, auctionRunner, metronClient, handlerOptions...)
+		auctionServer = http_server.New(cfg.ListenAddress, handler)
 	}
 
 	metricsTicker := clock.NewTicker(time.Duration(cfg.ReportInterval))
@@ -158,10 +222,13 @@ func main() {
 
 	members := grouper.Members{
 		{"lock-held-metrics", lockHeldMetronNotifier},
+		{"leader-watcher", leadership.WatchRunner(watchClient)},
+		{"auction-server", auctionServer},
 		{"lock", lock},
 		{"set-lock-held-metrics", lockheldmetrics.SetLockHeldRunner(logger, *lockHeldMetronNotifier)},
+		{"bbs-outbox", outbox},
 		{"auction-runner", auctionRunner},
-		{"auction-server", auctionServer},
+		{"leadership", leadership.LeaderRunner()},
 	}
 
 	if cfg.EnableConsulServiceRegistration {
@@ -182,6 +249,19 @@ func main() {
 	logger.Info("started")
 
 	err = <-monitor.Wait()
+
+	if auctionLogStore != nil {
+		if err := auctionLogStore.Close(); err != nil {
+			logger.Error("failed-to-close-auction-log", err)
+		}
+	}
+
+	if outboxStore != nil {
+		if err := outboxStore.Close(); err != nil {
+			logger.Error("failed-to-close-bbs-outbox", err)
+		}
+	}
+
 	if err != nil {
 		logger.Error("exited-with-failure", err)
 		os.Exit(1)
@@ -190,7 +270,7 @@ func main() {
 	logger.Info("exited")
 }
 
-func initializeAuctionRunner(logger lager.Logger, cfg config.AuctioneerConfig, bbsClient bbs.InternalClient, metronClient loggingclient.IngressClient) auctiontypes.AuctionRunner {
+func initializeAuctionRunner(logger lager.Logger, cfg config.AuctioneerConfig, bbsClient bbs.InternalClient, outbox *bbsoutbox.Outbox, auctionLogStore *auctionlog.FileStore, fairQueue *fairqueue.FairQueue, metronClient loggingclient.IngressClient, placementFailures *auctioneer.PlacementFailures, fence auctioneer.Fence) (auctiontypes.AuctionRunner, *auctionrunnerdelegate.AuctionRunnerDelegate) {
 	httpClient := cfhttp.NewClient(
 		cfhttp.WithRequestTimeout(time.Duration(cfg.CommunicationTimeout)),
 	)
@@ -209,23 +289,212 @@ func initializeAuctionRunner(logger lager.Logger, cfg config.AuctioneerConfig, b
 		logger.Fatal("new-rep-client-factory-failed", err)
 	}
 
-	delegate := auctionrunnerdelegate.New(repClientFactory, bbsClient, logger)
+	clock := clock.NewClock()
+	drainer := auctiondrainer.New(logger, clock, time.Duration(cfg.DrainTimeout), fence)
+	delegateOptions := []auctionrunnerdelegate.Option{
+		auctionrunnerdelegate.WithFence(fence),
+		auctionrunnerdelegate.WithCellRefreshInterval(clock, time.Duration(cfg.CellRefreshInterval)),
+		auctionrunnerdelegate.WithMetronClient(metronClient),
+		auctionrunnerdelegate.WithOutbox(outbox),
+	}
+	if cfg.CellQuarantineThreshold > 0 {
+		delegateOptions = append(delegateOptions, auctionrunnerdelegate.WithCellQuarantine(auctionrunnerdelegate.CellQuarantineConfig{
+			Threshold:    cfg.CellQuarantineThreshold,
+			BaseDuration: time.Duration(cfg.CellQuarantineBaseDuration),
+			MaxDuration:  time.Duration(cfg.CellQuarantineMaxDuration),
+		}))
+	}
+	delegateOptions = append(delegateOptions, initializeCellFilters(cfg.CellFilters)...)
+	if orderings := initializeCellOrderings(cfg.CellOrderings); len(orderings) > 0 {
+		delegateOptions = append(delegateOptions, auctionrunnerdelegate.WithCellOrderings(orderings...))
+	}
+	runnerDelegate := auctionrunnerdelegate.New(repClientFactory, bbsClient, logger, delegateOptions...)
+	delegate := drainer.Delegate(runnerDelegate)
+
+	var auctionLog *auctionlog.AuctionLog
+	if auctionLogStore != nil {
+		auctionLog = auctionlog.New(logger, auctionLogStore, fence)
+		delegate = auctionLog.Delegate(delegate)
+	}
+
+	// The retrier wraps the quota delegate and only passes on the failures it
+	// gives up on, so that retried auctions keep their reservation.
+	quotas := initializeDomainQuotas(logger, cfg, metronClient, runnerDelegate)
+	if quotas != nil {
+		delegate = quotas.Delegate(delegate)
+	}
+
+	// Failures are counted by reason inside the retrier too, so that an
+	// auction is counted once however many times it is retried.
+	delegate = auctionmetricemitterdelegate.NewPlacementFailureRecorder(metronClient, placementFailures).Delegate(delegate)
+
+	expiry := auctionexpiry.New(logger, clock, metronClient, time.Duration(cfg.AuctionMaxWait))
+	delegate = expiry.Delegate(delegate)
+
+	var retrier *auctionretrier.AuctionRetrier
+	if cfg.PlacementMaxRetries > 0 {
+		retrier = auctionretrier.New(logger, clock, auctionretrier.Policy{
+			MaxRetries:      cfg.PlacementMaxRetries,
+			Backoff:         time.Duration(cfg.PlacementRetryBackoff),
+			MaxBackoff:      time.Duration(cfg.PlacementRetryMaxBackoff),
+			RetryableErrors: cfg.PlacementRetryableErrors,
+		})
+		delegate = retrier.Delegate(delegate)
+	}
+
+	if fairQueue != nil {
+		delegate = fairQueue.Delegate(delegate)
+	}
+
 	metricEmitter := auctionmetricemitterdelegate.New(metronClient)
 	workPool, err := workpool.NewWorkPool(cfg.AuctionRunnerWorkers)
 	if err != nil {
 		logger.Fatal("failed-to-construct-auction-runner-workpool", err, lager.Data{"num-workers": cfg.AuctionRunnerWorkers}) // should never happen
 	}
 
-	return auctionrunner.New(
+	runner := expiry.Gate(drainer.Runner(runnerDelegate.Runner(auctionrunner.New(
 		logger,
-		delegate,
+		runnerDelegate.Delegate(delegate),
 		metricEmitter,
-		clock.NewClock(),
+		clock,
 		workPool,
 		cfg.BinPackFirstFitWeight,
 		cfg.StartingContainerWeight,
 		cfg.StartingContainerCountMaximum,
-	)
+	))), delegate)
+
+	if retrier != nil {
+		runner = retrier.Runner(runner)
+	}
+
+	if fairQueue != nil {
+		runner = fairQueue.Runner(runner)
+	}
+
+	// The auction log wraps the fair queue so that auctions are logged as soon
+	// as the handlers accept them, not only once the queue hands them over.
+	if auctionLog != nil {
+		runner = auctionLog.Runner(runner)
+	}
+
+	runner = expiry.Runner(runner)
+
+	// Auctions are admitted before anything else sees them, so that those
+	// over quota are neither logged nor queued.
+	if quotas != nil {
+		runner = quotas.Runner(runner, delegate)
+	}
+
+	return runner, runnerDelegate
+}
+
+// initializeAuctionLogStore returns nil when auctions are not logged.
+func initializeAuctionLogStore(logger lager.Logger, cfg config.AuctioneerConfig) *auctionlog.FileStore {
+	if cfg.AuctionLogPath == "" {
+		return nil
+	}
+
+	store, err := auctionlog.NewFileStore(cfg.AuctionLogPath)
+	if err != nil {
+		logger.Fatal("failed-to-open-auction-log", err, lager.Data{"path": cfg.AuctionLogPath})
+	}
+	return store
+}
+
+// initializeFairQueue returns nil when the fair queue is disabled.
+func initializeFairQueue(logger lager.Logger, cfg config.AuctioneerConfig, clock clock.Clock, metronClient loggingclient.IngressClient) *fairqueue.FairQueue {
+	if !cfg.FairQueueEnabled {
+		return nil
+	}
+
+	key := fairqueue.DomainKey
+	if cfg.FairQueueKey == config.FairQueueKeyPlacementTags {
+		key = fairqueue.PlacementTagsKey
+	}
+
+	return fairqueue.New(logger, clock, metronClient, fairqueue.Config{
+		BatchSize: cfg.FairQueueBatchSize,
+		Weights:   cfg.FairQueueWeights,
+		Key:       key,
+		MaxWait:   time.Duration(cfg.FairQueueMaxWait),
+		MaxDepth:  cfg.FairQueueMaxDepth,
+	})
+}
+
+// initializeDomainQuotas returns nil when no domain has a quota.
+func initializeDomainQuotas(logger lager.Logger, cfg config.AuctioneerConfig, metronClient loggingclient.IngressClient, registry domainquota.CellRegistry) *domainquota.Tracker {
+	if len(cfg.DomainQuotas) == 0 {
+		return nil
+	}
+
+	quotas := make(map[string]domainquota.Quota, len(cfg.DomainQuotas))
+	for domain, quota := range cfg.DomainQuotas {
+		quotas[domain] = domainquota.Quota{
+			MemoryMB:  quota.MemoryMB,
+			DiskMB:    quota.DiskMB,
+			Instances: quota.Instances,
+		}
+	}
+	return domainquota.New(logger, metronClient, quotas, registry)
+}
+
+func initializeCellFilters(configs []config.CellFilterConfig) []auctionrunnerdelegate.Option {
+	options := make([]auctionrunnerdelegate.Option, 0, len(configs))
+	for _, filterConfig := range configs {
+		var filter auctionrunnerdelegate.CellFilter
+		switch filterConfig.Type {
+		case config.CellFilterExcludeLabels:
+			filter = auctionrunnerdelegate.NewLabelExclusionFilter(filterConfig.Labels...)
+		case config.CellFilterDenyCellIDs:
+			filter = auctionrunnerdelegate.NewCellIDDenyList(filterConfig.CellIDs...)
+		default:
+			continue
+		}
+
+		if len(filterConfig.Domains) > 0 {
+			options = append(options, auctionrunnerdelegate.WithDomainCellFilters(filterConfig.Domains, filter))
+		} else {
+			options = append(options, auctionrunnerdelegate.WithCellFilters(filter))
+		}
+	}
+	return options
+}
+
+func initializeCellOrderings(configs []config.CellOrderingConfig) []auctionrunnerdelegate.CellOrdering {
+	orderings := make([]auctionrunnerdelegate.CellOrdering, 0, len(configs))
+	for _, orderingConfig := range configs {
+		switch orderingConfig.Type {
+		case config.CellOrderingPreferLabels:
+			orderings = append(orderings, auctionrunnerdelegate.NewLabelPreference(orderingConfig.Labels...))
+		}
+	}
+	return orderings
+}
+
+// initializeBBSOutbox also returns the file store of the outbox, which is nil
+// when the outbox is not durable.
+func initializeBBSOutbox(logger lager.Logger, cfg config.AuctioneerConfig, bbsClient bbs.InternalClient, metronClient loggingclient.IngressClient, fence auctioneer.Fence) (*bbsoutbox.Outbox, *bbsoutbox.FileStore) {
+	var store bbsoutbox.Store
+	var fileStore *bbsoutbox.FileStore
+	if cfg.BBSOutboxPath == "" {
+		logger.Info("bbs-outbox-not-durable", lager.Data{"reason": "bbs_outbox_path is not set"})
+	} else {
+		var err error
+		fileStore, err = bbsoutbox.NewFileStore(cfg.BBSOutboxPath)
+		if err != nil {
+			logger.Fatal("failed-to-open-bbs-outbox", err, lager.Data{"path": cfg.BBSOutboxPath})
+		}
+		store = fileStore
+	}
+
+	outbox := bbsoutbox.New(logger, clock.NewClock(), bbsClient, store, metronClient, fence, bbsoutbox.Config{
+		Workers:      cfg.BBSOutboxWorkers,
+		MaxAttempts:  cfg.BBSOutboxMaxAttempts,
+		Backoff:      time.Duration(cfg.BBSOutboxBackoff),
+		MaxBackoff:   time.Duration(cfg.BBSOutboxMaxBackoff),
+		DrainTimeout: time.Duration(cfg.BBSOutboxDrainTimeout),
+	})
+	return outbox, fileStore
 }
 
 func initializeMetron(logger lager.Logger, cfg config.AuctioneerConfig) (loggingclient.IngressClient, error) {
@@ -256,30 +525,56 @@ func initializeRegistrationRunner(logger lager.Logger, consulClient consuladapte
 func initializeLockMaintainer(
 	logger lager.Logger,
 	serviceClient auctioneer.ServiceClient,
-	port int,
+	presence auctioneer.Presence,
 	lockTTL time.Duration,
 	lockRetryInterval time.Duration,
 	metronClient loggingclient.IngressClient,
 ) ifrit.Runner {
+	lockMaintainer, err := serviceClient.NewAuctioneerLockRunner(logger, presence, lockRetryInterval, lockTTL, metronClient)
+	if err != nil {
+		logger.Fatal("Couldn't create lock maintainer", err)
+	}
+
+	return lockMaintainer
+}
+
+// auctioneerID is the configured UUID, or a random one when only the consul
+// lock is used.
+func auctioneerID(logger lager.Logger, cfg config.AuctioneerConfig) string {
+	if cfg.UUID != "" {
+		return cfg.UUID
+	}
+
 	uuid, err := uuid.NewV4()
 	if err != nil {
 		logger.Fatal("Couldn't generate uuid", err)
 	}
 
-	localIP, err := localip.LocalIP()
+	return uuid.String()
+}
+
+// initializeProxyTransport returns the transport used by standbys to forward
+// auctions to the leader. The server identity doubles as the client identity,
+// as the leader requires client certificates signed by the same CA.
+func initializeProxyTransport(logger lager.Logger, cfg config.AuctioneerConfig) http.RoundTripper {
+	tlsConfig, err := tlsconfig.Build(
+		tlsconfig.WithInternalServiceDefaults(),
+		tlsconfig.WithIdentityFromFile(cfg.ServerCertFile, cfg.ServerKeyFile),
+	).Client(tlsconfig.WithAuthorityFromFile(cfg.CACertFile))
 	if err != nil {
-		logger.Fatal("Couldn't determine local IP", err)
+		logger.Fatal("invalid-proxy-tls-config", err)
 	}
 
-	address := fmt.Sprintf("%s://%s:%d", serverProtocol, localIP, port)
-	auctioneerPresence := auctioneer.NewPresence(uuid.String(), address)
+	return cfhttp.NewClient(cfhttp.WithTLSConfig(tlsConfig)).Transport
+}
 
-	lockMaintainer, err := serviceClient.NewAuctioneerLockRunner(logger, auctioneerPresence, lockRetryInterval, lockTTL, metronClient)
+func advertisedAddress(logger lager.Logger, scheme string, port int) string {
+	localIP, err := localip.LocalIP()
 	if err != nil {
-		logger.Fatal("Couldn't create lock maintainer", err)
+		logger.Fatal("Couldn't determine local IP", err)
 	}
 
-	return lockMaintainer
+	return fmt.Sprintf("%s://%s:%d", scheme, localIP, port)
 }
 
 func validateBBSAddress(bbsAddress string) error {
@@ -6,13 +6,16 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net"
+	"net/http"
 	"os"
 	"os/exec"
 	"path"
+	"syscall"
 	"time"
 
 	"code.cloudfoundry.org/auctioneer"
 	"code.cloudfoundry.org/auctioneer/cmd/auctioneer/config"
+	"code.cloudfoundry.org/auctioneer/handlers"
 	"code.cloudfoundry.org/bbs"
 	"code.cloudfoundry.org/bbs/models"
 	"code.cloudfoundry.org/bbs/models/test/model_helpers"
@@ -34,6 +37,7 @@ import (
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/gbytes"
 	. "github.com/onsi/gomega/gexec"
+	"github.com/onsi/gomega/ghttp"
 	"github.com/tedsuo/ifrit"
 	"github.com/tedsuo/ifrit/ginkgomon"
 )
@@ -467,8 +471,13 @@ var _ = Describe("Auctioneer", func() {
 		var (
 			task                       *rep.Task
 			competingAuctioneerProcess ifrit.Process
+			competingPresence          []byte
 		)
 
+		BeforeEach(func() {
+			competingPresence = []byte{}
+		})
+
 		JustBeforeEach(func() {
 			task = &rep.Task{
 				TaskGuid: "task-guid",
@@ -482,7 +491,7 @@ var _ = Describe("Auctioneer", func() {
 				},
 			}
 
-			competingAuctioneerLock := locket.NewLock(logger, consulClient, locket.LockSchemaPath("auctioneer_lock"), []byte{}, clock.NewClock(), 500*time.Millisecond, 10*time.Second, locket.WithMetronClient(fakeMetronClient))
+			competingAuctioneerLock := locket.NewLock(logger, consulClient, locket.LockSchemaPath("auctioneer_lock"), competingPresence, clock.NewClock(), 500*time.Millisecond, 10*time.Second, locket.WithMetronClient(fakeMetronClient))
 			competingAuctioneerProcess = ifrit.Invoke(competingAuctioneerLock)
 
 			auctioneerProcess = ifrit.Background(runner)
@@ -492,6 +501,51 @@ var _ = Describe("Auctioneer", func() {
 			ginkgomon.Kill(competingAuctioneerProcess)
 		})
 
+		It("serves its status while standing by", func() {
+			var status auctioneer.Status
+			Eventually(func() error {
+				resp, err := http.Get("http://" + auctioneerLocation + "/v1/status")
+				if err != nil {
+					return err
+				}
+				defer resp.Body.Close()
+				return json.NewDecoder(resp.Body).Decode(&status)
+			}).Should(Succeed())
+
+			Expect(status.IsLeader).To(BeFalse())
+			Expect(status.Self.AuctioneerID).To(Equal(auctioneerConfig.UUID))
+		})
+
+		Context("when the competing auctioneer advertises its presence", func() {
+			var leaderServer *ghttp.Server
+
+			BeforeEach(func() {
+				leaderServer = ghttp.NewServer()
+				leaderServer.RouteToHandler("POST", "/v1/tasks", ghttp.CombineHandlers(
+					ghttp.VerifyHeaderKV(handlers.ProxiedByHeader, auctioneerConfig.UUID),
+					ghttp.RespondWith(http.StatusAccepted, "{}"),
+				))
+
+				var err error
+				competingPresence, err = json.Marshal(auctioneer.NewPresence("competing-auctioneer", leaderServer.URL()))
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			AfterEach(func() {
+				leaderServer.Close()
+			})
+
+			It("forwards auctions to the competing auctioneer", func() {
+				Eventually(func() error {
+					return auctioneerClient.RequestTaskAuctions(logger, []*auctioneer.TaskStartRequest{
+						&auctioneer.TaskStartRequest{*task},
+					})
+				}).ShouldNot(HaveOccurred())
+
+				Expect(leaderServer.ReceivedRequests()).NotTo(BeEmpty())
+			})
+		})
+
 		It("should not advertise its presence, and should not be reachable", func() {
 			Consistently(func() error {
 				return auctioneerClient.RequestTaskAuctions(logger, []*auctioneer.TaskStartRequest{
@@ -578,6 +632,58 @@ var _ = Describe("Auctioneer", func() {
 			Expect(lock.Resource.Owner).To(Equal(auctioneerConfig.UUID))
 		})
 
+		It("advertises its presence in the lock value", func() {
+			locketClient, err := locket.NewClient(logger, auctioneerConfig.ClientLocketConfig)
+			Expect(err).NotTo(HaveOccurred())
+
+			serviceClient := auctioneer.NewLocketServiceClient(locketClient, clock.NewClock())
+
+			var presence auctioneer.Presence
+			Eventually(func() error {
+				presence, err = serviceClient.CurrentAuctioneer()
+				return err
+			}).ShouldNot(HaveOccurred())
+
+			Expect(presence.AuctioneerID).To(Equal(auctioneerConfig.UUID))
+			Expect(presence.AuctioneerAddress).To(HaveSuffix(fmt.Sprintf(":%d", auctioneerServerPort)))
+			Expect(presence.AuctioneerAddress).To(HavePrefix("http://"))
+			Expect(presence.Scheme).To(Equal("http"))
+			Expect(presence.ClientCertRequired).To(BeFalse())
+			Expect(presence.StartedAt).NotTo(BeZero())
+			Expect(presence.Features).To(ConsistOf(auctioneer.SupportedFeatures))
+		})
+
+		It("reports the fencing token of its leadership term", func() {
+			var status auctioneer.Status
+			Eventually(func() (bool, error) {
+				resp, err := http.Get("http://" + auctioneerLocation + "/v1/status")
+				if err != nil {
+					return false, err
+				}
+				defer resp.Body.Close()
+				err = json.NewDecoder(resp.Body).Decode(&status)
+				return status.IsLeader, err
+			}).Should(BeTrue())
+
+			Expect(status.FencingToken).NotTo(BeZero())
+		})
+
+		It("releases the lock when it is stopped", func() {
+			locketClient, err := locket.NewClient(logger, auctioneerConfig.ClientLocketConfig)
+			Expect(err).NotTo(HaveOccurred())
+
+			Eventually(func() error {
+				_, err := locketClient.Fetch(context.Background(), &locketmodels.FetchRequest{Key: "auctioneer"})
+				return err
+			}).ShouldNot(HaveOccurred())
+
+			auctioneerProcess.Signal(syscall.SIGTERM)
+			Eventually(auctioneerProcess.Wait(), 2*time.Second).Should(Receive())
+
+			_, err = locketClient.Fetch(context.Background(), &locketmodels.FetchRequest{Key: "auctioneer"})
+			Expect(err).To(HaveOccurred())
+		})
+
 		It("emits metric about holding lock", func() {
 			Eventually(func() error {
 				return auctioneerClient.RequestTaskAuctions(logger, []*auctioneer.TaskStartRequest{
@@ -619,6 +725,32 @@ var _ = Describe("Auctioneer", func() {
 			})
 		})
 
+		Context("when consul is not configured at all", func() {
+			BeforeEach(func() {
+				auctioneerConfig.SkipConsulLock = true
+				auctioneerConfig.EnableConsulServiceRegistration = false
+				auctioneerConfig.ConsulCluster = ""
+			})
+
+			It("starts without a consul agent and accepts auctions", func() {
+				Eventually(func() error {
+					return auctioneerClient.RequestTaskAuctions(logger, []*auctioneer.TaskStartRequest{
+						&auctioneer.TaskStartRequest{*task},
+					})
+				}).ShouldNot(HaveOccurred())
+			})
+
+			Context("but consul service registration is enabled", func() {
+				BeforeEach(func() {
+					auctioneerConfig.EnableConsulServiceRegistration = true
+				})
+
+				It("exits with an error", func() {
+					Eventually(auctioneerProcess.Wait()).Should(Receive(Not(BeNil())))
+				})
+			})
+		})
+
 		Context("when the lock is not available", func() {
 			var competingProcess ifrit.Process
 
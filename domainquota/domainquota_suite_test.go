@@ -0,0 +1,13 @@
+package domainquota_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestDomainquota(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Domain Quota Suite")
+}
@@ -0,0 +1 @@
+package domainquota // import "code.cloudfoundry.org/auctioneer/domainquota"
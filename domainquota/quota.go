@@ -0,0 +1,499 @@
+package domainquota
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"code.cloudfoundry.org/auction/auctiontypes"
+	"code.cloudfoundry.org/auctioneer"
+	"code.cloudfoundry.org/bbs/models"
+	loggingclient "code.cloudfoundry.org/diego-logging-client"
+	loggregator "code.cloudfoundry.org/go-loggregator"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/rep"
+)
+
+const (
+	DomainMemoryMB         = "AuctioneerDomainMemoryMB"
+	DomainDiskMB           = "AuctioneerDomainDiskMB"
+	DomainInstances        = "AuctioneerDomainInstances"
+	QuotaRejectionsCounter = "AuctioneerDomainQuotaRejections"
+	domainTag              = "domain"
+)
+
+// Quota limits the resources of a domain. Zero leaves a resource unlimited.
+type Quota struct {
+	MemoryMB  int64
+	DiskMB    int64
+	Instances int64
+}
+
+// Usage is the resources a domain uses or asks for.
+type Usage struct {
+	MemoryMB  int64
+	DiskMB    int64
+	Instances int64
+}
+
+func (u *Usage) add(other Usage) {
+	u.MemoryMB += other.MemoryMB
+	u.DiskMB += other.DiskMB
+	u.Instances += other.Instances
+}
+
+func (u *Usage) subtract(other Usage) {
+	u.add(Usage{MemoryMB: -other.MemoryMB, DiskMB: -other.DiskMB, Instances: -other.Instances})
+	if u.MemoryMB < 0 {
+		u.MemoryMB = 0
+	}
+	if u.DiskMB < 0 {
+		u.DiskMB = 0
+	}
+	if u.Instances < 0 {
+		u.Instances = 0
+	}
+}
+
+func usageOf(resource rep.Resource, instances int) Usage {
+	return Usage{
+		MemoryMB:  int64(resource.MemoryMB) * int64(instances),
+		DiskMB:    int64(resource.DiskMB) * int64(instances),
+		Instances: int64(instances),
+	}
+}
+
+// ErrQuotaExceeded prefixes the placement error of the auctions rejected
+// because their domain would exceed its quota.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// QuotaExceededError is the placement error of an auction that would take its
+// domain over its quota.
+type QuotaExceededError struct {
+	Domain    string
+	Resource  string
+	Requested int64
+	InUse     int64
+	Limit     int64
+}
+
+func (e QuotaExceededError) Error() string {
+	return fmt.Sprintf(
+		"%s: domain %q would exceed its %s quota: %d requested, %d of %d in use or pending",
+		ErrQuotaExceeded, e.Domain, e.Resource, e.Requested, e.InUse, e.Limit,
+	)
+}
+
+// CellRegistry lists the cells registered with the BBS, including those that
+// are not offered to auctions.
+type CellRegistry interface {
+	Cells(logger lager.Logger) ([]auctioneer.Cell, error)
+}
+
+type lrpKey struct {
+	processGuid string
+	index       int
+}
+
+type reservation struct {
+	domain string
+	usage  Usage
+}
+
+// Tracker enforces per domain quotas. The usage of a domain is the sum of
+// what the cells last reported running for it, what was placed on them
+// since, and what was admitted but has not been auctioned yet.
+//
+// Usage is only known once the state of the cells has been fetched by an
+// auction, so quotas are not enforced against work already running until
+// the first auction after the auctioneer starts.
+type Tracker struct {
+	logger       lager.Logger
+	metronClient loggingclient.IngressClient
+	quotas       map[string]Quota
+	registry     CellRegistry
+
+	lock          sync.Mutex
+	cells         map[string]map[string]Usage
+	reserved      map[string]Usage
+	reservedTasks map[string]reservation
+	reservedLRPs  map[lrpKey]reservation
+}
+
+// New returns a Tracker that keeps the usage of every cell registry lists,
+// so that work running on cells left out of auctions still counts.
+func New(logger lager.Logger, metronClient loggingclient.IngressClient, quotas map[string]Quota, registry CellRegistry) *Tracker {
+	return &Tracker{
+		logger:        logger.Session("domain-quota"),
+		metronClient:  metronClient,
+		quotas:        quotas,
+		registry:      registry,
+		cells:         map[string]map[string]Usage{},
+		reserved:      map[string]Usage{},
+		reservedTasks: map[string]reservation{},
+		reservedLRPs:  map[lrpKey]reservation{},
+	}
+}
+
+// Runner wraps the runner the handlers schedule auctions on, so that every
+// task and LRP instance is admitted on its own. Admitted work is reserved
+// until its auction completes. Work that would take its domain over its quota
+// fails with a QuotaExceededError, which is reported to delegate so that it
+// reaches the BBS like any other failed auction.
+func (t *Tracker) Runner(runner auctiontypes.AuctionRunner, delegate auctiontypes.AuctionRunnerDelegate) auctiontypes.AuctionRunner {
+	return &admittingRunner{
+		AuctionRunner: runner,
+		delegate:      delegate,
+		tracker:       t,
+	}
+}
+
+// admitTasks splits tasks into those admitted and those that would exceed
+// the quota of their domain. Tasks that are already reserved, such as those
+// submitted again by the BBS, are admitted without reserving them twice.
+func (t *Tracker) admitTasks(tasks []auctioneer.TaskStartRequest) ([]auctioneer.TaskStartRequest, []auctiontypes.TaskAuction) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	admitted := make([]auctioneer.TaskStartRequest, 0, len(tasks))
+	rejected := []auctiontypes.TaskAuction{}
+	for i := range tasks {
+		task := &tasks[i]
+		if _, ok := t.reservedTasks[task.TaskGuid]; !ok {
+			usage := usageOf(task.Resource, 1)
+			if err := t.reserve(task.Domain, usage); err != nil {
+				rejected = append(rejected, auctiontypes.TaskAuction{
+					Task:          task.Task,
+					AuctionRecord: auctiontypes.AuctionRecord{PlacementError: err.Error()},
+				})
+				continue
+			}
+			t.reservedTasks[task.TaskGuid] = reservation{domain: task.Domain, usage: usage}
+		}
+		admitted = append(admitted, *task)
+	}
+	return admitted, rejected
+}
+
+// admitLRPs splits the instances of lrps into those admitted and those that
+// would exceed the quota of their domain, like admitTasks.
+func (t *Tracker) admitLRPs(lrps []auctioneer.LRPStartRequest) ([]auctioneer.LRPStartRequest, []auctiontypes.LRPAuction) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	admitted := make([]auctioneer.LRPStartRequest, 0, len(lrps))
+	rejected := []auctiontypes.LRPAuction{}
+	for i := range lrps {
+		start := lrps[i]
+		indices := make([]int, 0, len(start.Indices))
+		for _, index := range start.Indices {
+			key := lrpKey{start.ProcessGuid, index}
+			if _, ok := t.reservedLRPs[key]; !ok {
+				usage := usageOf(start.Resource, 1)
+				if err := t.reserve(start.Domain, usage); err != nil {
+					rejected = append(rejected, auctiontypes.LRPAuction{
+						LRP:           rep.NewLRP("", models.NewActualLRPKey(start.ProcessGuid, int32(index), start.Domain), start.Resource, start.PlacementConstraint),
+						AuctionRecord: auctiontypes.AuctionRecord{PlacementError: err.Error()},
+					})
+					continue
+				}
+				t.reservedLRPs[key] = reservation{domain: start.Domain, usage: usage}
+			}
+			indices = append(indices, index)
+		}
+
+		if len(indices) > 0 {
+			start.Indices = indices
+			admitted = append(admitted, start)
+		}
+	}
+	return admitted, rejected
+}
+
+// reserve adds usage to the reservations of domain unless it would exceed the
+// quota of domain.
+func (t *Tracker) reserve(domain string, usage Usage) error {
+	if quota, ok := t.quotas[domain]; ok {
+		if err := exceeds(domain, quota, t.usage(domain), usage); err != nil {
+			return err
+		}
+	}
+
+	reserved := t.reserved[domain]
+	reserved.add(usage)
+	t.reserved[domain] = reserved
+	return nil
+}
+
+func (t *Tracker) reportRejected(delegate auctiontypes.AuctionRunnerDelegate, results auctiontypes.AuctionResults) {
+	rejected := len(results.FailedTasks) + len(results.FailedLRPs)
+	if rejected == 0 {
+		return
+	}
+
+	for i := range results.FailedTasks {
+		t.logger.Info("quota-exceeded", lager.Data{"task-guid": results.FailedTasks[i].TaskGuid, "error": results.FailedTasks[i].PlacementError})
+	}
+	for i := range results.FailedLRPs {
+		t.logger.Info("quota-exceeded", lager.Data{"lrp": results.FailedLRPs[i].ActualLRPKey, "error": results.FailedLRPs[i].PlacementError})
+	}
+	if t.metronClient != nil {
+		err := t.metronClient.IncrementCounterWithDelta(QuotaRejectionsCounter, uint64(rejected))
+		if err != nil {
+			t.logger.Error("failed-to-increment-rejections-counter", err)
+		}
+	}
+	delegate.AuctionCompleted(results)
+}
+
+func exceeds(domain string, quota Quota, inUse, requested Usage) error {
+	checks := []struct {
+		resource             string
+		limit, inUse, wanted int64
+	}{
+		{"memory_mb", quota.MemoryMB, inUse.MemoryMB, requested.MemoryMB},
+		{"disk_mb", quota.DiskMB, inUse.DiskMB, requested.DiskMB},
+		{"instances", quota.Instances, inUse.Instances, requested.Instances},
+	}
+
+	for _, check := range checks {
+		if check.limit > 0 && check.inUse+check.wanted > check.limit {
+			return QuotaExceededError{
+				Domain:    domain,
+				Resource:  check.resource,
+				Requested: check.wanted,
+				InUse:     check.inUse,
+				Limit:     check.limit,
+			}
+		}
+	}
+	return nil
+}
+
+// Usage returns the usage of every domain known to the tracker.
+func (t *Tracker) Usage() map[string]Usage {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.allUsage()
+}
+
+func (t *Tracker) usage(domain string) Usage {
+	usage := t.reserved[domain]
+	for _, domains := range t.cells {
+		usage.add(domains[domain])
+	}
+	return usage
+}
+
+func (t *Tracker) allUsage() map[string]Usage {
+	usage := map[string]Usage{}
+	for domain := range t.quotas {
+		usage[domain] = t.usage(domain)
+	}
+	for domain := range t.reserved {
+		usage[domain] = t.usage(domain)
+	}
+	for _, domains := range t.cells {
+		for domain := range domains {
+			usage[domain] = t.usage(domain)
+		}
+	}
+	return usage
+}
+
+// Delegate wraps the auction runner delegate to observe the state of the
+// cells and the outcome of auctions. Every failed auction it is told about
+// releases its reservation, so it must not see the failures that are retried.
+func (t *Tracker) Delegate(delegate auctiontypes.AuctionRunnerDelegate) auctiontypes.AuctionRunnerDelegate {
+	return &trackingDelegate{
+		AuctionRunnerDelegate: delegate,
+		tracker:               t,
+	}
+}
+
+// observe replaces what cellID is known to run with its state.
+func (t *Tracker) observe(cellID string, state rep.CellState) {
+	domains := map[string]Usage{}
+	for i := range state.LRPs {
+		usage := domains[state.LRPs[i].Domain]
+		usage.add(usageOf(state.LRPs[i].Resource, 1))
+		domains[state.LRPs[i].Domain] = usage
+	}
+	for i := range state.Tasks {
+		usage := domains[state.Tasks[i].Domain]
+		usage.add(usageOf(state.Tasks[i].Resource, 1))
+		domains[state.Tasks[i].Domain] = usage
+	}
+
+	t.lock.Lock()
+	t.cells[cellID] = domains
+	t.lock.Unlock()
+}
+
+// retain forgets the cells that are no longer registered. Cells that are
+// registered but not offered to auctions, such as quarantined or filtered
+// cells, keep the usage they last reported. If the registered cells cannot be
+// listed every cell is kept.
+func (t *Tracker) retain(cellReps map[string]rep.Client) {
+	registered := make(map[string]struct{}, len(cellReps))
+	for cellID := range cellReps {
+		registered[cellID] = struct{}{}
+	}
+
+	cells, err := t.registry.Cells(t.logger)
+	if err != nil {
+		t.logger.Error("failed-to-list-registered-cells", err)
+		return
+	}
+	for _, cell := range cells {
+		registered[cell.CellID] = struct{}{}
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for cellID := range t.cells {
+		if _, ok := registered[cellID]; !ok {
+			delete(t.cells, cellID)
+		}
+	}
+}
+
+// completed releases the reservations of the auctioned work and adds the
+// placed work to its cell. Work that was not admitted through Runner, such as
+// auctions recovered from the auction log, has no reservation to release.
+func (t *Tracker) completed(results auctiontypes.AuctionResults) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	place := func(cellID, domain string, usage Usage) {
+		domains, ok := t.cells[cellID]
+		if !ok {
+			domains = map[string]Usage{}
+			t.cells[cellID] = domains
+		}
+		placed := domains[domain]
+		placed.add(usage)
+		domains[domain] = placed
+	}
+
+	releaseTask := func(taskGuid string) {
+		r, ok := t.reservedTasks[taskGuid]
+		if !ok {
+			return
+		}
+		delete(t.reservedTasks, taskGuid)
+		t.release(r)
+	}
+	releaseLRP := func(key lrpKey) {
+		r, ok := t.reservedLRPs[key]
+		if !ok {
+			return
+		}
+		delete(t.reservedLRPs, key)
+		t.release(r)
+	}
+
+	for _, lrp := range results.SuccessfulLRPs {
+		releaseLRP(lrpKey{lrp.ProcessGuid, int(lrp.Index)})
+		place(lrp.Winner, lrp.Domain, usageOf(lrp.Resource, 1))
+	}
+	for _, task := range results.SuccessfulTasks {
+		releaseTask(task.TaskGuid)
+		place(task.Winner, task.Domain, usageOf(task.Resource, 1))
+	}
+	for _, lrp := range results.FailedLRPs {
+		releaseLRP(lrpKey{lrp.ProcessGuid, int(lrp.Index)})
+	}
+	for _, task := range results.FailedTasks {
+		releaseTask(task.TaskGuid)
+	}
+
+	t.emitUsage()
+}
+
+func (t *Tracker) release(r reservation) {
+	reserved := t.reserved[r.domain]
+	reserved.subtract(r.usage)
+	if reserved == (Usage{}) {
+		delete(t.reserved, r.domain)
+	} else {
+		t.reserved[r.domain] = reserved
+	}
+}
+
+func (t *Tracker) emitUsage() {
+	if t.metronClient == nil {
+		return
+	}
+
+	for domain, usage := range t.allUsage() {
+		tag := loggregator.WithEnvelopeTag(domainTag, domain)
+		t.metronClient.SendMetric(DomainMemoryMB, int(usage.MemoryMB), tag)
+		t.metronClient.SendMetric(DomainDiskMB, int(usage.DiskMB), tag)
+		t.metronClient.SendMetric(DomainInstances, int(usage.Instances), tag)
+	}
+}
+
+type trackingDelegate struct {
+	auctiontypes.AuctionRunnerDelegate
+	tracker *Tracker
+}
+
+func (d *trackingDelegate) FetchCellReps() (map[string]rep.Client, error) {
+	cellReps, err := d.AuctionRunnerDelegate.FetchCellReps()
+	if err != nil {
+		return cellReps, err
+	}
+
+	d.tracker.retain(cellReps)
+
+	observed := make(map[string]rep.Client, len(cellReps))
+	for cellID, client := range cellReps {
+		observed[cellID] = &observedRepClient{Client: client, cellID: cellID, tracker: d.tracker}
+	}
+	return observed, nil
+}
+
+func (d *trackingDelegate) AuctionCompleted(results auctiontypes.AuctionResults) {
+	d.tracker.completed(results)
+	d.AuctionRunnerDelegate.AuctionCompleted(results)
+}
+
+// observedRepClient reports every state fetched from a cell to the tracker.
+type observedRepClient struct {
+	rep.Client
+	cellID  string
+	tracker *Tracker
+}
+
+func (c *observedRepClient) State(logger lager.Logger) (rep.CellState, error) {
+	state, err := c.Client.State(logger)
+	if err == nil {
+		c.tracker.observe(c.cellID, state)
+	}
+	return state, err
+}
+
+type admittingRunner struct {
+	auctiontypes.AuctionRunner
+	delegate auctiontypes.AuctionRunnerDelegate
+	tracker  *Tracker
+}
+
+func (r *admittingRunner) ScheduleLRPsForAuctions(starts []auctioneer.LRPStartRequest) {
+	admitted, rejected := r.tracker.admitLRPs(starts)
+	r.tracker.reportRejected(r.delegate, auctiontypes.AuctionResults{FailedLRPs: rejected})
+	if len(admitted) > 0 {
+		r.AuctionRunner.ScheduleLRPsForAuctions(admitted)
+	}
+}
+
+func (r *admittingRunner) ScheduleTasksForAuctions(tasks []auctioneer.TaskStartRequest) {
+	admitted, rejected := r.tracker.admitTasks(tasks)
+	r.tracker.reportRejected(r.delegate, auctiontypes.AuctionResults{FailedTasks: rejected})
+	if len(admitted) > 0 {
+		r.AuctionRunner.ScheduleTasksForAuctions(admitted)
+	}
+}
@@ -0,0 +1,305 @@
+package domainquota_test
+
+import (
+	"errors"
+	"time"
+
+	"code.cloudfoundry.org/auction/auctiontypes"
+	fake_auction_runner "code.cloudfoundry.org/auction/auctiontypes/fakes"
+	"code.cloudfoundry.org/auctioneer"
+	"code.cloudfoundry.org/auctioneer/auctionretrier"
+	"code.cloudfoundry.org/auctioneer/domainquota"
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/clock/fakeclock"
+	mfakes "code.cloudfoundry.org/diego-logging-client/testhelpers"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/rep"
+	"code.cloudfoundry.org/rep/repfakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakeDelegate struct {
+	cellReps  map[string]rep.Client
+	completed []auctiontypes.AuctionResults
+}
+
+func (d *fakeDelegate) FetchCellReps() (map[string]rep.Client, error) {
+	return d.cellReps, nil
+}
+
+func (d *fakeDelegate) AuctionCompleted(results auctiontypes.AuctionResults) {
+	d.completed = append(d.completed, results)
+}
+
+type fakeRegistry struct {
+	cells []auctioneer.Cell
+	err   error
+}
+
+func (r *fakeRegistry) Cells(lager.Logger) ([]auctioneer.Cell, error) {
+	return r.cells, r.err
+}
+
+var _ = Describe("Tracker", func() {
+	var (
+		logger           *lagertest.TestLogger
+		fakeMetronClient *mfakes.FakeIngressClient
+		innerDelegate    *fakeDelegate
+		repClient        *repfakes.FakeClient
+		registry         *fakeRegistry
+		fakeRunner       *fake_auction_runner.FakeAuctionRunner
+		tracker          *domainquota.Tracker
+		delegate         auctiontypes.AuctionRunnerDelegate
+		runner           auctiontypes.AuctionRunner
+		constraint       rep.PlacementConstraint
+	)
+
+	lrpStart := func(domain string, memoryMB int32, indices ...int) auctioneer.LRPStartRequest {
+		return auctioneer.NewLRPStartRequest("process-guid", domain, indices, rep.NewResource(memoryMB, 10, 10), constraint)
+	}
+
+	taskStart := func(guid, domain string, memoryMB int32) auctioneer.TaskStartRequest {
+		return auctioneer.NewTaskStartRequest(rep.NewTask(guid, domain, rep.NewResource(memoryMB, 10, 10), constraint))
+	}
+
+	fetchStates := func() {
+		cellReps, err := delegate.FetchCellReps()
+		Expect(err).NotTo(HaveOccurred())
+		for _, client := range cellReps {
+			client.State(logger)
+		}
+	}
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		fakeMetronClient = &mfakes.FakeIngressClient{}
+		constraint = rep.NewPlacementConstraint("rootfs", []string{}, []string{})
+
+		repClient = new(repfakes.FakeClient)
+		innerDelegate = &fakeDelegate{cellReps: map[string]rep.Client{"cell-a": repClient}}
+
+		registry = &fakeRegistry{cells: []auctioneer.Cell{{CellID: "cell-a"}}}
+		fakeRunner = new(fake_auction_runner.FakeAuctionRunner)
+
+		tracker = domainquota.New(logger, fakeMetronClient, map[string]domainquota.Quota{
+			"limited": {MemoryMB: 1024, Instances: 4},
+		}, registry)
+		delegate = tracker.Delegate(innerDelegate)
+		runner = tracker.Runner(fakeRunner, delegate)
+	})
+
+	Describe("admission", func() {
+		It("admits work within the quota and reserves it", func() {
+			starts := []auctioneer.LRPStartRequest{lrpStart("limited", 256, 0, 1)}
+			runner.ScheduleLRPsForAuctions(starts)
+
+			Expect(fakeRunner.ScheduleLRPsForAuctionsCallCount()).To(Equal(1))
+			Expect(fakeRunner.ScheduleLRPsForAuctionsArgsForCall(0)).To(Equal(starts))
+			Expect(tracker.Usage()["limited"]).To(Equal(domainquota.Usage{MemoryMB: 512, DiskMB: 20, Instances: 2}))
+			Expect(innerDelegate.completed).To(BeEmpty())
+		})
+
+		It("fails the work that would exceed the quota", func() {
+			runner.ScheduleTasksForAuctions([]auctioneer.TaskStartRequest{taskStart("task-1", "limited", 768)})
+			runner.ScheduleLRPsForAuctions([]auctioneer.LRPStartRequest{lrpStart("limited", 512, 0)})
+
+			Expect(fakeRunner.ScheduleLRPsForAuctionsCallCount()).To(Equal(0))
+			Expect(innerDelegate.completed).To(HaveLen(1))
+			failed := innerDelegate.completed[0].FailedLRPs
+			Expect(failed).To(HaveLen(1))
+			Expect(failed[0].ActualLRPKey).To(Equal(models.NewActualLRPKey("process-guid", 0, "limited")))
+			Expect(failed[0].PlacementError).To(Equal(domainquota.QuotaExceededError{
+				Domain:    "limited",
+				Resource:  "memory_mb",
+				Requested: 512,
+				InUse:     768,
+				Limit:     1024,
+			}.Error()))
+			Expect(failed[0].PlacementError).To(HavePrefix(domainquota.ErrQuotaExceeded.Error()))
+			Expect(failed[0].PlacementError).To(ContainSubstring(`domain "limited" would exceed its memory_mb quota`))
+
+			Expect(tracker.Usage()["limited"].MemoryMB).To(BeEquivalentTo(768))
+			Expect(fakeMetronClient.IncrementCounterWithDeltaCallCount()).To(Equal(1))
+			name, value := fakeMetronClient.IncrementCounterWithDeltaArgsForCall(0)
+			Expect(name).To(Equal(domainquota.QuotaRejectionsCounter))
+			Expect(value).To(BeEquivalentTo(1))
+		})
+
+		It("admits the work of other domains in the same submission", func() {
+			runner.ScheduleTasksForAuctions([]auctioneer.TaskStartRequest{
+				taskStart("task-1", "unlimited", 4096),
+				taskStart("task-2", "limited", 2048),
+				taskStart("task-3", "limited", 512),
+			})
+
+			Expect(fakeRunner.ScheduleTasksForAuctionsCallCount()).To(Equal(1))
+			admitted := fakeRunner.ScheduleTasksForAuctionsArgsForCall(0)
+			Expect(admitted).To(HaveLen(2))
+			Expect(admitted[0].TaskGuid).To(Equal("task-1"))
+			Expect(admitted[1].TaskGuid).To(Equal("task-3"))
+
+			Expect(innerDelegate.completed).To(HaveLen(1))
+			Expect(innerDelegate.completed[0].FailedTasks).To(HaveLen(1))
+			Expect(innerDelegate.completed[0].FailedTasks[0].TaskGuid).To(Equal("task-2"))
+
+			Expect(tracker.Usage()["unlimited"].MemoryMB).To(BeEquivalentTo(4096))
+			Expect(tracker.Usage()["limited"].MemoryMB).To(BeEquivalentTo(512))
+		})
+
+		It("enforces the instance quota per instance", func() {
+			runner.ScheduleLRPsForAuctions([]auctioneer.LRPStartRequest{lrpStart("limited", 1, 0, 1, 2, 3, 4)})
+
+			Expect(fakeRunner.ScheduleLRPsForAuctionsArgsForCall(0)[0].Indices).To(Equal([]int{0, 1, 2, 3}))
+			failed := innerDelegate.completed[0].FailedLRPs
+			Expect(failed).To(HaveLen(1))
+			Expect(failed[0].Index).To(BeEquivalentTo(4))
+			Expect(failed[0].PlacementError).To(ContainSubstring("instances quota"))
+		})
+
+		It("does not reserve work submitted again twice", func() {
+			runner.ScheduleTasksForAuctions([]auctioneer.TaskStartRequest{taskStart("task-1", "limited", 768)})
+			runner.ScheduleTasksForAuctions([]auctioneer.TaskStartRequest{taskStart("task-1", "limited", 768)})
+
+			Expect(fakeRunner.ScheduleTasksForAuctionsCallCount()).To(Equal(2))
+			Expect(tracker.Usage()["limited"].MemoryMB).To(BeEquivalentTo(768))
+		})
+
+		It("does not limit domains without a quota", func() {
+			runner.ScheduleTasksForAuctions([]auctioneer.TaskStartRequest{taskStart("task-1", "unlimited", 1<<20)})
+			Expect(fakeRunner.ScheduleTasksForAuctionsCallCount()).To(Equal(1))
+		})
+
+		It("does not release reservations for work it did not admit", func() {
+			runner.ScheduleTasksForAuctions([]auctioneer.TaskStartRequest{taskStart("task-1", "limited", 256)})
+			delegate.AuctionCompleted(auctiontypes.AuctionResults{
+				FailedTasks: []auctiontypes.TaskAuction{{
+					Task:          rep.NewTask("recovered-task", "limited", rep.NewResource(256, 10, 10), constraint),
+					AuctionRecord: auctiontypes.AuctionRecord{PlacementError: "insufficient resources: memory"},
+				}},
+			})
+
+			Expect(tracker.Usage()["limited"]).To(Equal(domainquota.Usage{MemoryMB: 256, DiskMB: 10, Instances: 1}))
+		})
+	})
+
+	Describe("tracking usage", func() {
+		It("counts what the cells report running", func() {
+			repClient.StateReturns(rep.CellState{
+				LRPs: []rep.LRP{
+					rep.NewLRP("", models.NewActualLRPKey("process-guid", 0, "limited"), rep.NewResource(512, 10, 10), constraint),
+				},
+				Tasks: []rep.Task{
+					rep.NewTask("task-1", "limited", rep.NewResource(256, 10, 10), constraint),
+				},
+			}, nil)
+			fetchStates()
+
+			Expect(tracker.Usage()["limited"]).To(Equal(domainquota.Usage{MemoryMB: 768, DiskMB: 20, Instances: 2}))
+			runner.ScheduleLRPsForAuctions([]auctioneer.LRPStartRequest{lrpStart("limited", 512, 0)})
+			Expect(fakeRunner.ScheduleLRPsForAuctionsCallCount()).To(Equal(0))
+		})
+
+		It("moves reservations to the winning cell once placed and releases failed ones", func() {
+			runner.ScheduleTasksForAuctions([]auctioneer.TaskStartRequest{
+				taskStart("task-1", "limited", 256),
+				taskStart("task-2", "limited", 256),
+			})
+
+			resource := rep.NewResource(256, 10, 10)
+			delegate.AuctionCompleted(auctiontypes.AuctionResults{
+				SuccessfulTasks: []auctiontypes.TaskAuction{{
+					Task:          rep.NewTask("task-1", "limited", resource, constraint),
+					AuctionRecord: auctiontypes.AuctionRecord{Winner: "cell-a"},
+				}},
+				FailedTasks: []auctiontypes.TaskAuction{{
+					Task:          rep.NewTask("task-2", "limited", resource, constraint),
+					AuctionRecord: auctiontypes.AuctionRecord{PlacementError: "insufficient resources: memory"},
+				}},
+			})
+
+			Expect(innerDelegate.completed).To(HaveLen(1))
+			Expect(tracker.Usage()["limited"]).To(Equal(domainquota.Usage{MemoryMB: 256, DiskMB: 10, Instances: 1}))
+
+			By("replacing the placements with the next state of the cell")
+			repClient.StateReturns(rep.CellState{}, nil)
+			fetchStates()
+			Expect(tracker.Usage()["limited"]).To(Equal(domainquota.Usage{}))
+		})
+
+		Context("when a cell is no longer offered to auctions", func() {
+			BeforeEach(func() {
+				repClient.StateReturns(rep.CellState{
+					Tasks: []rep.Task{rep.NewTask("task-1", "limited", rep.NewResource(256, 10, 10), constraint)},
+				}, nil)
+				fetchStates()
+				innerDelegate.cellReps = map[string]rep.Client{}
+			})
+
+			It("keeps its usage while it is registered", func() {
+				fetchStates()
+				Expect(tracker.Usage()["limited"].MemoryMB).To(BeEquivalentTo(256))
+			})
+
+			It("forgets its usage once it is no longer registered", func() {
+				registry.cells = nil
+				fetchStates()
+				Expect(tracker.Usage()["limited"].MemoryMB).To(BeEquivalentTo(0))
+			})
+
+			It("keeps its usage when the registered cells cannot be listed", func() {
+				registry.cells = nil
+				registry.err = errors.New("bbs unavailable")
+				fetchStates()
+				Expect(tracker.Usage()["limited"].MemoryMB).To(BeEquivalentTo(256))
+			})
+		})
+
+		It("emits usage gauges per domain after every auction", func() {
+			runner.ScheduleTasksForAuctions([]auctioneer.TaskStartRequest{taskStart("task-1", "limited", 256)})
+			delegate.AuctionCompleted(auctiontypes.AuctionResults{})
+
+			Expect(fakeMetronClient.SendMetricCallCount()).To(Equal(3))
+			name, value, opts := fakeMetronClient.SendMetricArgsForCall(0)
+			Expect(name).To(Equal(domainquota.DomainMemoryMB))
+			Expect(value).To(Equal(256))
+			Expect(opts).To(HaveLen(1))
+		})
+	})
+
+	Describe("behind an auction retrier", func() {
+		var retrier *auctionretrier.AuctionRetrier
+
+		failTask := func() {
+			delegate.AuctionCompleted(auctiontypes.AuctionResults{
+				FailedTasks: []auctiontypes.TaskAuction{{
+					Task:          rep.NewTask("task-1", "limited", rep.NewResource(256, 10, 10), constraint),
+					AuctionRecord: auctiontypes.AuctionRecord{PlacementError: "insufficient resources: memory"},
+				}},
+			})
+		}
+
+		BeforeEach(func() {
+			retrier = auctionretrier.New(logger, fakeclock.NewFakeClock(time.Now()), auctionretrier.Policy{MaxRetries: 1})
+			delegate = retrier.Delegate(tracker.Delegate(innerDelegate))
+
+			runner.ScheduleTasksForAuctions([]auctioneer.TaskStartRequest{taskStart("task-1", "limited", 256)})
+		})
+
+		It("holds the reservation of failures that are retried", func() {
+			failTask()
+
+			Expect(retrier.Waiting()).To(Equal(1))
+			Expect(tracker.Usage()["limited"]).To(Equal(domainquota.Usage{MemoryMB: 256, DiskMB: 10, Instances: 1}))
+		})
+
+		It("releases the reservation once the retrier gives up", func() {
+			failTask()
+			failTask()
+
+			Expect(tracker.Usage()["limited"]).To(Equal(domainquota.Usage{}))
+		})
+	})
+})
@@ -0,0 +1,108 @@
+package auctioneer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// maxErrorBodyBytes bounds how much of an error response is read when
+// decoding the message written by the auctioneer handlers.
+const maxErrorBodyBytes = 64 * 1024
+
+// ErrInvalidRequest is returned when the auctioneer rejects the request
+// payload (400 Bad Request).
+type ErrInvalidRequest struct {
+	Message string
+}
+
+func (e ErrInvalidRequest) Error() string {
+	return errorWithMessage("invalid request", e.Message)
+}
+
+// ErrNotLeader is returned when the contacted auctioneer does not hold the
+// lock and cannot schedule auctions (421 Misdirected Request).
+type ErrNotLeader struct {
+	Message string
+}
+
+func (e ErrNotLeader) Error() string {
+	return errorWithMessage("auctioneer is not the leader", e.Message)
+}
+
+// ErrTooManyRequests is returned when the auctioneer is shedding load
+// (429 Too Many Requests).
+type ErrTooManyRequests struct {
+	Message string
+}
+
+func (e ErrTooManyRequests) Error() string {
+	return errorWithMessage("too many requests", e.Message)
+}
+
+// ErrUnavailable is returned when the auctioneer cannot currently accept
+// work (503 Service Unavailable).
+type ErrUnavailable struct {
+	Message string
+}
+
+func (e ErrUnavailable) Error() string {
+	return errorWithMessage("auctioneer unavailable", e.Message)
+}
+
+// ErrUnexpectedStatus is returned for any other unsuccessful response.
+type ErrUnexpectedStatus struct {
+	StatusCode int
+	Message    string
+}
+
+func (e ErrUnexpectedStatus) Error() string {
+	return errorWithMessage(
+		fmt.Sprintf("http error: status code %d (%s)", e.StatusCode, http.StatusText(e.StatusCode)),
+		e.Message,
+	)
+}
+
+func errorWithMessage(description, message string) string {
+	if message == "" {
+		return description
+	}
+	return description + ": " + message
+}
+
+// errorFromResponse converts an unsuccessful response into one of the exported
+// error types, carrying the message of the HandlerError body if present.
+func errorFromResponse(resp *http.Response) error {
+	message := decodeErrorMessage(resp.Body)
+
+	switch resp.StatusCode {
+	case http.StatusBadRequest:
+		return ErrInvalidRequest{Message: message}
+	case http.StatusMisdirectedRequest:
+		return ErrNotLeader{Message: message}
+	case http.StatusTooManyRequests:
+		return ErrTooManyRequests{Message: message}
+	case http.StatusServiceUnavailable:
+		return ErrUnavailable{Message: message}
+	default:
+		return ErrUnexpectedStatus{StatusCode: resp.StatusCode, Message: message}
+	}
+}
+
+func decodeErrorMessage(body io.Reader) string {
+	payload, err := ioutil.ReadAll(io.LimitReader(body, maxErrorBodyBytes))
+	if err != nil {
+		return ""
+	}
+
+	handlerError := struct {
+		Error string `json:"error"`
+	}{}
+	if err := json.Unmarshal(payload, &handlerError); err != nil {
+		return ""
+	}
+
+	return handlerError.Error
+}
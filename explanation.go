@@ -0,0 +1,30 @@
+package auctioneer
+
+// PlacementExplanation describes how a start request would be placed on the
+// cells known to the auctioneer at the time it is explained. Each request is
+// explained on its own, without the requests it was submitted with.
+type PlacementExplanation struct {
+	Identifier string            `json:"identifier"`
+	Cells      []CellExplanation `json:"cells"`
+
+	// BestCellID is the cell with the lowest score, if any cell fits.
+	BestCellID string `json:"best_cell_id,omitempty"`
+	// InflightLimitReached is set when the cells are already starting as
+	// many containers as the auctioneer allows, in which case the auction
+	// would postpone the request.
+	InflightLimitReached bool `json:"inflight_limit_reached,omitempty"`
+}
+
+// CellExplanation describes a candidate cell. A cell is either filtered out
+// for one or more reasons, or scored; lower scores are preferred. Instances
+// counts the instances of the explained LRP already on the cell, which the
+// auction spreads across cells and zones before comparing scores.
+type CellExplanation struct {
+	CellID                 string                   `json:"cell_id"`
+	Zone                   string                   `json:"zone,omitempty"`
+	StartingContainerCount int                      `json:"starting_container_count"`
+	Instances              int                      `json:"instances,omitempty"`
+	FilteredOut            []PlacementFailureReason `json:"filtered_out,omitempty"`
+	Error                  string                   `json:"error,omitempty"`
+	Score                  *float64                 `json:"score,omitempty"`
+}
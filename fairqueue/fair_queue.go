@@ -0,0 +1,555 @@
+package fairqueue
+
+import (
+	"errors"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/auction/auctiontypes"
+	"code.cloudfoundry.org/auctioneer"
+	"code.cloudfoundry.org/clock"
+	loggingclient "code.cloudfoundry.org/diego-logging-client"
+	loggregator "code.cloudfoundry.org/go-loggregator"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/rep"
+	"github.com/tedsuo/ifrit"
+)
+
+const (
+	QueueDepth = "AuctioneerFairQueueDepth"
+	queueTag   = "queue"
+
+	DefaultBatchSize     = 100
+	DefaultMaxWait       = 30 * time.Second
+	DefaultSweepInterval = time.Second
+)
+
+// ErrFull is returned by Accepting while the queues are full.
+var ErrFull = errors.New("fair queue is full")
+
+// KeyFunc returns the queue a start request waits in.
+type KeyFunc func(domain string, constraint rep.PlacementConstraint) string
+
+// DomainKey queues start requests by domain.
+func DomainKey(domain string, _ rep.PlacementConstraint) string {
+	return domain
+}
+
+// PlacementTagsKey queues start requests by their placement tags, which
+// usually identify an isolation segment.
+func PlacementTagsKey(_ string, constraint rep.PlacementConstraint) string {
+	tags := append([]string{}, constraint.PlacementTags...)
+	sort.Strings(tags)
+	return strings.Join(tags, ",")
+}
+
+// Config configures the fair queue. A batch holds up to BatchSize tasks and
+// LRP instances, shared between the queues with work in proportion to their
+// weight. Queues without a weight have a weight of 1.
+type Config struct {
+	BatchSize int
+	Weights   map[string]int
+	Key       KeyFunc
+
+	// MaxWait is how long a batch may take to be auctioned before the next
+	// one is scheduled regardless.
+	MaxWait time.Duration
+
+	// MaxDepth is how many tasks and LRP instances may wait in all queues
+	// together before Accepting turns submissions away. Zero means no limit.
+	MaxDepth int
+
+	// SweepInterval is how often start requests past their deadline are taken
+	// out of the queues.
+	SweepInterval time.Duration
+}
+
+type item struct {
+	task *auctioneer.TaskStartRequest
+	lrp  *auctioneer.LRPStartRequest
+}
+
+type lrpKey struct {
+	processGuid string
+	index       int
+}
+
+func (i item) deadline() int64 {
+	if i.lrp != nil {
+		return i.lrp.Deadline
+	}
+	return i.task.Deadline
+}
+
+func (i item) size() int {
+	if i.lrp != nil {
+		return len(i.lrp.Indices)
+	}
+	return 1
+}
+
+// FairQueue sits between the handlers and the auction runner and hands the
+// runner one batch at a time, taking a fair share of the batch from every
+// queue with work, so that a queue with thousands of start requests does not
+// hold up the others. The next batch is handed over once the runner has
+// completed every auction of the batch.
+type FairQueue struct {
+	logger       lager.Logger
+	clock        clock.Clock
+	metronClient loggingclient.IngressClient
+	config       Config
+
+	lock     sync.Mutex
+	queues   map[string][]item
+	rotation int
+	added    chan struct{}
+	done     chan struct{}
+
+	inFlightTasks map[string]struct{}
+	inFlightLRPs  map[lrpKey]struct{}
+}
+
+func New(logger lager.Logger, clock clock.Clock, metronClient loggingclient.IngressClient, config Config) *FairQueue {
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultBatchSize
+	}
+	if config.MaxWait <= 0 {
+		config.MaxWait = DefaultMaxWait
+	}
+	if config.Key == nil {
+		config.Key = DomainKey
+	}
+	if config.SweepInterval <= 0 {
+		config.SweepInterval = DefaultSweepInterval
+	}
+
+	return &FairQueue{
+		logger:        logger.Session("fair-queue"),
+		clock:         clock,
+		metronClient:  metronClient,
+		config:        config,
+		queues:        map[string][]item{},
+		added:         make(chan struct{}, 1),
+		done:          make(chan struct{}, 1),
+		inFlightTasks: map[string]struct{}{},
+		inFlightLRPs:  map[lrpKey]struct{}{},
+	}
+}
+
+// Depth returns the number of tasks and LRP instances waiting in each queue.
+func (q *FairQueue) Depth() map[string]int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	depth := make(map[string]int, len(q.queues))
+	for key, items := range q.queues {
+		depth[key] = queueSize(items)
+	}
+	return depth
+}
+
+// Accepting returns ErrFull while MaxDepth or more tasks and LRP instances are
+// waiting. Start requests are still queued when it is not consulted, so a
+// submission accepted just below the limit may take the queues past it.
+func (q *FairQueue) Accepting(logger lager.Logger) error {
+	if q.config.MaxDepth <= 0 {
+		return nil
+	}
+
+	q.lock.Lock()
+	depth := 0
+	for _, items := range q.queues {
+		depth += queueSize(items)
+	}
+	q.lock.Unlock()
+
+	if depth >= q.config.MaxDepth {
+		logger.Info("fair-queue-full", lager.Data{"depth": depth, "max-depth": q.config.MaxDepth})
+		return ErrFull
+	}
+	return nil
+}
+
+// Delegate wraps the auction runner delegate to learn when the auctions of a
+// batch complete. Completions of other auctions, such as retries or auctions
+// failed before they reach the auction, are passed on without counting
+// towards the batch.
+func (q *FairQueue) Delegate(delegate auctiontypes.AuctionRunnerDelegate) auctiontypes.AuctionRunnerDelegate {
+	return &queueingDelegate{
+		AuctionRunnerDelegate: delegate,
+		queue:                 q,
+	}
+}
+
+// Runner wraps the auction runner so that start requests are queued and
+// handed to it in batches. Start requests past their deadline are handed to
+// the runner as soon as they are swept out of the queues, outside of any
+// batch, so that runner can fail them as expired instead of leaving them to
+// count towards the depth of the queues. When signalled, everything still
+// queued is handed to the runner right away.
+func (q *FairQueue) Runner(runner auctiontypes.AuctionRunner) auctiontypes.AuctionRunner {
+	return &queueingRunner{
+		AuctionRunner: runner,
+		queue:         q,
+	}
+}
+
+func (q *FairQueue) enqueue(items []item, key func(item) string) {
+	if len(items) == 0 {
+		return
+	}
+
+	q.lock.Lock()
+	touched := map[string]struct{}{}
+	for _, i := range items {
+		k := key(i)
+		q.queues[k] = append(q.queues[k], i)
+		touched[k] = struct{}{}
+	}
+	q.emitDepth(touched)
+	q.lock.Unlock()
+
+	notify(q.added)
+}
+
+func (q *FairQueue) enqueueTasks(tasks []auctioneer.TaskStartRequest) {
+	items := make([]item, len(tasks))
+	for i := range tasks {
+		items[i] = item{task: &tasks[i]}
+	}
+	q.enqueue(items, func(i item) string {
+		return q.config.Key(i.task.Domain, i.task.PlacementConstraint)
+	})
+}
+
+func (q *FairQueue) enqueueLRPs(lrps []auctioneer.LRPStartRequest) {
+	items := make([]item, len(lrps))
+	for i := range lrps {
+		items[i] = item{lrp: &lrps[i]}
+	}
+	q.enqueue(items, func(i item) string {
+		return q.config.Key(i.lrp.Domain, i.lrp.PlacementConstraint)
+	})
+}
+
+func (q *FairQueue) weight(key string) int {
+	if weight, ok := q.config.Weights[key]; ok && weight > 0 {
+		return weight
+	}
+	return 1
+}
+
+// takeBatch removes the next batch from the queues, or everything if all is
+// set. Every pass gives each queue with work its weighted share of the room
+// left in the batch, and at least one start request. The queue served first
+// rotates between batches.
+func (q *FairQueue) takeBatch(all bool) ([]auctioneer.TaskStartRequest, []auctioneer.LRPStartRequest) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	tasks := []auctioneer.TaskStartRequest{}
+	lrps := []auctioneer.LRPStartRequest{}
+	touched := map[string]struct{}{}
+
+	room := q.config.BatchSize
+	for len(q.queues) > 0 && (all || room > 0) {
+		keys := make([]string, 0, len(q.queues))
+		totalWeight := 0
+		for key := range q.queues {
+			keys = append(keys, key)
+			totalWeight += q.weight(key)
+		}
+		sort.Strings(keys)
+
+		passRoom := room
+		for n := range keys {
+			key := keys[(n+q.rotation)%len(keys)]
+			share := passRoom * q.weight(key) / totalWeight
+			if share < 1 {
+				share = 1
+			}
+			if !all && share > room {
+				share = room
+			}
+			if all {
+				share = queueSize(q.queues[key])
+			}
+			if share == 0 {
+				break
+			}
+
+			taken, rest := take(q.queues[key], share)
+			for _, i := range taken {
+				if i.task != nil {
+					tasks = append(tasks, *i.task)
+				} else {
+					lrps = append(lrps, *i.lrp)
+				}
+				room -= i.size()
+			}
+
+			if len(rest) == 0 {
+				delete(q.queues, key)
+			} else {
+				q.queues[key] = rest
+			}
+			touched[key] = struct{}{}
+		}
+	}
+	q.rotation++
+
+	q.emitDepth(touched)
+	return tasks, lrps
+}
+
+// takeExpired removes the start requests whose deadline has passed from the
+// queues.
+func (q *FairQueue) takeExpired() ([]auctioneer.TaskStartRequest, []auctioneer.LRPStartRequest) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	now := q.clock.Now().UnixNano()
+	tasks := []auctioneer.TaskStartRequest{}
+	lrps := []auctioneer.LRPStartRequest{}
+	touched := map[string]struct{}{}
+	for key, items := range q.queues {
+		live := items[:0]
+		for _, i := range items {
+			if deadline := i.deadline(); deadline == 0 || now < deadline {
+				live = append(live, i)
+				continue
+			}
+
+			if i.task != nil {
+				tasks = append(tasks, *i.task)
+			} else {
+				lrps = append(lrps, *i.lrp)
+			}
+			touched[key] = struct{}{}
+		}
+
+		if len(live) == 0 {
+			delete(q.queues, key)
+		} else {
+			q.queues[key] = live
+		}
+	}
+
+	q.emitDepth(touched)
+	return tasks, lrps
+}
+
+// take removes up to n tasks and LRP instances from the front of items,
+// splitting an LRP start request across batches if needed.
+func take(items []item, n int) ([]item, []item) {
+	taken := []item{}
+	for len(items) > 0 && n > 0 {
+		next := items[0]
+		if next.size() <= n {
+			taken = append(taken, next)
+			n -= next.size()
+			items = items[1:]
+			continue
+		}
+
+		head := *next.lrp
+		head.Indices = next.lrp.Indices[:n]
+		tail := *next.lrp
+		tail.Indices = next.lrp.Indices[n:]
+		taken = append(taken, item{lrp: &head})
+		items[0] = item{lrp: &tail}
+		n = 0
+	}
+	return taken, items
+}
+
+func queueSize(items []item) int {
+	size := 0
+	for _, i := range items {
+		size += i.size()
+	}
+	return size
+}
+
+func (q *FairQueue) emitDepth(keys map[string]struct{}) {
+	if q.metronClient == nil {
+		return
+	}
+
+	for key := range keys {
+		err := q.metronClient.SendMetric(QueueDepth, queueSize(q.queues[key]), loggregator.WithEnvelopeTag(queueTag, key))
+		if err != nil {
+			q.logger.Error("failed-to-send-queue-depth", err, lager.Data{"queue": key})
+		}
+	}
+}
+
+func (q *FairQueue) dispatch(runner auctiontypes.AuctionRunner, all bool) bool {
+	tasks, lrps := q.takeBatch(all)
+	if len(tasks) == 0 && len(lrps) == 0 {
+		return false
+	}
+
+	q.track(tasks, lrps)
+	q.logger.Debug("dispatching-batch", lager.Data{"tasks": len(tasks), "lrps": len(lrps)})
+	if len(tasks) > 0 {
+		runner.ScheduleTasksForAuctions(tasks)
+	}
+	if len(lrps) > 0 {
+		runner.ScheduleLRPsForAuctions(lrps)
+	}
+	return true
+}
+
+// track replaces the auctions in flight with those of the batch about to be
+// dispatched. A completion signalled for the previous batch, which may have
+// timed out, no longer counts.
+func (q *FairQueue) track(tasks []auctioneer.TaskStartRequest, lrps []auctioneer.LRPStartRequest) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.inFlightTasks = make(map[string]struct{}, len(tasks))
+	for i := range tasks {
+		q.inFlightTasks[tasks[i].TaskGuid] = struct{}{}
+	}
+	q.inFlightLRPs = map[lrpKey]struct{}{}
+	for i := range lrps {
+		for _, index := range lrps[i].Indices {
+			q.inFlightLRPs[lrpKey{lrps[i].ProcessGuid, index}] = struct{}{}
+		}
+	}
+
+	select {
+	case <-q.done:
+	default:
+	}
+}
+
+// complete forgets the auctions of results that are in flight and reports
+// whether they completed the batch.
+func (q *FairQueue) complete(results auctiontypes.AuctionResults) bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if len(q.inFlightTasks) == 0 && len(q.inFlightLRPs) == 0 {
+		return false
+	}
+
+	for _, tasks := range [][]auctiontypes.TaskAuction{results.SuccessfulTasks, results.FailedTasks} {
+		for i := range tasks {
+			delete(q.inFlightTasks, tasks[i].TaskGuid)
+		}
+	}
+	for _, lrps := range [][]auctiontypes.LRPAuction{results.SuccessfulLRPs, results.FailedLRPs} {
+		for i := range lrps {
+			delete(q.inFlightLRPs, lrpKey{lrps[i].ProcessGuid, int(lrps[i].Index)})
+		}
+	}
+
+	return len(q.inFlightTasks) == 0 && len(q.inFlightLRPs) == 0
+}
+
+func (q *FairQueue) sweep(runner auctiontypes.AuctionRunner) {
+	tasks, lrps := q.takeExpired()
+	if len(tasks) == 0 && len(lrps) == 0 {
+		return
+	}
+
+	q.logger.Info("sweeping-expired-auctions", lager.Data{"tasks": len(tasks), "lrps": len(lrps)})
+	if len(tasks) > 0 {
+		runner.ScheduleTasksForAuctions(tasks)
+	}
+	if len(lrps) > 0 {
+		runner.ScheduleLRPsForAuctions(lrps)
+	}
+}
+
+func notify(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+type queueingDelegate struct {
+	auctiontypes.AuctionRunnerDelegate
+	queue *FairQueue
+}
+
+func (d *queueingDelegate) AuctionCompleted(results auctiontypes.AuctionResults) {
+	d.AuctionRunnerDelegate.AuctionCompleted(results)
+	if d.queue.complete(results) {
+		notify(d.queue.done)
+	}
+}
+
+type queueingRunner struct {
+	auctiontypes.AuctionRunner
+	queue *FairQueue
+}
+
+func (r *queueingRunner) ScheduleTasksForAuctions(tasks []auctioneer.TaskStartRequest) {
+	r.queue.enqueueTasks(tasks)
+}
+
+func (r *queueingRunner) ScheduleLRPsForAuctions(lrps []auctioneer.LRPStartRequest) {
+	r.queue.enqueueLRPs(lrps)
+}
+
+func (r *queueingRunner) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	process := ifrit.Background(r.AuctionRunner)
+	select {
+	case <-process.Ready():
+	case err := <-process.Wait():
+		return err
+	}
+
+	close(ready)
+
+	sweeper := r.queue.clock.NewTicker(r.queue.config.SweepInterval)
+	defer sweeper.Stop()
+
+	inFlight := false
+	var timer clock.Timer
+	var timedOut <-chan time.Time
+	for {
+		if !inFlight && r.queue.dispatch(r.AuctionRunner, false) {
+			inFlight = true
+			timer = r.queue.clock.NewTimer(r.queue.config.MaxWait)
+			timedOut = timer.C()
+		}
+
+		select {
+		case <-r.queue.added:
+		case <-sweeper.C():
+			r.queue.sweep(r.AuctionRunner)
+		case <-r.queue.done:
+			inFlight = false
+		case <-timedOut:
+			r.queue.logger.Info("batch-timed-out", lager.Data{"max-wait": r.queue.config.MaxWait})
+			inFlight = false
+		case err := <-process.Wait():
+			stopTimer(timer)
+			return err
+		case signal := <-signals:
+			stopTimer(timer)
+			r.queue.dispatch(r.AuctionRunner, true)
+			process.Signal(signal)
+			return <-process.Wait()
+		}
+
+		if !inFlight {
+			stopTimer(timer)
+			timer, timedOut = nil, nil
+		}
+	}
+}
+
+func stopTimer(timer clock.Timer) {
+	if timer != nil {
+		timer.Stop()
+	}
+}
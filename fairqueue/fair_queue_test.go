@@ -0,0 +1,321 @@
+package fairqueue_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/auction/auctiontypes"
+	fake_auction_runner "code.cloudfoundry.org/auction/auctiontypes/fakes"
+	"code.cloudfoundry.org/auctioneer"
+	"code.cloudfoundry.org/auctioneer/auctionlog"
+	"code.cloudfoundry.org/auctioneer/fairqueue"
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/clock/fakeclock"
+	mfakes "code.cloudfoundry.org/diego-logging-client/testhelpers"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/rep"
+	"github.com/tedsuo/ifrit"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakeDelegate struct {
+	completed []auctiontypes.AuctionResults
+}
+
+func (d *fakeDelegate) FetchCellReps() (map[string]rep.Client, error) {
+	return map[string]rep.Client{}, nil
+}
+
+func (d *fakeDelegate) AuctionCompleted(results auctiontypes.AuctionResults) {
+	d.completed = append(d.completed, results)
+}
+
+var _ = Describe("FairQueue", func() {
+	var (
+		clock            *fakeclock.FakeClock
+		fakeMetronClient *mfakes.FakeIngressClient
+		config           fairqueue.Config
+		queue            *fairqueue.FairQueue
+		innerRunner      *fake_auction_runner.FakeAuctionRunner
+		runner           auctiontypes.AuctionRunner
+		delegate         auctiontypes.AuctionRunnerDelegate
+		process          ifrit.Process
+		constraint       rep.PlacementConstraint
+	)
+
+	tasks := func(domain string, n int) []auctioneer.TaskStartRequest {
+		tasks := make([]auctioneer.TaskStartRequest, n)
+		for i := range tasks {
+			tasks[i] = auctioneer.NewTaskStartRequest(rep.NewTask(fmt.Sprintf("%s-%d", domain, i), domain, rep.NewResource(10, 10, 10), constraint))
+		}
+		return tasks
+	}
+
+	domainsOf := func(tasks []auctioneer.TaskStartRequest) []string {
+		domains := []string{}
+		for _, task := range tasks {
+			domains = append(domains, task.Domain)
+		}
+		return domains
+	}
+
+	completeTasks := func(call int) {
+		results := auctiontypes.AuctionResults{}
+		for _, task := range innerRunner.ScheduleTasksForAuctionsArgsForCall(call) {
+			results.SuccessfulTasks = append(results.SuccessfulTasks, auctiontypes.TaskAuction{Task: task.Task})
+		}
+		delegate.AuctionCompleted(results)
+	}
+
+	completeLRPs := func(call int) {
+		results := auctiontypes.AuctionResults{}
+		for _, start := range innerRunner.ScheduleLRPsForAuctionsArgsForCall(call) {
+			for _, index := range start.Indices {
+				results.SuccessfulLRPs = append(results.SuccessfulLRPs, auctiontypes.LRPAuction{
+					LRP: rep.NewLRP("", models.NewActualLRPKey(start.ProcessGuid, int32(index), start.Domain), start.Resource, start.PlacementConstraint),
+				})
+			}
+		}
+		delegate.AuctionCompleted(results)
+	}
+
+	BeforeEach(func() {
+		clock = fakeclock.NewFakeClock(time.Now())
+		fakeMetronClient = &mfakes.FakeIngressClient{}
+		constraint = rep.NewPlacementConstraint("linux", []string{}, []string{})
+		config = fairqueue.Config{BatchSize: 4, MaxWait: time.Minute}
+
+		innerRunner = new(fake_auction_runner.FakeAuctionRunner)
+		innerRunner.RunStub = func(signals <-chan os.Signal, ready chan<- struct{}) error {
+			close(ready)
+			<-signals
+			return nil
+		}
+	})
+
+	JustBeforeEach(func() {
+		queue = fairqueue.New(lagertest.NewTestLogger("test"), clock, fakeMetronClient, config)
+		runner = queue.Runner(innerRunner)
+		delegate = queue.Delegate(&fakeDelegate{})
+
+		runner.ScheduleTasksForAuctions(tasks("busy", 10))
+		runner.ScheduleTasksForAuctions(tasks("quiet", 2))
+
+		process = ifrit.Invoke(runner)
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive())
+	})
+
+	It("takes a fair share of each batch from every domain", func() {
+		Eventually(innerRunner.ScheduleTasksForAuctionsCallCount).Should(Equal(1))
+		Expect(domainsOf(innerRunner.ScheduleTasksForAuctionsArgsForCall(0))).To(Equal([]string{"busy", "busy", "quiet", "quiet"}))
+		Expect(queue.Depth()).To(Equal(map[string]int{"busy": 8}))
+	})
+
+	It("only hands over the next batch once every auction of the batch completes", func() {
+		Eventually(innerRunner.ScheduleTasksForAuctionsCallCount).Should(Equal(1))
+		Consistently(innerRunner.ScheduleTasksForAuctionsCallCount).Should(Equal(1))
+
+		batch := innerRunner.ScheduleTasksForAuctionsArgsForCall(0)
+		delegate.AuctionCompleted(auctiontypes.AuctionResults{
+			SuccessfulTasks: []auctiontypes.TaskAuction{{Task: batch[0].Task}},
+		})
+		Consistently(innerRunner.ScheduleTasksForAuctionsCallCount).Should(Equal(1))
+
+		delegate.AuctionCompleted(auctiontypes.AuctionResults{
+			SuccessfulTasks: []auctiontypes.TaskAuction{{Task: batch[1].Task}},
+			FailedTasks:     []auctiontypes.TaskAuction{{Task: batch[2].Task}, {Task: batch[3].Task}},
+		})
+		Eventually(innerRunner.ScheduleTasksForAuctionsCallCount).Should(Equal(2))
+		Expect(domainsOf(innerRunner.ScheduleTasksForAuctionsArgsForCall(1))).To(Equal([]string{"busy", "busy", "busy", "busy"}))
+	})
+
+	It("does not count the completion of auctions outside the batch", func() {
+		Eventually(innerRunner.ScheduleTasksForAuctionsCallCount).Should(Equal(1))
+
+		delegate.AuctionCompleted(auctiontypes.AuctionResults{})
+		delegate.AuctionCompleted(auctiontypes.AuctionResults{
+			FailedTasks: []auctiontypes.TaskAuction{{
+				Task:          rep.NewTask("retried-task", "busy", rep.NewResource(10, 10, 10), constraint),
+				AuctionRecord: auctiontypes.AuctionRecord{PlacementError: "auction expired"},
+			}},
+		})
+		Consistently(innerRunner.ScheduleTasksForAuctionsCallCount).Should(Equal(1))
+	})
+
+	It("hands over the next batch when an auction takes too long", func() {
+		Eventually(innerRunner.ScheduleTasksForAuctionsCallCount).Should(Equal(1))
+		Eventually(clock.WatcherCount).Should(Equal(2))
+
+		clock.Increment(time.Minute)
+		Eventually(innerRunner.ScheduleTasksForAuctionsCallCount).Should(Equal(2))
+	})
+
+	It("sweeps start requests past their deadline out of the queues", func() {
+		Eventually(innerRunner.ScheduleTasksForAuctionsCallCount).Should(Equal(1))
+		Eventually(clock.WatcherCount).Should(Equal(2))
+
+		expiring := tasks("expiring", 1)
+		expiring[0].Deadline = clock.Now().Add(time.Second).UnixNano()
+		runner.ScheduleTasksForAuctions(expiring)
+		Expect(queue.Depth()).To(HaveKeyWithValue("expiring", 1))
+
+		clock.Increment(time.Second)
+		Eventually(innerRunner.ScheduleTasksForAuctionsCallCount).Should(Equal(2))
+		Expect(innerRunner.ScheduleTasksForAuctionsArgsForCall(1)).To(Equal(expiring))
+		Expect(queue.Depth()).NotTo(HaveKey("expiring"))
+		Expect(queue.Depth()).To(HaveKeyWithValue("busy", 8))
+	})
+
+	It("emits the depth of every queue", func() {
+		Eventually(innerRunner.ScheduleTasksForAuctionsCallCount).Should(Equal(1))
+
+		depths := []int{}
+		for i := 0; i < fakeMetronClient.SendMetricCallCount(); i++ {
+			name, value, opts := fakeMetronClient.SendMetricArgsForCall(i)
+			Expect(name).To(Equal(fairqueue.QueueDepth))
+			Expect(opts).To(HaveLen(1))
+			depths = append(depths, value)
+		}
+		Expect(depths).To(ConsistOf(10, 2, 8, 0))
+	})
+
+	It("hands over everything still queued when signalled", func() {
+		Eventually(innerRunner.ScheduleTasksForAuctionsCallCount).Should(Equal(1))
+
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive())
+		Expect(innerRunner.ScheduleTasksForAuctionsCallCount()).To(Equal(2))
+		Expect(innerRunner.ScheduleTasksForAuctionsArgsForCall(1)).To(HaveLen(8))
+	})
+
+	Context("with weights", func() {
+		BeforeEach(func() {
+			config.Weights = map[string]int{"quiet": 3}
+		})
+
+		It("shares the batch in proportion to the weights", func() {
+			Eventually(innerRunner.ScheduleTasksForAuctionsCallCount).Should(Equal(1))
+			Expect(domainsOf(innerRunner.ScheduleTasksForAuctionsArgsForCall(0))).To(Equal([]string{"busy", "quiet", "quiet", "busy"}))
+		})
+	})
+
+	Describe("Accepting", func() {
+		It("accepts submissions without a max depth", func() {
+			Expect(queue.Accepting(lagertest.NewTestLogger("test"))).To(Succeed())
+		})
+
+		Context("with a max depth", func() {
+			BeforeEach(func() {
+				config.MaxDepth = 10
+			})
+
+			It("turns submissions away once the queues are full", func() {
+				Eventually(innerRunner.ScheduleTasksForAuctionsCallCount).Should(Equal(1))
+				Expect(queue.Accepting(lagertest.NewTestLogger("test"))).To(Succeed())
+
+				runner.ScheduleTasksForAuctions(tasks("other", 2))
+				Expect(queue.Accepting(lagertest.NewTestLogger("test"))).To(MatchError(fairqueue.ErrFull))
+			})
+		})
+	})
+
+	Describe("LRPs", func() {
+		It("splits the instances of a start request across batches", func() {
+			Eventually(innerRunner.ScheduleTasksForAuctionsCallCount).Should(Equal(1))
+			for i := 0; i < 2; i++ {
+				completeTasks(i)
+				Eventually(innerRunner.ScheduleTasksForAuctionsCallCount).Should(Equal(i + 2))
+			}
+			Expect(queue.Depth()).To(BeEmpty())
+
+			runner.ScheduleLRPsForAuctions([]auctioneer.LRPStartRequest{
+				auctioneer.NewLRPStartRequest("process-guid", "busy", []int{0, 1, 2, 3, 4, 5}, rep.NewResource(10, 10, 10), constraint),
+			})
+			completeTasks(2)
+
+			Eventually(innerRunner.ScheduleLRPsForAuctionsCallCount).Should(Equal(1))
+			Expect(innerRunner.ScheduleLRPsForAuctionsArgsForCall(0)[0].Indices).To(Equal([]int{0, 1, 2, 3}))
+
+			completeLRPs(0)
+			Eventually(innerRunner.ScheduleLRPsForAuctionsCallCount).Should(Equal(2))
+			Expect(innerRunner.ScheduleLRPsForAuctionsArgsForCall(1)[0].Indices).To(Equal([]int{4, 5}))
+		})
+	})
+
+	Describe("PlacementTagsKey", func() {
+		It("queues by the sorted placement tags", func() {
+			Expect(fairqueue.PlacementTagsKey("domain", rep.NewPlacementConstraint("linux", []string{"b", "a"}, []string{}))).To(Equal("a,b"))
+		})
+	})
+})
+
+var _ = Describe("FairQueue behind an auction log", func() {
+	var (
+		dir         string
+		path        string
+		store       *auctionlog.FileStore
+		queue       *fairqueue.FairQueue
+		innerRunner *fake_auction_runner.FakeAuctionRunner
+		runner      auctiontypes.AuctionRunner
+		process     ifrit.Process
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "fair-queue")
+		Expect(err).NotTo(HaveOccurred())
+
+		path = filepath.Join(dir, "auctions.log")
+		store, err = auctionlog.NewFileStore(path)
+		Expect(err).NotTo(HaveOccurred())
+
+		innerRunner = new(fake_auction_runner.FakeAuctionRunner)
+		innerRunner.RunStub = func(signals <-chan os.Signal, ready chan<- struct{}) error {
+			close(ready)
+			<-signals
+			return nil
+		}
+
+		logger := lagertest.NewTestLogger("test")
+		queue = fairqueue.New(logger, fakeclock.NewFakeClock(time.Now()), &mfakes.FakeIngressClient{}, fairqueue.Config{BatchSize: 1, MaxWait: time.Minute})
+		runner = auctionlog.New(logger, store, nil).Runner(queue.Runner(innerRunner))
+		process = ifrit.Invoke(runner)
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive())
+		store.Close()
+		os.RemoveAll(dir)
+	})
+
+	It("recovers start requests that were still queued", func() {
+		constraint := rep.NewPlacementConstraint("linux", []string{}, []string{})
+		tasks := []auctioneer.TaskStartRequest{}
+		for i := 0; i < 3; i++ {
+			tasks = append(tasks, auctioneer.NewTaskStartRequest(rep.NewTask(fmt.Sprintf("task-%d", i), "domain", rep.NewResource(10, 10, 10), constraint)))
+		}
+		runner.ScheduleTasksForAuctions(tasks)
+
+		Eventually(innerRunner.ScheduleTasksForAuctionsCallCount).Should(Equal(1))
+		Consistently(innerRunner.ScheduleTasksForAuctionsCallCount).Should(Equal(1))
+		Expect(queue.Depth()).To(Equal(map[string]int{"domain": 2}))
+
+		recovered, err := auctionlog.NewFileStore(path)
+		Expect(err).NotTo(HaveOccurred())
+		defer recovered.Close()
+
+		recoveredTasks, _, err := recovered.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recoveredTasks).To(ConsistOf(tasks))
+	})
+})
@@ -0,0 +1,13 @@
+package fairqueue_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestFairqueue(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Fair Queue Suite")
+}
@@ -0,0 +1 @@
+package fairqueue // import "code.cloudfoundry.org/auctioneer/fairqueue"
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"net/http"
+
+	"code.cloudfoundry.org/lager"
+)
+
+// Backpressure turns submissions away while the auctioneer has more work
+// waiting than it accepts. An error rejects the whole submission with 429 Too
+// Many Requests and the error as message, so that the submitter tries again
+// later.
+type Backpressure interface {
+	Accepting(logger lager.Logger) error
+}
+
+func withBackpressure(backpressure Backpressure, handle func(http.ResponseWriter, *http.Request, lager.Logger)) func(http.ResponseWriter, *http.Request, lager.Logger) {
+	if backpressure == nil {
+		return handle
+	}
+
+	return func(w http.ResponseWriter, r *http.Request, logger lager.Logger) {
+		if err := backpressure.Accepting(logger); err != nil {
+			logger.Info("submission-turned-away", lager.Data{"reason": err.Error()})
+			writeTooManyRequestsJSONResponse(w, err)
+			return
+		}
+		handle(w, r, logger)
+	}
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"code.cloudfoundry.org/auctioneer"
+	"code.cloudfoundry.org/lager"
+)
+
+// CellInventory lists the cells auctions are run against and lets operators
+// clear the quarantine of a cell.
+type CellInventory interface {
+	Cells(logger lager.Logger) ([]auctioneer.Cell, error)
+	ClearCellQuarantine(logger lager.Logger, cellID string) bool
+}
+
+// emptyInventory is used when the handlers are not given a cell inventory.
+type emptyInventory struct{}
+
+func (emptyInventory) Cells(lager.Logger) ([]auctioneer.Cell, error) { return []auctioneer.Cell{}, nil }
+func (emptyInventory) ClearCellQuarantine(lager.Logger, string) bool { return false }
+
+type CellsHandler struct {
+	inventory CellInventory
+}
+
+func NewCellsHandler(inventory CellInventory) *CellsHandler {
+	return &CellsHandler{
+		inventory: inventory,
+	}
+}
+
+func (*CellsHandler) logSession(logger lager.Logger) lager.Logger {
+	return logger.Session("cells-handler")
+}
+
+func (h *CellsHandler) Index(w http.ResponseWriter, r *http.Request, logger lager.Logger) {
+	logger = h.logSession(logger).Session("index")
+
+	cells, err := h.inventory.Cells(logger)
+	if err != nil {
+		logger.Error("failed-to-fetch-cells", err)
+		writeUnavailableJSONResponse(w, err)
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, cells)
+}
+
+func (h *CellsHandler) ClearQuarantine(w http.ResponseWriter, r *http.Request, logger lager.Logger) {
+	cellID := r.FormValue(":cell_id")
+	logger = h.logSession(logger).Session("clear-quarantine", lager.Data{"cell-id": cellID})
+
+	if !h.inventory.ClearCellQuarantine(logger, cellID) {
+		writeJSONResponse(w, http.StatusNotFound, HandlerError{
+			Error: fmt.Sprintf("cell %q is not quarantined", cellID),
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
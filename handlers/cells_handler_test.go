@@ -0,0 +1,128 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	fake_auction_runner "code.cloudfoundry.org/auction/auctiontypes/fakes"
+	"code.cloudfoundry.org/auctioneer"
+	"code.cloudfoundry.org/auctioneer/handlers"
+	mfakes "code.cloudfoundry.org/diego-logging-client/testhelpers"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/lager/lagertest"
+	"github.com/tedsuo/rata"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakeInventory struct {
+	cells       []auctioneer.Cell
+	err         error
+	quarantined map[string]bool
+}
+
+func (i *fakeInventory) Cells(lager.Logger) ([]auctioneer.Cell, error) {
+	return i.cells, i.err
+}
+
+func (i *fakeInventory) ClearCellQuarantine(_ lager.Logger, cellID string) bool {
+	cleared := i.quarantined[cellID]
+	delete(i.quarantined, cellID)
+	return cleared
+}
+
+var _ = Describe("CellsHandler", func() {
+	var (
+		logger           *lagertest.TestLogger
+		responseRecorder *httptest.ResponseRecorder
+		inventory        *fakeInventory
+		handler          http.Handler
+		reqGen           *rata.RequestGenerator
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		responseRecorder = httptest.NewRecorder()
+		reqGen = rata.NewRequestGenerator("http://localhost", auctioneer.Routes)
+
+		inventory = &fakeInventory{
+			cells: []auctioneer.Cell{
+				{CellID: "cell-A", RepAddress: "cell-a.url"},
+				{
+					CellID:     "cell-B",
+					RepAddress: "cell-b.url",
+					Quarantine: &auctioneer.CellQuarantine{ConsecutiveFailures: 3, Until: time.Unix(1000, 0).UTC()},
+				},
+			},
+			quarantined: map[string]bool{"cell-B": true},
+		}
+
+		handler = handlers.New(
+			logger,
+			new(fake_auction_runner.FakeAuctionRunner),
+			&mfakes.FakeIngressClient{},
+			handlers.WithCellInventory(inventory),
+		)
+	})
+
+	Describe("Index", func() {
+		JustBeforeEach(func() {
+			req, err := reqGen.CreateRequest(auctioneer.CellsRoute, rata.Params{}, nil)
+			Expect(err).NotTo(HaveOccurred())
+			handler.ServeHTTP(responseRecorder, req)
+		})
+
+		It("lists the cells with their quarantine", func() {
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+
+			cells := []auctioneer.Cell{}
+			Expect(json.Unmarshal(responseRecorder.Body.Bytes(), &cells)).To(Succeed())
+			Expect(cells).To(Equal(inventory.cells))
+		})
+
+		Context("when the cells cannot be fetched", func() {
+			BeforeEach(func() {
+				inventory.err = errors.New("bbs unavailable")
+			})
+
+			It("responds with 503", func() {
+				Expect(responseRecorder.Code).To(Equal(http.StatusServiceUnavailable))
+			})
+		})
+	})
+
+	Describe("ClearQuarantine", func() {
+		var cellID string
+
+		JustBeforeEach(func() {
+			req, err := reqGen.CreateRequest(auctioneer.ClearCellQuarantineRoute, rata.Params{"cell_id": cellID}, nil)
+			Expect(err).NotTo(HaveOccurred())
+			handler.ServeHTTP(responseRecorder, req)
+		})
+
+		Context("when the cell is quarantined", func() {
+			BeforeEach(func() {
+				cellID = "cell-B"
+			})
+
+			It("clears the quarantine", func() {
+				Expect(responseRecorder.Code).To(Equal(http.StatusNoContent))
+				Expect(inventory.quarantined).NotTo(HaveKey("cell-B"))
+			})
+		})
+
+		Context("when the cell is not quarantined", func() {
+			BeforeEach(func() {
+				cellID = "cell-A"
+			})
+
+			It("responds with 404", func() {
+				Expect(responseRecorder.Code).To(Equal(http.StatusNotFound))
+			})
+		})
+	})
+})
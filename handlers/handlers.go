@@ -17,9 +17,77 @@ const (
 	RequestCount           = "RequestCount"
 )
 
-func New(logger lager.Logger, runner auctiontypes.AuctionRunner, metronClient loggingclient.IngressClient) http.Handler {
-	taskAuctionHandler := logWrap(NewTaskAuctionHandler(runner).Create, logger)
-	lrpAuctionHandler := logWrap(NewLRPAuctionHandler(runner).Create, logger)
+type Option func(*options)
+
+type options struct {
+	leadership   Leadership
+	transport    http.RoundTripper
+	inventory    CellInventory
+	failures     *auctioneer.PlacementFailures
+	explainer    PlacementExplainer
+	backpressure Backpressure
+}
+
+// WithLeadership lets the handler be served before the lock is held. Auctions,
+// previews and cell requests are served locally while leadership reports this
+// auctioneer as the leader, and are otherwise forwarded to the leader through
+// transport (http.DefaultTransport if nil). Status is always served locally.
+// Without it the handler must only be served while the lock is held.
+func WithLeadership(leadership Leadership, transport http.RoundTripper) Option {
+	return func(o *options) {
+		o.leadership = leadership
+		o.transport = transport
+	}
+}
+
+// WithCellInventory serves the cells of inventory. Without it no cells are
+// listed.
+func WithCellInventory(inventory CellInventory) Option {
+	return func(o *options) {
+		o.inventory = inventory
+	}
+}
+
+// WithPlacementFailures includes the placement failure counts of failures in
+// the status.
+func WithPlacementFailures(failures *auctioneer.PlacementFailures) Option {
+	return func(o *options) {
+		o.failures = failures
+	}
+}
+
+// WithPlacementExplainer serves previews of auctions and the status in
+// explain mode. Without it previews are unavailable.
+func WithPlacementExplainer(explainer PlacementExplainer) Option {
+	return func(o *options) {
+		o.explainer = explainer
+	}
+}
+
+// WithBackpressure turns auction submissions away with 429 Too Many Requests
+// while backpressure is not accepting them.
+func WithBackpressure(backpressure Backpressure) Option {
+	return func(o *options) {
+		o.backpressure = backpressure
+	}
+}
+
+func New(logger lager.Logger, runner auctiontypes.AuctionRunner, metronClient loggingclient.IngressClient, opts ...Option) http.Handler {
+	o := &options{
+		leadership: soleLeadership{},
+		inventory:  emptyInventory{},
+		explainer:  noExplainer{},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	proxy := newLeaderProxy(logger, o.leadership, o.transport)
+	taskAuctionHandler := proxy.wrap(logWrap(withBackpressure(o.backpressure, NewTaskAuctionHandler(runner).Create), logger))
+	lrpAuctionHandler := proxy.wrap(logWrap(withBackpressure(o.backpressure, NewLRPAuctionHandler(runner).Create), logger))
+	statusHandler := http.HandlerFunc(NewStatusHandler(logger, o.leadership, o.failures, o.explainer).Show)
+	cellsHandler := NewCellsHandler(o.inventory)
+	previewHandler := NewPreviewHandler(o.explainer)
 
 	emitter := &auctioneerEmitter{
 		logger:       logger,
@@ -27,8 +95,13 @@ func New(logger lager.Logger, runner auctiontypes.AuctionRunner, metronClient lo
 	}
 
 	actions := rata.Handlers{
-		auctioneer.CreateTaskAuctionsRoute: middleware.RecordLatency(taskAuctionHandler, emitter),
-		auctioneer.CreateLRPAuctionsRoute:  middleware.RecordLatency(lrpAuctionHandler, emitter),
+		auctioneer.CreateTaskAuctionsRoute:  middleware.RecordLatency(taskAuctionHandler, emitter),
+		auctioneer.CreateLRPAuctionsRoute:   middleware.RecordLatency(lrpAuctionHandler, emitter),
+		auctioneer.StatusRoute:              statusHandler,
+		auctioneer.CellsRoute:               proxy.wrap(logWrap(cellsHandler.Index, logger)),
+		auctioneer.ClearCellQuarantineRoute: proxy.wrap(logWrap(cellsHandler.ClearQuarantine, logger)),
+		auctioneer.PreviewTaskAuctionsRoute: proxy.wrap(logWrap(previewHandler.Tasks, logger)),
+		auctioneer.PreviewLRPAuctionsRoute:  proxy.wrap(logWrap(previewHandler.LRPs, logger)),
 	}
 
 	handler, err := rata.NewRouter(auctioneer.Routes, actions)
@@ -41,10 +114,14 @@ func New(logger lager.Logger, runner auctiontypes.AuctionRunner, metronClient lo
 
 func logWrap(loggable func(http.ResponseWriter, *http.Request, lager.Logger), logger lager.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		requestLog := logger.Session("request", lager.Data{
+		data := lager.Data{
 			"method":  r.Method,
 			"request": r.URL.String(),
-		})
+		}
+		if requestID := r.Header.Get(auctioneer.RequestIDHeader); requestID != "" {
+			data["request-id"] = requestID
+		}
+		requestLog := logger.Session("request", data)
 
 		requestLog.Info("serving")
 		loggable(w, r, requestLog)
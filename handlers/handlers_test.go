@@ -3,6 +3,7 @@ package handlers_test
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 
@@ -17,6 +18,7 @@ import (
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
 )
 
 var _ = Describe("Auction Handlers", func() {
@@ -46,7 +48,7 @@ var _ = Describe("Auction Handlers", func() {
 				pc := rep.NewPlacementConstraint("rootfs", []string{}, []string{})
 				task := rep.NewTask("the-task-guid", "test", resource, pc)
 
-				tasks := []auctioneer.TaskStartRequest{auctioneer.TaskStartRequest{task}}
+				tasks := []auctioneer.TaskStartRequest{auctioneer.TaskStartRequest{Task: task}}
 				reqGen := rata.NewRequestGenerator("http://localhost", auctioneer.Routes)
 
 				payload, err := json.Marshal(tasks)
@@ -83,6 +85,20 @@ var _ = Describe("Auction Handlers", func() {
 		})
 	})
 
+	Describe("request id", func() {
+		BeforeEach(func() {
+			reqGen := rata.NewRequestGenerator("http://localhost", auctioneer.Routes)
+			req, err := reqGen.CreateRequest(auctioneer.CreateTaskAuctionsRoute, rata.Params{}, bytes.NewBufferString("[]"))
+			Expect(err).NotTo(HaveOccurred())
+			req.Header.Set(auctioneer.RequestIDHeader, "some-request-id")
+			handler.ServeHTTP(responseRecorder, req)
+		})
+
+		It("logs the request id sent by the client", func() {
+			Expect(logger).To(gbytes.Say(`"request-id":"some-request-id"`))
+		})
+	})
+
 	Describe("LRP Handler", func() {
 		Context("with a valid LRPStart", func() {
 			BeforeEach(func() {
@@ -134,4 +150,34 @@ var _ = Describe("Auction Handlers", func() {
 			})
 		})
 	})
+	Describe("backpressure", func() {
+		var backpressure *fakeBackpressure
+
+		BeforeEach(func() {
+			backpressure = &fakeBackpressure{err: errors.New("fair queue is full")}
+			handler = handlers.New(logger, runner, fakeMetronClient, handlers.WithBackpressure(backpressure))
+
+			reqGen := rata.NewRequestGenerator("http://localhost", auctioneer.Routes)
+			req, err := reqGen.CreateRequest(auctioneer.CreateLRPAuctionsRoute, rata.Params{}, bytes.NewBufferString("[]"))
+			Expect(err).NotTo(HaveOccurred())
+			handler.ServeHTTP(responseRecorder, req)
+		})
+
+		It("turns submissions away with 429 and the error", func() {
+			Expect(responseRecorder.Code).To(Equal(http.StatusTooManyRequests))
+
+			handlerError := handlers.HandlerError{}
+			Expect(json.NewDecoder(responseRecorder.Body).Decode(&handlerError)).To(Succeed())
+			Expect(handlerError.Error).To(Equal("fair queue is full"))
+			Expect(runner.ScheduleLRPsForAuctionsCallCount()).To(Equal(0))
+		})
+	})
 })
+
+type fakeBackpressure struct {
+	err error
+}
+
+func (b *fakeBackpressure) Accepting(lager.Logger) error {
+	return b.err
+}
@@ -18,6 +18,18 @@ func writeInternalErrorJSONResponse(w http.ResponseWriter, err error) {
 	})
 }
 
+func writeTooManyRequestsJSONResponse(w http.ResponseWriter, err error) {
+	writeJSONResponse(w, http.StatusTooManyRequests, HandlerError{
+		Error: err.Error(),
+	})
+}
+
+func writeUnavailableJSONResponse(w http.ResponseWriter, err error) {
+	writeJSONResponse(w, http.StatusServiceUnavailable, HandlerError{
+		Error: err.Error(),
+	})
+}
+
 func writeStatusAcceptedResponse(w http.ResponseWriter) {
 	writeJSONResponse(w, http.StatusAccepted, struct{}{})
 }
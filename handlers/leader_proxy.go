@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+
+	"code.cloudfoundry.org/auctioneer"
+	"code.cloudfoundry.org/lager"
+)
+
+// ProxiedByHeader is set on auction requests forwarded by a standby. A
+// standby receiving a request that carries it answers 421 Misdirected Request
+// instead of forwarding it again.
+const ProxiedByHeader = "X-Auctioneer-Proxied-By"
+
+// Leadership reports whether this auctioneer holds the lock and which
+// auctioneer does otherwise.
+type Leadership interface {
+	IsLeader() bool
+	Leader() (auctioneer.Presence, bool)
+	Status() auctioneer.Status
+}
+
+// soleLeadership is used when the handlers are not told about the lock; the
+// auctioneer then only serves once it holds it.
+type soleLeadership struct{}
+
+func (soleLeadership) IsLeader() bool                      { return true }
+func (soleLeadership) Leader() (auctioneer.Presence, bool) { return auctioneer.Presence{}, false }
+func (soleLeadership) Status() auctioneer.Status           { return auctioneer.Status{IsLeader: true} }
+
+type leaderProxy struct {
+	logger     lager.Logger
+	leadership Leadership
+	transport  http.RoundTripper
+}
+
+func newLeaderProxy(logger lager.Logger, leadership Leadership, transport http.RoundTripper) *leaderProxy {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	return &leaderProxy{
+		logger:     logger.Session("leader-proxy"),
+		leadership: leadership,
+		transport:  transport,
+	}
+}
+
+// wrap serves requests with local while this auctioneer is the leader and
+// forwards them to the leader otherwise.
+func (p *leaderProxy) wrap(local http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if p.leadership.IsLeader() {
+			local.ServeHTTP(w, r)
+			return
+		}
+
+		logger := p.logger.Session("proxy", lager.Data{
+			"method":  r.Method,
+			"request": r.URL.String(),
+		})
+
+		if proxiedBy := r.Header.Get(ProxiedByHeader); proxiedBy != "" {
+			logger.Info("rejecting-proxied-request", lager.Data{"proxied-by": proxiedBy})
+			writeJSONResponse(w, http.StatusMisdirectedRequest, HandlerError{
+				Error: "request was forwarded to an auctioneer that is not the leader",
+			})
+			return
+		}
+
+		self := p.leadership.Status().Self
+		leader, ok := p.leadership.Leader()
+		if !ok {
+			logger.Info("no-leader")
+			writeUnavailableJSONResponse(w, errors.New("no auctioneer holds the lock"))
+			return
+		}
+
+		// the lock still advertises this auctioneer while it is stepping down
+		if self.AuctioneerID != "" && leader.AuctioneerID == self.AuctioneerID {
+			logger.Info("stepping-down")
+			writeUnavailableJSONResponse(w, errors.New("auctioneer is stepping down"))
+			return
+		}
+
+		target, err := url.Parse(leader.AuctioneerAddress)
+		if err == nil && (target.Scheme == "" || target.Host == "") {
+			err = errors.New("leader address must include a scheme and host")
+		}
+		if err != nil {
+			logger.Error("invalid-leader-address", err, lager.Data{"leader": leader.AuctioneerAddress})
+			writeUnavailableJSONResponse(w, err)
+			return
+		}
+
+		proxy := httputil.NewSingleHostReverseProxy(target)
+		proxy.Transport = p.transport
+		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			logger.Error("failed-to-reach-leader", err, lager.Data{"leader": leader.AuctioneerAddress})
+			writeUnavailableJSONResponse(w, err)
+		}
+
+		proxiedBy := self.AuctioneerID
+		if proxiedBy == "" {
+			proxiedBy = "standby"
+		}
+		r.Header.Set(ProxiedByHeader, proxiedBy)
+
+		logger.Debug("forwarding", lager.Data{"leader": leader.AuctioneerAddress})
+		proxy.ServeHTTP(w, r)
+	}
+}
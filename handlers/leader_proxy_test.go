@@ -0,0 +1,174 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	fake_auction_runner "code.cloudfoundry.org/auction/auctiontypes/fakes"
+	"code.cloudfoundry.org/auctioneer"
+	"code.cloudfoundry.org/auctioneer/handlers"
+	mfakes "code.cloudfoundry.org/diego-logging-client/testhelpers"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/rep"
+	"github.com/tedsuo/rata"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+)
+
+type fakeLeadership struct {
+	self     auctioneer.Presence
+	isLeader bool
+	leader   *auctioneer.Presence
+}
+
+func (l *fakeLeadership) IsLeader() bool {
+	return l.isLeader
+}
+
+func (l *fakeLeadership) Leader() (auctioneer.Presence, bool) {
+	if l.leader == nil {
+		return auctioneer.Presence{}, false
+	}
+	return *l.leader, true
+}
+
+func (l *fakeLeadership) Status() auctioneer.Status {
+	return auctioneer.Status{Self: l.self, IsLeader: l.isLeader, Leader: l.leader}
+}
+
+var _ = Describe("Leader Proxy", func() {
+	var (
+		logger           *lagertest.TestLogger
+		runner           *fake_auction_runner.FakeAuctionRunner
+		responseRecorder *httptest.ResponseRecorder
+		leadership       *fakeLeadership
+		leaderServer     *ghttp.Server
+		request          *http.Request
+		reqGen           *rata.RequestGenerator
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		runner = new(fake_auction_runner.FakeAuctionRunner)
+		responseRecorder = httptest.NewRecorder()
+		leaderServer = ghttp.NewServer()
+
+		leadership = &fakeLeadership{
+			self: auctioneer.NewPresence("standby-id", "http://127.0.0.1:1"),
+		}
+
+		reqGen = rata.NewRequestGenerator("http://localhost", auctioneer.Routes)
+
+		task := rep.NewTask("the-task-guid", "test", rep.NewResource(1, 2, 3), rep.NewPlacementConstraint("rootfs", []string{}, []string{}))
+		payload, err := json.Marshal([]auctioneer.TaskStartRequest{{Task: task}})
+		Expect(err).NotTo(HaveOccurred())
+
+		request, err = reqGen.CreateRequest(auctioneer.CreateTaskAuctionsRoute, rata.Params{}, bytes.NewBuffer(payload))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	JustBeforeEach(func() {
+		handler := handlers.New(logger, runner, &mfakes.FakeIngressClient{}, handlers.WithLeadership(leadership, nil))
+		handler.ServeHTTP(responseRecorder, request)
+	})
+
+	AfterEach(func() {
+		leaderServer.Close()
+	})
+
+	Context("when this auctioneer is the leader", func() {
+		BeforeEach(func() {
+			leadership.isLeader = true
+		})
+
+		It("schedules the auction locally", func() {
+			Expect(responseRecorder.Code).To(Equal(http.StatusAccepted))
+			Expect(runner.ScheduleTasksForAuctionsCallCount()).To(Equal(1))
+			Expect(leaderServer.ReceivedRequests()).To(BeEmpty())
+		})
+	})
+
+	Context("when another auctioneer is the leader", func() {
+		BeforeEach(func() {
+			leader := auctioneer.NewPresence("leader-id", leaderServer.URL())
+			leadership.leader = &leader
+
+			leaderServer.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyRequest("POST", "/v1/tasks"),
+				ghttp.VerifyHeaderKV(handlers.ProxiedByHeader, "standby-id"),
+				ghttp.RespondWith(http.StatusAccepted, "{}"),
+			))
+		})
+
+		It("forwards the request to the leader", func() {
+			Expect(leaderServer.ReceivedRequests()).To(HaveLen(1))
+			Expect(responseRecorder.Code).To(Equal(http.StatusAccepted))
+			Expect(runner.ScheduleTasksForAuctionsCallCount()).To(Equal(0))
+		})
+
+		Context("when the request was already forwarded", func() {
+			BeforeEach(func() {
+				request.Header.Set(handlers.ProxiedByHeader, "another-standby-id")
+			})
+
+			It("responds with 421 instead of forwarding it again", func() {
+				Expect(responseRecorder.Code).To(Equal(http.StatusMisdirectedRequest))
+				Expect(leaderServer.ReceivedRequests()).To(BeEmpty())
+			})
+		})
+
+		Context("when the leader cannot be reached", func() {
+			BeforeEach(func() {
+				leaderServer.Close()
+			})
+
+			It("responds with 503", func() {
+				Expect(responseRecorder.Code).To(Equal(http.StatusServiceUnavailable))
+			})
+		})
+	})
+
+	Context("when the lock still advertises this auctioneer", func() {
+		BeforeEach(func() {
+			leadership.leader = &leadership.self
+		})
+
+		It("responds with 503 instead of forwarding the request to itself", func() {
+			Expect(responseRecorder.Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(runner.ScheduleTasksForAuctionsCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when no auctioneer is the leader", func() {
+		It("responds with 503", func() {
+			Expect(responseRecorder.Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(runner.ScheduleTasksForAuctionsCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when requesting the status", func() {
+		BeforeEach(func() {
+			leader := auctioneer.NewPresence("leader-id", leaderServer.URL())
+			leadership.leader = &leader
+
+			var err error
+			request, err = reqGen.CreateRequest(auctioneer.StatusRoute, rata.Params{}, nil)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("answers locally", func() {
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			Expect(leaderServer.ReceivedRequests()).To(BeEmpty())
+
+			var status auctioneer.Status
+			Expect(json.Unmarshal(responseRecorder.Body.Bytes(), &status)).To(Succeed())
+			Expect(status.Self.AuctioneerID).To(Equal("standby-id"))
+			Expect(status.IsLeader).To(BeFalse())
+			Expect(status.Leader.AuctioneerID).To(Equal("leader-id"))
+		})
+	})
+})
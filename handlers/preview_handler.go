@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"code.cloudfoundry.org/auctioneer"
+	"code.cloudfoundry.org/lager"
+)
+
+var ErrExplanationsUnavailable = errors.New("placement explanations are not available")
+
+// PlacementExplainer explains how start requests would be placed, and which
+// cells every auction currently skips.
+type PlacementExplainer interface {
+	ExplainCells(logger lager.Logger) ([]auctioneer.CellExplanation, error)
+	ExplainLRPs(logger lager.Logger, lrpStarts []auctioneer.LRPStartRequest) ([]auctioneer.PlacementExplanation, error)
+	ExplainTasks(logger lager.Logger, taskStarts []auctioneer.TaskStartRequest) ([]auctioneer.PlacementExplanation, error)
+}
+
+// noExplainer is used when the handlers are not given a placement explainer.
+type noExplainer struct{}
+
+func (noExplainer) ExplainCells(lager.Logger) ([]auctioneer.CellExplanation, error) {
+	return nil, ErrExplanationsUnavailable
+}
+
+func (noExplainer) ExplainLRPs(lager.Logger, []auctioneer.LRPStartRequest) ([]auctioneer.PlacementExplanation, error) {
+	return nil, ErrExplanationsUnavailable
+}
+
+func (noExplainer) ExplainTasks(lager.Logger, []auctioneer.TaskStartRequest) ([]auctioneer.PlacementExplanation, error) {
+	return nil, ErrExplanationsUnavailable
+}
+
+// PreviewHandler explains how the start requests it is given would be placed,
+// without scheduling them. Unlike the auction handlers it rejects the whole
+// request if any start request is invalid.
+type PreviewHandler struct {
+	explainer PlacementExplainer
+}
+
+func NewPreviewHandler(explainer PlacementExplainer) *PreviewHandler {
+	return &PreviewHandler{
+		explainer: explainer,
+	}
+}
+
+func (*PreviewHandler) logSession(logger lager.Logger) lager.Logger {
+	return logger.Session("preview-handler")
+}
+
+func (h *PreviewHandler) LRPs(w http.ResponseWriter, r *http.Request, logger lager.Logger) {
+	logger = h.logSession(logger).Session("lrps")
+
+	starts := []auctioneer.LRPStartRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&starts); err != nil {
+		logger.Error("malformed-json", err)
+		writeInvalidJSONResponse(w, err)
+		return
+	}
+
+	for i := range starts {
+		if err := starts[i].Validate(); err != nil {
+			logger.Error("start-validate-failed", err, lager.Data{"lrp-start": starts[i]})
+			writeInvalidJSONResponse(w, err)
+			return
+		}
+	}
+
+	explanations, err := h.explainer.ExplainLRPs(logger, starts)
+	if err != nil {
+		logger.Error("failed-to-explain", err)
+		writeUnavailableJSONResponse(w, err)
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, explanations)
+}
+
+func (h *PreviewHandler) Tasks(w http.ResponseWriter, r *http.Request, logger lager.Logger) {
+	logger = h.logSession(logger).Session("tasks")
+
+	starts := []auctioneer.TaskStartRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&starts); err != nil {
+		logger.Error("malformed-json", err)
+		writeInvalidJSONResponse(w, err)
+		return
+	}
+
+	for i := range starts {
+		if err := starts[i].Validate(); err != nil {
+			logger.Error("start-validate-failed", err, lager.Data{"task-start": starts[i]})
+			writeInvalidJSONResponse(w, err)
+			return
+		}
+	}
+
+	explanations, err := h.explainer.ExplainTasks(logger, starts)
+	if err != nil {
+		logger.Error("failed-to-explain", err)
+		writeUnavailableJSONResponse(w, err)
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, explanations)
+}
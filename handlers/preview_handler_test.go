@@ -0,0 +1,164 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	fake_auction_runner "code.cloudfoundry.org/auction/auctiontypes/fakes"
+	"code.cloudfoundry.org/auctioneer"
+	"code.cloudfoundry.org/auctioneer/handlers"
+	mfakes "code.cloudfoundry.org/diego-logging-client/testhelpers"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/rep"
+	"github.com/tedsuo/rata"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakeExplainer struct {
+	cells        []auctioneer.CellExplanation
+	explanations []auctioneer.PlacementExplanation
+	err          error
+
+	lrpStarts  []auctioneer.LRPStartRequest
+	taskStarts []auctioneer.TaskStartRequest
+}
+
+func (e *fakeExplainer) ExplainCells(lager.Logger) ([]auctioneer.CellExplanation, error) {
+	return e.cells, e.err
+}
+
+func (e *fakeExplainer) ExplainLRPs(_ lager.Logger, lrpStarts []auctioneer.LRPStartRequest) ([]auctioneer.PlacementExplanation, error) {
+	e.lrpStarts = lrpStarts
+	return e.explanations, e.err
+}
+
+func (e *fakeExplainer) ExplainTasks(_ lager.Logger, taskStarts []auctioneer.TaskStartRequest) ([]auctioneer.PlacementExplanation, error) {
+	e.taskStarts = taskStarts
+	return e.explanations, e.err
+}
+
+var _ = Describe("PreviewHandler", func() {
+	var (
+		logger           *lagertest.TestLogger
+		runner           *fake_auction_runner.FakeAuctionRunner
+		explainer        *fakeExplainer
+		responseRecorder *httptest.ResponseRecorder
+		handler          http.Handler
+		reqGen           *rata.RequestGenerator
+		resource         rep.Resource
+		constraint       rep.PlacementConstraint
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		runner = new(fake_auction_runner.FakeAuctionRunner)
+		responseRecorder = httptest.NewRecorder()
+		reqGen = rata.NewRequestGenerator("http://localhost", auctioneer.Routes)
+		resource = rep.NewResource(1, 2, 3)
+		constraint = rep.NewPlacementConstraint("rootfs", []string{}, []string{})
+
+		explainer = &fakeExplainer{
+			explanations: []auctioneer.PlacementExplanation{
+				{
+					Identifier: "the-guid",
+					BestCellID: "cell-a",
+					Cells:      []auctioneer.CellExplanation{{CellID: "cell-a"}},
+				},
+			},
+		}
+
+		handler = handlers.New(logger, runner, &mfakes.FakeIngressClient{}, handlers.WithPlacementExplainer(explainer))
+	})
+
+	serve := func(route string, body interface{}) {
+		payload, err := json.Marshal(body)
+		Expect(err).NotTo(HaveOccurred())
+		req, err := reqGen.CreateRequest(route, rata.Params{}, bytes.NewBuffer(payload))
+		Expect(err).NotTo(HaveOccurred())
+		handler.ServeHTTP(responseRecorder, req)
+	}
+
+	Describe("LRPs", func() {
+		It("explains the LRP starts without scheduling them", func() {
+			starts := []auctioneer.LRPStartRequest{
+				auctioneer.NewLRPStartRequest("the-guid", "domain", []int{0}, resource, constraint),
+			}
+			serve(auctioneer.PreviewLRPAuctionsRoute, starts)
+
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			Expect(explainer.lrpStarts).To(Equal(starts))
+			Expect(runner.ScheduleLRPsForAuctionsCallCount()).To(Equal(0))
+
+			explanations := []auctioneer.PlacementExplanation{}
+			Expect(json.Unmarshal(responseRecorder.Body.Bytes(), &explanations)).To(Succeed())
+			Expect(explanations).To(Equal(explainer.explanations))
+		})
+
+		Context("when a start is invalid", func() {
+			It("responds with 400", func() {
+				serve(auctioneer.PreviewLRPAuctionsRoute, []auctioneer.LRPStartRequest{
+					auctioneer.NewLRPStartRequest("", "domain", []int{0}, resource, constraint),
+				})
+
+				Expect(responseRecorder.Code).To(Equal(http.StatusBadRequest))
+				Expect(explainer.lrpStarts).To(BeNil())
+			})
+		})
+
+		Context("when the starts cannot be explained", func() {
+			BeforeEach(func() {
+				explainer.err = errors.New("bbs unavailable")
+			})
+
+			It("responds with 503", func() {
+				serve(auctioneer.PreviewLRPAuctionsRoute, []auctioneer.LRPStartRequest{
+					auctioneer.NewLRPStartRequest("the-guid", "domain", []int{0}, resource, constraint),
+				})
+
+				Expect(responseRecorder.Code).To(Equal(http.StatusServiceUnavailable))
+			})
+		})
+	})
+
+	Describe("Tasks", func() {
+		It("explains the task starts without scheduling them", func() {
+			starts := []auctioneer.TaskStartRequest{
+				auctioneer.NewTaskStartRequest(rep.NewTask("the-guid", "domain", resource, constraint)),
+			}
+			serve(auctioneer.PreviewTaskAuctionsRoute, starts)
+
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			Expect(explainer.taskStarts).To(Equal(starts))
+			Expect(runner.ScheduleTasksForAuctionsCallCount()).To(Equal(0))
+		})
+
+		Context("when the body is not valid JSON", func() {
+			It("responds with 400", func() {
+				serve(auctioneer.PreviewTaskAuctionsRoute, "not-a-list")
+
+				Expect(responseRecorder.Code).To(Equal(http.StatusBadRequest))
+			})
+		})
+	})
+
+	Context("without a placement explainer", func() {
+		BeforeEach(func() {
+			handler = handlers.New(logger, runner, &mfakes.FakeIngressClient{})
+		})
+
+		It("responds with 503", func() {
+			serve(auctioneer.PreviewTaskAuctionsRoute, []auctioneer.TaskStartRequest{
+				auctioneer.NewTaskStartRequest(rep.NewTask("the-guid", "domain", resource, constraint)),
+			})
+
+			Expect(responseRecorder.Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(responseRecorder.Body.String()).To(ContainSubstring(handlers.ErrExplanationsUnavailable.Error()))
+		})
+	})
+})
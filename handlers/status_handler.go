@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"code.cloudfoundry.org/auctioneer"
+	"code.cloudfoundry.org/lager"
+)
+
+type StatusHandler struct {
+	logger     lager.Logger
+	leadership Leadership
+	failures   *auctioneer.PlacementFailures
+	explainer  PlacementExplainer
+}
+
+// NewStatusHandler serves the status of leadership. failures may be nil, in
+// which case no placement failures are reported.
+func NewStatusHandler(logger lager.Logger, leadership Leadership, failures *auctioneer.PlacementFailures, explainer PlacementExplainer) *StatusHandler {
+	return &StatusHandler{
+		logger:     logger.Session("status-handler"),
+		leadership: leadership,
+		failures:   failures,
+		explainer:  explainer,
+	}
+}
+
+// Show is not logged per request as load balancers may poll it frequently.
+// With explain=true it also explains which cells auctions currently skip,
+// which requires fetching the state of every cell. The status is served
+// without the cells if they cannot be explained.
+func (h *StatusHandler) Show(w http.ResponseWriter, r *http.Request) {
+	status := h.leadership.Status()
+	if h.failures != nil {
+		status.PlacementFailures = h.failures.Counts()
+	}
+
+	if explain, _ := strconv.ParseBool(r.FormValue("explain")); explain {
+		cells, err := h.explainer.ExplainCells(h.logger)
+		if err != nil {
+			h.logger.Error("failed-to-explain-cells", err)
+		}
+		status.Cells = cells
+	}
+
+	writeJSONResponse(w, http.StatusOK, status)
+}
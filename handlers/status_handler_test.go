@@ -0,0 +1,99 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/auctioneer"
+	"code.cloudfoundry.org/auctioneer/handlers"
+	"code.cloudfoundry.org/lager/lagertest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("StatusHandler", func() {
+	var (
+		leadership       *fakeLeadership
+		failures         *auctioneer.PlacementFailures
+		explainer        *fakeExplainer
+		request          *http.Request
+		handler          *handlers.StatusHandler
+		responseRecorder *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		leadership = &fakeLeadership{
+			self:     auctioneer.NewPresence("leader-id", "http://127.0.0.1:1"),
+			isLeader: true,
+		}
+		failures = nil
+		explainer = &fakeExplainer{}
+		request = newTestRequest("")
+		responseRecorder = httptest.NewRecorder()
+	})
+
+	JustBeforeEach(func() {
+		handler = handlers.NewStatusHandler(lagertest.NewTestLogger("test"), leadership, failures, explainer)
+		handler.Show(responseRecorder, request)
+	})
+
+	It("responds with the leadership status", func() {
+		Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+
+		var status auctioneer.Status
+		Expect(json.Unmarshal(responseRecorder.Body.Bytes(), &status)).To(Succeed())
+		Expect(status.Self.AuctioneerID).To(Equal("leader-id"))
+		Expect(status.IsLeader).To(BeTrue())
+		Expect(status.PlacementFailures).To(BeEmpty())
+		Expect(status.Cells).To(BeEmpty())
+	})
+
+	Context("when placement failures are recorded", func() {
+		BeforeEach(func() {
+			failures = auctioneer.NewPlacementFailures()
+			failures.Add(auctioneer.PlacementFailureInsufficientMemory, 3)
+			failures.Add(auctioneer.PlacementFailurePlacementTagMismatch, 1)
+		})
+
+		It("includes the counts per reason", func() {
+			var status auctioneer.Status
+			Expect(json.Unmarshal(responseRecorder.Body.Bytes(), &status)).To(Succeed())
+			Expect(status.PlacementFailures).To(Equal(map[auctioneer.PlacementFailureReason]uint64{
+				auctioneer.PlacementFailureInsufficientMemory:   3,
+				auctioneer.PlacementFailurePlacementTagMismatch: 1,
+			}))
+		})
+	})
+
+	Context("in explain mode", func() {
+		BeforeEach(func() {
+			request.URL.RawQuery = "explain=true"
+			explainer.cells = []auctioneer.CellExplanation{
+				{CellID: "cell-a", FilteredOut: []auctioneer.PlacementFailureReason{auctioneer.PlacementFailureCellQuarantined}},
+			}
+		})
+
+		It("explains which cells are skipped", func() {
+			var status auctioneer.Status
+			Expect(json.Unmarshal(responseRecorder.Body.Bytes(), &status)).To(Succeed())
+			Expect(status.Cells).To(Equal(explainer.cells))
+		})
+
+		Context("when the cells cannot be explained", func() {
+			BeforeEach(func() {
+				explainer.err = handlers.ErrExplanationsUnavailable
+			})
+
+			It("still responds with the status", func() {
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+
+				var status auctioneer.Status
+				Expect(json.Unmarshal(responseRecorder.Body.Bytes(), &status)).To(Succeed())
+				Expect(status.IsLeader).To(BeTrue())
+				Expect(status.Cells).To(BeEmpty())
+			})
+		})
+	})
+})
@@ -41,7 +41,7 @@ var _ = Describe("TaskAuctionHandler", func() {
 				resource := rep.NewResource(1, 2, 3)
 				pc := rep.NewPlacementConstraint("rootfs", []string{}, []string{})
 				task := rep.NewTask("the-task-guid", "test", resource, pc)
-				tasks = []auctioneer.TaskStartRequest{auctioneer.TaskStartRequest{task}}
+				tasks = []auctioneer.TaskStartRequest{auctioneer.TaskStartRequest{Task: task}}
 				handler.Create(responseRecorder, newTestRequest(tasks), logger)
 			})
 
@@ -66,7 +66,7 @@ var _ = Describe("TaskAuctionHandler", func() {
 
 			BeforeEach(func() {
 				task := rep.Task{}
-				tasks = []auctioneer.TaskStartRequest{auctioneer.TaskStartRequest{task}}
+				tasks = []auctioneer.TaskStartRequest{auctioneer.TaskStartRequest{Task: task}}
 
 				handler.Create(responseRecorder, newTestRequest(tasks), logger)
 			})
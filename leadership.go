@@ -0,0 +1,207 @@
+package auctioneer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"github.com/tedsuo/ifrit"
+)
+
+var (
+	ErrLockNotHeld    = errors.New("auctioneer does not hold the lock")
+	ErrLeadershipLost = errors.New("auctioneer lost the lock")
+)
+
+// Fence reports the fencing token of the current leadership term. It returns
+// false once the lock has been released or lost, and work of the term must
+// then no longer be started against the cells or the BBS. Neither checks the
+// token, so work already in flight when the term ends is not stopped.
+type Fence interface {
+	FencingToken() (uint64, bool)
+}
+
+// Status describes an auctioneer instance and the leader it knows of. It is
+// served by every instance, whether or not it holds the lock.
+type Status struct {
+	Self         Presence  `json:"self"`
+	IsLeader     bool      `json:"is_leader"`
+	Leader       *Presence `json:"leader,omitempty"`
+	FencingToken uint64    `json:"fencing_token,omitempty"`
+
+	// PlacementFailures counts the placements that failed on this instance
+	// by reason.
+	PlacementFailures map[PlacementFailureReason]uint64 `json:"placement_failures,omitempty"`
+
+	// Cells explains which cells auctions would currently skip. It is only
+	// filled in when the status is requested in explain mode.
+	Cells []CellExplanation `json:"cells,omitempty"`
+}
+
+// Leadership tracks whether this auctioneer holds the lock and, while it is
+// standing by, which auctioneer does.
+type Leadership struct {
+	self Presence
+
+	lock    sync.RWMutex
+	term    uint64
+	leading bool
+	leader  Presence
+}
+
+func NewLeadership(self Presence) *Leadership {
+	return &Leadership{self: self}
+}
+
+func (l *Leadership) IsLeader() bool {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	return l.leading
+}
+
+// Leader returns the presence of the auctioneer holding the lock, or false if
+// it is not known.
+func (l *Leadership) Leader() (Presence, bool) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	if l.leading {
+		return l.self, true
+	}
+
+	return l.leader, l.leader.AuctioneerID != ""
+}
+
+// FencingToken returns the token of the term started by LockRunner, and
+// false while the lock is not held.
+func (l *Leadership) FencingToken() (uint64, bool) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	return l.term, l.term != 0
+}
+
+func (l *Leadership) Status() Status {
+	token, _ := l.FencingToken()
+	status := Status{
+		Self:         l.self,
+		IsLeader:     l.IsLeader(),
+		FencingToken: token,
+	}
+
+	if leader, ok := l.Leader(); ok {
+		status.Leader = &leader
+	}
+
+	return status
+}
+
+// LockRunner wraps the lock runner so that a leadership term starts once the
+// lock is acquired and ends the moment the lock runner exits, before the rest
+// of the group learns that the lock was lost. fencingToken is called once the
+// lock is acquired to get the token of the new term, and again every
+// retryInterval for as long as it fails and the lock is held.
+func (l *Leadership) LockRunner(lock ifrit.Runner, clock clock.Clock, retryInterval time.Duration, fencingToken func() (uint64, error)) ifrit.Runner {
+	return ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
+		process := ifrit.Background(lock)
+
+		select {
+		case <-process.Ready():
+		case err := <-process.Wait():
+			return err
+		case signal := <-signals:
+			process.Signal(signal)
+			return <-process.Wait()
+		}
+
+		token, err := fencingToken()
+		for err != nil {
+			select {
+			case err := <-process.Wait():
+				if err == nil {
+					err = ErrLeadershipLost
+				}
+				return err
+			case signal := <-signals:
+				process.Signal(signal)
+				return <-process.Wait()
+			case <-clock.After(retryInterval):
+			}
+
+			token, err = fencingToken()
+		}
+
+		l.setTerm(token)
+		close(ready)
+
+		select {
+		case err := <-process.Wait():
+			l.setTerm(0)
+			if err == nil {
+				err = ErrLeadershipLost
+			}
+			return err
+		case signal := <-signals:
+			l.setTerm(0)
+			process.Signal(signal)
+			return <-process.Wait()
+		}
+	})
+}
+
+// LeaderRunner marks this auctioneer as the leader for as long as it runs. It
+// belongs after the lock in an ordered group, so that it only starts once the
+// lock is held and is stopped before the lock is released.
+func (l *Leadership) LeaderRunner() ifrit.Runner {
+	return ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
+		l.setLeading(true)
+		defer l.setLeading(false)
+
+		close(ready)
+		<-signals
+		return nil
+	})
+}
+
+// WatchRunner follows the auctioneer holding the lock through serviceClient.
+func (l *Leadership) WatchRunner(serviceClient ServiceClient) ifrit.Runner {
+	return ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		updates := serviceClient.WatchAuctioneer(ctx)
+		close(ready)
+
+		for {
+			select {
+			case <-signals:
+				return nil
+			case presence, ok := <-updates:
+				if !ok {
+					return nil
+				}
+				l.setLeader(presence)
+			}
+		}
+	})
+}
+
+func (l *Leadership) setTerm(term uint64) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.term = term
+}
+
+func (l *Leadership) setLeading(leading bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.leading = leading
+}
+
+func (l *Leadership) setLeader(presence Presence) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.leader = presence
+}
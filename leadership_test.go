@@ -0,0 +1,205 @@
+package auctioneer_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/auctioneer"
+	"code.cloudfoundry.org/clock/fakeclock"
+	locketmodels "code.cloudfoundry.org/locket/models"
+	"code.cloudfoundry.org/locket/models/modelsfakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/tedsuo/ifrit"
+	"github.com/tedsuo/ifrit/ginkgomon"
+)
+
+var _ = Describe("Leadership", func() {
+	var (
+		self       auctioneer.Presence
+		leadership *auctioneer.Leadership
+	)
+
+	BeforeEach(func() {
+		self = auctioneer.NewPresence("self-id", "https://self.example.com:9016")
+		leadership = auctioneer.NewLeadership(self)
+	})
+
+	It("starts as a standby without a known leader", func() {
+		Expect(leadership.IsLeader()).To(BeFalse())
+
+		_, ok := leadership.Leader()
+		Expect(ok).To(BeFalse())
+		Expect(leadership.Status()).To(Equal(auctioneer.Status{Self: self}))
+	})
+
+	Describe("LeaderRunner", func() {
+		var process ifrit.Process
+
+		BeforeEach(func() {
+			process = ginkgomon.Invoke(leadership.LeaderRunner())
+		})
+
+		AfterEach(func() {
+			ginkgomon.Interrupt(process)
+		})
+
+		It("leads while running", func() {
+			Expect(leadership.IsLeader()).To(BeTrue())
+
+			leader, ok := leadership.Leader()
+			Expect(ok).To(BeTrue())
+			Expect(leader).To(Equal(self))
+
+			ginkgomon.Interrupt(process)
+			Expect(leadership.IsLeader()).To(BeFalse())
+		})
+	})
+
+	Describe("LockRunner", func() {
+		var (
+			lockAcquired chan struct{}
+			lockLost     chan struct{}
+			tokenErrs    chan error
+			clock        *fakeclock.FakeClock
+			process      ifrit.Process
+		)
+
+		BeforeEach(func() {
+			lockAcquired = make(chan struct{})
+			lockLost = make(chan struct{})
+			tokenErrs = make(chan error, 1)
+			clock = fakeclock.NewFakeClock(time.Now())
+		})
+
+		JustBeforeEach(func() {
+			lock := ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
+				select {
+				case <-lockAcquired:
+				case <-signals:
+					return nil
+				}
+				close(ready)
+
+				select {
+				case <-lockLost:
+					return nil
+				case <-signals:
+					return nil
+				}
+			})
+
+			process = ifrit.Background(leadership.LockRunner(lock, clock, time.Second, func() (uint64, error) {
+				select {
+				case err := <-tokenErrs:
+					return 0, err
+				default:
+					return 42, nil
+				}
+			}))
+		})
+
+		AfterEach(func() {
+			ginkgomon.Interrupt(process)
+		})
+
+		It("starts a term with the fencing token once the lock is acquired", func() {
+			Consistently(process.Ready()).ShouldNot(BeClosed())
+			_, held := leadership.FencingToken()
+			Expect(held).To(BeFalse())
+
+			close(lockAcquired)
+			Eventually(process.Ready()).Should(BeClosed())
+
+			token, held := leadership.FencingToken()
+			Expect(held).To(BeTrue())
+			Expect(token).To(BeEquivalentTo(42))
+			Expect(leadership.Status().FencingToken).To(BeEquivalentTo(42))
+		})
+
+		It("ends the term and exits as soon as the lock is lost", func() {
+			close(lockAcquired)
+			Eventually(process.Ready()).Should(BeClosed())
+
+			close(lockLost)
+			Eventually(process.Wait()).Should(Receive(Equal(auctioneer.ErrLeadershipLost)))
+
+			_, held := leadership.FencingToken()
+			Expect(held).To(BeFalse())
+		})
+
+		It("ends the term when signalled", func() {
+			close(lockAcquired)
+			Eventually(process.Ready()).Should(BeClosed())
+
+			ginkgomon.Interrupt(process)
+
+			_, held := leadership.FencingToken()
+			Expect(held).To(BeFalse())
+		})
+
+		Context("when the fencing token cannot be determined", func() {
+			BeforeEach(func() {
+				tokenErrs <- errors.New("no token")
+			})
+
+			It("keeps the lock and tries again", func() {
+				close(lockAcquired)
+				Consistently(process.Ready()).ShouldNot(BeClosed())
+				Expect(process.Wait()).NotTo(Receive())
+
+				clock.WaitForWatcherAndIncrement(time.Second)
+				Eventually(process.Ready()).Should(BeClosed())
+
+				token, held := leadership.FencingToken()
+				Expect(held).To(BeTrue())
+				Expect(token).To(BeEquivalentTo(42))
+			})
+
+			It("exits when the lock is lost in the meantime", func() {
+				close(lockAcquired)
+				Eventually(clock.WatcherCount).Should(Equal(1))
+
+				close(lockLost)
+				Eventually(process.Wait()).Should(Receive(Equal(auctioneer.ErrLeadershipLost)))
+			})
+		})
+	})
+
+	Describe("WatchRunner", func() {
+		var (
+			locketClient *modelsfakes.FakeLocketClient
+			leader       auctioneer.Presence
+			process      ifrit.Process
+		)
+
+		BeforeEach(func() {
+			leader = auctioneer.NewPresence("leader-id", "https://leader.example.com:9016")
+			payload, err := json.Marshal(leader)
+			Expect(err).NotTo(HaveOccurred())
+
+			locketClient = &modelsfakes.FakeLocketClient{}
+			locketClient.FetchReturns(&locketmodels.FetchResponse{
+				Resource: &locketmodels.Resource{Key: auctioneer.LocketLockKey, Value: string(payload)},
+			}, nil)
+
+			serviceClient := auctioneer.NewLocketServiceClient(locketClient, fakeclock.NewFakeClock(time.Now()))
+			process = ginkgomon.Invoke(leadership.WatchRunner(serviceClient))
+		})
+
+		AfterEach(func() {
+			ginkgomon.Interrupt(process)
+		})
+
+		It("follows the auctioneer holding the lock", func() {
+			Eventually(func() auctioneer.Presence {
+				current, _ := leadership.Leader()
+				return current
+			}).Should(Equal(leader))
+
+			Expect(leadership.IsLeader()).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,227 @@
+package auctioneer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	loggingclient "code.cloudfoundry.org/diego-logging-client"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/locket"
+	"code.cloudfoundry.org/locket/lock"
+	locketmodels "code.cloudfoundry.org/locket/models"
+	"github.com/tedsuo/ifrit"
+	"google.golang.org/grpc"
+)
+
+const LocketLockKey = "auctioneer"
+
+// LocketFencingTokenKeyPrefix prefixes the Locket resources that claim
+// fencing tokens. Token N is claimed by locking LocketFencingTokenKeyPrefix+N
+// with the claiming auctioneer as owner, so Locket refuses a token to all but
+// the first auctioneer to claim it.
+const LocketFencingTokenKeyPrefix = "auctioneer-fencing-token-"
+
+// Locket forgets resources once their TTL expires, so claims are kept for far
+// longer than any deployment goes without a leader.
+const locketFencingTokenTTL = int64(10 * 365 * 24 * time.Hour / time.Second)
+
+type locketServiceClient struct {
+	locketClient locketmodels.LocketClient
+	clock        clock.Clock
+}
+
+// NewLocketServiceClient returns a ServiceClient that holds and reads the
+// auctioneer lock in Locket. The lock owner is the presence's AuctioneerID
+// and the lock value carries the JSON encoded Presence.
+func NewLocketServiceClient(locketClient locketmodels.LocketClient, clock clock.Clock) ServiceClient {
+	return locketServiceClient{
+		locketClient: locketClient,
+		clock:        clock,
+	}
+}
+
+func (c locketServiceClient) NewAuctioneerLockRunner(logger lager.Logger, presence Presence, retryInterval, lockTTL time.Duration, metronClient loggingclient.IngressClient) (ifrit.Runner, error) {
+	if err := presence.Validate(); err != nil {
+		return nil, err
+	}
+
+	payload, err := json.Marshal(presence)
+	if err != nil {
+		return nil, err
+	}
+
+	lockIdentifier := &locketmodels.Resource{
+		Key:      LocketLockKey,
+		Owner:    presence.AuctioneerID,
+		Value:    string(payload),
+		TypeCode: locketmodels.LOCK,
+		Type:     locketmodels.LockType,
+	}
+
+	ttlInSeconds := int64(lockTTL / time.Second)
+	if ttlInSeconds <= 0 {
+		ttlInSeconds = locket.DefaultSessionTTLInSeconds
+	}
+
+	return lock.NewLockRunner(logger, c.locketClient, lockIdentifier, ttlInSeconds, c.clock, retryInterval), nil
+}
+
+func (c locketServiceClient) CurrentAuctioneer() (Presence, error) {
+	resp, err := c.locketClient.Fetch(context.Background(), &locketmodels.FetchRequest{Key: LocketLockKey})
+	if err != nil {
+		return Presence{}, err
+	}
+
+	return presenceFromResource(resp.Resource)
+}
+
+func (c locketServiceClient) CurrentAuctioneerAddress() (string, error) {
+	presence, err := c.CurrentAuctioneer()
+	return presence.AuctioneerAddress, err
+}
+
+// WatchAuctioneer polls Locket every WatchPollInterval, as Locket has no way
+// of notifying clients of lock changes.
+func (c locketServiceClient) WatchAuctioneer(ctx context.Context) <-chan Presence {
+	publisher := newPresencePublisher()
+
+	go func() {
+		defer close(publisher.updates)
+
+		for {
+			resp, err := c.locketClient.Fetch(ctx, &locketmodels.FetchRequest{Key: LocketLockKey})
+			if ctx.Err() != nil {
+				return
+			}
+
+			switch {
+			case err == nil:
+				presence, err := presenceFromResource(resp.Resource)
+				if err != nil {
+					presence = Presence{}
+				}
+				if !publisher.publish(ctx, presence) {
+					return
+				}
+			case grpc.Code(err) == grpc.Code(locketmodels.ErrResourceNotFound):
+				if !publisher.publish(ctx, Presence{}) {
+					return
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-c.clock.After(WatchPollInterval):
+			}
+		}
+	}()
+
+	return publisher.updates
+}
+
+// FencingToken starts a new leadership term by claiming the token following
+// the greatest one claimed so far. Locket's API exposes no version of its
+// locks, so the claims themselves are the counter: a claim lost to another
+// auctioneer moves on to the next token, and the lock is checked again once a
+// token is claimed so that a term is only started by the lock holder. The
+// claims of earlier terms of this auctioneer are released afterwards.
+func (c locketServiceClient) FencingToken(presence Presence) (uint64, error) {
+	ctx := context.Background()
+	if err := c.checkLockOwner(ctx, presence); err != nil {
+		return 0, err
+	}
+
+	resp, err := c.locketClient.FetchAll(ctx, &locketmodels.FetchAllRequest{TypeCode: locketmodels.LOCK})
+	if err != nil {
+		return 0, err
+	}
+
+	var token uint64
+	owned := []*locketmodels.Resource{}
+	for _, resource := range resp.Resources {
+		claimed, ok := fencingTokenFromKey(resource.Key)
+		if !ok {
+			continue
+		}
+		if claimed > token {
+			token = claimed
+		}
+		if resource.Owner == presence.AuctioneerID {
+			owned = append(owned, resource)
+		}
+	}
+
+	for {
+		token++
+		_, err = c.locketClient.Lock(ctx, &locketmodels.LockRequest{
+			Resource: &locketmodels.Resource{
+				Key:      LocketFencingTokenKeyPrefix + strconv.FormatUint(token, 10),
+				Owner:    presence.AuctioneerID,
+				TypeCode: locketmodels.LOCK,
+				Type:     locketmodels.LockType,
+			},
+			TtlInSeconds: locketFencingTokenTTL,
+		})
+		if err == nil {
+			break
+		}
+		if grpc.Code(err) != grpc.Code(locketmodels.ErrLockCollision) {
+			return 0, err
+		}
+	}
+
+	if err := c.checkLockOwner(ctx, presence); err != nil {
+		return 0, err
+	}
+
+	for _, resource := range owned {
+		c.locketClient.Release(ctx, &locketmodels.ReleaseRequest{Resource: resource})
+	}
+
+	return token, nil
+}
+
+func (c locketServiceClient) checkLockOwner(ctx context.Context, presence Presence) error {
+	resp, err := c.locketClient.Fetch(ctx, &locketmodels.FetchRequest{Key: LocketLockKey})
+	if err != nil {
+		return err
+	}
+
+	if resp.Resource == nil || resp.Resource.Owner != presence.AuctioneerID {
+		return ErrLockNotHeld
+	}
+
+	return nil
+}
+
+func fencingTokenFromKey(key string) (uint64, bool) {
+	if !strings.HasPrefix(key, LocketFencingTokenKeyPrefix) {
+		return 0, false
+	}
+
+	token, err := strconv.ParseUint(strings.TrimPrefix(key, LocketFencingTokenKeyPrefix), 10, 64)
+	return token, err == nil
+}
+
+func presenceFromResource(resource *locketmodels.Resource) (Presence, error) {
+	presence := Presence{}
+	if resource == nil {
+		return presence, errors.New("lock has no resource")
+	}
+
+	if err := json.Unmarshal([]byte(resource.Value), &presence); err != nil {
+		return presence, err
+	}
+
+	if err := presence.Validate(); err != nil {
+		return presence, err
+	}
+
+	return presence, nil
+}
@@ -0,0 +1,313 @@
+package auctioneer_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"code.cloudfoundry.org/auctioneer"
+	"code.cloudfoundry.org/clock/fakeclock"
+	mfakes "code.cloudfoundry.org/diego-logging-client/testhelpers"
+	"code.cloudfoundry.org/lager/lagertest"
+	locketmodels "code.cloudfoundry.org/locket/models"
+	"code.cloudfoundry.org/locket/models/modelsfakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/tedsuo/ifrit"
+	"github.com/tedsuo/ifrit/ginkgomon"
+	"google.golang.org/grpc"
+)
+
+var _ = Describe("LocketServiceClient", func() {
+	var (
+		locketClient  *modelsfakes.FakeLocketClient
+		serviceClient auctioneer.ServiceClient
+		clock         *fakeclock.FakeClock
+		logger        *lagertest.TestLogger
+		presence      auctioneer.Presence
+	)
+
+	BeforeEach(func() {
+		locketClient = &modelsfakes.FakeLocketClient{}
+		logger = lagertest.NewTestLogger("test")
+		presence = auctioneer.NewPresence("auctioneer-id", "https://auctioneer.example.com:9016")
+
+		clock = fakeclock.NewFakeClock(time.Now())
+		serviceClient = auctioneer.NewLocketServiceClient(locketClient, clock)
+	})
+
+	Describe("NewAuctioneerLockRunner", func() {
+		var process ifrit.Process
+
+		AfterEach(func() {
+			ginkgomon.Interrupt(process)
+		})
+
+		It("locks with the presence id as owner and the presence as value", func() {
+			runner, err := serviceClient.NewAuctioneerLockRunner(logger, presence, time.Second, 15*time.Second, &mfakes.FakeIngressClient{})
+			Expect(err).NotTo(HaveOccurred())
+
+			process = ginkgomon.Invoke(runner)
+
+			Expect(locketClient.LockCallCount()).To(Equal(1))
+			_, req, _ := locketClient.LockArgsForCall(0)
+			Expect(req.Resource.Key).To(Equal(auctioneer.LocketLockKey))
+			Expect(req.Resource.Owner).To(Equal("auctioneer-id"))
+			Expect(req.TtlInSeconds).To(BeEquivalentTo(15))
+
+			advertised := auctioneer.Presence{}
+			Expect(json.Unmarshal([]byte(req.Resource.Value), &advertised)).To(Succeed())
+			Expect(advertised).To(Equal(presence))
+		})
+
+		Context("when the presence is invalid", func() {
+			It("returns an error", func() {
+				_, err := serviceClient.NewAuctioneerLockRunner(logger, auctioneer.Presence{}, time.Second, 15*time.Second, &mfakes.FakeIngressClient{})
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("CurrentAuctioneer", func() {
+		Context("when the lock carries a presence", func() {
+			BeforeEach(func() {
+				payload, err := json.Marshal(presence)
+				Expect(err).NotTo(HaveOccurred())
+
+				locketClient.FetchReturns(&locketmodels.FetchResponse{
+					Resource: &locketmodels.Resource{
+						Key:   auctioneer.LocketLockKey,
+						Owner: "auctioneer-id",
+						Value: string(payload),
+					},
+				}, nil)
+			})
+
+			It("returns the presence", func() {
+				current, err := serviceClient.CurrentAuctioneer()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(current).To(Equal(presence))
+
+				_, req, _ := locketClient.FetchArgsForCall(0)
+				Expect(req.Key).To(Equal(auctioneer.LocketLockKey))
+			})
+
+			It("returns the address", func() {
+				address, err := serviceClient.CurrentAuctioneerAddress()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(address).To(Equal(presence.AuctioneerAddress))
+			})
+		})
+
+		Context("when the lock does not carry a presence", func() {
+			BeforeEach(func() {
+				locketClient.FetchReturns(&locketmodels.FetchResponse{
+					Resource: &locketmodels.Resource{Key: auctioneer.LocketLockKey, Owner: "someone-else"},
+				}, nil)
+			})
+
+			It("returns an error", func() {
+				_, err := serviceClient.CurrentAuctioneer()
+				Expect(err).To(HaveOccurred())
+			})
+		})
+
+		Context("when the lock cannot be fetched", func() {
+			BeforeEach(func() {
+				locketClient.FetchReturns(nil, errors.New("no lock"))
+			})
+
+			It("returns an error", func() {
+				_, err := serviceClient.CurrentAuctioneerAddress()
+				Expect(err).To(MatchError("no lock"))
+			})
+		})
+	})
+
+	Describe("FencingToken", func() {
+		var locks map[string]*locketmodels.Resource
+
+		lockAs := func(owner, key string) {
+			_, err := locketClient.Lock(context.Background(), &locketmodels.LockRequest{
+				Resource: &locketmodels.Resource{Key: key, Owner: owner, TypeCode: locketmodels.LOCK},
+			})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		BeforeEach(func() {
+			// The stubs follow Locket's semantics: a lock held by another owner
+			// collides, while the same owner only refreshes it.
+			locks = map[string]*locketmodels.Resource{}
+
+			locketClient.LockStub = func(_ context.Context, req *locketmodels.LockRequest, _ ...grpc.CallOption) (*locketmodels.LockResponse, error) {
+				if existing, ok := locks[req.Resource.Key]; ok && existing.Owner != req.Resource.Owner {
+					return nil, locketmodels.ErrLockCollision
+				}
+				locks[req.Resource.Key] = req.Resource
+				return &locketmodels.LockResponse{}, nil
+			}
+			locketClient.FetchStub = func(_ context.Context, req *locketmodels.FetchRequest, _ ...grpc.CallOption) (*locketmodels.FetchResponse, error) {
+				resource, ok := locks[req.Key]
+				if !ok {
+					return nil, locketmodels.ErrResourceNotFound
+				}
+				return &locketmodels.FetchResponse{Resource: resource}, nil
+			}
+			locketClient.FetchAllStub = func(_ context.Context, req *locketmodels.FetchAllRequest, _ ...grpc.CallOption) (*locketmodels.FetchAllResponse, error) {
+				resp := &locketmodels.FetchAllResponse{}
+				for _, resource := range locks {
+					if resource.TypeCode == req.TypeCode {
+						resp.Resources = append(resp.Resources, resource)
+					}
+				}
+				return resp, nil
+			}
+			locketClient.ReleaseStub = func(_ context.Context, req *locketmodels.ReleaseRequest, _ ...grpc.CallOption) (*locketmodels.ReleaseResponse, error) {
+				if existing, ok := locks[req.Resource.Key]; ok && existing.Owner != req.Resource.Owner {
+					return nil, locketmodels.ErrLockCollision
+				}
+				delete(locks, req.Resource.Key)
+				return &locketmodels.ReleaseResponse{}, nil
+			}
+
+			lockAs("auctioneer-id", auctioneer.LocketLockKey)
+		})
+
+		It("starts counting at 1", func() {
+			token, err := serviceClient.FencingToken(presence)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(token).To(BeEquivalentTo(1))
+
+			Expect(locks).To(HaveKey(auctioneer.LocketFencingTokenKeyPrefix + "1"))
+			claim := locks[auctioneer.LocketFencingTokenKeyPrefix+"1"]
+			Expect(claim.Owner).To(Equal("auctioneer-id"))
+		})
+
+		It("claims a greater token for every term and releases the earlier claims", func() {
+			lockAs("other-id", auctioneer.LocketFencingTokenKeyPrefix+"41")
+
+			token, err := serviceClient.FencingToken(presence)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(token).To(BeEquivalentTo(42))
+
+			token, err = serviceClient.FencingToken(presence)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(token).To(BeEquivalentTo(43))
+
+			Expect(locks).NotTo(HaveKey(auctioneer.LocketFencingTokenKeyPrefix + "42"))
+			Expect(locks).To(HaveKey(auctioneer.LocketFencingTokenKeyPrefix + "41"))
+			Expect(locks).To(HaveKey(auctioneer.LocketFencingTokenKeyPrefix + "43"))
+		})
+
+		It("moves on to the next token when another auctioneer claims it first", func() {
+			lockAs("other-id", auctioneer.LocketFencingTokenKeyPrefix+"1")
+			locketClient.FetchAllReturns(&locketmodels.FetchAllResponse{}, nil)
+
+			token, err := serviceClient.FencingToken(presence)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(token).To(BeEquivalentTo(2))
+			Expect(locks[auctioneer.LocketFencingTokenKeyPrefix+"1"].Owner).To(Equal("other-id"))
+		})
+
+		It("returns ErrLockNotHeld for another auctioneer", func() {
+			locks[auctioneer.LocketLockKey].Owner = "other-id"
+
+			_, err := serviceClient.FencingToken(presence)
+			Expect(err).To(Equal(auctioneer.ErrLockNotHeld))
+			Expect(locketClient.FetchAllCallCount()).To(Equal(0))
+		})
+
+		It("returns ErrLockNotHeld when the lock is lost while claiming a token", func() {
+			lockStub := locketClient.LockStub
+			locketClient.LockStub = func(ctx context.Context, req *locketmodels.LockRequest, opts ...grpc.CallOption) (*locketmodels.LockResponse, error) {
+				locks[auctioneer.LocketLockKey] = &locketmodels.Resource{Key: auctioneer.LocketLockKey, Owner: "other-id"}
+				return lockStub(ctx, req, opts...)
+			}
+
+			_, err := serviceClient.FencingToken(presence)
+			Expect(err).To(Equal(auctioneer.ErrLockNotHeld))
+		})
+
+		It("returns an error when the token cannot be claimed", func() {
+			locketClient.LockReturns(nil, errors.New("boom"))
+
+			_, err := serviceClient.FencingToken(presence)
+			Expect(err).To(MatchError("boom"))
+		})
+	})
+
+	Describe("WatchAuctioneer", func() {
+		var (
+			ctx     context.Context
+			cancel  context.CancelFunc
+			updates <-chan auctioneer.Presence
+		)
+
+		lockHeldBy := func(presence auctioneer.Presence) *locketmodels.FetchResponse {
+			payload, err := json.Marshal(presence)
+			Expect(err).NotTo(HaveOccurred())
+			return &locketmodels.FetchResponse{
+				Resource: &locketmodels.Resource{
+					Key:   auctioneer.LocketLockKey,
+					Owner: presence.AuctioneerID,
+					Value: string(payload),
+				},
+			}
+		}
+
+		BeforeEach(func() {
+			locketClient.FetchReturns(lockHeldBy(presence), nil)
+		})
+
+		JustBeforeEach(func() {
+			ctx, cancel = context.WithCancel(context.Background())
+			updates = serviceClient.WatchAuctioneer(ctx)
+		})
+
+		AfterEach(func() {
+			cancel()
+		})
+
+		It("sends the current presence", func() {
+			Eventually(updates).Should(Receive(Equal(presence)))
+		})
+
+		It("only sends a presence when the lock changes hands", func() {
+			Eventually(updates).Should(Receive(Equal(presence)))
+
+			clock.WaitForWatcherAndIncrement(auctioneer.WatchPollInterval)
+			Eventually(locketClient.FetchCallCount).Should(Equal(2))
+			Consistently(updates).ShouldNot(Receive())
+
+			newPresence := auctioneer.NewPresence("other-auctioneer-id", "https://other.example.com:9016")
+			locketClient.FetchReturns(lockHeldBy(newPresence), nil)
+			clock.WaitForWatcherAndIncrement(auctioneer.WatchPollInterval)
+			Eventually(updates).Should(Receive(Equal(newPresence)))
+		})
+
+		It("sends an empty presence when the lock is released", func() {
+			Eventually(updates).Should(Receive(Equal(presence)))
+
+			locketClient.FetchReturns(nil, locketmodels.ErrResourceNotFound)
+			clock.WaitForWatcherAndIncrement(auctioneer.WatchPollInterval)
+			Eventually(updates).Should(Receive(Equal(auctioneer.Presence{})))
+		})
+
+		It("does not send anything when locket cannot be reached", func() {
+			Eventually(updates).Should(Receive(Equal(presence)))
+
+			locketClient.FetchReturns(nil, errors.New("connection refused"))
+			clock.WaitForWatcherAndIncrement(auctioneer.WatchPollInterval)
+			Eventually(locketClient.FetchCallCount).Should(Equal(2))
+			Consistently(updates).ShouldNot(Receive())
+		})
+
+		It("closes the channel when the context is done", func() {
+			Eventually(updates).Should(Receive(Equal(presence)))
+
+			cancel()
+			Eventually(updates).Should(BeClosed())
+		})
+	})
+})
@@ -0,0 +1,62 @@
+package auctioneer
+
+import "sync"
+
+// PlacementFailureReason is the cause of a failed placement, as classified
+// from the placement error reported by the auction.
+type PlacementFailureReason string
+
+const (
+	PlacementFailureInsufficientMemory     PlacementFailureReason = "insufficient_memory"
+	PlacementFailureInsufficientDisk       PlacementFailureReason = "insufficient_disk"
+	PlacementFailureInsufficientPids       PlacementFailureReason = "insufficient_pids"
+	PlacementFailureInsufficientContainers PlacementFailureReason = "insufficient_containers"
+	PlacementFailureRootFSMismatch         PlacementFailureReason = "rootfs_mismatch"
+	PlacementFailurePlacementTagMismatch   PlacementFailureReason = "placement_tag_mismatch"
+	PlacementFailureVolumeDriverMismatch   PlacementFailureReason = "volume_driver_mismatch"
+	PlacementFailureNoCells                PlacementFailureReason = "no_cells"
+	PlacementFailureCellCommunication      PlacementFailureReason = "cell_communication"
+	PlacementFailureQuotaExceeded          PlacementFailureReason = "quota_exceeded"
+	PlacementFailureExpired                PlacementFailureReason = "expired"
+	PlacementFailureOther                  PlacementFailureReason = "other"
+
+	// The following reasons only explain why a single cell was left out of
+	// an auction; see CellExplanation.
+	PlacementFailureCellFiltered    PlacementFailureReason = "cell_filtered"
+	PlacementFailureCellQuarantined PlacementFailureReason = "cell_quarantined"
+	PlacementFailureCellEvacuating  PlacementFailureReason = "cell_evacuating"
+	PlacementFailureCellUnreachable PlacementFailureReason = "cell_unreachable"
+)
+
+// PlacementFailures counts failed placements by reason since the auctioneer
+// started. A placement that failed for several reasons, such as lacking both
+// memory and disk, counts towards each of them.
+type PlacementFailures struct {
+	lock   sync.Mutex
+	counts map[PlacementFailureReason]uint64
+}
+
+func NewPlacementFailures() *PlacementFailures {
+	return &PlacementFailures{
+		counts: map[PlacementFailureReason]uint64{},
+	}
+}
+
+func (p *PlacementFailures) Add(reason PlacementFailureReason, count uint64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.counts[reason] += count
+}
+
+// Counts returns a copy of the counts.
+func (p *PlacementFailures) Counts() map[PlacementFailureReason]uint64 {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	counts := make(map[PlacementFailureReason]uint64, len(p.counts))
+	for reason, count := range p.counts {
+		counts[reason] = count
+	}
+	return counts
+}
@@ -0,0 +1,304 @@
+package placementexplainer
+
+import (
+	"sort"
+	"sync"
+
+	"code.cloudfoundry.org/auctioneer"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/rep"
+)
+
+// LocalityOffset is added to the score of a cell for each instance of the
+// LRP it already runs, as done by the auction.
+const LocalityOffset = 1000
+
+// CellSource provides the cells auctions are run against. CandidateCells
+// lists every registered cell and returns the rep clients of those that are
+// neither filtered out nor quarantined. Fetching the cells and their state
+// must not affect the auctions, e.g. by quarantining unresponsive cells.
+type CellSource interface {
+	CandidateCells(logger lager.Logger) (map[string]rep.Client, []auctioneer.Cell, error)
+}
+
+// Weights are the scoring settings of the auction runner.
+type Weights struct {
+	BinPackFirstFitWeight         float64
+	StartingContainerWeight       float64
+	StartingContainerCountMaximum int
+}
+
+// Explainer explains how start requests would be placed by fetching the
+// state of every cell and applying the filters and scoring of the auction.
+// It does not reserve any resources, so the explanation may differ from the
+// outcome of an auction run later on.
+type Explainer struct {
+	cells   CellSource
+	weights Weights
+}
+
+func New(cells CellSource, weights Weights) *Explainer {
+	return &Explainer{
+		cells:   cells,
+		weights: weights,
+	}
+}
+
+type candidate struct {
+	explanation auctioneer.CellExplanation
+	state       *rep.CellState
+
+	// deniedDomains lists the domains whose cell filters leave the cell out.
+	deniedDomains []string
+}
+
+// ExplainCells explains which cells are left out of every auction.
+func (e *Explainer) ExplainCells(logger lager.Logger) ([]auctioneer.CellExplanation, error) {
+	logger = logger.Session("explain-cells")
+
+	candidates, err := e.fetchCandidates(logger)
+	if err != nil {
+		return nil, err
+	}
+
+	explanations := make([]auctioneer.CellExplanation, 0, len(candidates))
+	for _, c := range candidates {
+		explanations = append(explanations, c.explanation)
+	}
+	return explanations, nil
+}
+
+func (e *Explainer) ExplainLRPs(logger lager.Logger, lrpStarts []auctioneer.LRPStartRequest) ([]auctioneer.PlacementExplanation, error) {
+	logger = logger.Session("explain-lrps")
+
+	candidates, err := e.fetchCandidates(logger)
+	if err != nil {
+		return nil, err
+	}
+
+	explanations := make([]auctioneer.PlacementExplanation, 0, len(lrpStarts))
+	for i := range lrpStarts {
+		lrpStart := &lrpStarts[i]
+		explanations = append(explanations, e.explain(lrpStart.ProcessGuid, lrpStart.Domain, candidates, &lrpStart.PlacementConstraint, &lrpStart.Resource, func(state *rep.CellState) int {
+			instances := 0
+			for j := range state.LRPs {
+				if state.LRPs[j].ProcessGuid == lrpStart.ProcessGuid {
+					instances++
+				}
+			}
+			return instances
+		}))
+	}
+	return explanations, nil
+}
+
+func (e *Explainer) ExplainTasks(logger lager.Logger, taskStarts []auctioneer.TaskStartRequest) ([]auctioneer.PlacementExplanation, error) {
+	logger = logger.Session("explain-tasks")
+
+	candidates, err := e.fetchCandidates(logger)
+	if err != nil {
+		return nil, err
+	}
+
+	explanations := make([]auctioneer.PlacementExplanation, 0, len(taskStarts))
+	for i := range taskStarts {
+		task := &taskStarts[i].Task
+		explanations = append(explanations, e.explain(task.TaskGuid, task.Domain, candidates, &task.PlacementConstraint, &task.Resource, nil))
+	}
+	return explanations, nil
+}
+
+// explain filters and scores the candidates for a single request. instances
+// counts the instances of an LRP on a cell and is nil for tasks.
+func (e *Explainer) explain(
+	identifier string,
+	domain string,
+	candidates []candidate,
+	constraint *rep.PlacementConstraint,
+	resource *rep.Resource,
+	instances func(*rep.CellState) int,
+) auctioneer.PlacementExplanation {
+	explanation := auctioneer.PlacementExplanation{
+		Identifier: identifier,
+		Cells:      make([]auctioneer.CellExplanation, 0, len(candidates)),
+	}
+
+	startingContainers := 0
+	zoneInstances := map[string]int{}
+	for _, c := range candidates {
+		if c.state == nil {
+			continue
+		}
+		startingContainers += c.state.StartingContainerCount
+		if instances != nil {
+			zoneInstances[c.state.Zone] += instances(c.state)
+		}
+	}
+	explanation.InflightLimitReached = e.weights.StartingContainerCountMaximum > 0 &&
+		startingContainers >= e.weights.StartingContainerCountMaximum
+
+	best := -1
+	for _, c := range candidates {
+		cell := c.explanation
+		switch {
+		case deniedFor(c.deniedDomains, domain):
+			cell.FilteredOut = []auctioneer.PlacementFailureReason{auctioneer.PlacementFailureCellFiltered}
+		case c.state != nil:
+			cell.FilteredOut = filter(c.state, constraint, resource)
+			if len(cell.FilteredOut) == 0 {
+				score := c.state.ComputeScore(resource, e.weights.StartingContainerWeight) +
+					float64(c.state.CellIndex)*e.weights.BinPackFirstFitWeight
+				if instances != nil {
+					cell.Instances = instances(c.state)
+					score += float64(cell.Instances * LocalityOffset)
+				}
+				cell.Score = &score
+			}
+		}
+
+		if cell.Score != nil && (best < 0 || better(&cell, &explanation.Cells[best], zoneInstances)) {
+			best = len(explanation.Cells)
+		}
+		explanation.Cells = append(explanation.Cells, cell)
+	}
+
+	if best >= 0 {
+		explanation.BestCellID = explanation.Cells[best].CellID
+	}
+	return explanation
+}
+
+// better reports whether cell would be picked over best. Like the auction,
+// it prefers the zones running the fewest instances of the LRP, and only then
+// the lowest score.
+func better(cell, best *auctioneer.CellExplanation, zoneInstances map[string]int) bool {
+	if zoneInstances[cell.Zone] != zoneInstances[best.Zone] {
+		return zoneInstances[cell.Zone] < zoneInstances[best.Zone]
+	}
+	return *cell.Score < *best.Score
+}
+
+func deniedFor(domains []string, domain string) bool {
+	for _, d := range domains {
+		if d == domain {
+			return true
+		}
+	}
+	return false
+}
+
+func filter(state *rep.CellState, constraint *rep.PlacementConstraint, resource *rep.Resource) []auctioneer.PlacementFailureReason {
+	reasons := []auctioneer.PlacementFailureReason{}
+
+	if !state.MatchRootFS(constraint.RootFs) {
+		reasons = append(reasons, auctioneer.PlacementFailureRootFSMismatch)
+	}
+	if !state.MatchVolumeDrivers(constraint.VolumeDrivers) {
+		reasons = append(reasons, auctioneer.PlacementFailureVolumeDriverMismatch)
+	}
+	if !state.MatchPlacementTags(constraint.PlacementTags) {
+		reasons = append(reasons, auctioneer.PlacementFailurePlacementTagMismatch)
+	}
+
+	reasons = append(reasons, InsufficientResources(state.ResourceMatch(resource))...)
+
+	if len(reasons) == 0 {
+		return nil
+	}
+	return reasons
+}
+
+// InsufficientResources returns a reason per resource that an error returned
+// by rep.CellState.ResourceMatch reports exhausted.
+func InsufficientResources(err error) []auctioneer.PlacementFailureReason {
+	reasons := []auctioneer.PlacementFailureReason{}
+
+	insufficient, ok := err.(rep.InsufficientResourcesError)
+	if !ok {
+		return reasons
+	}
+
+	if _, ok := insufficient.Problems["memory"]; ok {
+		reasons = append(reasons, auctioneer.PlacementFailureInsufficientMemory)
+	}
+	if _, ok := insufficient.Problems["disk"]; ok {
+		reasons = append(reasons, auctioneer.PlacementFailureInsufficientDisk)
+	}
+	if _, ok := insufficient.Problems["pids"]; ok {
+		reasons = append(reasons, auctioneer.PlacementFailureInsufficientPids)
+	}
+	if _, ok := insufficient.Problems["containers"]; ok {
+		reasons = append(reasons, auctioneer.PlacementFailureInsufficientContainers)
+	}
+	return reasons
+}
+
+// fetchCandidates fetches the state of every cell in parallel. Cells that
+// every auction skips are returned with a nil state and the reason they are
+// skipped, sorted by cell ID.
+func (e *Explainer) fetchCandidates(logger lager.Logger) ([]candidate, error) {
+	cellReps, cells, err := e.cells.CandidateCells(logger)
+	if err != nil {
+		logger.Error("failed-to-fetch-cells", err)
+		return nil, err
+	}
+
+	candidates := make([]candidate, 0, len(cells))
+	deniedDomains := make(map[string][]string, len(cells))
+	for _, cell := range cells {
+		if _, ok := cellReps[cell.CellID]; ok {
+			deniedDomains[cell.CellID] = cell.FilteredForDomains
+			continue
+		}
+
+		explanation := auctioneer.CellExplanation{CellID: cell.CellID}
+		switch {
+		case cell.FilteredBy != "":
+			explanation.FilteredOut = []auctioneer.PlacementFailureReason{auctioneer.PlacementFailureCellFiltered}
+			explanation.Error = "filtered out by " + cell.FilteredBy
+		case cell.Quarantine != nil:
+			explanation.FilteredOut = []auctioneer.PlacementFailureReason{auctioneer.PlacementFailureCellQuarantined}
+		default:
+			continue
+		}
+		candidates = append(candidates, candidate{explanation: explanation})
+	}
+
+	lock := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for cellID, client := range cellReps {
+		wg.Add(1)
+		go func(cellID string, client rep.Client) {
+			defer wg.Done()
+
+			c := candidate{
+				explanation:   auctioneer.CellExplanation{CellID: cellID},
+				deniedDomains: deniedDomains[cellID],
+			}
+			state, err := client.State(logger)
+			switch {
+			case err != nil:
+				logger.Error("failed-to-fetch-cell-state", err, lager.Data{"cell-id": cellID})
+				c.explanation.FilteredOut = []auctioneer.PlacementFailureReason{auctioneer.PlacementFailureCellUnreachable}
+				c.explanation.Error = err.Error()
+			case state.Evacuating:
+				c.explanation.Zone = state.Zone
+				c.explanation.FilteredOut = []auctioneer.PlacementFailureReason{auctioneer.PlacementFailureCellEvacuating}
+			default:
+				c.explanation.Zone = state.Zone
+				c.explanation.StartingContainerCount = state.StartingContainerCount
+				c.state = &state
+			}
+
+			lock.Lock()
+			candidates = append(candidates, c)
+			lock.Unlock()
+		}(cellID, client)
+	}
+	wg.Wait()
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].explanation.CellID < candidates[j].explanation.CellID
+	})
+	return candidates, nil
+}
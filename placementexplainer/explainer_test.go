@@ -0,0 +1,271 @@
+package placementexplainer_test
+
+import (
+	"errors"
+
+	"code.cloudfoundry.org/auctioneer"
+	"code.cloudfoundry.org/auctioneer/placementexplainer"
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/rep"
+	"code.cloudfoundry.org/rep/repfakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakeCellSource struct {
+	cellReps map[string]rep.Client
+	cells    []auctioneer.Cell
+	err      error
+}
+
+func (s *fakeCellSource) CandidateCells(lager.Logger) (map[string]rep.Client, []auctioneer.Cell, error) {
+	return s.cellReps, s.cells, s.err
+}
+
+var _ = Describe("Explainer", func() {
+	var (
+		logger     *lagertest.TestLogger
+		cellSource *fakeCellSource
+		weights    placementexplainer.Weights
+		explainer  *placementexplainer.Explainer
+		constraint rep.PlacementConstraint
+		resource   rep.Resource
+	)
+
+	cellWithState := func(state rep.CellState, err error) rep.Client {
+		client := new(repfakes.FakeClient)
+		client.StateReturns(state, err)
+		return client
+	}
+
+	newState := func(cellID string, index int, zone string, memoryMB int32, lrps ...rep.LRP) rep.CellState {
+		return rep.NewCellState(
+			cellID,
+			index,
+			"",
+			rep.RootFSProviders{"preloaded": rep.NewFixedSetRootFSProvider("cflinuxfs3")},
+			rep.NewResources(memoryMB, 1024, 10),
+			rep.NewResources(1024, 1024, 10),
+			lrps,
+			nil,
+			zone,
+			0,
+			false,
+			[]string{"nfs"},
+			[]string{},
+			[]string{},
+			0,
+		)
+	}
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		cellSource = &fakeCellSource{cellReps: map[string]rep.Client{}}
+		weights = placementexplainer.Weights{}
+		constraint = rep.NewPlacementConstraint("preloaded:cflinuxfs3", []string{}, []string{})
+		resource = rep.NewResource(256, 256, 10)
+	})
+
+	JustBeforeEach(func() {
+		explainer = placementexplainer.New(cellSource, weights)
+	})
+
+	Describe("ExplainTasks", func() {
+		var explanations []auctioneer.PlacementExplanation
+
+		JustBeforeEach(func() {
+			var err error
+			explanations, err = explainer.ExplainTasks(logger, []auctioneer.TaskStartRequest{
+				auctioneer.NewTaskStartRequest(rep.NewTask("task-guid", "domain", resource, constraint)),
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(explanations).To(HaveLen(1))
+			Expect(explanations[0].Identifier).To(Equal("task-guid"))
+		})
+
+		Context("when cells are filtered out", func() {
+			BeforeEach(func() {
+				cellSource.cellReps["cell-a"] = cellWithState(newState("cell-a", 0, "z1", 128), nil)
+				cellSource.cellReps["cell-b"] = cellWithState(rep.CellState{}, errors.New("boom"))
+				cellSource.cellReps["cell-c"] = cellWithState(newState("cell-c", 1, "z1", 1024), nil)
+				cellSource.cells = []auctioneer.Cell{
+					{CellID: "cell-a"},
+					{CellID: "cell-b"},
+					{CellID: "cell-c"},
+					{CellID: "cell-d", Quarantine: &auctioneer.CellQuarantine{ConsecutiveFailures: 3}},
+					{CellID: "cell-e", FilteredBy: "cell-id-deny-list"},
+				}
+
+				constraint = rep.NewPlacementConstraint("preloaded:cflinuxfs3", []string{}, []string{"nfs"})
+			})
+
+			It("explains why each cell was filtered out", func() {
+				cells := explanations[0].Cells
+				Expect(cells).To(HaveLen(5))
+
+				Expect(cells[0].CellID).To(Equal("cell-a"))
+				Expect(cells[0].FilteredOut).To(ConsistOf(auctioneer.PlacementFailureInsufficientMemory))
+				Expect(cells[0].Score).To(BeNil())
+
+				Expect(cells[1].CellID).To(Equal("cell-b"))
+				Expect(cells[1].FilteredOut).To(ConsistOf(auctioneer.PlacementFailureCellUnreachable))
+				Expect(cells[1].Error).To(Equal("boom"))
+
+				Expect(cells[2].CellID).To(Equal("cell-c"))
+				Expect(cells[2].FilteredOut).To(BeEmpty())
+				Expect(cells[2].Score).NotTo(BeNil())
+
+				Expect(cells[3].CellID).To(Equal("cell-d"))
+				Expect(cells[3].FilteredOut).To(ConsistOf(auctioneer.PlacementFailureCellQuarantined))
+
+				Expect(cells[4].CellID).To(Equal("cell-e"))
+				Expect(cells[4].FilteredOut).To(ConsistOf(auctioneer.PlacementFailureCellFiltered))
+				Expect(cells[4].Error).To(ContainSubstring("cell-id-deny-list"))
+
+				Expect(explanations[0].BestCellID).To(Equal("cell-c"))
+			})
+		})
+
+		Context("when the cell filters of the domain leave out a cell", func() {
+			BeforeEach(func() {
+				cellSource.cellReps["cell-a"] = cellWithState(newState("cell-a", 0, "z1", 1024), nil)
+				cellSource.cellReps["cell-b"] = cellWithState(newState("cell-b", 1, "z1", 1024), nil)
+				cellSource.cells = []auctioneer.Cell{
+					{CellID: "cell-a", FilteredForDomains: []string{"domain"}},
+					{CellID: "cell-b", FilteredForDomains: []string{"other-domain"}},
+				}
+			})
+
+			It("explains that the cell was filtered out", func() {
+				cells := explanations[0].Cells
+				Expect(cells[0].FilteredOut).To(ConsistOf(auctioneer.PlacementFailureCellFiltered))
+				Expect(cells[0].Score).To(BeNil())
+				Expect(cells[1].FilteredOut).To(BeEmpty())
+				Expect(explanations[0].BestCellID).To(Equal("cell-b"))
+			})
+		})
+
+		Context("when the placement constraint does not match", func() {
+			BeforeEach(func() {
+				cellSource.cellReps["cell-a"] = cellWithState(newState("cell-a", 0, "z1", 1024), nil)
+				constraint = rep.NewPlacementConstraint("preloaded:windows", []string{"gpu"}, []string{"smb"})
+			})
+
+			It("lists every mismatch", func() {
+				Expect(explanations[0].Cells[0].FilteredOut).To(Equal([]auctioneer.PlacementFailureReason{
+					auctioneer.PlacementFailureRootFSMismatch,
+					auctioneer.PlacementFailureVolumeDriverMismatch,
+					auctioneer.PlacementFailurePlacementTagMismatch,
+				}))
+				Expect(explanations[0].BestCellID).To(BeEmpty())
+			})
+		})
+
+		Context("when the cells are starting too many containers", func() {
+			BeforeEach(func() {
+				state := newState("cell-a", 0, "z1", 1024)
+				state.StartingContainerCount = 5
+				cellSource.cellReps["cell-a"] = cellWithState(state, nil)
+				weights.StartingContainerCountMaximum = 5
+			})
+
+			It("reports the in-flight limit", func() {
+				Expect(explanations[0].InflightLimitReached).To(BeTrue())
+				Expect(explanations[0].Cells[0].StartingContainerCount).To(Equal(5))
+			})
+		})
+	})
+
+	Describe("ExplainLRPs", func() {
+		var explanations []auctioneer.PlacementExplanation
+
+		BeforeEach(func() {
+			existing := rep.NewLRP("", models.NewActualLRPKey("process-guid", 0, "domain"), resource, constraint)
+			cellSource.cellReps["cell-a"] = cellWithState(newState("cell-a", 0, "z1", 1024, existing), nil)
+			cellSource.cellReps["cell-b"] = cellWithState(newState("cell-b", 1, "z1", 512), nil)
+			cellSource.cellReps["cell-c"] = cellWithState(newState("cell-c", 2, "z2", 256), nil)
+		})
+
+		JustBeforeEach(func() {
+			var err error
+			explanations, err = explainer.ExplainLRPs(logger, []auctioneer.LRPStartRequest{
+				auctioneer.NewLRPStartRequest("process-guid", "domain", []int{1}, resource, constraint),
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(explanations).To(HaveLen(1))
+		})
+
+		It("penalizes cells already running the LRP", func() {
+			cells := explanations[0].Cells
+			Expect(cells[0].Instances).To(Equal(1))
+			Expect(*cells[0].Score).To(BeNumerically(">", placementexplainer.LocalityOffset))
+			Expect(*cells[1].Score).To(BeNumerically("<", placementexplainer.LocalityOffset))
+		})
+
+		It("prefers the zone running the fewest instances", func() {
+			cells := explanations[0].Cells
+			Expect(*cells[2].Score).To(BeNumerically(">", *cells[1].Score))
+			Expect(explanations[0].BestCellID).To(Equal("cell-c"))
+		})
+	})
+
+	Describe("ExplainCells", func() {
+		BeforeEach(func() {
+			evacuating := newState("cell-a", 0, "z1", 1024)
+			evacuating.Evacuating = true
+			cellSource.cellReps["cell-a"] = cellWithState(evacuating, nil)
+			cellSource.cellReps["cell-b"] = cellWithState(newState("cell-b", 1, "z2", 1024), nil)
+		})
+
+		It("explains which cells are skipped by every auction", func() {
+			cells, err := explainer.ExplainCells(logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cells).To(Equal([]auctioneer.CellExplanation{
+				{CellID: "cell-a", Zone: "z1", FilteredOut: []auctioneer.PlacementFailureReason{auctioneer.PlacementFailureCellEvacuating}},
+				{CellID: "cell-b", Zone: "z2"},
+			}))
+		})
+
+		Context("when the cells cannot be fetched", func() {
+			BeforeEach(func() {
+				cellSource.err = errors.New("bbs down")
+			})
+
+			It("returns the error", func() {
+				_, err := explainer.ExplainCells(logger)
+				Expect(err).To(MatchError("bbs down"))
+			})
+		})
+	})
+})
+
+var _ = Describe("InsufficientResources", func() {
+	It("returns a reason per exhausted resource", func() {
+		err := rep.InsufficientResourcesError{Problems: map[string]struct{}{
+			"containers": {},
+			"disk":       {},
+			"memory":     {},
+			"pids":       {},
+		}}
+
+		Expect(placementexplainer.InsufficientResources(err)).To(Equal([]auctioneer.PlacementFailureReason{
+			auctioneer.PlacementFailureInsufficientMemory,
+			auctioneer.PlacementFailureInsufficientDisk,
+			auctioneer.PlacementFailureInsufficientPids,
+			auctioneer.PlacementFailureInsufficientContainers,
+		}))
+	})
+
+	It("reports insufficient pids on their own", func() {
+		err := rep.InsufficientResourcesError{Problems: map[string]struct{}{"pids": {}}}
+		Expect(placementexplainer.InsufficientResources(err)).To(ConsistOf(auctioneer.PlacementFailureInsufficientPids))
+	})
+
+	It("returns nothing for other errors", func() {
+		Expect(placementexplainer.InsufficientResources(nil)).To(BeEmpty())
+		Expect(placementexplainer.InsufficientResources(errors.New("boom"))).To(BeEmpty())
+	})
+})
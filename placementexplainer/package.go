@@ -0,0 +1 @@
+package placementexplainer // import "code.cloudfoundry.org/auctioneer/placementexplainer"
@@ -0,0 +1,13 @@
+package placementexplainer_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestPlacementexplainer(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Placement Explainer Suite")
+}
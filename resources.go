@@ -9,10 +9,15 @@ import (
 
 type TaskStartRequest struct {
 	rep.Task
+
+	// Deadline, in Unix nanoseconds, is when the requester gives up on the
+	// task. A task that has not been auctioned by then is rejected instead.
+	// Zero means no deadline.
+	Deadline int64 `json:"deadline,omitempty"`
 }
 
 func NewTaskStartRequest(task rep.Task) TaskStartRequest {
-	return TaskStartRequest{task}
+	return TaskStartRequest{Task: task}
 }
 
 func NewTaskStartRequestFromModel(taskGuid, domain string, taskDef *models.TaskDefinition) TaskStartRequest {
@@ -21,7 +26,7 @@ func NewTaskStartRequestFromModel(taskGuid, domain string, taskDef *models.TaskD
 		volumeMounts = append(volumeMounts, volumeMount.Driver)
 	}
 	return TaskStartRequest{
-		rep.NewTask(
+		Task: rep.NewTask(
 			taskGuid,
 			domain,
 			rep.NewResource(taskDef.MemoryMb, taskDef.DiskMb, taskDef.MaxPids),
@@ -47,6 +52,12 @@ type LRPStartRequest struct {
 	ProcessGuid string `json:"process_guid"`
 	Domain      string `json:"domain"`
 	Indices     []int  `json:"indices"`
+
+	// Deadline, in Unix nanoseconds, is when the requester gives up on the
+	// instances. Instances that have not been auctioned by then are failed
+	// instead. Zero means no deadline.
+	Deadline int64 `json:"deadline,omitempty"`
+
 	rep.PlacementConstraint
 	rep.Resource
 }
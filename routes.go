@@ -3,11 +3,21 @@ package auctioneer
 import "github.com/tedsuo/rata"
 
 const (
-	CreateTaskAuctionsRoute = "CreateTaskAuctions"
-	CreateLRPAuctionsRoute  = "CreateLRPAuctions"
+	CreateTaskAuctionsRoute  = "CreateTaskAuctions"
+	CreateLRPAuctionsRoute   = "CreateLRPAuctions"
+	StatusRoute              = "Status"
+	CellsRoute               = "Cells"
+	ClearCellQuarantineRoute = "ClearCellQuarantine"
+	PreviewTaskAuctionsRoute = "PreviewTaskAuctions"
+	PreviewLRPAuctionsRoute  = "PreviewLRPAuctions"
 )
 
 var Routes = rata.Routes{
 	{Path: "/v1/tasks", Method: "POST", Name: CreateTaskAuctionsRoute},
 	{Path: "/v1/lrps", Method: "POST", Name: CreateLRPAuctionsRoute},
+	{Path: "/v1/status", Method: "GET", Name: StatusRoute},
+	{Path: "/v1/cells", Method: "GET", Name: CellsRoute},
+	{Path: "/v1/cells/:cell_id/quarantine", Method: "DELETE", Name: ClearCellQuarantineRoute},
+	{Path: "/v1/tasks/preview", Method: "POST", Name: PreviewTaskAuctionsRoute},
+	{Path: "/v1/lrps/preview", Method: "POST", Name: PreviewLRPAuctionsRoute},
 }
@@ -1,8 +1,12 @@
 package auctioneer
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"reflect"
+	"strings"
 	"time"
 
 	"code.cloudfoundry.org/clock"
@@ -10,6 +14,7 @@ import (
 	loggingclient "code.cloudfoundry.org/diego-logging-client"
 	"code.cloudfoundry.org/lager"
 	"code.cloudfoundry.org/locket"
+	"github.com/hashicorp/consul/api"
 	"github.com/tedsuo/ifrit"
 )
 
@@ -19,9 +24,48 @@ func LockSchemaPath() string {
 	return locket.LockSchemaPath(LockSchemaKey)
 }
 
+const (
+	FeatureTaskAuctions   = "task-auctions"
+	FeatureLRPAuctions    = "lrp-auctions"
+	FeatureRequestID      = "request-id"
+	FeatureTypedErrors    = "typed-errors"
+	FeatureStatus         = "status"
+	FeatureLeaderProxy    = "leader-proxy"
+	FeatureCellQuarantine = "cell-quarantine"
+	FeaturePreview        = "preview"
+	FeatureDomainQuotas   = "domain-quotas"
+)
+
+// SupportedFeatures lists the API features served by this version of the
+// auctioneer. They are advertised in the Presence so that clients can
+// negotiate before relying on them.
+var SupportedFeatures = []string{
+	FeatureTaskAuctions,
+	FeatureLRPAuctions,
+	FeatureRequestID,
+	FeatureTypedErrors,
+	FeatureStatus,
+	FeatureLeaderProxy,
+	FeatureCellQuarantine,
+	FeaturePreview,
+	FeatureDomainQuotas,
+}
+
+// Presence is advertised by the auctioneer holding the lock. Only the ID and
+// address are required; the remaining fields are empty when advertised by
+// older auctioneers.
 type Presence struct {
 	AuctioneerID      string `json:"auctioneer_id"`
 	AuctioneerAddress string `json:"auctioneer_address"`
+
+	// Scheme is "http" or "https", matching the scheme of AuctioneerAddress.
+	Scheme string `json:"scheme,omitempty"`
+	// ClientCertRequired is set when the server verifies client certificates.
+	ClientCertRequired bool   `json:"client_cert_required,omitempty"`
+	Version            string `json:"version,omitempty"`
+	// StartedAt is the Unix time in seconds at which the auctioneer started.
+	StartedAt int64    `json:"started_at,omitempty"`
+	Features  []string `json:"features,omitempty"`
 }
 
 func NewPresence(id, address string) Presence {
@@ -40,13 +84,83 @@ func (a Presence) Validate() error {
 		return errors.New("auctioneer_address cannot be blank")
 	}
 
+	switch a.Scheme {
+	case "", "http", "https":
+	default:
+		return fmt.Errorf("unsupported scheme %q", a.Scheme)
+	}
+
 	return nil
 }
 
+// RequiresTLS reports whether the advertised server only accepts TLS.
+func (a Presence) RequiresTLS() bool {
+	return a.Scheme == "https" || strings.HasPrefix(a.AuctioneerAddress, "https://")
+}
+
+// HasFeature reports whether the advertised auctioneer supports feature.
+func (a Presence) HasFeature(feature string) bool {
+	for _, f := range a.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	// WatchPollInterval is how often WatchAuctioneer polls the lock when the
+	// backend cannot notify it of changes, and how long it waits before
+	// retrying after a failed lookup.
+	WatchPollInterval = 1 * time.Second
+
+	consulWatchWaitTime = 30 * time.Second
+)
+
 type ServiceClient interface {
 	NewAuctioneerLockRunner(logger lager.Logger, presence Presence, retryInterval, lockTTL time.Duration, metronClient loggingclient.IngressClient) (ifrit.Runner, error)
 	CurrentAuctioneer() (Presence, error)
 	CurrentAuctioneerAddress() (string, error)
+
+	// WatchAuctioneer sends the current presence on the returned channel and
+	// then a new one every time the lock changes hands. An empty Presence is
+	// sent while no auctioneer holds the lock. Lookup failures are retried
+	// without sending anything. The channel is closed once ctx is done.
+	WatchAuctioneer(ctx context.Context) <-chan Presence
+
+	// FencingToken returns a token for the leadership term of the auctioneer
+	// advertising presence, which must hold the lock. Tokens of later terms
+	// are greater.
+	FencingToken(presence Presence) (uint64, error)
+}
+
+// presencePublisher sends presences to a watcher, dropping repeats of the
+// last presence sent.
+type presencePublisher struct {
+	updates chan Presence
+	last    Presence
+	sent    bool
+}
+
+func newPresencePublisher() *presencePublisher {
+	return &presencePublisher{updates: make(chan Presence)}
+}
+
+// publish returns false when ctx is done before the watcher received the
+// presence.
+func (p *presencePublisher) publish(ctx context.Context, presence Presence) bool {
+	if p.sent && reflect.DeepEqual(p.last, presence) {
+		return true
+	}
+
+	select {
+	case p.updates <- presence:
+		p.last = presence
+		p.sent = true
+		return true
+	case <-ctx.Done():
+		return false
+	}
 }
 
 type serviceClient struct {
@@ -97,6 +211,80 @@ func (c serviceClient) CurrentAuctioneerAddress() (string, error) {
 	return presence.AuctioneerAddress, err
 }
 
+// WatchAuctioneer uses Consul blocking queries on the lock key, so a new
+// presence is seen as soon as Consul records it. Consul queries cannot be
+// cancelled, so the channel may be closed up to 30 seconds after ctx is done.
+func (c serviceClient) WatchAuctioneer(ctx context.Context) <-chan Presence {
+	publisher := newPresencePublisher()
+
+	go func() {
+		defer close(publisher.updates)
+
+		var waitIndex uint64
+		for ctx.Err() == nil {
+			kvPair, meta, err := c.consulClient.KV().Get(LockSchemaPath(), &api.QueryOptions{
+				WaitIndex: waitIndex,
+				WaitTime:  consulWatchWaitTime,
+			})
+			if err != nil {
+				waitIndex = 0
+				select {
+				case <-ctx.Done():
+					return
+				case <-c.clock.After(WatchPollInterval):
+				}
+				continue
+			}
+
+			// the index can go backwards, e.g. when consul restores a snapshot
+			if meta.LastIndex < waitIndex {
+				waitIndex = 0
+			} else {
+				waitIndex = meta.LastIndex
+			}
+
+			if ctx.Err() != nil || !publisher.publish(ctx, presenceFromKVPair(kvPair)) {
+				return
+			}
+		}
+	}()
+
+	return publisher.updates
+}
+
+// FencingToken returns the lock index of the Consul lock key, which Consul
+// increments every time the lock is acquired.
+func (c serviceClient) FencingToken(presence Presence) (uint64, error) {
+	kvPair, _, err := c.consulClient.KV().Get(LockSchemaPath(), nil)
+	if err != nil {
+		return 0, err
+	}
+
+	holder := presenceFromKVPair(kvPair)
+	if holder.AuctioneerID != presence.AuctioneerID {
+		return 0, ErrLockNotHeld
+	}
+
+	return kvPair.LockIndex, nil
+}
+
+func presenceFromKVPair(kvPair *api.KVPair) Presence {
+	presence := Presence{}
+	if kvPair == nil || kvPair.Session == "" {
+		return presence
+	}
+
+	if err := json.Unmarshal(kvPair.Value, &presence); err != nil {
+		return Presence{}
+	}
+
+	if err := presence.Validate(); err != nil {
+		return Presence{}
+	}
+
+	return presence
+}
+
 func (c serviceClient) getAcquiredValue(key string) ([]byte, error) {
 	kvPair, _, err := c.consulClient.KV().Get(key, nil)
 	if err != nil {
@@ -1,6 +1,7 @@
 package auctioneer_test
 
 import (
+	"context"
 	"time"
 
 	"code.cloudfoundry.org/lager/lagertest"
@@ -51,6 +52,15 @@ var _ = Describe("ServiceClient", func() {
 				Expect(err).NotTo(HaveOccurred())
 				Expect(address).To(Equal(presence.AuctioneerAddress))
 			})
+
+			It("returns the lock index as the fencing token", func() {
+				token, err := serviceClient.FencingToken(presence)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(token).NotTo(BeZero())
+
+				_, err = serviceClient.FencingToken(auctioneer.NewPresence("other-id", "other.example.com"))
+				Expect(err).To(Equal(auctioneer.ErrLockNotHeld))
+			})
 		})
 
 		Context("when unable to get any auctioneer presences", func() {
@@ -60,4 +70,64 @@ var _ = Describe("ServiceClient", func() {
 			})
 		})
 	})
+
+	Describe("WatchAuctioneer", func() {
+		var (
+			cancel  context.CancelFunc
+			updates <-chan auctioneer.Presence
+		)
+
+		BeforeEach(func() {
+			var ctx context.Context
+			ctx, cancel = context.WithCancel(context.Background())
+			updates = serviceClient.WatchAuctioneer(ctx)
+		})
+
+		AfterEach(func() {
+			cancel()
+		})
+
+		It("sends the presence as auctioneers come and go", func() {
+			Eventually(updates).Should(Receive(Equal(auctioneer.Presence{})))
+
+			presence := auctioneer.NewPresence("auctioneer-id", "auctioneer.example.com")
+			auctioneerLock, err := serviceClient.NewAuctioneerLockRunner(logger, presence, 100*time.Millisecond, 10*time.Second, &mfakes.FakeIngressClient{})
+			Expect(err).NotTo(HaveOccurred())
+			heartbeater := ginkgomon.Invoke(auctioneerLock)
+
+			Eventually(updates).Should(Receive(Equal(presence)))
+
+			ginkgomon.Interrupt(heartbeater)
+			Eventually(updates).Should(Receive(Equal(auctioneer.Presence{})))
+		})
+	})
+
+	Describe("Presence", func() {
+		var presence auctioneer.Presence
+
+		BeforeEach(func() {
+			presence = auctioneer.NewPresence("auctioneer-id", "https://auctioneer.example.com:9016")
+		})
+
+		It("accepts a presence advertised by an older auctioneer", func() {
+			Expect(presence.Validate()).To(Succeed())
+			Expect(presence.RequiresTLS()).To(BeTrue())
+			Expect(presence.HasFeature(auctioneer.FeatureTaskAuctions)).To(BeFalse())
+		})
+
+		It("rejects an unsupported scheme", func() {
+			presence.Scheme = "gopher"
+			Expect(presence.Validate()).To(HaveOccurred())
+		})
+
+		It("reports the advertised features", func() {
+			presence.Scheme = "https"
+			presence.Features = auctioneer.SupportedFeatures
+
+			Expect(presence.Validate()).To(Succeed())
+			Expect(presence.HasFeature(auctioneer.FeatureLRPAuctions)).To(BeTrue())
+			Expect(presence.HasFeature(auctioneer.FeaturePreview)).To(BeTrue())
+			Expect(presence.HasFeature("time-travel")).To(BeFalse())
+		})
+	})
 })